@@ -86,6 +86,11 @@ type ClusterSPIFFEIDSpec struct {
 	// Set the entry hint
 	// +kubebuilder:validation:Optional
 	Hint string `json:"hint,omitempty"`
+
+	// Set which trust domain profile of the controller manager configuration
+	// the entries are registered with. Defaults to the main trust domain.
+	// +kubebuilder:validation:Optional
+	TrustDomainProfile string `json:"trustDomainProfile,omitempty"`
 }
 
 // ClusterSPIFFEIDStatus defines the observed state of ClusterSPIFFEID
@@ -93,6 +98,30 @@ type ClusterSPIFFEIDStatus struct {
 	// Stats produced by the last entry reconciliation run
 	// +kubebuilder:validation:Optional
 	Stats ClusterSPIFFEIDStats `json:"stats"`
+
+	// The ClusterSPIFFEIDPolicy rules violated by the entries rendered in
+	// the last entry reconciliation run. Entries that violate a policy are
+	// not set.
+	// +kubebuilder:validation:Optional
+	PolicyViolations []ClusterSPIFFEIDPolicyViolation `json:"policyViolations,omitempty"`
+
+	// The trust domain profile targeted by the ClusterSPIFFEID, if it is
+	// not configured. No entries are declared until it is.
+	// +kubebuilder:validation:Optional
+	UnconfiguredTrustDomainProfile string `json:"unconfiguredTrustDomainProfile,omitempty"`
+}
+
+// ClusterSPIFFEIDPolicyViolation is a ClusterSPIFFEIDPolicy rule violated by
+// the entries rendered for one or more pods.
+type ClusterSPIFFEIDPolicyViolation struct {
+	// The name of the ClusterSPIFFEIDPolicy.
+	Policy string `json:"policy"`
+
+	// Why the entries violate the policy.
+	Reason string `json:"reason"`
+
+	// How many pods the entries violating the policy were rendered for.
+	Pods int `json:"pods"`
 }
 
 // ClusterSPIFFEIDStats contain entry reconciliation statistics.
@@ -116,6 +145,11 @@ type ClusterSPIFFEIDStats struct {
 	// +kubebuilder:validation:Optional
 	PodEntryRenderFailures int `json:"podEntryRenderFailures"`
 
+	// How many entries rendered for selected pods were not set because they
+	// violate a ClusterSPIFFEIDPolicy that applies to the pod's namespace.
+	// +kubebuilder:validation:Optional
+	PodEntryPolicyViolations int `json:"podEntryPolicyViolations"`
+
 	// How many entries were masked by entries for other ClusterSPIFFEIDs.
 	// This happens when one or more ClusterSPIFFEIDs produce an entry for
 	// the same pod with the same set of workload selectors.
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"text/template"
@@ -27,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -44,6 +46,7 @@ var clusterspiffeidlog = logf.Log.WithName("clusterspiffeid-resource")
 func (r *ClusterSPIFFEID) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithValidator(&clusterSPIFFEIDValidator{reader: mgr.GetClient()}).
 		Complete()
 }
 
@@ -52,31 +55,51 @@ func (r *ClusterSPIFFEID) SetupWebhookWithManager(mgr ctrl.Manager) error {
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 //+kubebuilder:webhook:path=/validate-spire-spiffe-io-v1alpha1-clusterspiffeid,mutating=false,failurePolicy=fail,sideEffects=None,groups=spire.spiffe.io,resources=clusterspiffeids,verbs=create;update,versions=v1alpha1,name=vclusterspiffeid.kb.io,admissionReviewVersions=v1
 
-var _ webhook.Validator = &ClusterSPIFFEID{}
+// clusterSPIFFEIDValidator validates ClusterSPIFFEIDs. It reads the
+// ClusterSPIFFEIDPolicies and namespaces the ClusterSPIFFEIDs are checked
+// against with the reader.
+type clusterSPIFFEIDValidator struct {
+	reader client.Reader
+}
+
+var _ webhook.CustomValidator = &clusterSPIFFEIDValidator{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *ClusterSPIFFEID) ValidateCreate() (admission.Warnings, error) {
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *clusterSPIFFEIDValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*ClusterSPIFFEID)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterSPIFFEID but got %T", obj)
+	}
 	clusterspiffeidlog.Info("validate create", "name", r.Name)
 
-	return r.validate()
+	return r.validate(ctx, v.reader)
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *ClusterSPIFFEID) ValidateUpdate(runtime.Object) (admission.Warnings, error) {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *clusterSPIFFEIDValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*ClusterSPIFFEID)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterSPIFFEID but got %T", newObj)
+	}
 	clusterspiffeidlog.Info("validate update", "name", r.Name)
 
-	return r.validate()
+	return r.validate(ctx, v.reader)
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *ClusterSPIFFEID) ValidateDelete() (admission.Warnings, error) {
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *clusterSPIFFEIDValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
 	// Deletes are not validated.
 	return nil, nil
 }
 
-func (r *ClusterSPIFFEID) validate() (admission.Warnings, error) {
-	_, err := ParseClusterSPIFFEIDSpec(&r.Spec)
-	return nil, err
+// validate parses the spec and checks it against the ClusterSPIFFEIDPolicies
+// that apply to the namespaces it selects.
+func (r *ClusterSPIFFEID) validate(ctx context.Context, reader client.Reader) (admission.Warnings, error) {
+	spec, err := ParseClusterSPIFFEIDSpec(&r.Spec)
+	if err != nil {
+		return nil, err
+	}
+	return nil, checkClusterSPIFFEIDPolicies(ctx, reader, r, spec)
 }
 
 // +kubebuilder:object:generate=false
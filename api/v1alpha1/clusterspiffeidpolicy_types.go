@@ -0,0 +1,83 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterSPIFFEIDPolicySpec constrains the entries ClusterSPIFFEIDs may
+// declare for the pods in the selected namespaces.
+type ClusterSPIFFEIDPolicySpec struct {
+	// NamespaceSelector selects the namespaces whose pods the policy
+	// applies to. The policy applies to every namespace if unset.
+	// +kubebuilder:validation:Optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// SPIFFEIDPathPatterns are regular expressions, one of which must match
+	// the whole path of each SPIFFE ID. Any path is allowed if unset.
+	// +kubebuilder:validation:Optional
+	SPIFFEIDPathPatterns []string `json:"spiffeIDPathPatterns,omitempty"`
+
+	// AllowAdmin allows entries that can access the SPIRE administrative
+	// APIs.
+	// +kubebuilder:validation:Optional
+	AllowAdmin bool `json:"allowAdmin,omitempty"`
+
+	// AllowDownstream allows entries for downstream SPIRE servers.
+	// +kubebuilder:validation:Optional
+	AllowDownstream bool `json:"allowDownstream,omitempty"`
+
+	// MinTTL is the shortest X509 and JWT SVID TTL allowed. When either
+	// MinTTL or MaxTTL is set, the TTLs must be set explicitly, since the
+	// SPIRE Server default is not known.
+	// +kubebuilder:validation:Optional
+	MinTTL metav1.Duration `json:"minTTL,omitempty"`
+
+	// MaxTTL is the longest X509 and JWT SVID TTL allowed.
+	// +kubebuilder:validation:Optional
+	MaxTTL metav1.Duration `json:"maxTTL,omitempty"`
+
+	// AllowedFederatesWith are the trust domains entries may federate with.
+	// Entries may not federate with any trust domain if unset.
+	// +kubebuilder:validation:Optional
+	AllowedFederatesWith []string `json:"allowedFederatesWith,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterSPIFFEIDPolicy is the Schema for the clusterspiffeidpolicies API
+type ClusterSPIFFEIDPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterSPIFFEIDPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterSPIFFEIDPolicyList contains a list of ClusterSPIFFEIDPolicy
+type ClusterSPIFFEIDPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSPIFFEIDPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterSPIFFEIDPolicy{}, &ClusterSPIFFEIDPolicyList{})
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var clusterspiffeidpolicylog = logf.Log.WithName("clusterspiffeidpolicy-resource")
+
+func (r *ClusterSPIFFEIDPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-spire-spiffe-io-v1alpha1-clusterspiffeidpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=spire.spiffe.io,resources=clusterspiffeidpolicies,verbs=create;update,versions=v1alpha1,name=vclusterspiffeidpolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterSPIFFEIDPolicy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterSPIFFEIDPolicy) ValidateCreate() (admission.Warnings, error) {
+	clusterspiffeidpolicylog.Info("validate create", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterSPIFFEIDPolicy) ValidateUpdate(runtime.Object) (admission.Warnings, error) {
+	clusterspiffeidpolicylog.Info("validate update", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterSPIFFEIDPolicy) ValidateDelete() (admission.Warnings, error) {
+	// Deletes are not validated.
+	return nil, nil
+}
+
+func (r *ClusterSPIFFEIDPolicy) validate() (admission.Warnings, error) {
+	_, err := ParseClusterSPIFFEIDPolicySpec(&r.Spec)
+	return nil, err
+}
+
+// +kubebuilder:object:generate=false
+// ParsedClusterSPIFFEIDPolicySpec is a parsed and validated ClusterSPIFFEIDPolicySpec
+type ParsedClusterSPIFFEIDPolicySpec struct {
+	NamespaceSelector    labels.Selector
+	SPIFFEIDPathPatterns []*regexp.Regexp
+	AllowAdmin           bool
+	AllowDownstream      bool
+	MinTTL               time.Duration
+	MaxTTL               time.Duration
+	AllowedFederatesWith map[spiffeid.TrustDomain]struct{}
+}
+
+// ParseClusterSPIFFEIDPolicySpec parses and validates the fields in the ClusterSPIFFEIDPolicySpec
+func ParseClusterSPIFFEIDPolicySpec(spec *ClusterSPIFFEIDPolicySpec) (*ParsedClusterSPIFFEIDPolicySpec, error) {
+	var namespaceSelector labels.Selector
+	if spec.NamespaceSelector != nil {
+		var err error
+		namespaceSelector, err = metav1.LabelSelectorAsSelector(spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespaceSelector value: %w", err)
+		}
+	}
+
+	spiffeIDPathPatterns := make([]*regexp.Regexp, 0, len(spec.SPIFFEIDPathPatterns))
+	for _, value := range spec.SPIFFEIDPathPatterns {
+		// The pattern must match the whole path.
+		pattern, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid spiffeIDPathPatterns value: %w", err)
+		}
+		spiffeIDPathPatterns = append(spiffeIDPathPatterns, pattern)
+	}
+
+	switch {
+	case spec.MinTTL.Duration < 0:
+		return nil, errors.New("invalid minTTL value: must not be negative")
+	case spec.MaxTTL.Duration < 0:
+		return nil, errors.New("invalid maxTTL value: must not be negative")
+	case spec.MaxTTL.Duration > 0 && spec.MinTTL.Duration > spec.MaxTTL.Duration:
+		return nil, errors.New("invalid minTTL value: must not be greater than maxTTL")
+	}
+
+	allowedFederatesWith := make(map[spiffeid.TrustDomain]struct{}, len(spec.AllowedFederatesWith))
+	for _, value := range spec.AllowedFederatesWith {
+		td, err := spiffeid.TrustDomainFromString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowedFederatesWith value: %w", err)
+		}
+		allowedFederatesWith[td] = struct{}{}
+	}
+
+	return &ParsedClusterSPIFFEIDPolicySpec{
+		NamespaceSelector:    namespaceSelector,
+		SPIFFEIDPathPatterns: spiffeIDPathPatterns,
+		AllowAdmin:           spec.AllowAdmin,
+		AllowDownstream:      spec.AllowDownstream,
+		MinTTL:               spec.MinTTL.Duration,
+		MaxTTL:               spec.MaxTTL.Duration,
+		AllowedFederatesWith: allowedFederatesWith,
+	}, nil
+}
+
+// AppliesToNamespace returns true if the policy applies to the pods in the
+// namespace.
+func (p *ParsedClusterSPIFFEIDPolicySpec) AppliesToNamespace(namespace *corev1.Namespace) bool {
+	return p.NamespaceSelector == nil || p.NamespaceSelector.Matches(labels.Set(namespace.Labels))
+}
+
+// CheckSpec returns why the entries rendered from the ClusterSPIFFEID spec
+// violate the policy, whichever pod they are rendered for.
+func (p *ParsedClusterSPIFFEIDPolicySpec) CheckSpec(spec *ParsedClusterSPIFFEIDSpec) []string {
+	var reasons []string
+	if spec.Admin && !p.AllowAdmin {
+		reasons = append(reasons, "admin is not allowed")
+	}
+	if spec.Downstream && !p.AllowDownstream {
+		reasons = append(reasons, "downstream is not allowed")
+	}
+	reasons = append(reasons, p.checkTTL("ttl", spec.TTL)...)
+	reasons = append(reasons, p.checkTTL("jwtTtl", spec.JWTTTL)...)
+	for _, td := range spec.FederatesWith {
+		if _, ok := p.AllowedFederatesWith[td]; !ok {
+			reasons = append(reasons, fmt.Sprintf("federating with %q is not allowed", td.Name()))
+		}
+	}
+	return reasons
+}
+
+// CheckSPIFFEIDPath returns why the SPIFFE ID path violates the policy, if
+// it does.
+func (p *ParsedClusterSPIFFEIDPolicySpec) CheckSPIFFEIDPath(path string) []string {
+	if len(p.SPIFFEIDPathPatterns) == 0 {
+		return nil
+	}
+	for _, pattern := range p.SPIFFEIDPathPatterns {
+		if pattern.MatchString(path) {
+			return nil
+		}
+	}
+	return []string{"SPIFFE ID path does not match any allowed pattern"}
+}
+
+func (p *ParsedClusterSPIFFEIDPolicySpec) checkTTL(field string, ttl time.Duration) []string {
+	switch {
+	case p.MinTTL == 0 && p.MaxTTL == 0:
+		return nil
+	case ttl == 0:
+		return []string{fmt.Sprintf("%s must be set", field)}
+	case ttl < p.MinTTL:
+		return []string{fmt.Sprintf("%s is shorter than the minimum of %s", field, p.MinTTL)}
+	case p.MaxTTL > 0 && ttl > p.MaxTTL:
+		return []string{fmt.Sprintf("%s is longer than the maximum of %s", field, p.MaxTTL)}
+	default:
+		return nil
+	}
+}
+
+// checkClusterSPIFFEIDPolicies checks the ClusterSPIFFEID against the
+// ClusterSPIFFEIDPolicies that apply to any of the namespaces it currently
+// selects. The SPIFFE ID path can only be checked if the SPIFFE ID template
+// does not depend on the pod; otherwise it is checked when the entries are
+// rendered.
+func checkClusterSPIFFEIDPolicies(ctx context.Context, reader client.Reader, r *ClusterSPIFFEID, spec *ParsedClusterSPIFFEIDSpec) error {
+	var policies ClusterSPIFFEIDPolicyList
+	if err := reader.List(ctx, &policies); err != nil {
+		return fmt.Errorf("unable to list ClusterSPIFFEIDPolicies: %w", err)
+	}
+	if len(policies.Items) == 0 {
+		return nil
+	}
+
+	var opts []client.ListOption
+	if spec.NamespaceSelector != nil {
+		opts = append(opts, client.MatchingLabelsSelector{Selector: spec.NamespaceSelector})
+	}
+	var namespaces corev1.NamespaceList
+	if err := reader.List(ctx, &namespaces, opts...); err != nil {
+		return fmt.Errorf("unable to list namespaces: %w", err)
+	}
+
+	var path string
+	if !strings.Contains(r.Spec.SPIFFEIDTemplate, "{{") {
+		if id, err := spiffeid.FromString(r.Spec.SPIFFEIDTemplate); err == nil {
+			path = id.Path()
+		}
+	}
+
+	sort.Slice(policies.Items, func(i, j int) bool {
+		return policies.Items[i].Name < policies.Items[j].Name
+	})
+	var errs []error
+	for _, policy := range policies.Items {
+		policySpec, err := ParseClusterSPIFFEIDPolicySpec(&policy.Spec)
+		if err != nil {
+			// Invalid policies apply to every namespace, so that a broken
+			// policy does not silently allow anything.
+			errs = append(errs, fmt.Errorf("ClusterSPIFFEIDPolicy %q is invalid: %w", policy.Name, err))
+			continue
+		}
+		if !policySpec.appliesToAnyNamespace(namespaces.Items) {
+			continue
+		}
+		reasons := policySpec.CheckSpec(spec)
+		if path != "" {
+			reasons = append(reasons, policySpec.CheckSPIFFEIDPath(path)...)
+		}
+		if len(reasons) > 0 {
+			errs = append(errs, fmt.Errorf("violates ClusterSPIFFEIDPolicy %q: %s", policy.Name, strings.Join(reasons, "; ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *ParsedClusterSPIFFEIDPolicySpec) appliesToAnyNamespace(namespaces []corev1.Namespace) bool {
+	for i := range namespaces {
+		if p.AppliesToNamespace(&namespaces[i]) {
+			return true
+		}
+	}
+	return false
+}
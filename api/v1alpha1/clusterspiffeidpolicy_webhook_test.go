@@ -0,0 +1,143 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseClusterSPIFFEIDPolicySpec(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		spec   ClusterSPIFFEIDPolicySpec
+		expErr string
+	}{
+		{
+			name: "valid",
+			spec: ClusterSPIFFEIDPolicySpec{
+				SPIFFEIDPathPatterns: []string{"/ns/.+"},
+				MinTTL:               metav1.Duration{Duration: time.Minute},
+				MaxTTL:               metav1.Duration{Duration: time.Hour},
+				AllowedFederatesWith: []string{"other.org"},
+			},
+		},
+		{
+			name:   "invalid pattern",
+			spec:   ClusterSPIFFEIDPolicySpec{SPIFFEIDPathPatterns: []string{"("}},
+			expErr: "invalid spiffeIDPathPatterns value: error parsing regexp: missing closing ): `^(?:()$`",
+		},
+		{
+			name:   "negative TTL",
+			spec:   ClusterSPIFFEIDPolicySpec{MinTTL: metav1.Duration{Duration: -time.Minute}},
+			expErr: "invalid minTTL value: must not be negative",
+		},
+		{
+			name: "min TTL greater than max TTL",
+			spec: ClusterSPIFFEIDPolicySpec{
+				MinTTL: metav1.Duration{Duration: time.Hour},
+				MaxTTL: metav1.Duration{Duration: time.Minute},
+			},
+			expErr: "invalid minTTL value: must not be greater than maxTTL",
+		},
+		{
+			name:   "invalid trust domain",
+			spec:   ClusterSPIFFEIDPolicySpec{AllowedFederatesWith: []string{"BAD"}},
+			expErr: "invalid allowedFederatesWith value: trust domain characters are limited to lowercase letters, numbers, dots, dashes, and underscores",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseClusterSPIFFEIDPolicySpec(&tt.spec)
+			if tt.expErr != "" {
+				assert.EqualError(t, err, tt.expErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestClusterSPIFFEIDPolicyCheck(t *testing.T) {
+	policy, err := ParseClusterSPIFFEIDPolicySpec(&ClusterSPIFFEIDPolicySpec{
+		SPIFFEIDPathPatterns: []string{"/ns/[^/]+", "/static"},
+		MinTTL:               metav1.Duration{Duration: time.Minute},
+		MaxTTL:               metav1.Duration{Duration: time.Hour},
+		AllowedFederatesWith: []string{"allowed.org"},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, policy.CheckSpec(&ParsedClusterSPIFFEIDSpec{
+		TTL:           time.Minute,
+		JWTTTL:        time.Hour,
+		FederatesWith: []spiffeid.TrustDomain{spiffeid.RequireTrustDomainFromString("allowed.org")},
+	}))
+	assert.Equal(t, []string{
+		"admin is not allowed",
+		"downstream is not allowed",
+		"ttl is shorter than the minimum of 1m0s",
+		"jwtTtl must be set",
+		`federating with "other.org" is not allowed`,
+	}, policy.CheckSpec(&ParsedClusterSPIFFEIDSpec{
+		Admin:         true,
+		Downstream:    true,
+		TTL:           time.Second,
+		FederatesWith: []spiffeid.TrustDomain{spiffeid.RequireTrustDomainFromString("other.org")},
+	}))
+	assert.Equal(t, []string{"jwtTtl is longer than the maximum of 1h0m0s"}, policy.CheckSpec(&ParsedClusterSPIFFEIDSpec{
+		TTL:    time.Hour,
+		JWTTTL: 2 * time.Hour,
+	}))
+
+	// Patterns must match the whole path.
+	assert.Empty(t, policy.CheckSPIFFEIDPath("/ns/default"))
+	assert.Empty(t, policy.CheckSPIFFEIDPath("/static"))
+	assert.Equal(t, []string{"SPIFFE ID path does not match any allowed pattern"}, policy.CheckSPIFFEIDPath("/ns/default/sa/default"))
+	assert.Equal(t, []string{"SPIFFE ID path does not match any allowed pattern"}, policy.CheckSPIFFEIDPath("/static/other"))
+}
+
+func TestValidateClusterSPIFFEIDAgainstPolicies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, AddToScheme(scheme))
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments", Labels: map[string]string{"team": "payments"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other", Labels: map[string]string{"team": "other"}}},
+		&ClusterSPIFFEIDPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "payments"},
+			Spec: ClusterSPIFFEIDPolicySpec{
+				NamespaceSelector:    &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+				SPIFFEIDPathPatterns: []string{"/payments/.+"},
+			},
+		},
+	).Build()
+
+	validate := func(spec ClusterSPIFFEIDSpec) error {
+		_, err := (&ClusterSPIFFEID{Spec: spec}).validate(context.Background(), reader)
+		return err
+	}
+
+	// The policy does not apply to the namespaces that are not selected.
+	assert.NoError(t, validate(ClusterSPIFFEIDSpec{
+		SPIFFEIDTemplate:  "spiffe://example.org/admin",
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "other"}},
+		Admin:             true,
+	}))
+
+	assert.EqualError(t, validate(ClusterSPIFFEIDSpec{
+		SPIFFEIDTemplate: "spiffe://example.org/admin",
+		Admin:            true,
+	}), `violates ClusterSPIFFEIDPolicy "payments": admin is not allowed; SPIFFE ID path does not match any allowed pattern`)
+
+	// Templated SPIFFE IDs are checked when the entries are rendered.
+	assert.NoError(t, validate(ClusterSPIFFEIDSpec{
+		SPIFFEIDTemplate: "spiffe://example.org/ns/{{ .PodMeta.Namespace }}",
+	}))
+}
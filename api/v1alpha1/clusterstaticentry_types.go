@@ -39,6 +39,10 @@ type ClusterStaticEntrySpec struct {
 	// Set which Controller Class will act on this object
 	// +kubebuilder:validation:Optional
 	ClassName string `json:"className,omitempty"`
+	// Set which trust domain profile of the controller manager configuration
+	// the entry is registered with. Defaults to the main trust domain.
+	// +kubebuilder:validation:Optional
+	TrustDomainProfile string `json:"trustDomainProfile,omitempty"`
 }
 
 // ClusterStaticEntryStatus defines the observed state of ClusterStaticEntry
@@ -51,6 +55,11 @@ type ClusterStaticEntryStatus struct {
 
 	// If the static entry was successfully created/updated.
 	Set bool `json:"set"`
+
+	// The trust domain profile targeted by the static entry, if it is not
+	// configured. The entry is not declared until it is.
+	// +kubebuilder:validation:Optional
+	UnconfiguredTrustDomainProfile string `json:"unconfiguredTrustDomainProfile,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -23,6 +23,12 @@ func LoadOptionsFromFile(path string, scheme *runtime.Scheme, options *ctrl.Opti
 	return addOptionsFromConfigSpec(options, config.ControllerManagerConfigurationSpec)
 }
 
+// LoadOptionsFromConfig sets the options from a config that was not loaded
+// from a file, e.g. one read from a ControllerManagerConfig object.
+func LoadOptionsFromConfig(options *ctrl.Options, config *ControllerManagerConfig) error {
+	return addOptionsFromConfigSpec(options, config.ControllerManagerConfigurationSpec)
+}
+
 func loadFile(path string, scheme *runtime.Scheme, config *ControllerManagerConfig, expandEnv bool) error {
 	content, err := os.ReadFile(path)
 	if err != nil {
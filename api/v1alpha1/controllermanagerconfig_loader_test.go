@@ -126,6 +126,66 @@ func TestLoadOptionsFromFileReplaceDefaultValues(t *testing.T) {
 	require.Equal(t, "127.0.0.1:8082", options.Metrics.BindAddress)
 }
 
+func TestLoadOptionsFromFileSPIREServerClient(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(spirev1alpha1.AddToScheme(scheme))
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+reconcileTimeout: 5m
+spireServerClient:
+  keepaliveTime: 10m
+  maxListAttempts: 5
+`), 0600))
+
+	options := ctrl.Options{Scheme: scheme}
+	ctrlConfig := spirev1alpha1.ControllerManagerConfig{
+		ReconcileTimeout: metav1.Duration{Duration: 10 * time.Minute},
+		SPIREServerClient: spirev1alpha1.SPIREServerClientConfig{
+			RPCTimeout:      metav1.Duration{Duration: 30 * time.Second},
+			MaxListAttempts: 3,
+		},
+	}
+	require.NoError(t, spirev1alpha1.LoadOptionsFromFile(path, scheme, &options, &ctrlConfig, false))
+
+	// Unset fields keep their defaults.
+	require.Equal(t, metav1.Duration{Duration: 5 * time.Minute}, ctrlConfig.ReconcileTimeout)
+	require.Equal(t, spirev1alpha1.SPIREServerClientConfig{
+		RPCTimeout:      metav1.Duration{Duration: 30 * time.Second},
+		KeepaliveTime:   metav1.Duration{Duration: 10 * time.Minute},
+		MaxListAttempts: 5,
+	}, ctrlConfig.SPIREServerClient)
+}
+
+func TestLoadOptionsFromFileTracing(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(spirev1alpha1.AddToScheme(scheme))
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+tracing:
+  endpoint: otel-collector:4317
+  insecure: true
+`), 0600))
+
+	options := ctrl.Options{Scheme: scheme}
+	ctrlConfig := spirev1alpha1.ControllerManagerConfig{
+		Tracing: spirev1alpha1.TracingConfig{SamplingPercent: 100},
+	}
+	require.NoError(t, spirev1alpha1.LoadOptionsFromFile(path, scheme, &options, &ctrlConfig, false))
+
+	// Unset fields keep their defaults.
+	require.Equal(t, spirev1alpha1.TracingConfig{
+		Endpoint:        "otel-collector:4317",
+		Insecure:        true,
+		SamplingPercent: 100,
+	}, ctrlConfig.Tracing)
+}
+
 func TestLoadOptionsFromFileInvalidPath(t *testing.T) {
 	scheme := runtime.NewScheme()
 	options := ctrl.Options{Scheme: scheme}
@@ -24,11 +24,16 @@ import (
 )
 
 //+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
 
 // ControllerManagerConfig is the Schema for the controller manager configuration
 type ControllerManagerConfig struct {
 	metav1.TypeMeta `json:",inline"`
 
+	// ObjectMeta is only used when the configuration is read from a
+	// ControllerManagerConfig object in the cluster.
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
 	// ControllerManagerConfigurationSpec returns the contfigurations for controllers
 	ControllerManagerConfigurationSpec `json:",inline"`
 
@@ -36,29 +41,115 @@ type ControllerManagerConfig struct {
 	ClusterName string `json:"clusterName"`
 
 	// ClusterDomain is the cluster domain, ie cluster.local
+	// +optional
 	ClusterDomain string `json:"clusterDomain"`
 
 	// TrustDomain is the name of the SPIFFE trust domain
 	TrustDomain string `json:"trustDomain"`
 
 	// IgnoreNamespaces are the namespaces to ignore
+	// +optional
 	IgnoreNamespaces []string `json:"ignoreNamespaces"`
 
 	// ValidatingWebhookConfigurationName selects the webhook configuration to manage.
 	// Defaults to spire-controller-manager-webhook.
+	// +optional
 	ValidatingWebhookConfigurationName string `json:"validatingWebhookConfigurationName"`
 
 	// GCInterval is how often SPIRE state is reconciled when the controller
 	// is otherwise idle. This impacts how quickly SPIRE state will converge
 	// after CRDs are removed or SPIRE state is mutated out from underneath
 	// the controller.
+	// +optional
 	GCInterval time.Duration `json:"gcInterval"`
 
 	// SPIREServerSocketPath is the path to the SPIRE Server API socket
+	// +optional
 	SPIREServerSocketPath string `json:"spireServerSocketPath"`
 
 	// LogLevel is the log level for the controller manager
+	// +optional
 	LogLevel string `json:"logLevel"`
+
+	// EntryRenderWorkers is the number of workers used to render entries
+	// for ClusterSPIFFEIDs. Defaults to the number of CPUs available.
+	// +optional
+	EntryRenderWorkers int `json:"entryRenderWorkers"`
+
+	// ListEntriesByParentID lists SPIRE entries by the parent IDs of the
+	// entries the controller manages instead of listing every entry on the
+	// server. All entries are still listed every GCInterval.
+	// +optional
+	ListEntriesByParentID bool `json:"listEntriesByParentID"`
+
+	// CheckEntryRevisions skips updates to entries whose revision on the
+	// SPIRE Server no longer matches the listed one, re-reading them
+	// instead. The SPIRE API has no conditional updates, so this costs a
+	// list per batch of updates and still overwrites a change made between
+	// that list and the update.
+	// +optional
+	CheckEntryRevisions bool `json:"checkEntryRevisions"`
+
+	// ReconcileTimeout bounds each reconciliation of SPIRE state so that an
+	// unresponsive SPIRE Server cannot stall reconciliation forever.
+	// Defaults to 1m. Reconciliation is unbounded if set to 0.
+	// +optional
+	ReconcileTimeout metav1.Duration `json:"reconcileTimeout"`
+
+	// SPIREServerClient configures the client used to talk to the SPIRE
+	// Server API.
+	// +optional
+	SPIREServerClient SPIREServerClientConfig `json:"spireServerClient"`
+
+	// Tracing configures the export of reconciliation trace spans.
+	// +optional
+	Tracing TracingConfig `json:"tracing"`
+
+	// DebugEndpoint serves the state computed by the last entry reconcile on
+	// the metrics server at /debug/entries, and triggers a reconcile when
+	// the endpoint is POSTed to. Trust domain profiles are served by name
+	// with the profile query parameter.
+	// +optional
+	DebugEndpoint bool `json:"debugEndpoint"`
+
+	// Audit configures where an event is recorded for every change made to
+	// the entries and federation relationships on SPIRE Server.
+	// +optional
+	Audit AuditConfig `json:"audit"`
+
+	// Status is reported by the controller managers configured from this
+	// object. It is ignored in config files.
+	Status ControllerManagerConfigStatus `json:"status,omitempty"`
+}
+
+// ControllerManagerConfigStatus reports which generation of a
+// ControllerManagerConfig object is in effect.
+type ControllerManagerConfigStatus struct {
+	// ObservedGeneration is the most recent generation seen by the
+	// controller manager.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ActiveGeneration is the generation the controller manager is running
+	// with. It lags behind the observed generation when a change could not
+	// be applied.
+	// +optional
+	ActiveGeneration int64 `json:"activeGeneration,omitempty"`
+
+	// Error is why the observed generation could not be applied, e.g. it
+	// changes a field that requires a restart. It is empty when the observed
+	// generation is active.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ControllerManagerConfigList contains a list of ControllerManagerConfig
+type ControllerManagerConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ControllerManagerConfig `json:"items"`
 }
 
 // ControllerManagerConfigurationSpec defines the desired state of GenericControllerManagerConfiguration.
@@ -142,6 +233,30 @@ type ControllerManagerConfigurationSpec struct {
 	// Generally useful when switching from nonprefixed to prefixed, or between two different prefixes.
 	// +optiional
 	EntryIDPrefixCleanup *string `json:"entryIDPrefixCleanup,omitempty"`
+
+	// EntryRetirementGracePeriod is how long an entry that is no longer declared is kept before it is deleted. Entries are
+	// deleted as soon as they are no longer declared if unset.
+	// +optional
+	EntryRetirementGracePeriod metav1.Duration `json:"entryRetirementGracePeriod,omitempty"`
+
+	// TrustDomainProfiles are additional trust domains, each served by its own SPIRE Server, that ClusterSPIFFEIDs and
+	// ClusterStaticEntries can target by profile name. Objects that do not name a profile target TrustDomain.
+	// +optional
+	TrustDomainProfiles []TrustDomainProfile `json:"trustDomainProfiles,omitempty"`
+}
+
+// TrustDomainProfile is a trust domain, and the SPIRE Server serving it,
+// that ClusterSPIFFEIDs and ClusterStaticEntries can target by name.
+type TrustDomainProfile struct {
+	// Name is the name objects target the profile with.
+	Name string `json:"name"`
+
+	// TrustDomain is the name of the SPIFFE trust domain.
+	TrustDomain string `json:"trustDomain"`
+
+	// SPIREServerSocketPath is the path to the API socket of the SPIRE
+	// Server for the trust domain.
+	SPIREServerSocketPath string `json:"spireServerSocketPath"`
 }
 
 // ReconcileConfig configuration used to enable/disable syncing various types
@@ -159,6 +274,92 @@ type ReconcileConfig struct {
 	ClusterStaticEntries bool `json:"clusterStaticEntries,omitempty"`
 }
 
+// SPIREServerClientConfig configures the client used to talk to the SPIRE
+// Server API.
+type SPIREServerClientConfig struct {
+	// RPCTimeout bounds each call to the SPIRE Server API. Defaults to 30s.
+	// Calls are unbounded if set to 0.
+	// +optional
+	RPCTimeout metav1.Duration `json:"rpcTimeout,omitempty"`
+
+	// KeepaliveTime is how long the connection may be idle before the SPIRE
+	// Server is pinged. Keepalive is disabled if unset. Note that SPIRE
+	// Server closes connections that ping more often than every 5m.
+	// +optional
+	KeepaliveTime metav1.Duration `json:"keepaliveTime,omitempty"`
+
+	// KeepaliveTimeout is how long to wait for a ping to be acknowledged
+	// before the connection is closed. Defaults to 20s.
+	// +optional
+	KeepaliveTimeout metav1.Duration `json:"keepaliveTimeout,omitempty"`
+
+	// MaxListAttempts is the maximum number of attempts made for idempotent
+	// list and get calls when the SPIRE Server is unavailable. Must be
+	// between 1 and 5. Defaults to 3.
+	// +optional
+	MaxListAttempts int `json:"maxListAttempts,omitempty"`
+}
+
+// TracingConfig configures the export of reconciliation trace spans to an
+// OpenTelemetry collector.
+type TracingConfig struct {
+	// Endpoint is the host:port of the OTLP gRPC collector. Tracing is
+	// disabled if unset.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Insecure disables TLS on the connection to the collector.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// SamplingPercent is the percentage of reconciliations that are traced.
+	// Must be between 0 and 100. Defaults to 100.
+	// +optional
+	SamplingPercent int `json:"samplingPercent,omitempty"`
+}
+
+// AuditConfig configures the outputs audit events are written to. Auditing
+// is disabled if no output is configured.
+type AuditConfig struct {
+	// Stdout writes each event as a line of JSON to stdout.
+	// +optional
+	Stdout bool `json:"stdout,omitempty"`
+
+	// File writes each event as a line of JSON to a rotated file.
+	// +optional
+	File *AuditFileConfig `json:"file,omitempty"`
+
+	// Webhook posts the events to a URL.
+	// +optional
+	Webhook *AuditWebhookConfig `json:"webhook,omitempty"`
+}
+
+// AuditFileConfig configures the file audit events are written to.
+type AuditFileConfig struct {
+	// Path is the path of the file.
+	Path string `json:"path"`
+
+	// MaxSizeMB is the size in megabytes the file may grow to before it is
+	// rotated. Defaults to 100.
+	// +optional
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+
+	// MaxBackups is how many rotated files are kept. Defaults to 5.
+	// +optional
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// AuditWebhookConfig configures the URL audit events are posted to.
+type AuditWebhookConfig struct {
+	// URL is the http or https URL the events are posted to as a JSON
+	// array.
+	URL string `json:"url"`
+
+	// Timeout is how long a post may take. Defaults to 5s.
+	// +optional
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
 // NamespaceConfig configuration used to filter cached namespaces
 type NamespaceConfig struct {
 	// LabelSelectors map of Labels selectors
@@ -244,5 +445,5 @@ type ControllerWebhook struct {
 }
 
 func init() {
-	SchemeBuilder.Register(&ControllerManagerConfig{})
+	SchemeBuilder.Register(&ControllerManagerConfig{}, &ControllerManagerConfigList{})
 }
@@ -120,6 +120,9 @@ var _ = BeforeSuite(func() {
 	err = (&ClusterSPIFFEID{}).SetupWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = (&ClusterSPIFFEIDPolicy{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:webhook
 
 	go func() {
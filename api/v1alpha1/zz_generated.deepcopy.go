@@ -27,6 +27,62 @@ import (
 	timex "time"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditConfig) DeepCopyInto(out *AuditConfig) {
+	*out = *in
+	if in.File != nil {
+		in, out := &in.File, &out.File
+		*out = new(AuditFileConfig)
+		**out = **in
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(AuditWebhookConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditConfig.
+func (in *AuditConfig) DeepCopy() *AuditConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditFileConfig) DeepCopyInto(out *AuditFileConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditFileConfig.
+func (in *AuditFileConfig) DeepCopy() *AuditFileConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditFileConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditWebhookConfig) DeepCopyInto(out *AuditWebhookConfig) {
+	*out = *in
+	out.Timeout = in.Timeout
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditWebhookConfig.
+func (in *AuditWebhookConfig) DeepCopy() *AuditWebhookConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditWebhookConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BundleEndpointProfile) DeepCopyInto(out *BundleEndpointProfile) {
 	*out = *in
@@ -138,7 +194,7 @@ func (in *ClusterSPIFFEID) DeepCopyInto(out *ClusterSPIFFEID) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIFFEID.
@@ -191,6 +247,111 @@ func (in *ClusterSPIFFEIDList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSPIFFEIDPolicy) DeepCopyInto(out *ClusterSPIFFEIDPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIFFEIDPolicy.
+func (in *ClusterSPIFFEIDPolicy) DeepCopy() *ClusterSPIFFEIDPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSPIFFEIDPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterSPIFFEIDPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSPIFFEIDPolicyList) DeepCopyInto(out *ClusterSPIFFEIDPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterSPIFFEIDPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIFFEIDPolicyList.
+func (in *ClusterSPIFFEIDPolicyList) DeepCopy() *ClusterSPIFFEIDPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSPIFFEIDPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterSPIFFEIDPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSPIFFEIDPolicySpec) DeepCopyInto(out *ClusterSPIFFEIDPolicySpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SPIFFEIDPathPatterns != nil {
+		in, out := &in.SPIFFEIDPathPatterns, &out.SPIFFEIDPathPatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.MinTTL = in.MinTTL
+	out.MaxTTL = in.MaxTTL
+	if in.AllowedFederatesWith != nil {
+		in, out := &in.AllowedFederatesWith, &out.AllowedFederatesWith
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIFFEIDPolicySpec.
+func (in *ClusterSPIFFEIDPolicySpec) DeepCopy() *ClusterSPIFFEIDPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSPIFFEIDPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSPIFFEIDPolicyViolation) DeepCopyInto(out *ClusterSPIFFEIDPolicyViolation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIFFEIDPolicyViolation.
+func (in *ClusterSPIFFEIDPolicyViolation) DeepCopy() *ClusterSPIFFEIDPolicyViolation {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSPIFFEIDPolicyViolation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterSPIFFEIDSpec) DeepCopyInto(out *ClusterSPIFFEIDSpec) {
 	*out = *in
@@ -252,6 +413,11 @@ func (in *ClusterSPIFFEIDStats) DeepCopy() *ClusterSPIFFEIDStats {
 func (in *ClusterSPIFFEIDStatus) DeepCopyInto(out *ClusterSPIFFEIDStatus) {
 	*out = *in
 	out.Stats = in.Stats
+	if in.PolicyViolations != nil {
+		in, out := &in.PolicyViolations, &out.PolicyViolations
+		*out = make([]ClusterSPIFFEIDPolicyViolation, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIFFEIDStatus.
@@ -421,12 +587,18 @@ func (in *ControllerHealth) DeepCopy() *ControllerHealth {
 func (in *ControllerManagerConfig) DeepCopyInto(out *ControllerManagerConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.ControllerManagerConfigurationSpec.DeepCopyInto(&out.ControllerManagerConfigurationSpec)
 	if in.IgnoreNamespaces != nil {
 		in, out := &in.IgnoreNamespaces, &out.IgnoreNamespaces
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	out.ReconcileTimeout = in.ReconcileTimeout
+	out.SPIREServerClient = in.SPIREServerClient
+	out.Tracing = in.Tracing
+	in.Audit.DeepCopyInto(&out.Audit)
+	out.Status = in.Status
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerManagerConfig.
@@ -447,6 +619,53 @@ func (in *ControllerManagerConfig) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerManagerConfigList) DeepCopyInto(out *ControllerManagerConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ControllerManagerConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerManagerConfigList.
+func (in *ControllerManagerConfigList) DeepCopy() *ControllerManagerConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerManagerConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ControllerManagerConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerManagerConfigStatus) DeepCopyInto(out *ControllerManagerConfigStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerManagerConfigStatus.
+func (in *ControllerManagerConfigStatus) DeepCopy() *ControllerManagerConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerManagerConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ControllerManagerConfigurationSpec) DeepCopyInto(out *ControllerManagerConfigurationSpec) {
 	*out = *in
@@ -499,6 +718,12 @@ func (in *ControllerManagerConfigurationSpec) DeepCopyInto(out *ControllerManage
 		*out = new(string)
 		**out = **in
 	}
+	out.EntryRetirementGracePeriod = in.EntryRetirementGracePeriod
+	if in.TrustDomainProfiles != nil {
+		in, out := &in.TrustDomainProfiles, &out.TrustDomainProfiles
+		*out = make([]TrustDomainProfile, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerManagerConfigurationSpec.
@@ -589,3 +814,51 @@ func (in *ReconcileConfig) DeepCopy() *ReconcileConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIREServerClientConfig) DeepCopyInto(out *SPIREServerClientConfig) {
+	*out = *in
+	out.RPCTimeout = in.RPCTimeout
+	out.KeepaliveTime = in.KeepaliveTime
+	out.KeepaliveTimeout = in.KeepaliveTimeout
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIREServerClientConfig.
+func (in *SPIREServerClientConfig) DeepCopy() *SPIREServerClientConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIREServerClientConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracingConfig) DeepCopyInto(out *TracingConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracingConfig.
+func (in *TracingConfig) DeepCopy() *TracingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TracingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrustDomainProfile) DeepCopyInto(out *TrustDomainProfile) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrustDomainProfile.
+func (in *TrustDomainProfile) DeepCopy() *TrustDomainProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(TrustDomainProfile)
+	in.DeepCopyInto(out)
+	return out
+}
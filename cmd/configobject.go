@@ -0,0 +1,177 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+)
+
+const configObjectWebhookPath = "/validate-spire-spiffe-io-v1alpha1-controllermanagerconfig"
+
+//+kubebuilder:rbac:groups=spire.spiffe.io,resources=controllermanagerconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=spire.spiffe.io,resources=controllermanagerconfigs/status,verbs=get;update;patch
+
+//+kubebuilder:webhook:path=/validate-spire-spiffe-io-v1alpha1-controllermanagerconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=spire.spiffe.io,resources=controllermanagerconfigs,verbs=create;update,versions=v1alpha1,name=vcontrollermanagerconfig.kb.io,admissionReviewVersions=v1
+
+// parseConfigObjectKey parses the <namespace>/<name> of a
+// ControllerManagerConfig object.
+func parseConfigObjectKey(s string) (client.ObjectKey, error) {
+	namespace, name, ok := strings.Cut(s, "/")
+	if !ok || namespace == "" || name == "" {
+		return client.ObjectKey{}, fmt.Errorf("invalid config object %q: expected <namespace>/<name>", s)
+	}
+	return client.ObjectKey{Namespace: namespace, Name: name}, nil
+}
+
+// loadConfigObject loads the configuration from a ControllerManagerConfig
+// object, on top of the default values.
+func loadConfigObject(ctx context.Context, reader client.Reader, key client.ObjectKey) (Config, error) {
+	// The object is read unstructured so that fields that are not set keep
+	// their default values, as they do when loading a config file.
+	obj := new(unstructured.Unstructured)
+	obj.SetGroupVersionKind(spirev1alpha1.GroupVersion.WithKind("ControllerManagerConfig"))
+	if err := reader.Get(ctx, key, obj); err != nil {
+		return Config{}, fmt.Errorf("unable to get ControllerManagerConfig %s: %w", key, err)
+	}
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to marshal ControllerManagerConfig %s: %w", key, err)
+	}
+	return decodeConfigObject(data)
+}
+
+// decodeConfigObject decodes a ControllerManagerConfig object on top of the
+// default values.
+func decodeConfigObject(data []byte) (Config, error) {
+	retval := Config{
+		ctrlConfig: defaultControllerManagerConfig(),
+		options:    ctrl.Options{Scheme: scheme},
+	}
+	if err := json.Unmarshal(data, &retval.ctrlConfig); err != nil {
+		return retval, fmt.Errorf("unable to decode ControllerManagerConfig: %w", err)
+	}
+	if err := spirev1alpha1.LoadOptionsFromConfig(&retval.options, &retval.ctrlConfig); err != nil {
+		return retval, fmt.Errorf("unable to load the ControllerManagerConfig: %w", err)
+	}
+	return retval, nil
+}
+
+// objectConfigSource reloads the configuration from a ControllerManagerConfig
+// object, and reports the generation in effect in its status.
+type objectConfigSource struct {
+	reader client.Reader
+	client client.Client
+	key    client.ObjectKey
+
+	// observed is the generation last loaded, and active the generation the
+	// controller manager is running with.
+	observed int64
+	active   int64
+}
+
+func newObjectConfigSource(reader client.Reader, c client.Client, mainConfig Config) *objectConfigSource {
+	return &objectConfigSource{
+		reader: reader,
+		client: c,
+		key:    mainConfig.configObject,
+		active: mainConfig.loadedCtrlConfig.Generation,
+	}
+}
+
+func (s *objectConfigSource) load(ctx context.Context) (Config, string, error) {
+	mainConfig, err := loadConfigObject(ctx, s.reader, s.key)
+	if err != nil {
+		return Config{}, "", err
+	}
+	s.observed = mainConfig.ctrlConfig.Generation
+	return mainConfig, fmt.Sprint(s.observed), nil
+}
+
+func (s *objectConfigSource) report(ctx context.Context, reloadErr error) error {
+	// The error is set to null rather than omitted when there is none, so
+	// that the merge patch clears the error of a previous reload.
+	var reloadErrMessage *string
+	if reloadErr == nil {
+		s.active = s.observed
+	} else {
+		reloadErrMessage = ptr.To(reloadErr.Error())
+	}
+
+	obj := &spirev1alpha1.ControllerManagerConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: s.key.Namespace, Name: s.key.Name},
+	}
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"observedGeneration": s.observed,
+			"activeGeneration":   s.active,
+			"error":              reloadErrMessage,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal ControllerManagerConfig status: %w", err)
+	}
+	if err := s.client.Status().Patch(ctx, obj, client.RawPatch("application/merge-patch+json", patch)); err != nil {
+		return fmt.Errorf("unable to update ControllerManagerConfig %s status: %w", s.key, err)
+	}
+	return nil
+}
+
+// configObjectValidator validates ControllerManagerConfig objects with the
+// same checks made at startup, and warns about changes that only take
+// effect after a restart.
+type configObjectValidator struct{}
+
+func (configObjectValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	mainConfig, err := decodeConfigObject(req.Object.Raw)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if _, errs := validateConfig(&mainConfig); len(errs) > 0 {
+		return admission.Denied(errors.Join(errs...).Error())
+	}
+
+	response := admission.Allowed("")
+	if req.Operation == admissionv1.Update {
+		oldConfig, err := decodeConfigObject(req.OldObject.Raw)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		changed, err := changedConfigFields(oldConfig.ctrlConfig, mainConfig.ctrlConfig)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if restartRequired := restartRequiredFields(changed); len(restartRequired) > 0 {
+			response = response.WithWarnings(fmt.Sprintf("changing %s requires restarting the controller managers configured from this object", strings.Join(restartRequired, ", ")))
+		}
+	}
+	return response
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
+	"github.com/spiffe/spire-controller-manager/pkg/test/k8stest"
+)
+
+func TestParseConfigObjectKey(t *testing.T) {
+	key, err := parseConfigObjectKey("spire-system/config")
+	require.NoError(t, err)
+	assert.Equal(t, client.ObjectKey{Namespace: "spire-system", Name: "config"}, key)
+
+	for _, s := range []string{"config", "/config", "spire-system/"} {
+		_, err := parseConfigObjectKey(s)
+		assert.EqualError(t, err, `invalid config object "`+s+`": expected <namespace>/<name>`)
+	}
+}
+
+func TestDecodeConfigObjectTimeouts(t *testing.T) {
+	// The timeouts are bounded by default...
+	config, err := decodeConfigObject([]byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, config.ctrlConfig.ReconcileTimeout.Duration)
+	assert.Equal(t, 30*time.Second, config.ctrlConfig.SPIREServerClient.RPCTimeout.Duration)
+
+	// ...unless set to zero.
+	config, err = decodeConfigObject([]byte(`{"reconcileTimeout": "0s", "spireServerClient": {"rpcTimeout": "0s"}}`))
+	require.NoError(t, err)
+	assert.Zero(t, config.ctrlConfig.ReconcileTimeout.Duration)
+	assert.Zero(t, config.ctrlConfig.SPIREServerClient.RPCTimeout.Duration)
+}
+
+func TestConfigObjectReload(t *testing.T) {
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "spire-system", Name: "config"}
+	// The config is read from an unstructured object holding only the fields
+	// that are set, as when it is applied from a manifest. The fake client
+	// stores typed objects, which would set every field.
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "spire.spiffe.io/v1alpha1",
+		"kind":       "ControllerManagerConfig",
+		"metadata": map[string]any{
+			"namespace":  key.Namespace,
+			"name":       key.Name,
+			"generation": int64(1),
+		},
+		"clusterName": "cluster",
+		"trustDomain": "example.org",
+		"logLevel":    "info",
+	}}
+	reader := unstructuredReader{obj: obj}
+	k8sClient := k8stest.WithScheme(t, fake.NewClientBuilder()).
+		WithObjects(obj.DeepCopy()).
+		WithStatusSubresource(&spirev1alpha1.ControllerManagerConfig{}).
+		Build()
+
+	mainConfig, err := loadConfigObject(ctx, reader, key)
+	require.NoError(t, err)
+	// Fields that are not set keep their default values.
+	assert.Equal(t, defaultGCInterval, mainConfig.ctrlConfig.GCInterval)
+	assert.Equal(t, []string{"kube-system", "kube-public", "spire-system"}, mainConfig.ctrlConfig.IgnoreNamespaces)
+	assert.Equal(t, "cluster", mainConfig.ctrlConfig.ClusterName)
+
+	mainConfig.configObject = key
+	mainConfig.loadedCtrlConfig = *mainConfig.ctrlConfig.DeepCopy()
+	mainConfig.logLevel = uberzap.NewAtomicLevelAt(zapcore.InfoLevel)
+	_, errs := validateConfig(&mainConfig)
+	require.Empty(t, errs)
+	live := liveconfig.New(newLiveConfig(mainConfig))
+	r := newConfigReloader(mainConfig, newObjectConfigSource(reader, k8sClient, mainConfig), live)
+
+	requireStatus := func(expected spirev1alpha1.ControllerManagerConfigStatus) {
+		t.Helper()
+		actual := new(spirev1alpha1.ControllerManagerConfig)
+		require.NoError(t, k8sClient.Get(ctx, key, actual))
+		require.Equal(t, expected, actual.Status)
+	}
+	update := func(field string, value any) {
+		t.Helper()
+		if value == nil {
+			unstructured.RemoveNestedField(obj.Object, field)
+		} else {
+			require.NoError(t, unstructured.SetNestedField(obj.Object, value, field))
+		}
+		obj.SetGeneration(obj.GetGeneration() + 1)
+	}
+
+	t.Log("The generation in effect is reported at startup")
+	require.NoError(t, r.reload(ctx))
+	requireStatus(spirev1alpha1.ControllerManagerConfigStatus{ObservedGeneration: 1, ActiveGeneration: 1})
+
+	t.Log("Reloadable changes are applied")
+	update("gcInterval", int64(time.Minute))
+	require.NoError(t, r.reload(ctx))
+	assert.Equal(t, time.Minute, live.Load().GCInterval)
+	requireStatus(spirev1alpha1.ControllerManagerConfigStatus{ObservedGeneration: 2, ActiveGeneration: 2})
+
+	t.Log("Changes that require a restart are reported")
+	update("spireServerSocketPath", "/other.sock")
+	require.EqualError(t, r.reload(ctx), "changing spireServerSocketPath requires a restart; no changes were applied")
+	requireStatus(spirev1alpha1.ControllerManagerConfigStatus{
+		ObservedGeneration: 3,
+		ActiveGeneration:   2,
+		Error:              "changing spireServerSocketPath requires a restart; no changes were applied",
+	})
+
+	t.Log("Reverting the change clears the error")
+	update("spireServerSocketPath", nil)
+	require.NoError(t, r.reload(ctx))
+	requireStatus(spirev1alpha1.ControllerManagerConfigStatus{ObservedGeneration: 4, ActiveGeneration: 4})
+}
+
+func TestConfigObjectValidator(t *testing.T) {
+	valid := `{"apiVersion":"spire.spiffe.io/v1alpha1","kind":"ControllerManagerConfig","metadata":{"name":"config"},"clusterName":"cluster","trustDomain":"example.org","logLevel":"info"}`
+
+	for _, test := range []struct {
+		name             string
+		operation        admissionv1.Operation
+		object           string
+		oldObject        string
+		expectedAllowed  bool
+		expectedMessage  string
+		expectedWarnings []string
+	}{
+		{
+			name:            "valid",
+			operation:       admissionv1.Create,
+			object:          valid,
+			expectedAllowed: true,
+		},
+		{
+			name:            "invalid",
+			operation:       admissionv1.Create,
+			object:          `{"clusterName":"cluster","ignoreNamespaces":["("],"logLevel":"loud"}`,
+			expectedAllowed: false,
+			expectedMessage: "unable to compile ignore namespaces regex: error parsing regexp: missing closing ): `(`\nunable to parse log level: invalid log level: loud\ntrust domain is required configuration",
+		},
+		{
+			name:            "reloadable update",
+			operation:       admissionv1.Update,
+			object:          `{"clusterName":"cluster","trustDomain":"example.org","logLevel":"info","className":"a"}`,
+			oldObject:       valid,
+			expectedAllowed: true,
+		},
+		{
+			name:             "update requiring a restart",
+			operation:        admissionv1.Update,
+			object:           `{"clusterName":"other","trustDomain":"example.org","logLevel":"info","className":"a"}`,
+			oldObject:        valid,
+			expectedAllowed:  true,
+			expectedWarnings: []string{"changing clusterName requires restarting the controller managers configured from this object"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: test.operation,
+				Object:    runtime.RawExtension{Raw: []byte(test.object)},
+				OldObject: runtime.RawExtension{Raw: []byte(test.oldObject)},
+			}}
+			resp := configObjectValidator{}.Handle(context.Background(), req)
+			assert.Equal(t, test.expectedAllowed, resp.Allowed)
+			if test.expectedMessage != "" {
+				require.NotNil(t, resp.Result)
+				assert.Equal(t, test.expectedMessage, resp.Result.Message)
+			}
+			assert.Equal(t, test.expectedWarnings, resp.Warnings)
+		})
+	}
+}
+
+func TestObjectConfigSourceReportsPatchFailures(t *testing.T) {
+	k8sClient := k8stest.WithScheme(t, fake.NewClientBuilder()).Build()
+	source := &objectConfigSource{client: k8sClient, key: client.ObjectKey{Namespace: "ns", Name: "missing"}}
+	err := source.report(context.Background(), errors.New("oh no"))
+	require.ErrorContains(t, err, "unable to update ControllerManagerConfig ns/missing status")
+}
+
+// unstructuredReader serves a single unstructured object as is.
+type unstructuredReader struct {
+	client.Reader
+	obj *unstructured.Unstructured
+}
+
+func (r unstructuredReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if key != client.ObjectKeyFromObject(r.obj) {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	obj.(*unstructured.Unstructured).Object = runtime.DeepCopyJSON(r.obj.Object)
+	return nil
+}
@@ -0,0 +1,546 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/test/spirefake"
+)
+
+// The end-to-end tests run the manager as wired up by run against envtest
+// and a fake SPIRE Server. They are skipped unless the envtest binaries are
+// available, e.g. when run with `make test`.
+
+const (
+	e2eTrustDomain    = "example.org"
+	e2eClusterName    = "e2e"
+	e2eNamespace      = "workload"
+	e2eNodeName       = "node1"
+	e2eWebhookName    = "spire-controller-manager-webhook"
+	e2eServiceNS      = "spire-system"
+	e2eEventuallyWait = 30 * time.Second
+	e2eEventuallyTick = 100 * time.Millisecond
+)
+
+var setE2ELoggerOnce sync.Once
+
+type e2eHarness struct {
+	t           *testing.T
+	k8sClient   client.Client
+	clientset   *kubernetes.Clientset
+	spire       *spirefake.Server
+	webhookPort int
+	nodeUID     string
+}
+
+// startE2E starts envtest, a fake SPIRE Server, and the manager. The
+// configure callback, if set, can adjust the configuration before the
+// manager is started and the setup callback, if set, can seed the fake
+// SPIRE Server.
+func startE2E(t *testing.T, configure func(*Config), setup func(*spirefake.Server)) *e2eHarness {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set; run with `make test` to run the end-to-end tests")
+	}
+
+	setE2ELoggerOnce.Do(func() {
+		w := io.Discard
+		if testing.Verbose() {
+			w = os.Stderr
+		}
+		ctrl.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(w)))
+	})
+
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+	}
+	restConfig, err := testEnv.Start()
+	require.NoError(t, err, "failed to start envtest")
+	t.Cleanup(func() {
+		assert.NoError(t, testEnv.Stop(), "failed to stop envtest")
+	})
+
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	require.NoError(t, err)
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	require.NoError(t, err)
+
+	spire := spirefake.Start(t, spirefake.Config{
+		TrustDomain: spiffeid.RequireTrustDomainFromString(e2eTrustDomain),
+	})
+	if setup != nil {
+		setup(spire)
+	}
+
+	h := &e2eHarness{
+		t:           t,
+		k8sClient:   k8sClient,
+		clientset:   clientset,
+		spire:       spire,
+		webhookPort: freePort(t),
+	}
+	h.createFixtures()
+
+	ctrlConfig := defaultControllerManagerConfig()
+	ctrlConfig.TrustDomain = e2eTrustDomain
+	ctrlConfig.ClusterName = e2eClusterName
+	ctrlConfig.ClusterDomain = "cluster.local"
+	ctrlConfig.SPIREServerSocketPath = spire.SocketPath()
+	ctrlConfig.GCInterval = time.Second
+	ctrlConfig.ValidatingWebhookConfigurationName = e2eWebhookName
+	ctrlConfig.Webhook.Host = "127.0.0.1"
+	ctrlConfig.Webhook.Port = ptr.To(h.webhookPort)
+	mainConfig := Config{
+		ctrlConfig: ctrlConfig,
+		options: ctrl.Options{
+			Scheme:                 scheme,
+			Metrics:                metricsserver.Options{BindAddress: "0"},
+			HealthProbeBindAddress: "0",
+		},
+		reconcile: spirev1alpha1.ReconcileConfig{
+			ClusterSPIFFEIDs:             true,
+			ClusterFederatedTrustDomains: true,
+			ClusterStaticEntries:         true,
+		},
+	}
+	if configure != nil {
+		configure(&mainConfig)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- runManager(ctx, mainConfig, restConfig, clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations())
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-errCh:
+			assert.NoError(t, err, "manager failed")
+		case <-time.After(e2eEventuallyWait):
+			t.Error("timed out waiting for the manager to stop")
+		}
+	})
+	return h
+}
+
+// createFixtures creates the node, namespace and webhook configuration that
+// every scenario relies on.
+func (h *e2eHarness) createFixtures() {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: e2eNodeName}}
+	h.create(node)
+	h.nodeUID = string(node.UID)
+
+	h.create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: e2eNamespace}})
+	h.create(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: e2eNamespace, Name: "default"}})
+
+	// The webhook only exists so that the webhook manager has something to
+	// manage. It selects no objects so the API server never calls it.
+	h.create(&admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: e2eWebhookName},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name: "vclusterspiffeid.kb.io",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Namespace: e2eServiceNS,
+						Name:      "spire-controller-manager-webhook-service",
+					},
+				},
+				ObjectSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"e2e.spiffe.io/never": "true"},
+				},
+				SideEffects:             ptr.To(admissionregistrationv1.SideEffectClassNone),
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	})
+}
+
+func (h *e2eHarness) create(obj client.Object) {
+	h.t.Helper()
+	require.NoError(h.t, h.k8sClient.Create(context.Background(), obj))
+}
+
+func (h *e2eHarness) update(obj client.Object, mutate func()) {
+	h.t.Helper()
+	require.NoError(h.t, h.k8sClient.Get(context.Background(), client.ObjectKeyFromObject(obj), obj))
+	mutate()
+	require.NoError(h.t, h.k8sClient.Update(context.Background(), obj))
+}
+
+func (h *e2eHarness) delete(obj client.Object) {
+	h.t.Helper()
+	require.NoError(h.t, h.k8sClient.Delete(context.Background(), obj))
+}
+
+func (h *e2eHarness) createPod(name string, labels map[string]string) *corev1.Pod {
+	h.t.Helper()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: e2eNamespace, Name: name, Labels: labels},
+		Spec: corev1.PodSpec{
+			NodeName:                     e2eNodeName,
+			ServiceAccountName:           "default",
+			AutomountServiceAccountToken: ptr.To(false),
+			Containers:                   []corev1.Container{{Name: "workload", Image: "workload"}},
+		},
+	}
+	h.create(pod)
+	return pod
+}
+
+// eventuallyEntries waits until the SPIFFE IDs of the entries on the fake
+// SPIRE Server match the expected ones, in any order.
+func (h *e2eHarness) eventuallyEntries(expected ...string) []*apitypes.Entry {
+	h.t.Helper()
+	var entries []*apitypes.Entry
+	require.EventuallyWithT(h.t, func(c *assert.CollectT) {
+		entries = h.spire.Entries()
+		actual := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			actual = append(actual, spiffeIDString(entry.SpiffeId))
+		}
+		assert.ElementsMatch(c, expected, actual)
+	}, e2eEventuallyWait, e2eEventuallyTick)
+	return entries
+}
+
+func (h *e2eHarness) eventually(condition func(c *assert.CollectT)) {
+	h.t.Helper()
+	require.EventuallyWithT(h.t, condition, e2eEventuallyWait, e2eEventuallyTick)
+}
+
+func (h *e2eHarness) parentID() string {
+	return fmt.Sprintf("spiffe://%s/spire/agent/k8s_psat/%s/%s", e2eTrustDomain, e2eClusterName, h.nodeUID)
+}
+
+func TestE2EClusterSPIFFEIDLifecycle(t *testing.T) {
+	h := startE2E(t, nil, nil)
+
+	pod := h.createPod("pod1", map[string]string{"app": "e2e"})
+	clusterSPIFFEID := &spirev1alpha1.ClusterSPIFFEID{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload"},
+		Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+			SPIFFEIDTemplate: "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}",
+			PodSelector:      &metav1.LabelSelector{MatchLabels: map[string]string{"app": "e2e"}},
+		},
+	}
+	h.create(clusterSPIFFEID)
+
+	entries := h.eventuallyEntries("spiffe://example.org/ns/workload/pod/pod1")
+	assert.Equal(t, h.parentID(), spiffeIDString(entries[0].ParentId))
+	assert.Contains(t, selectorStrings(entries[0].Selectors), "k8s:pod-uid:"+string(pod.UID))
+
+	h.eventually(func(c *assert.CollectT) {
+		actual := new(spirev1alpha1.ClusterSPIFFEID)
+		assert.NoError(c, h.k8sClient.Get(context.Background(), client.ObjectKeyFromObject(clusterSPIFFEID), actual))
+		assert.Equal(c, 1, actual.Status.Stats.PodsSelected)
+		assert.Equal(c, 1, actual.Status.Stats.EntriesToSet)
+		assert.Equal(c, 0, actual.Status.Stats.EntryFailures)
+	})
+
+	h.update(clusterSPIFFEID, func() {
+		clusterSPIFFEID.Spec.SPIFFEIDTemplate = "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}"
+		clusterSPIFFEID.Spec.Hint = "updated"
+	})
+	entries = h.eventuallyEntries("spiffe://example.org/ns/workload/sa/default")
+	assert.Equal(t, "updated", entries[0].Hint)
+
+	h.delete(clusterSPIFFEID)
+	h.eventuallyEntries()
+}
+
+func TestE2EClusterStaticEntryLifecycle(t *testing.T) {
+	h := startE2E(t, nil, nil)
+
+	clusterStaticEntry := &spirev1alpha1.ClusterStaticEntry{
+		ObjectMeta: metav1.ObjectMeta{Name: "static"},
+		Spec: spirev1alpha1.ClusterStaticEntrySpec{
+			SPIFFEID:  "spiffe://example.org/static",
+			ParentID:  "spiffe://example.org/parent",
+			Selectors: []string{"unix:uid:1000"},
+		},
+	}
+	h.create(clusterStaticEntry)
+	h.eventuallyEntries("spiffe://example.org/static")
+	h.eventually(func(c *assert.CollectT) {
+		actual := new(spirev1alpha1.ClusterStaticEntry)
+		assert.NoError(c, h.k8sClient.Get(context.Background(), client.ObjectKeyFromObject(clusterStaticEntry), actual))
+		assert.True(c, actual.Status.Rendered)
+		assert.True(c, actual.Status.Set)
+		assert.False(c, actual.Status.Masked)
+	})
+
+	h.update(clusterStaticEntry, func() {
+		clusterStaticEntry.Spec.Selectors = []string{"unix:uid:2000"}
+	})
+	h.eventually(func(c *assert.CollectT) {
+		entries := h.spire.Entries()
+		if assert.Len(c, entries, 1) {
+			assert.Equal(c, []string{"unix:uid:2000"}, selectorStrings(entries[0].Selectors))
+		}
+	})
+
+	h.delete(clusterStaticEntry)
+	h.eventuallyEntries()
+}
+
+func TestE2EFallback(t *testing.T) {
+	h := startE2E(t, nil, nil)
+
+	h.createPod("labeled", map[string]string{"app": "e2e"})
+	h.createPod("unlabeled", nil)
+	h.create(&spirev1alpha1.ClusterSPIFFEID{
+		ObjectMeta: metav1.ObjectMeta{Name: "fallback"},
+		Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+			SPIFFEIDTemplate: "spiffe://{{ .TrustDomain }}/fallback/{{ .PodMeta.Name }}",
+			Fallback:         true,
+		},
+	})
+	h.create(&spirev1alpha1.ClusterSPIFFEID{
+		ObjectMeta: metav1.ObjectMeta{Name: "specific"},
+		Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+			SPIFFEIDTemplate: "spiffe://{{ .TrustDomain }}/specific/{{ .PodMeta.Name }}",
+			PodSelector:      &metav1.LabelSelector{MatchLabels: map[string]string{"app": "e2e"}},
+		},
+	})
+
+	// The fallback only applies to the pod without a more specific ID.
+	h.eventuallyEntries(
+		"spiffe://example.org/specific/labeled",
+		"spiffe://example.org/fallback/unlabeled",
+	)
+}
+
+func TestE2EClassName(t *testing.T) {
+	h := startE2E(t, func(config *Config) {
+		config.ctrlConfig.ClassName = "e2e"
+		config.ctrlConfig.WatchClassless = false
+	}, nil)
+
+	for _, className := range []string{"e2e", "other", ""} {
+		name := className
+		if name == "" {
+			name = "classless"
+		}
+		h.create(&spirev1alpha1.ClusterStaticEntry{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: spirev1alpha1.ClusterStaticEntrySpec{
+				SPIFFEID:  "spiffe://example.org/" + name,
+				ParentID:  "spiffe://example.org/parent",
+				Selectors: []string{"unix:uid:1000"},
+				ClassName: className,
+			},
+		})
+	}
+	h.create(&spirev1alpha1.ClusterFederatedTrustDomain{
+		ObjectMeta: metav1.ObjectMeta{Name: "other"},
+		Spec: spirev1alpha1.ClusterFederatedTrustDomainSpec{
+			TrustDomain:           "other.org",
+			BundleEndpointURL:     "https://other.org/bundle",
+			BundleEndpointProfile: spirev1alpha1.BundleEndpointProfile{Type: spirev1alpha1.HTTPSWebProfileType},
+			ClassName:             "other",
+		},
+	})
+
+	// Every object is considered in the same pass, so once the entry for
+	// our class shows up, the others would have too.
+	h.eventuallyEntries("spiffe://example.org/e2e")
+	assert.Empty(t, h.spire.FederationRelationships())
+}
+
+func TestE2EEntryIDPrefixCleanup(t *testing.T) {
+	h := startE2E(t, func(config *Config) {
+		config.ctrlConfig.EntryIDPrefix = "e2e."
+		config.ctrlConfig.EntryIDPrefixCleanup = ptr.To("")
+	}, func(spire *spirefake.Server) {
+		spire.SetEntries(
+			makeSeedEntry("legacy", "spiffe://example.org/legacy"),
+			makeSeedEntry("other.entry", "spiffe://example.org/other"),
+		)
+	})
+
+	h.create(&spirev1alpha1.ClusterStaticEntry{
+		ObjectMeta: metav1.ObjectMeta{Name: "static"},
+		Spec: spirev1alpha1.ClusterStaticEntrySpec{
+			SPIFFEID:  "spiffe://example.org/static",
+			ParentID:  "spiffe://example.org/parent",
+			Selectors: []string{"unix:uid:1000"},
+		},
+	})
+
+	// Entries without a prefix were created by an older controller manager
+	// and are cleaned up. Entries with another prefix are left alone.
+	entries := h.eventuallyEntries("spiffe://example.org/other", "spiffe://example.org/static")
+	for _, entry := range entries {
+		if spiffeIDString(entry.SpiffeId) == "spiffe://example.org/static" {
+			assert.Regexp(t, `^e2e\.`, entry.Id)
+		}
+	}
+}
+
+func TestE2EFederation(t *testing.T) {
+	h := startE2E(t, nil, nil)
+
+	clusterFederatedTrustDomain := &spirev1alpha1.ClusterFederatedTrustDomain{
+		ObjectMeta: metav1.ObjectMeta{Name: "domain1"},
+		Spec: spirev1alpha1.ClusterFederatedTrustDomainSpec{
+			TrustDomain:           "domain1.org",
+			BundleEndpointURL:     "https://domain1.org/bundle",
+			BundleEndpointProfile: spirev1alpha1.BundleEndpointProfile{Type: spirev1alpha1.HTTPSWebProfileType},
+		},
+	}
+	h.create(clusterFederatedTrustDomain)
+	h.eventually(func(c *assert.CollectT) {
+		federationRelationships := h.spire.FederationRelationships()
+		if assert.Len(c, federationRelationships, 1) {
+			assert.Equal(c, "domain1.org", federationRelationships[0].TrustDomain)
+			assert.Equal(c, "https://domain1.org/bundle", federationRelationships[0].BundleEndpointUrl)
+		}
+	})
+
+	h.update(clusterFederatedTrustDomain, func() {
+		clusterFederatedTrustDomain.Spec.BundleEndpointURL = "https://domain1.org/moved"
+		clusterFederatedTrustDomain.Spec.BundleEndpointProfile = spirev1alpha1.BundleEndpointProfile{
+			Type:             spirev1alpha1.HTTPSSPIFFEProfileType,
+			EndpointSPIFFEID: "spiffe://domain1.org/spire/server",
+		}
+	})
+	h.eventually(func(c *assert.CollectT) {
+		federationRelationships := h.spire.FederationRelationships()
+		if assert.Len(c, federationRelationships, 1) {
+			assert.Equal(c, "https://domain1.org/moved", federationRelationships[0].BundleEndpointUrl)
+			assert.Equal(c, "spiffe://domain1.org/spire/server", federationRelationships[0].GetHttpsSpiffe().GetEndpointSpiffeId())
+		}
+	})
+
+	h.delete(clusterFederatedTrustDomain)
+	h.eventually(func(c *assert.CollectT) {
+		assert.Empty(c, h.spire.FederationRelationships())
+	})
+}
+
+func TestE2EWebhookCertificateRotation(t *testing.T) {
+	h := startE2E(t, nil, nil)
+	webhookClient := h.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+
+	// The webhook configuration is patched with the trust domain bundle.
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h.spire.X509Authority().Raw})
+	h.eventually(func(c *assert.CollectT) {
+		webhookConfig, err := webhookClient.Get(context.Background(), e2eWebhookName, metav1.GetOptions{})
+		if assert.NoError(c, err) {
+			assert.Equal(c, caBundle, webhookConfig.Webhooks[0].ClientConfig.CABundle)
+		}
+	})
+	h.eventuallyServesDNSName("spire-controller-manager-webhook-service.spire-system.svc")
+
+	// Changing the webhook service rotates the certificate so that it is
+	// valid for the new DNS name.
+	minted := h.spire.Calls(spirefake.MintX509SVIDMethod)
+	webhookConfig, err := webhookClient.Get(context.Background(), e2eWebhookName, metav1.GetOptions{})
+	require.NoError(t, err)
+	webhookConfig.Webhooks[0].ClientConfig.Service.Name = "renamed"
+	_, err = webhookClient.Update(context.Background(), webhookConfig, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	h.eventually(func(c *assert.CollectT) {
+		assert.Greater(c, h.spire.Calls(spirefake.MintX509SVIDMethod), minted)
+	})
+	h.eventuallyServesDNSName("renamed.spire-system.svc")
+}
+
+// eventuallyServesDNSName waits until the webhook server serves a
+// certificate, signed by the fake SPIRE Server, for the DNS name.
+func (h *e2eHarness) eventuallyServesDNSName(dnsName string) {
+	h.t.Helper()
+	h.eventually(func(c *assert.CollectT) {
+		conn, err := tls.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(h.webhookPort)), &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // the chain is verified below
+		})
+		if !assert.NoError(c, err) {
+			return
+		}
+		defer conn.Close()
+		certs := conn.ConnectionState().PeerCertificates
+		if assert.NotEmpty(c, certs) {
+			assert.Contains(c, certs[0].DNSNames, dnsName)
+			assert.NoError(c, certs[0].CheckSignatureFrom(h.spire.X509Authority()))
+		}
+	})
+}
+
+func makeSeedEntry(id, spiffeID string) *apitypes.Entry {
+	td := spiffeid.RequireTrustDomainFromString(e2eTrustDomain)
+	return &apitypes.Entry{
+		Id:        id,
+		SpiffeId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: spiffeid.RequireFromString(spiffeID).Path()},
+		ParentId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: "/parent"},
+		Selectors: []*apitypes.Selector{{Type: "unix", Value: "uid:" + id}},
+	}
+}
+
+func spiffeIDString(id *apitypes.SPIFFEID) string {
+	if id == nil {
+		return ""
+	}
+	return "spiffe://" + id.TrustDomain + id.Path
+}
+
+func selectorStrings(selectors []*apitypes.Selector) []string {
+	out := make([]string, 0, len(selectors))
+	for _, selector := range selectors {
+		out = append(out, selector.Type+":"+selector.Value)
+	}
+	return out
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	addr, ok := listener.Addr().(*net.TCPAddr)
+	require.True(t, ok, "unexpected listener address type")
+	return addr.Port
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/entryexport"
+	"github.com/spiffe/spire-controller-manager/pkg/k8sapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+)
+
+// exportManifest is a ClusterStaticEntry manifest, without the status and
+// the metadata that is only meaningful on objects read from a cluster.
+type exportManifest struct {
+	APIVersion string                               `json:"apiVersion"`
+	Kind       string                               `json:"kind"`
+	Metadata   exportManifestMetadata               `json:"metadata"`
+	Spec       spirev1alpha1.ClusterStaticEntrySpec `json:"spec"`
+}
+
+type exportManifestMetadata struct {
+	Name string `json:"name"`
+}
+
+// runExport implements the export command, which writes a ClusterStaticEntry
+// manifest for each entry on SPIRE Server selected by the filter flags. With
+// -retag, it instead retags the selected entries with the entry ID prefix so
+// that the controller manager adopts them, once the manifests have been
+// applied. It returns the process exit code.
+func runExport(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var configFileFlag string
+	var expandEnvFlag bool
+	var kubeconfigFlag string
+	var spireAPISocketFlag string
+	var parentIDFlag string
+	var spiffeIDRegexFlag string
+	var unmanagedFlag bool
+	var classNameFlag string
+	var retagFlag bool
+	flags.StringVar(&configFileFlag, "config", "", "The controller manager config file to export with. Flags override configuration from this file.")
+	flags.BoolVar(&expandEnvFlag, "expand-env", false, "Expand environment variables in SPIRE Controller Manager config file")
+	flags.StringVar(&kubeconfigFlag, "kubeconfig", "", "The kubeconfig file to connect to the cluster with when retagging. Defaults to the same lookup as kubectl.")
+	flags.StringVar(&spireAPISocketFlag, "spire-api-socket", "", "The path to the SPIRE API socket. Defaults to the socket in the config file, or "+defaultSPIREServerSocketPath)
+	flags.StringVar(&parentIDFlag, "parent-id", "", "Export the entries with this parent ID")
+	flags.StringVar(&spiffeIDRegexFlag, "spiffe-id-regex", "", "Export the entries with a SPIFFE ID matching this regular expression")
+	flags.BoolVar(&unmanagedFlag, "unmanaged", false, "Export the entries whose ID does not start with the configured entry ID prefix")
+	flags.StringVar(&classNameFlag, "class-name", "", "The class name to assign the ClusterStaticEntries to. Defaults to the class name in the config file.")
+	flags.BoolVar(&retagFlag, "retag", false, "Instead of exporting, recreate the selected entries with the configured entry ID prefix so that the controller manager adopts them")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s export [flags]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(stderr, "Writes a ClusterStaticEntry manifest for each entry on SPIRE Server selected by the")
+		fmt.Fprintln(stderr, "filter flags. Once the manifests have been applied to the cluster, run again with")
+		fmt.Fprintln(stderr, "-retag to recreate the entries with the configured entry ID prefix so that the")
+		fmt.Fprintln(stderr, "controller manager adopts them rather than creating duplicates. Entries are only")
+		fmt.Fprintln(stderr, "retagged if a ClusterStaticEntry in the cluster declares each of them. Each entry is")
+		fmt.Fprintln(stderr, "briefly missing while it is recreated.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	if retagFlag && !unmanagedFlag {
+		// Without -unmanaged, the entries of other controller managers
+		// could be retagged and taken over.
+		fmt.Fprintln(stderr, "-retag requires -unmanaged")
+		flags.Usage()
+		return 2
+	}
+
+	var filter entryexport.Filter
+	if parentIDFlag != "" {
+		parentID, err := spiffeid.FromString(parentIDFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid parent ID %q: %v\n", parentIDFlag, err)
+			return 2
+		}
+		filter.ParentID = parentID
+	}
+	if spiffeIDRegexFlag != "" {
+		pattern, err := regexp.Compile(spiffeIDRegexFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid SPIFFE ID regex %q: %v\n", spiffeIDRegexFlag, err)
+			return 2
+		}
+		filter.SPIFFEIDPattern = pattern
+	}
+
+	// Retagging checks the entries against the ClusterStaticEntries the
+	// controller manager would declare, so it needs the complete config.
+	var mainConfig Config
+	var config spireentry.ReconcilerConfig
+	var err error
+	if retagFlag {
+		mainConfig, config, err = renderConfig(configFileFlag, expandEnvFlag, "", "", "")
+	} else {
+		mainConfig, err = loadConfig(configFileFlag, expandEnvFlag)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	entryIDPrefix := addDotSuffix(mainConfig.ctrlConfig.EntryIDPrefix)
+	if unmanagedFlag && entryIDPrefix == "" {
+		fmt.Fprintln(stderr, "-unmanaged and -retag require an entry ID prefix to be configured")
+		return 1
+	}
+	if unmanagedFlag {
+		filter.WithoutIDPrefix = entryIDPrefix
+	}
+	if classNameFlag == "" {
+		classNameFlag = mainConfig.ctrlConfig.ClassName
+	}
+
+	var k8sClient client.Client
+	if retagFlag {
+		k8sClient, err = newClusterClient(kubeconfigFlag)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	spireClient, err := dialSPIREServer(mainConfig, spireAPISocketFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer spireClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if retagFlag {
+		config.EntryClient = spireClient
+		n, err := retag(ctx, config, k8sClient, filter)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stderr, "Retagged %d entries\n", n)
+		return 0
+	}
+
+	n, err := export(ctx, spireClient, filter, classNameFlag, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Exported %d entries\n", n)
+	return 0
+}
+
+// export writes a ClusterStaticEntry manifest for each entry selected by
+// the filter. It returns the number of entries exported.
+func export(ctx context.Context, entryClient spireapi.EntryClient, filter entryexport.Filter, className string, out io.Writer) (int, error) {
+	entries, err := listExportEntries(ctx, entryClient, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, clusterStaticEntry := range entryexport.ClusterStaticEntries(entries, className) {
+		data, err := yaml.Marshal(exportManifest{
+			APIVersion: clusterStaticEntry.APIVersion,
+			Kind:       clusterStaticEntry.Kind,
+			Metadata:   exportManifestMetadata{Name: clusterStaticEntry.Name},
+			Spec:       clusterStaticEntry.Spec,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal ClusterStaticEntry: %w", err)
+		}
+		if i > 0 {
+			data = append([]byte("---\n"), data...)
+		}
+		if _, err := out.Write(data); err != nil {
+			return 0, fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+
+	return len(entries), nil
+}
+
+// retag recreates the entries selected by the filter with the entry ID
+// prefix. Nothing is retagged unless each entry is declared by a
+// ClusterStaticEntry in the cluster, since the controller manager would
+// otherwise delete the retagged entries as undeclared. It returns the
+// number of entries retagged.
+func retag(ctx context.Context, config spireentry.ReconcilerConfig, k8sClient client.Client, filter entryexport.Filter) (int, error) {
+	entries, err := listExportEntries(ctx, config.EntryClient, filter)
+	if err != nil {
+		return 0, err
+	}
+	clusterStaticEntries, err := k8sapi.ListClusterStaticEntries(ctx, k8sClient)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list ClusterStaticEntries: %w", err)
+	}
+	rendered, err := spireentry.Render(ctx, config, spireentry.RenderInput{ClusterStaticEntries: clusterStaticEntries})
+	if err != nil {
+		return 0, fmt.Errorf("failed to render entries: %w", err)
+	}
+	declared := make([]spireapi.Entry, 0, len(rendered.Entries))
+	for _, entry := range rendered.Entries {
+		declared = append(declared, entry.Entry)
+	}
+	if undeclared := entryexport.Undeclared(entries, declared); len(undeclared) > 0 {
+		return 0, fmt.Errorf("entries are not declared by a ClusterStaticEntry in the cluster; apply the exported manifests before retagging: %s", strings.Join(undeclared, ", "))
+	}
+	if err := entryexport.Retag(ctx, config.EntryClient, entries, addDotSuffix(config.EntryIDPrefix)); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// listExportEntries lists the entries selected by the filter. The parent ID
+// is filtered on by SPIRE Server. The other filters are not supported by
+// the SPIRE API.
+func listExportEntries(ctx context.Context, entryClient spireapi.EntryClient, filter entryexport.Filter) ([]spireapi.Entry, error) {
+	entries, err := entryClient.ListFilteredEntries(ctx, spireapi.EntryFilter{ByParentID: filter.ParentID}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SPIRE entries: %w", err)
+	}
+	return entryexport.Select(entries, filter), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/entryexport"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+	"github.com/spiffe/spire-controller-manager/pkg/test/spirefake"
+)
+
+func TestExport(t *testing.T) {
+	spire := spirefake.Start(t, spirefake.Config{TrustDomain: spiffeid.RequireTrustDomainFromString("example.org")})
+	spire.SetEntries(
+		makeSeedEntry("legacy-1", "spiffe://example.org/legacy/1"),
+		makeSeedEntry("legacy-2", "spiffe://example.org/legacy/2"),
+		makeSeedEntry("prefix.managed", "spiffe://example.org/legacy/3"),
+	)
+	spireClient, err := spireapi.DialSocket(spire.SocketPath())
+	require.NoError(t, err)
+	defer spireClient.Close()
+
+	out := new(bytes.Buffer)
+	n, err := export(context.Background(), spireClient, entryexport.Filter{WithoutIDPrefix: "prefix."}, "class", out)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, `apiVersion: spire.spiffe.io/v1alpha1
+kind: ClusterStaticEntry
+metadata:
+  name: legacy-1
+spec:
+  className: class
+  jwtSVIDTTL: 0s
+  parentID: spiffe://example.org/parent
+  selectors:
+  - unix:uid:legacy-1
+  spiffeID: spiffe://example.org/legacy/1
+  x509SVIDTTL: 0s
+---
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ClusterStaticEntry
+metadata:
+  name: legacy-2
+spec:
+  className: class
+  jwtSVIDTTL: 0s
+  parentID: spiffe://example.org/parent
+  selectors:
+  - unix:uid:legacy-2
+  spiffeID: spiffe://example.org/legacy/2
+  x509SVIDTTL: 0s
+`, out.String())
+
+	// Exporting leaves the entries alone.
+	assert.ElementsMatch(t, []string{"legacy-1", "legacy-2", "prefix.managed"}, spireEntryIDs(spire))
+
+	// Only entries under the parent ID are exported.
+	n, err = export(context.Background(), spireClient, entryexport.Filter{ParentID: spiffeid.RequireFromString("spiffe://example.org/other")}, "class", new(bytes.Buffer))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestRetag(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	spire := spirefake.Start(t, spirefake.Config{TrustDomain: td})
+	spire.SetEntries(
+		makeSeedEntry("legacy-1", "spiffe://example.org/legacy/1"),
+		makeSeedEntry("legacy-2", "spiffe://example.org/legacy/2"),
+		makeSeedEntry("prefix.managed", "spiffe://example.org/legacy/3"),
+	)
+	spireClient, err := spireapi.DialSocket(spire.SocketPath())
+	require.NoError(t, err)
+	defer spireClient.Close()
+
+	clusterStaticEntry := func(id string) *spirev1alpha1.ClusterStaticEntry {
+		return &spirev1alpha1.ClusterStaticEntry{
+			ObjectMeta: metav1.ObjectMeta{Name: id},
+			Spec: spirev1alpha1.ClusterStaticEntrySpec{
+				SPIFFEID:  "spiffe://example.org/legacy/" + strings.TrimPrefix(id, "legacy-"),
+				ParentID:  "spiffe://example.org/parent",
+				Selectors: []string{"unix:uid:" + id},
+			},
+		}
+	}
+	config := spireentry.ReconcilerConfig{
+		TrustDomain:    td,
+		ClusterName:    "cluster",
+		EntryClient:    spireClient,
+		EntryIDPrefix:  "prefix.",
+		WatchClassless: true,
+		Reconcile:      spirev1alpha1.ReconcileConfig{ClusterStaticEntries: true},
+	}
+	filter := entryexport.Filter{WithoutIDPrefix: "prefix."}
+
+	// Nothing is retagged until every entry is declared in the cluster.
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(clusterStaticEntry("legacy-1")).Build()
+	_, err = retag(context.Background(), config, k8sClient, filter)
+	assert.EqualError(t, err, "entries are not declared by a ClusterStaticEntry in the cluster; apply the exported manifests before retagging: legacy-2")
+	assert.ElementsMatch(t, []string{"legacy-1", "legacy-2", "prefix.managed"}, spireEntryIDs(spire))
+
+	k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(clusterStaticEntry("legacy-1"), clusterStaticEntry("legacy-2")).Build()
+	n, err := retag(context.Background(), config, k8sClient, filter)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"prefix.legacy-1", "prefix.legacy-2", "prefix.managed"}, spireEntryIDs(spire))
+}
+
+func spireEntryIDs(spire *spirefake.Server) []string {
+	var ids []string
+	for _, entry := range spire.Entries() {
+		ids = append(ids, entry.Id)
+	}
+	return ids
+}
+
+func TestRunExportUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"extra"},
+		{"-parent-id", "not-a-spiffe-id"},
+		{"-spiffe-id-regex", "("},
+		{"-retag"},
+	} {
+		code := runExport(args, new(bytes.Buffer), new(bytes.Buffer))
+		assert.Equal(t, 2, code, args)
+	}
+}
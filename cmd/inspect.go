@@ -0,0 +1,356 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+)
+
+var errNoEntries = errors.New("no entries found")
+
+// inspectQuery is what the inspect command is asked about. Exactly one of
+// the fields is set.
+type inspectQuery struct {
+	EntryID  string
+	SPIFFEID spiffeid.ID
+	Pod      types.NamespacedName
+}
+
+// inspectOutput is what the inspect command prints.
+type inspectOutput struct {
+	Entries          []inspectOutputEntry    `json:"entries"`
+	ClusterSPIFFEIDs []inspectOutputPodMatch `json:"clusterSPIFFEIDs,omitempty"`
+}
+
+type inspectOutputEntry struct {
+	Action         string              `json:"action"`
+	OutdatedFields []string            `json:"outdatedFields,omitempty"`
+	Declared       []renderOutputEntry `json:"declared,omitempty"`
+	Current        []renderOutputEntry `json:"current,omitempty"`
+	Deleted        []string            `json:"deleted,omitempty"`
+	Rekeyed        []string            `json:"rekeyed,omitempty"`
+	Retiring       []string            `json:"retiring,omitempty"`
+}
+
+type inspectOutputPodMatch struct {
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	Reason  string `json:"reason"`
+}
+
+// runInspect implements the inspect command, which explains which objects
+// declare the entries for an entry ID, SPIFFE ID or pod, how they compare
+// to the entries on SPIRE Server and, for a pod, why each ClusterSPIFFEID
+// does or does not apply to it. Nothing is written to the cluster or to
+// SPIRE Server. It returns the process exit code.
+func runInspect(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var configFileFlag string
+	var expandEnvFlag bool
+	var kubeconfigFlag string
+	var spireAPISocketFlag string
+	var trustDomainFlag string
+	var clusterNameFlag string
+	var clusterDomainFlag string
+	var entryIDFlag string
+	var spiffeIDFlag string
+	var podFlag string
+	var unsupportedFieldsFlag string
+	var outputFlag string
+	flags.StringVar(&configFileFlag, "config", "", "The controller manager config file to inspect with. Flags override configuration from this file.")
+	flags.BoolVar(&expandEnvFlag, "expand-env", false, "Expand environment variables in SPIRE Controller Manager config file")
+	flags.StringVar(&kubeconfigFlag, "kubeconfig", "", "The kubeconfig file to connect to the cluster with. Defaults to the same lookup as kubectl.")
+	flags.StringVar(&spireAPISocketFlag, "spire-api-socket", "", "The path to the SPIRE API socket. Defaults to the socket in the config file, or "+defaultSPIREServerSocketPath)
+	flags.StringVar(&trustDomainFlag, "trust-domain", "", "The trust domain of the SPIRE Server")
+	flags.StringVar(&clusterNameFlag, "cluster-name", "", "The cluster name entries are declared with")
+	flags.StringVar(&clusterDomainFlag, "cluster-domain", "", "The cluster domain DNS names are rendered with")
+	flags.StringVar(&entryIDFlag, "entry-id", "", "Inspect the entry with this ID")
+	flags.StringVar(&spiffeIDFlag, "spiffe-id", "", "Inspect the entries with this SPIFFE ID")
+	flags.StringVar(&podFlag, "pod", "", "Inspect the entries for the pod, given as namespace/name")
+	flags.StringVar(&unsupportedFieldsFlag, "unsupported-fields", "", "Comma-separated entry fields that SPIRE Server does not support ("+strings.Join(probedFieldNames(), ", ")+"). Other fields are treated as supported.")
+	flags.StringVar(&outputFlag, "o", "yaml", "The output format, either yaml or json")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s inspect (-entry-id <id> | -spiffe-id <id> | -pod <namespace/name>) [flags]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(stderr, "Explains which ClusterSPIFFEIDs and ClusterStaticEntries declare the entries for an")
+		fmt.Fprintln(stderr, "entry ID, SPIFFE ID or pod, whether they are masked, and what the next reconcile would")
+		fmt.Fprintln(stderr, "change on SPIRE Server. For a pod, also explains why each ClusterSPIFFEID does or does")
+		fmt.Fprintln(stderr, "not apply to it. No entries are changed on SPIRE Server.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	query, err := parseInspectQuery(entryIDFlag, spiffeIDFlag, podFlag)
+	if err != nil || flags.NArg() > 0 {
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+		flags.Usage()
+		return 2
+	}
+	if outputFlag != "yaml" && outputFlag != "json" {
+		fmt.Fprintf(stderr, "invalid output format %q: expected yaml or json\n", outputFlag)
+		return 2
+	}
+	unsupportedFields, err := parseUnsupportedFields(unsupportedFieldsFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		flags.Usage()
+		return 2
+	}
+
+	mainConfig, config, err := renderConfig(configFileFlag, expandEnvFlag, trustDomainFlag, clusterNameFlag, clusterDomainFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	k8sClient, err := newClusterClient(kubeconfigFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	spireClient, err := dialSPIREServer(mainConfig, spireAPISocketFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer spireClient.Close()
+	config.EntryClient = spireClient
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = log.IntoContext(ctx, zap.New(zap.WriteTo(stderr)))
+
+	out, err := inspect(ctx, config, k8sClient, query, unsupportedFields)
+	switch {
+	case errors.Is(err, errNoEntries):
+		fmt.Fprintln(stderr, "No entries found")
+		return 1
+	case err != nil:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	data, err := marshalOutput(out, outputFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to marshal output: %v\n", err)
+		return 1
+	}
+	if _, err := stdout.Write(data); err != nil {
+		fmt.Fprintf(stderr, "failed to write output: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// probedFields are the entry fields the manager probes SPIRE Server
+// support for.
+var probedFields = []spireapi.Field{
+	spireapi.JWTSVIDTTLField,
+	spireapi.HintField,
+	spireapi.StoreSVIDField,
+}
+
+func probedFieldNames() []string {
+	names := make([]string, 0, len(probedFields))
+	for _, field := range probedFields {
+		names = append(names, string(field))
+	}
+	return names
+}
+
+// parseUnsupportedFields parses a comma-separated list of the fields SPIRE
+// Server does not support.
+func parseUnsupportedFields(value string) (map[spireapi.Field]struct{}, error) {
+	unsupportedFields := make(map[spireapi.Field]struct{})
+	if value == "" {
+		return unsupportedFields, nil
+	}
+	for _, name := range strings.Split(value, ",") {
+		field := spireapi.Field(strings.TrimSpace(name))
+		if !slices.Contains(probedFields, field) {
+			return nil, fmt.Errorf("invalid unsupported field %q: expected one of %s", field, strings.Join(probedFieldNames(), ", "))
+		}
+		unsupportedFields[field] = struct{}{}
+	}
+	return unsupportedFields, nil
+}
+
+func parseInspectQuery(entryID, spiffeID, pod string) (inspectQuery, error) {
+	var query inspectQuery
+	var set int
+	if entryID != "" {
+		query.EntryID = entryID
+		set++
+	}
+	if spiffeID != "" {
+		id, err := spiffeid.FromString(spiffeID)
+		if err != nil {
+			return inspectQuery{}, fmt.Errorf("invalid SPIFFE ID %q: %w", spiffeID, err)
+		}
+		query.SPIFFEID = id
+		set++
+	}
+	if pod != "" {
+		namespace, name, ok := strings.Cut(pod, "/")
+		if !ok || namespace == "" || name == "" {
+			return inspectQuery{}, fmt.Errorf("invalid pod %q: expected namespace/name", pod)
+		}
+		query.Pod = types.NamespacedName{Namespace: namespace, Name: name}
+		set++
+	}
+	if set != 1 {
+		return inspectQuery{}, errors.New("exactly one of -entry-id, -spiffe-id or -pod is required")
+	}
+	return query, nil
+}
+
+// newClusterClient returns a client for the cluster in the kubeconfig file,
+// or found the same way as kubectl if no file is given.
+func newClusterClient(kubeconfig string) (client.Client, error) {
+	var restConfig *rest.Config
+	var err error
+	if kubeconfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		restConfig, err = ctrl.GetConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster configuration: %w", err)
+	}
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create an API client: %w", err)
+	}
+	return k8sClient, nil
+}
+
+// dialSPIREServer dials the SPIRE Server socket given by the flag, if set,
+// or by the configuration.
+func dialSPIREServer(mainConfig Config, socketPath string) (spireapi.Client, error) {
+	if socketPath == "" {
+		socketPath = mainConfig.ctrlConfig.SPIREServerSocketPath
+	}
+	if socketPath == "" {
+		socketPath = defaultSPIREServerSocketPath
+	}
+	spireClient, err := spireapi.DialSocketWithConfig(socketPath, spireapi.ClientConfig{
+		RPCTimeout:       mainConfig.ctrlConfig.SPIREServerClient.RPCTimeout.Duration,
+		KeepaliveTime:    mainConfig.ctrlConfig.SPIREServerClient.KeepaliveTime.Duration,
+		KeepaliveTimeout: mainConfig.ctrlConfig.SPIREServerClient.KeepaliveTimeout.Duration,
+		MaxListAttempts:  mainConfig.ctrlConfig.SPIREServerClient.MaxListAttempts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial SPIRE Server socket: %w", err)
+	}
+	return spireClient, nil
+}
+
+// inspect lists the objects entries are declared from in the cluster and
+// inspects them against the entries on SPIRE Server to answer the query.
+func inspect(ctx context.Context, config spireentry.ReconcilerConfig, k8sClient client.Client, query inspectQuery, unsupportedFields map[spireapi.Field]struct{}) (*inspectOutput, error) {
+	input, err := spireentry.ListRenderInput(ctx, k8sClient)
+	if err != nil {
+		return nil, err
+	}
+	inspection, err := spireentry.Inspect(ctx, config, input, unsupportedFields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect entries: %w", err)
+	}
+
+	out := &inspectOutput{}
+	var inspected []spireentry.InspectedEntry
+	switch {
+	case query.EntryID != "":
+		inspected = inspection.ByEntryID(query.EntryID)
+	case !query.SPIFFEID.IsZero():
+		inspected = inspection.BySPIFFEID(query.SPIFFEID)
+	default:
+		explanation, err := inspection.ExplainPod(ctx, query.Pod.Namespace, query.Pod.Name)
+		if err != nil {
+			return nil, err
+		}
+		inspected = explanation.Entries
+		for _, match := range explanation.ClusterSPIFFEIDs {
+			out.ClusterSPIFFEIDs = append(out.ClusterSPIFFEIDs, inspectOutputPodMatch{
+				Name:    match.ClusterSPIFFEID,
+				Applied: match.Applied,
+				Reason:  match.Reason,
+			})
+		}
+	}
+	// A pod that no ClusterSPIFFEID applies to is still worth explaining.
+	if len(inspected) == 0 && len(out.ClusterSPIFFEIDs) == 0 {
+		return nil, errNoEntries
+	}
+
+	out.Entries = make([]inspectOutputEntry, 0, len(inspected))
+	for _, entry := range inspected {
+		out.Entries = append(out.Entries, newInspectOutputEntry(entry))
+	}
+	return out, nil
+}
+
+func newInspectOutputEntry(inspected spireentry.InspectedEntry) inspectOutputEntry {
+	outEntry := inspectOutputEntry{
+		Action: string(inspected.Action),
+	}
+	for _, field := range inspected.OutdatedFields {
+		outEntry.OutdatedFields = append(outEntry.OutdatedFields, string(field))
+	}
+	for _, declared := range inspected.Declared {
+		outEntry.Declared = append(outEntry.Declared, newRenderedOutputEntry(declared))
+	}
+	for _, current := range inspected.Current {
+		outEntry.Current = append(outEntry.Current, newOutputEntry(current))
+	}
+	for _, deleted := range inspected.Deleted {
+		outEntry.Deleted = append(outEntry.Deleted, deleted.ID)
+	}
+	for _, rekeyed := range inspected.Rekeyed {
+		outEntry.Rekeyed = append(outEntry.Rekeyed, rekeyed.ID)
+	}
+	for _, retiring := range inspected.Retiring {
+		outEntry.Retiring = append(outEntry.Retiring, retiring.ID)
+	}
+	return outEntry
+}
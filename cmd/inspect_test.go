@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+	"github.com/spiffe/spire-controller-manager/pkg/test/spirefake"
+)
+
+func TestInspect(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	spire := spirefake.Start(t, spirefake.Config{TrustDomain: td})
+	spire.SetEntries(
+		&apitypes.Entry{
+			Id:        "current",
+			SpiffeId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: "/ns/workload/sa/sa"},
+			ParentId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: "/spire/agent/k8s_psat/cluster/node-uid"},
+			Selectors: []*apitypes.Selector{{Type: "k8s", Value: "pod-uid:pod-uid"}},
+			Hint:      "stale",
+		},
+		makeSeedEntry("undeclared", "spiffe://example.org/old"),
+	)
+	spireClient, err := spireapi.DialSocket(spire.SocketPath())
+	require.NoError(t, err)
+	defer spireClient.Close()
+
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&spirev1alpha1.ClusterSPIFFEID{
+			ObjectMeta: metav1.ObjectMeta{Name: "workloads", UID: "workloads"},
+			Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+				SPIFFEIDTemplate: "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}",
+			},
+		},
+		&spirev1alpha1.ClusterSPIFFEID{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", UID: "db"},
+			Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+				SPIFFEIDTemplate: "spiffe://{{ .TrustDomain }}/db",
+				PodSelector:      &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "workload", UID: "workload"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: "pod", UID: "pod-uid"},
+			Spec:       corev1.PodSpec{NodeName: "node", ServiceAccountName: "sa"},
+		},
+	).Build()
+
+	config := spireentry.ReconcilerConfig{
+		TrustDomain:    td,
+		ClusterName:    "cluster",
+		ClusterDomain:  "cluster.local",
+		EntryClient:    spireClient,
+		WatchClassless: true,
+		Reconcile: spirev1alpha1.ReconcileConfig{
+			ClusterSPIFFEIDs:     true,
+			ClusterStaticEntries: true,
+		},
+	}
+
+	currentEntry := renderOutputEntry{
+		ID:        "current",
+		SPIFFEID:  "spiffe://example.org/ns/workload/sa/sa",
+		ParentID:  "spiffe://example.org/spire/agent/k8s_psat/cluster/node-uid",
+		Selectors: []string{"k8s:pod-uid:pod-uid"},
+		Hint:      "stale",
+	}
+	declaredEntry := renderOutputEntry{
+		SPIFFEID:   "spiffe://example.org/ns/workload/sa/sa",
+		ParentID:   "spiffe://example.org/spire/agent/k8s_psat/cluster/node-uid",
+		Selectors:  []string{"k8s:pod-uid:pod-uid"},
+		DeclaredBy: "ClusterSPIFFEID/workloads",
+	}
+
+	for _, test := range []struct {
+		name        string
+		query       inspectQuery
+		expectedOut *inspectOutput
+		expectedErr string
+	}{
+		{
+			name:  "by entry ID",
+			query: inspectQuery{EntryID: "current"},
+			expectedOut: &inspectOutput{
+				Entries: []inspectOutputEntry{{
+					Action:         "update",
+					OutdatedFields: []string{"hint"},
+					Declared:       []renderOutputEntry{declaredEntry},
+					Current:        []renderOutputEntry{currentEntry},
+				}},
+			},
+		},
+		{
+			name:  "by SPIFFE ID",
+			query: inspectQuery{SPIFFEID: spiffeid.RequireFromString("spiffe://example.org/old")},
+			expectedOut: &inspectOutput{
+				Entries: []inspectOutputEntry{{
+					Action: "delete",
+					Current: []renderOutputEntry{{
+						ID:        "undeclared",
+						SPIFFEID:  "spiffe://example.org/old",
+						ParentID:  "spiffe://example.org/parent",
+						Selectors: []string{"unix:uid:undeclared"},
+					}},
+					Deleted: []string{"undeclared"},
+				}},
+			},
+		},
+		{
+			name:  "pod",
+			query: inspectQuery{Pod: types.NamespacedName{Namespace: "workload", Name: "pod"}},
+			expectedOut: &inspectOutput{
+				Entries: []inspectOutputEntry{{
+					Action:         "update",
+					OutdatedFields: []string{"hint"},
+					Declared:       []renderOutputEntry{declaredEntry},
+					Current:        []renderOutputEntry{currentEntry},
+				}},
+				ClusterSPIFFEIDs: []inspectOutputPodMatch{
+					{Name: "db", Reason: `podSelector "app=db" does not match the labels of the pod`},
+					{Name: "workloads", Applied: true, Reason: "declares entry for spiffe://example.org/ns/workload/sa/sa"},
+				},
+			},
+		},
+		{
+			name:        "no entries",
+			query:       inspectQuery{EntryID: "missing"},
+			expectedErr: "no entries found",
+		},
+		{
+			name:        "pod not found",
+			query:       inspectQuery{Pod: types.NamespacedName{Namespace: "workload", Name: "missing"}},
+			expectedErr: "pod workload/missing not found",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := inspect(context.Background(), config, k8sClient, test.query, nil)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedOut, out)
+		})
+	}
+
+	// Inspecting never writes to SPIRE Server.
+	assert.Len(t, spire.Entries(), 2)
+	assert.Zero(t, spire.Calls(spirefake.BatchCreateEntryMethod))
+	assert.Zero(t, spire.Calls(spirefake.BatchUpdateEntryMethod))
+	assert.Zero(t, spire.Calls(spirefake.BatchDeleteEntryMethod))
+}
+
+func TestParseUnsupportedFields(t *testing.T) {
+	unsupportedFields, err := parseUnsupportedFields("")
+	require.NoError(t, err)
+	assert.Empty(t, unsupportedFields)
+
+	unsupportedFields, err = parseUnsupportedFields("hint, storeSVID")
+	require.NoError(t, err)
+	assert.Equal(t, map[spireapi.Field]struct{}{spireapi.HintField: {}, spireapi.StoreSVIDField: {}}, unsupportedFields)
+
+	_, err = parseUnsupportedFields("admin")
+	assert.EqualError(t, err, `invalid unsupported field "admin": expected one of jwtSVIDTTL, hint, storeSVID`)
+}
+
+func TestRunInspectUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"-entry-id", "id", "-pod", "workload/pod"},
+		{"-pod", "pod"},
+		{"-spiffe-id", "not-a-spiffe-id"},
+		{"-pod", "workload/pod", "-unsupported-fields", "hint,admin"},
+	} {
+		stderr := new(bytes.Buffer)
+		code := runInspect(args, new(bytes.Buffer), stderr)
+		assert.Equal(t, 2, code, args)
+		assert.Contains(t, stderr.String(), "Usage:", args)
+	}
+}
@@ -17,11 +17,14 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -32,14 +35,18 @@ import (
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	"k8s.io/client-go/kubernetes"
+	admissionregistrationapiv1 "k8s.io/client-go/kubernetes/typed/admissionregistration/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 
+	uberzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -49,11 +56,14 @@ import (
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
 	"github.com/spiffe/spire-controller-manager/internal/controller"
+	"github.com/spiffe/spire-controller-manager/pkg/audit"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
 	"github.com/spiffe/spire-controller-manager/pkg/metrics"
 	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
 	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
 	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
 	"github.com/spiffe/spire-controller-manager/pkg/spirefederationrelationship"
+	"github.com/spiffe/spire-controller-manager/pkg/tracing"
 	"github.com/spiffe/spire-controller-manager/pkg/webhookmanager"
 	//+kubebuilder:scaffold:imports
 )
@@ -64,12 +74,26 @@ type Config struct {
 	ignoreNamespacesRegex []*regexp.Regexp
 	parentIDTemplate      *template.Template
 	reconcile             spirev1alpha1.ReconcileConfig
+
+	// configFile and expandEnv, or configObject, are where the config was
+	// loaded from, and loadedCtrlConfig the config as loaded, so that changes
+	// can be reloaded.
+	configFile       string
+	expandEnv        bool
+	configObject     client.ObjectKey
+	loadedCtrlConfig spirev1alpha1.ControllerManagerConfig
+	logLevel         uberzap.AtomicLevel
 }
 
 const (
-	defaultSPIREServerSocketPath = "/spire-server/api.sock"
-	defaultGCInterval            = 10 * time.Second
-	k8sDefaultService            = "kubernetes.default.svc"
+	defaultSPIREServerSocketPath  = "/spire-server/api.sock"
+	defaultGCInterval             = 10 * time.Second
+	defaultReconcileTimeout       = time.Minute
+	defaultSPIREServerRPCTimeout  = 30 * time.Second
+	defaultMaxListAttempts        = 3
+	defaultTracingSamplingPercent = 100
+	k8sDefaultService             = "kubernetes.default.svc"
+	debugEntriesPath              = "/debug/entries"
 )
 
 var (
@@ -84,11 +108,33 @@ func init() {
 
 	k8sMetrics.Registry.MustRegister(
 		metrics.PromCounters[metrics.StaticEntryFailures],
+		metrics.PromCounterVecs[metrics.OutdatedEntryFields],
+		metrics.PromCounters[metrics.EntryCacheDivergences],
+		metrics.PromCounters[metrics.EntryIDPrefixRekeys],
+		metrics.PromGauges[metrics.RetiringEntries],
+		metrics.PromProfileGaugeVecs[metrics.RetiringEntries],
+		metrics.PromCounterVecs[metrics.AuditEventFailures],
+		metrics.PromHistogramVecs[metrics.SPIREAPIRequestDuration],
 	)
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(runRender(os.Args[2:], os.Stdout, os.Stderr))
+		case "validate-config":
+			os.Exit(runValidateConfig(os.Args[2:], os.Stdout, os.Stderr))
+		case "inspect":
+			os.Exit(runInspect(os.Args[2:], os.Stdout, os.Stderr))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:], os.Stdout, os.Stderr))
+		case "export":
+			os.Exit(runExport(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
 	mainConfig, err := parseConfig()
 	if err != nil {
 		setupLog.Error(err, "error parsing configuration")
@@ -107,39 +153,69 @@ func addDotSuffix(val string) string {
 	return val
 }
 
+// defaultControllerManagerConfig returns the configuration used for any
+// values not set in the config file.
+func defaultControllerManagerConfig() spirev1alpha1.ControllerManagerConfig {
+	return spirev1alpha1.ControllerManagerConfig{
+		IgnoreNamespaces:                   []string{"kube-system", "kube-public", "spire-system"},
+		GCInterval:                         defaultGCInterval,
+		ValidatingWebhookConfigurationName: "spire-controller-manager-webhook",
+		ReconcileTimeout:                   metav1.Duration{Duration: defaultReconcileTimeout},
+		SPIREServerClient: spirev1alpha1.SPIREServerClientConfig{
+			RPCTimeout:      metav1.Duration{Duration: defaultSPIREServerRPCTimeout},
+			MaxListAttempts: defaultMaxListAttempts,
+		},
+		Tracing: spirev1alpha1.TracingConfig{
+			SamplingPercent: defaultTracingSamplingPercent,
+		},
+	}
+}
+
 func parseConfig() (Config, error) {
-	var retval Config
 	var configFileFlag string
+	var configObjectFlag string
 	var spireAPISocketFlag string
 	var expandEnvFlag bool
 	flag.StringVar(&configFileFlag, "config", "",
 		"The controller will load its initial configuration from this file. "+
 			"Omit this flag to use the default configuration values. "+
 			"Command-line flags override configuration from this file.")
+	flag.StringVar(&configObjectFlag, "config-object", "",
+		"The controller will load its configuration from this ControllerManagerConfig object, "+
+			"given as <namespace>/<name>, instead of a file.")
 	flag.StringVar(&spireAPISocketFlag, "spire-api-socket", "", "The path to the SPIRE API socket (deprecated; use the config file)")
 	flag.BoolVar(&expandEnvFlag, "expand-env", false, "Expand environment variables in SPIRE Controller Manager config file")
 	flag.Parse()
 
-	// Set default values
-	retval.ctrlConfig = spirev1alpha1.ControllerManagerConfig{
-		IgnoreNamespaces:                   []string{"kube-system", "kube-public", "spire-system"},
-		GCInterval:                         defaultGCInterval,
-		ValidatingWebhookConfigurationName: "spire-controller-manager-webhook",
-	}
-
-	retval.options = ctrl.Options{Scheme: scheme}
-
-	if configFileFlag != "" {
-		if err := spirev1alpha1.LoadOptionsFromFile(configFileFlag, scheme, &retval.options, &retval.ctrlConfig, expandEnvFlag); err != nil {
-			return retval, fmt.Errorf("unable to load the config file: %w", err)
+	var retval Config
+	if configObjectFlag != "" {
+		if configFileFlag != "" {
+			return retval, errors.New("the config and config-object flags cannot be used together")
 		}
-		for _, ignoredNamespace := range retval.ctrlConfig.IgnoreNamespaces {
-			regex, err := regexp.Compile(ignoredNamespace)
-			if err != nil {
-				return retval, fmt.Errorf("unable to compile ignore namespaces regex: %w", err)
-			}
-
-			retval.ignoreNamespacesRegex = append(retval.ignoreNamespacesRegex, regex)
+		configObject, err := parseConfigObjectKey(configObjectFlag)
+		if err != nil {
+			return retval, err
+		}
+		retval, err = loadConfigObjectFromCluster(configObject)
+		if err != nil {
+			return retval, err
+		}
+		retval.configObject = configObject
+	} else {
+		var err error
+		retval, err = loadConfig(configFileFlag, expandEnvFlag)
+		if err != nil {
+			return retval, err
+		}
+		retval.configFile = configFileFlag
+		retval.expandEnv = expandEnvFlag
+	}
+	retval.loadedCtrlConfig = *retval.ctrlConfig.DeepCopy()
+	if configFileFlag != "" || configObjectFlag != "" {
+		var errs []error
+		retval.ignoreNamespacesRegex, errs = compileIgnoreNamespaces(retval.ctrlConfig.IgnoreNamespaces)
+		if len(errs) > 0 {
+			return retval, errors.Join(errs...)
 		}
 	}
 
@@ -148,8 +224,10 @@ func parseConfig() (Config, error) {
 	if err != nil {
 		return retval, fmt.Errorf("unable to parse log level: %w", err)
 	}
+	// The level is atomic so that it can be changed by a config reload.
+	retval.logLevel = uberzap.NewAtomicLevelAt(logLevel)
 	opts := zap.Options{
-		Level:       logLevel,
+		Level:       retval.logLevel,
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
@@ -183,11 +261,108 @@ func parseConfig() (Config, error) {
 		retval.ctrlConfig.ClusterDomain = clusterDomain
 	}
 
+	printCleanup := "<unset>"
+	if retval.ctrlConfig.EntryIDPrefixCleanup != nil {
+		printCleanup = *retval.ctrlConfig.EntryIDPrefixCleanup
+	}
+
+	errs := completeConfig(&retval)
+
+	setupLog.Info("Config loaded",
+		"cluster name", retval.ctrlConfig.ClusterName,
+		"cluster domain", retval.ctrlConfig.ClusterDomain,
+		"trust domain", retval.ctrlConfig.TrustDomain,
+		"ignore namespaces", retval.ctrlConfig.IgnoreNamespaces,
+		"gc interval", retval.ctrlConfig.GCInterval,
+		"spire server socket path", retval.ctrlConfig.SPIREServerSocketPath,
+		"trust domain profiles", trustDomainProfileNames(retval.ctrlConfig.TrustDomainProfiles),
+		"class name", retval.ctrlConfig.ClassName,
+		"handle crs without class name", retval.ctrlConfig.WatchClassless,
+		"reconcile ClusterSPIFFEIDs", retval.reconcile.ClusterSPIFFEIDs,
+		"reconcile ClusterFederatedTrustDomains", retval.reconcile.ClusterFederatedTrustDomains,
+		"reconcile ClusterStaticEntries", retval.reconcile.ClusterStaticEntries,
+		"entryIDPrefix", retval.ctrlConfig.EntryIDPrefix,
+		"entryIDPrefixCleanup", printCleanup,
+		"entry retirement grace period", retval.ctrlConfig.EntryRetirementGracePeriod.Duration,
+		"entry render workers", retval.ctrlConfig.EntryRenderWorkers,
+		"list entries by parent ID", retval.ctrlConfig.ListEntriesByParentID,
+		"check entry revisions", retval.ctrlConfig.CheckEntryRevisions,
+		"reconcile timeout", retval.ctrlConfig.ReconcileTimeout.Duration,
+		"spire server rpc timeout", retval.ctrlConfig.SPIREServerClient.RPCTimeout.Duration,
+		"spire server keepalive time", retval.ctrlConfig.SPIREServerClient.KeepaliveTime.Duration,
+		"spire server keepalive timeout", retval.ctrlConfig.SPIREServerClient.KeepaliveTimeout.Duration,
+		"spire server max list attempts", retval.ctrlConfig.SPIREServerClient.MaxListAttempts,
+		"tracing endpoint", retval.ctrlConfig.Tracing.Endpoint,
+		"tracing insecure", retval.ctrlConfig.Tracing.Insecure,
+		"tracing sampling percent", retval.ctrlConfig.Tracing.SamplingPercent,
+		"audit stdout", retval.ctrlConfig.Audit.Stdout,
+		"audit file", retval.ctrlConfig.Audit.File != nil,
+		"audit webhook", retval.ctrlConfig.Audit.Webhook != nil)
+
+	if retval.ctrlConfig.ControllerManagerConfigurationSpec.Webhook.CertDir != "" {
+		setupLog.Info("certDir configuration is ignored", "certDir", retval.ctrlConfig.ControllerManagerConfigurationSpec.Webhook.CertDir)
+	}
+
+	return retval, errors.Join(errs...)
+}
+
+// loadConfig loads the configuration from the config file, if any, on top of
+// the default values.
+func loadConfig(configFile string, expandEnv bool) (Config, error) {
+	retval := Config{
+		ctrlConfig: defaultControllerManagerConfig(),
+		options:    ctrl.Options{Scheme: scheme},
+	}
+	if configFile != "" {
+		if err := spirev1alpha1.LoadOptionsFromFile(configFile, scheme, &retval.options, &retval.ctrlConfig, expandEnv); err != nil {
+			return retval, fmt.Errorf("unable to load the config file: %w", err)
+		}
+	}
+	return retval, nil
+}
+
+// loadConfigObjectFromCluster loads the configuration from a
+// ControllerManagerConfig object, read with a client of its own since the
+// manager, and its client, are created from the configuration.
+func loadConfigObjectFromCluster(configObject client.ObjectKey) (Config, error) {
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to get the Kubernetes client configuration: %w", err)
+	}
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to create a Kubernetes client: %w", err)
+	}
+	return loadConfigObject(context.Background(), k8sClient, configObject)
+}
+
+// compileIgnoreNamespaces compiles the ignore namespaces regexes, returning
+// an error for each one that is invalid.
+func compileIgnoreNamespaces(ignoreNamespaces []string) ([]*regexp.Regexp, []error) {
+	var regexes []*regexp.Regexp
+	var errs []error
+	for _, ignoredNamespace := range ignoreNamespaces {
+		regex, err := regexp.Compile(ignoredNamespace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to compile ignore namespaces regex: %w", err))
+			continue
+		}
+		regexes = append(regexes, regex)
+	}
+	return regexes, errs
+}
+
+// completeConfig fills in the parts of the configuration derived from the
+// controller manager config and validates it. Every problem found is
+// returned so that they can be reported at once.
+func completeConfig(retval *Config) []error {
+	var errs []error
+
 	if retval.ctrlConfig.ParentIDTemplate != "" {
 		var err error
 		retval.parentIDTemplate, err = template.New("customParentIDTemplate").Parse(retval.ctrlConfig.ParentIDTemplate)
 		if err != nil {
-			return retval, fmt.Errorf("unable to parse parent ID template: %w", err)
+			errs = append(errs, fmt.Errorf("unable to parse parent ID template: %w", err))
 		}
 	}
 
@@ -200,65 +375,285 @@ func parseConfig() (Config, error) {
 	}
 
 	retval.ctrlConfig.EntryIDPrefix = addDotSuffix(retval.ctrlConfig.EntryIDPrefix)
-
-	printCleanup := "<unset>"
 	if retval.ctrlConfig.EntryIDPrefixCleanup != nil {
-		printCleanup = *retval.ctrlConfig.EntryIDPrefixCleanup
 		*retval.ctrlConfig.EntryIDPrefixCleanup = addDotSuffix(*retval.ctrlConfig.EntryIDPrefixCleanup)
 		if retval.ctrlConfig.EntryIDPrefix != "" && retval.ctrlConfig.EntryIDPrefix == *retval.ctrlConfig.EntryIDPrefixCleanup {
-			return retval, fmt.Errorf("if entryIDPrefixCleanup is specified, it can not be the same value as entryIDPrefix")
+			errs = append(errs, errors.New("if entryIDPrefixCleanup is specified, it can not be the same value as entryIDPrefix"))
 		}
 	}
+	if retval.ctrlConfig.EntryRetirementGracePeriod.Duration < 0 {
+		errs = append(errs, errors.New("entry retirement grace period must not be negative"))
+	}
 
-	setupLog.Info("Config loaded",
-		"cluster name", retval.ctrlConfig.ClusterName,
-		"cluster domain", retval.ctrlConfig.ClusterDomain,
-		"trust domain", retval.ctrlConfig.TrustDomain,
-		"ignore namespaces", retval.ctrlConfig.IgnoreNamespaces,
-		"gc interval", retval.ctrlConfig.GCInterval,
-		"spire server socket path", retval.ctrlConfig.SPIREServerSocketPath,
-		"class name", retval.ctrlConfig.ClassName,
-		"handle crs without class name", retval.ctrlConfig.WatchClassless,
-		"reconcile ClusterSPIFFEIDs", retval.reconcile.ClusterSPIFFEIDs,
-		"reconcile ClusterFederatedTrustDomains", retval.reconcile.ClusterFederatedTrustDomains,
-		"reconcile ClusterStaticEntries", retval.reconcile.ClusterStaticEntries,
-		"entryIDPrefix", retval.ctrlConfig.EntryIDPrefix,
-		"entryIDPrefixCleanup", printCleanup)
+	if retval.ctrlConfig.TrustDomain == "" {
+		errs = append(errs, errors.New("trust domain is required configuration"))
+	} else if _, err := spiffeid.TrustDomainFromString(retval.ctrlConfig.TrustDomain); err != nil {
+		errs = append(errs, fmt.Errorf("invalid trust domain name: %w", err))
+	}
+	errs = append(errs, validateTrustDomainProfiles(retval.ctrlConfig)...)
+	if retval.ctrlConfig.ClusterName == "" {
+		errs = append(errs, errors.New("cluster name is required configuration"))
+	}
+	if retval.ctrlConfig.ValidatingWebhookConfigurationName == "" {
+		errs = append(errs, errors.New("validating webhook configuration name is required configuration"))
+	}
+	if retval.ctrlConfig.EntryRenderWorkers < 0 {
+		errs = append(errs, errors.New("entry render workers must not be negative"))
+	}
+	if retval.ctrlConfig.ReconcileTimeout.Duration < 0 {
+		errs = append(errs, errors.New("reconcile timeout must not be negative"))
+	}
+	if retval.ctrlConfig.SPIREServerClient.RPCTimeout.Duration < 0 {
+		errs = append(errs, errors.New("SPIRE server RPC timeout must not be negative"))
+	}
+	if retval.ctrlConfig.SPIREServerClient.KeepaliveTime.Duration < 0 {
+		errs = append(errs, errors.New("SPIRE server keepalive time must not be negative"))
+	}
+	if retval.ctrlConfig.SPIREServerClient.KeepaliveTimeout.Duration < 0 {
+		errs = append(errs, errors.New("SPIRE server keepalive timeout must not be negative"))
+	}
+	if retval.ctrlConfig.SPIREServerClient.MaxListAttempts < 1 || retval.ctrlConfig.SPIREServerClient.MaxListAttempts > 5 {
+		errs = append(errs, errors.New("SPIRE server max list attempts must be between 1 and 5"))
+	}
+	if retval.ctrlConfig.Tracing.SamplingPercent < 0 || retval.ctrlConfig.Tracing.SamplingPercent > 100 {
+		errs = append(errs, errors.New("tracing sampling percent must be between 0 and 100"))
+	}
+	errs = append(errs, validateAuditConfig(retval.ctrlConfig.Audit)...)
+	return errs
+}
 
-	switch {
-	case retval.ctrlConfig.TrustDomain == "":
-		setupLog.Error(nil, "trust domain is required configuration")
-		return retval, errors.New("trust domain is required configuration")
-	case retval.ctrlConfig.ClusterName == "":
-		return retval, errors.New("cluster name is required configuration")
-	case retval.ctrlConfig.ValidatingWebhookConfigurationName == "":
-		return retval, errors.New("validating webhook configuration name is required configuration")
-	case retval.ctrlConfig.ControllerManagerConfigurationSpec.Webhook.CertDir != "":
-		setupLog.Info("certDir configuration is ignored", "certDir", retval.ctrlConfig.ControllerManagerConfigurationSpec.Webhook.CertDir)
+// validateAuditConfig validates the audit outputs.
+func validateAuditConfig(auditConfig spirev1alpha1.AuditConfig) []error {
+	var errs []error
+	if file := auditConfig.File; file != nil {
+		if file.Path == "" {
+			errs = append(errs, errors.New("audit file path is required"))
+		}
+		if file.MaxSizeMB < 0 {
+			errs = append(errs, errors.New("audit file max size must not be negative"))
+		}
+		if file.MaxBackups < 0 {
+			errs = append(errs, errors.New("audit file max backups must not be negative"))
+		}
+	}
+	if webhook := auditConfig.Webhook; webhook != nil {
+		u, err := url.Parse(webhook.URL)
+		switch {
+		case webhook.URL == "":
+			errs = append(errs, errors.New("audit webhook URL is required"))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("invalid audit webhook URL: %w", err))
+		case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+			errs = append(errs, fmt.Errorf("audit webhook URL %q must be an absolute http or https URL", webhook.URL))
+		}
+		if webhook.Timeout.Duration < 0 {
+			errs = append(errs, errors.New("audit webhook timeout must not be negative"))
+		}
 	}
+	return errs
+}
 
-	return retval, nil
+// validateTrustDomainProfiles validates the trust domain profiles. Each
+// profile must have its own trust domain and SPIRE Server, since entry
+// reconcilers delete the entries on their server that they do not declare.
+func validateTrustDomainProfiles(ctrlConfig spirev1alpha1.ControllerManagerConfig) []error {
+	var errs []error
+	names := make(map[string]bool)
+	trustDomains := map[string]bool{ctrlConfig.TrustDomain: true}
+	socketPath := ctrlConfig.SPIREServerSocketPath
+	if socketPath == "" {
+		socketPath = defaultSPIREServerSocketPath
+	}
+	socketPaths := map[string]bool{socketPath: true}
+	for i, profile := range ctrlConfig.TrustDomainProfiles {
+		switch {
+		case profile.Name == "":
+			errs = append(errs, fmt.Errorf("trust domain profile %d: name is required", i))
+		case names[profile.Name]:
+			errs = append(errs, fmt.Errorf("trust domain profile %q is defined more than once", profile.Name))
+		}
+		names[profile.Name] = true
+
+		if _, err := spiffeid.TrustDomainFromString(profile.TrustDomain); err != nil {
+			errs = append(errs, fmt.Errorf("trust domain profile %q: invalid trust domain name: %w", profile.Name, err))
+		} else if trustDomains[profile.TrustDomain] {
+			errs = append(errs, fmt.Errorf("trust domain profile %q: trust domain %q is already in use", profile.Name, profile.TrustDomain))
+		}
+		trustDomains[profile.TrustDomain] = true
+
+		switch {
+		case profile.SPIREServerSocketPath == "":
+			errs = append(errs, fmt.Errorf("trust domain profile %q: SPIRE server socket path is required", profile.Name))
+		case socketPaths[profile.SPIREServerSocketPath]:
+			errs = append(errs, fmt.Errorf("trust domain profile %q: SPIRE server socket path %q is already in use", profile.Name, profile.SPIREServerSocketPath))
+		}
+		socketPaths[profile.SPIREServerSocketPath] = true
+	}
+	return errs
+}
+
+// validateConfig completes the config and runs every check made at startup
+// that does not need SPIRE Server or Kubernetes. It returns the log level and
+// every problem found.
+func validateConfig(mainConfig *Config) (zapcore.Level, []error) {
+	var errs []error
+	mainConfig.ignoreNamespacesRegex, errs = compileIgnoreNamespaces(mainConfig.ctrlConfig.IgnoreNamespaces)
+	logLevel, err := getLogLevel(mainConfig.ctrlConfig.LogLevel)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to parse log level: %w", err))
+	}
+	errs = append(errs, completeConfig(mainConfig)...)
+	return logLevel, errs
+}
+
+// newEntryReconcilerConfig returns the entry reconciler configuration,
+// without the clients.
+func newEntryReconcilerConfig(mainConfig Config, trustDomain spiffeid.TrustDomain) spireentry.ReconcilerConfig {
+	return spireentry.ReconcilerConfig{
+		TrustDomain:                trustDomain,
+		ClusterName:                mainConfig.ctrlConfig.ClusterName,
+		ClusterDomain:              mainConfig.ctrlConfig.ClusterDomain,
+		IgnoreNamespaces:           mainConfig.ignoreNamespacesRegex,
+		GCInterval:                 mainConfig.ctrlConfig.GCInterval,
+		ReconcileTimeout:           mainConfig.ctrlConfig.ReconcileTimeout.Duration,
+		ClassName:                  mainConfig.ctrlConfig.ClassName,
+		WatchClassless:             mainConfig.ctrlConfig.WatchClassless,
+		ParentIDTemplate:           mainConfig.parentIDTemplate,
+		Reconcile:                  mainConfig.reconcile,
+		EntryIDPrefix:              mainConfig.ctrlConfig.EntryIDPrefix,
+		EntryIDPrefixCleanup:       mainConfig.ctrlConfig.EntryIDPrefixCleanup,
+		EntryRetirementGracePeriod: mainConfig.ctrlConfig.EntryRetirementGracePeriod.Duration,
+		RenderWorkers:              mainConfig.ctrlConfig.EntryRenderWorkers,
+		ListEntriesByParentID:      mainConfig.ctrlConfig.ListEntriesByParentID,
+		CheckEntryRevisions:        mainConfig.ctrlConfig.CheckEntryRevisions,
+		TrustDomainProfiles:        trustDomainProfileNames(mainConfig.ctrlConfig.TrustDomainProfiles),
+	}
+}
+
+func trustDomainProfileNames(profiles []spirev1alpha1.TrustDomainProfile) []string {
+	var names []string
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// newAuditRecorder returns a recorder writing to the configured audit
+// outputs, or nil if there are none.
+func newAuditRecorder(auditConfig spirev1alpha1.AuditConfig) (*audit.Recorder, error) {
+	var sinks []audit.Sink
+	if auditConfig.Stdout {
+		sinks = append(sinks, audit.NewStdoutSink())
+	}
+	if file := auditConfig.File; file != nil {
+		sink, err := audit.NewFileSink(audit.FileSinkConfig{
+			Path:       file.Path,
+			MaxSizeMB:  file.MaxSizeMB,
+			MaxBackups: file.MaxBackups,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if webhook := auditConfig.Webhook; webhook != nil {
+		sink, err := audit.NewWebhookSink(audit.WebhookSinkConfig{
+			URL:     webhook.URL,
+			Timeout: webhook.Timeout.Duration,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return audit.NewRecorder(sinks...), nil
 }
 
 func run(mainConfig Config) (err error) {
 	webhookEnabled := os.Getenv("ENABLE_WEBHOOKS") != "false"
 
+	ctx := ctrl.SetupSignalHandler()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Endpoint:        mainConfig.ctrlConfig.Tracing.Endpoint,
+		Insecure:        mainConfig.ctrlConfig.Tracing.Insecure,
+		SamplingPercent: mainConfig.ctrlConfig.Tracing.SamplingPercent,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		return err
+	}
+	defer func() {
+		// The signal handler context is done by now, so flush the pending
+		// spans with a fresh deadline.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			setupLog.Error(err, "unable to flush trace spans")
+		}
+	}()
+
+	var webhookClient admissionregistrationapiv1.ValidatingWebhookConfigurationInterface
+	if webhookEnabled {
+		// We need a direct client to query and patch up the webhook. We can't use
+		// the controller runtime client for this because we can't start the manager
+		// without the webhook credentials being in place, and the webhook credentials
+		// need the DNS name of the webhook service from the configuration.
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			setupLog.Error(err, "failed to get in cluster configuration")
+			return err
+		}
+		// creates the clientset
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			setupLog.Error(err, "failed to create an API client")
+			return err
+		}
+		webhookClient = clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	}
+
+	return runManager(ctx, mainConfig, ctrl.GetConfigOrDie(), webhookClient)
+}
+
+// runManager wires up the SPIRE Server client, the reconcilers and the
+// controllers and runs the manager until the context is done. The webhooks
+// are only served if a webhook configuration client is provided.
+func runManager(ctx context.Context, mainConfig Config, restConfig *rest.Config, webhookClient admissionregistrationapiv1.ValidatingWebhookConfigurationInterface) error {
+	webhookEnabled := webhookClient != nil
+
 	trustDomain, err := spiffeid.TrustDomainFromString(mainConfig.ctrlConfig.TrustDomain)
 	if err != nil {
 		setupLog.Error(err, "invalid trust domain name")
 		return err
 	}
 
-	ctx := ctrl.SetupSignalHandler()
-
 	setupLog.Info("Dialing SPIRE Server socket")
-	spireClient, err := spireapi.DialSocket(mainConfig.ctrlConfig.SPIREServerSocketPath)
+	spireClient, err := dialSPIREServer(mainConfig, mainConfig.ctrlConfig.SPIREServerSocketPath)
 	if err != nil {
 		setupLog.Error(err, "unable to dial SPIRE Server socket")
 		return err
 	}
 	defer spireClient.Close()
 
+	// The entries of each trust domain profile are reconciled against its
+	// own SPIRE Server. Federation relationships and the webhook credentials
+	// are only managed on the main SPIRE Server.
+	profileClients := make([]spireapi.Client, 0, len(mainConfig.ctrlConfig.TrustDomainProfiles))
+	for _, profile := range mainConfig.ctrlConfig.TrustDomainProfiles {
+		setupLog.Info("Dialing SPIRE Server socket", "trust domain profile", profile.Name)
+		profileClient, err := dialSPIREServer(mainConfig, profile.SPIREServerSocketPath)
+		if err != nil {
+			setupLog.Error(err, "unable to dial SPIRE Server socket", "trust domain profile", profile.Name)
+			return err
+		}
+		defer profileClient.Close()
+		profileClients = append(profileClients, profileClient)
+	}
+
 	// It's unfortunate that we have to keep credentials on disk so that the
 	// manager can load them. Webhook server credentials are stored in a single
 	// file to keep rotation simple.
@@ -278,7 +673,8 @@ func run(mainConfig Config) (err error) {
 				os.Exit(1)
 			}
 		}()
-		mainConfig.options.WebhookServer = webhook.NewServer(webhook.Options{
+		webhookOptions := webhook.Options{
+			Host:     mainConfig.ctrlConfig.Webhook.Host,
 			CertDir:  certDir,
 			CertName: keyPairName,
 			KeyName:  keyPairName,
@@ -287,28 +683,17 @@ func run(mainConfig Config) (err error) {
 					s.MinVersion = tls.VersionTLS12
 				},
 			},
-		})
-		// We need a direct client to query and patch up the webhook. We can't use
-		// the controller runtime client for this because we can't start the manager
-		// without the webhook credentials being in place, and the webhook credentials
-		// need the DNS name of the webhook service from the configuration.
-		config, err := rest.InClusterConfig()
-		if err != nil {
-			setupLog.Error(err, "failed to get in cluster configuration")
-			return err
 		}
-		// creates the clientset
-		clientset, err := kubernetes.NewForConfig(config)
-		if err != nil {
-			setupLog.Error(err, "failed to create an API client")
-			return err
+		if mainConfig.ctrlConfig.Webhook.Port != nil {
+			webhookOptions.Port = *mainConfig.ctrlConfig.Webhook.Port
 		}
+		mainConfig.options.WebhookServer = webhook.NewServer(webhookOptions)
 
 		webhookManager := webhookmanager.New(webhookmanager.Config{
 			ID:            spiffeid.RequireFromPath(trustDomain, "/spire-controller-manager-webhook"),
 			KeyPairPath:   filepath.Join(certDir, keyPairName),
 			WebhookName:   mainConfig.ctrlConfig.ValidatingWebhookConfigurationName,
-			WebhookClient: clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations(),
+			WebhookClient: webhookClient,
 			SVIDClient:    spireClient,
 			BundleClient:  spireClient,
 		})
@@ -321,29 +706,70 @@ func run(mainConfig Config) (err error) {
 		webhookRunnable = webhookManager
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), mainConfig.options)
+	mgr, err := ctrl.NewManager(restConfig, mainConfig.options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		return err
 	}
 
-	var entryReconciler reconciler.Reconciler
+	liveConfig := liveconfig.New(newLiveConfig(mainConfig))
+
+	auditor, err := newAuditRecorder(mainConfig.ctrlConfig.Audit)
+	if err != nil {
+		setupLog.Error(err, "unable to set up audit outputs")
+		return err
+	}
+	defer func() {
+		if err := auditor.Close(); err != nil {
+			setupLog.Error(err, "unable to close audit outputs")
+		}
+	}()
+
+	// There is an entry reconciler for the main trust domain and one for
+	// each trust domain profile. The controllers trigger all of them.
+	var entryReconcilers []reconciler.Reconciler
+	var entryTriggerer reconciler.Triggerers
 	if mainConfig.reconcile.ClusterSPIFFEIDs || mainConfig.reconcile.ClusterStaticEntries {
-		entryReconciler = spireentry.Reconciler(spireentry.ReconcilerConfig{
-			TrustDomain:          trustDomain,
-			ClusterName:          mainConfig.ctrlConfig.ClusterName,
-			ClusterDomain:        mainConfig.ctrlConfig.ClusterDomain,
-			K8sClient:            mgr.GetClient(),
-			EntryClient:          spireClient,
-			IgnoreNamespaces:     mainConfig.ignoreNamespacesRegex,
-			GCInterval:           mainConfig.ctrlConfig.GCInterval,
-			ClassName:            mainConfig.ctrlConfig.ClassName,
-			WatchClassless:       mainConfig.ctrlConfig.WatchClassless,
-			ParentIDTemplate:     mainConfig.parentIDTemplate,
-			Reconcile:            mainConfig.reconcile,
-			EntryIDPrefix:        mainConfig.ctrlConfig.EntryIDPrefix,
-			EntryIDPrefixCleanup: mainConfig.ctrlConfig.EntryIDPrefixCleanup,
-		})
+		entryReconcilerConfig := newEntryReconcilerConfig(mainConfig, trustDomain)
+		entryReconcilerConfig.K8sClient = mgr.GetClient()
+		entryReconcilerConfig.EntryClient = spireClient
+		entryReconcilerConfig.LiveConfig = liveConfig
+		entryReconcilerConfig.Auditor = auditor
+		if mainConfig.ctrlConfig.DebugEndpoint {
+			entryReconcilerConfig.Debugger = spireentry.NewDebugger()
+		}
+		mainEntryReconciler := spireentry.Reconciler(entryReconcilerConfig)
+		entryReconcilers = append(entryReconcilers, mainEntryReconciler)
+
+		// Each profile has its own debugger, served by name on the debug
+		// endpoint.
+		debugHandlers := make(map[string]http.Handler)
+		if debugger := entryReconcilerConfig.Debugger; debugger != nil {
+			debugHandlers[""] = debugger.Handler(mainEntryReconciler)
+		}
+		for i, profile := range mainConfig.ctrlConfig.TrustDomainProfiles {
+			profileReconcilerConfig := entryReconcilerConfig
+			profileReconcilerConfig.TrustDomain = spiffeid.RequireTrustDomainFromString(profile.TrustDomain)
+			profileReconcilerConfig.TrustDomainProfile = profile.Name
+			profileReconcilerConfig.EntryClient = profileClients[i]
+			if mainConfig.ctrlConfig.DebugEndpoint {
+				profileReconcilerConfig.Debugger = spireentry.NewDebugger()
+			}
+			profileEntryReconciler := spireentry.Reconciler(profileReconcilerConfig)
+			if debugger := profileReconcilerConfig.Debugger; debugger != nil {
+				debugHandlers[profile.Name] = debugger.Handler(profileEntryReconciler)
+			}
+			entryReconcilers = append(entryReconcilers, profileEntryReconciler)
+		}
+		if len(debugHandlers) > 0 {
+			if err := mgr.AddMetricsServerExtraHandler(debugEntriesPath, spireentry.ProfileDebugHandler(debugHandlers)); err != nil {
+				setupLog.Error(err, "unable to set up debug endpoint")
+				return err
+			}
+		}
+		for _, r := range entryReconcilers {
+			entryTriggerer = append(entryTriggerer, r)
+		}
 	}
 
 	var federationRelationshipReconciler reconciler.Reconciler
@@ -352,8 +778,11 @@ func run(mainConfig Config) (err error) {
 			K8sClient:         mgr.GetClient(),
 			TrustDomainClient: spireClient,
 			GCInterval:        mainConfig.ctrlConfig.GCInterval,
+			ReconcileTimeout:  mainConfig.ctrlConfig.ReconcileTimeout.Duration,
 			ClassName:         mainConfig.ctrlConfig.ClassName,
 			WatchClassless:    mainConfig.ctrlConfig.WatchClassless,
+			LiveConfig:        liveConfig,
+			Auditor:           auditor,
 		})
 		if err = (&controller.ClusterFederatedTrustDomainReconciler{
 			Client:    mgr.GetClient(),
@@ -369,17 +798,25 @@ func run(mainConfig Config) (err error) {
 		if err = (&controller.ClusterSPIFFEIDReconciler{
 			Client:    mgr.GetClient(),
 			Scheme:    mgr.GetScheme(),
-			Triggerer: entryReconciler,
+			Triggerer: entryTriggerer,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "ClusterSPIFFEID")
 			return err
 		}
+		if err = (&controller.ClusterSPIFFEIDPolicyReconciler{
+			Client:    mgr.GetClient(),
+			Scheme:    mgr.GetScheme(),
+			Triggerer: entryTriggerer,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ClusterSPIFFEIDPolicy")
+			return err
+		}
 	}
 	if mainConfig.reconcile.ClusterStaticEntries {
 		if err = (&controller.ClusterStaticEntryReconciler{
 			Client:    mgr.GetClient(),
 			Scheme:    mgr.GetScheme(),
-			Triggerer: entryReconciler,
+			Triggerer: entryTriggerer,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "ClusterStaticEntry")
 			return err
@@ -394,6 +831,11 @@ func run(mainConfig Config) (err error) {
 			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterSPIFFEID")
 			return err
 		}
+		if err = (&spirev1alpha1.ClusterSPIFFEIDPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterSPIFFEIDPolicy")
+			return err
+		}
+		mgr.GetWebhookServer().Register(configObjectWebhookPath, &webhook.Admission{Handler: configObjectValidator{}})
 	}
 	//+kubebuilder:scaffold:builder
 
@@ -401,8 +843,9 @@ func run(mainConfig Config) (err error) {
 		if err = (&controller.PodReconciler{
 			Client:           mgr.GetClient(),
 			Scheme:           mgr.GetScheme(),
-			Triggerer:        entryReconciler,
+			Triggerer:        entryTriggerer,
 			IgnoreNamespaces: mainConfig.ignoreNamespacesRegex,
+			LiveConfig:       liveConfig,
 		}).SetupWithManager(ctx, mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "Pod")
 			return err
@@ -410,15 +853,16 @@ func run(mainConfig Config) (err error) {
 		if err = (&controller.EndpointsReconciler{
 			Client:           mgr.GetClient(),
 			Scheme:           mgr.GetScheme(),
-			Triggerer:        entryReconciler,
+			Triggerer:        entryTriggerer,
 			IgnoreNamespaces: mainConfig.ignoreNamespacesRegex,
+			LiveConfig:       liveConfig,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "Endpoints")
 			return err
 		}
 	}
 
-	if entryReconciler != nil {
+	for _, entryReconciler := range entryReconcilers {
 		if err = mgr.Add(manager.RunnableFunc(entryReconciler.Run)); err != nil {
 			setupLog.Error(err, "unable to manage entry reconciler")
 			return err
@@ -432,6 +876,26 @@ func run(mainConfig Config) (err error) {
 		}
 	}
 
+	var configSource configSource
+	switch {
+	case mainConfig.configObject.Name != "":
+		configSource = newObjectConfigSource(mgr.GetAPIReader(), mgr.GetClient(), mainConfig)
+	case mainConfig.configFile != "":
+		configSource = fileConfigSource{configFile: mainConfig.configFile, expandEnv: mainConfig.expandEnv}
+	}
+	if configSource != nil {
+		var triggerers []reconciler.Triggerer
+		for _, r := range append(entryReconcilers, federationRelationshipReconciler) {
+			if r != nil {
+				triggerers = append(triggerers, r)
+			}
+		}
+		if err = mgr.Add(newConfigReloader(mainConfig, configSource, liveConfig, triggerers...)); err != nil {
+			setupLog.Error(err, "unable to manage config reloader")
+			return err
+		}
+	}
+
 	if webhookRunnable != nil {
 		if err = mgr.Add(webhookRunnable); err != nil {
 			setupLog.Error(err, "unable to manage federation relationship reconciler")
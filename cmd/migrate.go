@@ -0,0 +1,223 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/spiffe/spire-controller-manager/pkg/registrarmigration"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+)
+
+// migrateOutput is the migration plan, and whether it was applied.
+type migrateOutput struct {
+	Applied   bool                    `json:"applied"`
+	Adopt     []migrateOutputAdoption `json:"adopt"`
+	Delete    []migrateOutputEntry    `json:"delete"`
+	Unmatched []migrateOutputEntry    `json:"unmatched"`
+}
+
+type migrateOutputAdoption struct {
+	Current  renderOutputEntry `json:"current"`
+	Declared renderOutputEntry `json:"declared"`
+}
+
+type migrateOutputEntry struct {
+	Entry  renderOutputEntry `json:"entry"`
+	Reason string            `json:"reason"`
+}
+
+// runMigrate implements the migrate command, which adopts the entries
+// created by the Kubernetes Workload Registrar as the entries declared by
+// ClusterSPIFFEIDs, updating them in place so that workloads keep their
+// entries throughout the migration. Without -apply it only prints the plan.
+// It returns the process exit code.
+func runMigrate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var configFileFlag string
+	var expandEnvFlag bool
+	var kubeconfigFlag string
+	var spireAPISocketFlag string
+	var trustDomainFlag string
+	var clusterNameFlag string
+	var clusterDomainFlag string
+	var registrarClusterNameFlag string
+	var applyFlag bool
+	var outputFlag string
+	flags.StringVar(&configFileFlag, "config", "", "The controller manager config file to migrate with. Flags override configuration from this file.")
+	flags.BoolVar(&expandEnvFlag, "expand-env", false, "Expand environment variables in SPIRE Controller Manager config file")
+	flags.StringVar(&kubeconfigFlag, "kubeconfig", "", "The kubeconfig file to connect to the cluster with. Defaults to the same lookup as kubectl.")
+	flags.StringVar(&spireAPISocketFlag, "spire-api-socket", "", "The path to the SPIRE API socket. Defaults to the socket in the config file, or "+defaultSPIREServerSocketPath)
+	flags.StringVar(&trustDomainFlag, "trust-domain", "", "The trust domain of the SPIRE Server")
+	flags.StringVar(&clusterNameFlag, "cluster-name", "", "The cluster name entries are declared with")
+	flags.StringVar(&clusterDomainFlag, "cluster-domain", "", "The cluster domain DNS names are rendered with")
+	flags.StringVar(&registrarClusterNameFlag, "registrar-cluster-name", "", "The cluster name the Kubernetes Workload Registrar was configured with. Defaults to the cluster name entries are declared with.")
+	flags.BoolVar(&applyFlag, "apply", false, "Apply the plan. Without this flag the plan is only printed.")
+	flags.StringVar(&outputFlag, "o", "yaml", "The output format, either yaml or json")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s migrate [flags]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(stderr, "Plans the adoption of the entries created by the Kubernetes Workload Registrar as the")
+		fmt.Fprintln(stderr, "entries declared by ClusterSPIFFEIDs. Registrar entries are updated in place, so that")
+		fmt.Fprintln(stderr, "workloads keep their entries throughout the migration, and registrar entries that are")
+		fmt.Fprintln(stderr, "no longer needed are deleted. Review the plan, then run again with -apply. The")
+		fmt.Fprintln(stderr, "Kubernetes Workload Registrar must be stopped first.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	if outputFlag != "yaml" && outputFlag != "json" {
+		fmt.Fprintf(stderr, "invalid output format %q: expected yaml or json\n", outputFlag)
+		return 2
+	}
+
+	mainConfig, config, err := renderConfig(configFileFlag, expandEnvFlag, trustDomainFlag, clusterNameFlag, clusterDomainFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if registrarClusterNameFlag == "" {
+		registrarClusterNameFlag = config.ClusterName
+	}
+
+	k8sClient, err := newClusterClient(kubeconfigFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	spireClient, err := dialSPIREServer(mainConfig, spireAPISocketFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer spireClient.Close()
+	config.EntryClient = spireClient
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = log.IntoContext(ctx, zap.New(zap.WriteTo(stderr)))
+
+	out, err := migrate(ctx, config, k8sClient, registrarClusterNameFlag, applyFlag)
+	if out != nil {
+		data, err := marshalOutput(out, outputFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to marshal output: %v\n", err)
+			return 1
+		}
+		if _, err := stdout.Write(data); err != nil {
+			fmt.Fprintf(stderr, "failed to write output: %v\n", err)
+			return 1
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// migrate plans the adoption of the registrar entries on SPIRE Server by
+// the entries declared in the cluster, and applies the plan if asked to. The
+// plan is returned even if applying it fails.
+func migrate(ctx context.Context, config spireentry.ReconcilerConfig, k8sClient client.Client, registrarClusterName string, apply bool) (*migrateOutput, error) {
+	// Adopted entries keep their IDs, which do not carry the prefix the
+	// controller manager uses to tell which entries it owns. With a prefix,
+	// the entries without one must be cleaned up, so that the manager
+	// re-keys the adopted entries under the prefix.
+	if config.EntryIDPrefix != "" && (config.EntryIDPrefixCleanup == nil || *config.EntryIDPrefixCleanup != "") {
+		return nil, errors.New(`registrar entries can only be adopted with an entry ID prefix if entryIDPrefixCleanup is set to "", so that the adopted entries are re-keyed under the prefix`)
+	}
+
+	// The manager is kept from reconciling ClusterSPIFFEIDs until the
+	// registrar entries are adopted, but they are rendered to adopt them.
+	config.Reconcile.ClusterSPIFFEIDs = true
+
+	input, err := spireentry.ListRenderInput(ctx, k8sClient)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := spireentry.Render(ctx, config, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render entries: %w", err)
+	}
+	current, err := config.EntryClient.ListEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SPIRE entries: %w", err)
+	}
+	plan, err := registrarmigration.MakePlan(registrarmigration.Config{
+		TrustDomain: config.TrustDomain,
+		ClusterName: registrarClusterName,
+	}, rendered, input.Pods, current)
+	if err != nil {
+		return nil, err
+	}
+
+	out := newMigrateOutput(plan)
+	if !apply {
+		return out, nil
+	}
+	if err := registrarmigration.Apply(ctx, config.EntryClient, plan); err != nil {
+		return out, fmt.Errorf("failed to apply migration plan: %w", err)
+	}
+	out.Applied = true
+	return out, nil
+}
+
+func newMigrateOutput(plan *registrarmigration.Plan) *migrateOutput {
+	out := &migrateOutput{
+		Adopt:     make([]migrateOutputAdoption, 0, len(plan.Adopt)),
+		Delete:    make([]migrateOutputEntry, 0, len(plan.Delete)),
+		Unmatched: make([]migrateOutputEntry, 0, len(plan.Unmatched)),
+	}
+	for _, adoption := range plan.Adopt {
+		out.Adopt = append(out.Adopt, migrateOutputAdoption{
+			Current:  newOutputEntry(adoption.Entry),
+			Declared: newRenderedOutputEntry(adoption.Target),
+		})
+	}
+	for _, deletion := range plan.Delete {
+		out.Delete = append(out.Delete, migrateOutputEntry{
+			Entry:  newOutputEntry(deletion.Entry),
+			Reason: deletion.Reason,
+		})
+	}
+	for _, unmatched := range plan.Unmatched {
+		out.Unmatched = append(out.Unmatched, migrateOutputEntry{
+			Entry:  newOutputEntry(unmatched.Entry),
+			Reason: unmatched.Reason,
+		})
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+	"github.com/spiffe/spire-controller-manager/pkg/test/spirefake"
+)
+
+func TestMigrate(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	nodeAliasID := &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: "/k8s-workload-registrar/registrar/node/node"}
+
+	spire := spirefake.Start(t, spirefake.Config{TrustDomain: td})
+	spire.SetEntries(
+		&apitypes.Entry{
+			Id:        "node-alias",
+			SpiffeId:  nodeAliasID,
+			ParentId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: "/spire/server"},
+			Selectors: []*apitypes.Selector{{Type: "k8s_psat", Value: "agent_node_name:node"}},
+		},
+		&apitypes.Entry{
+			Id:        "registrar",
+			SpiffeId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: "/ns/workload/sa/sa"},
+			ParentId:  nodeAliasID,
+			Selectors: []*apitypes.Selector{{Type: "k8s", Value: "pod-uid:pod-uid"}},
+		},
+		makeSeedEntry("other", "spiffe://example.org/other"),
+	)
+	spireClient, err := spireapi.DialSocket(spire.SocketPath())
+	require.NoError(t, err)
+	defer spireClient.Close()
+
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&spirev1alpha1.ClusterSPIFFEID{
+			ObjectMeta: metav1.ObjectMeta{Name: "workloads", UID: "workloads"},
+			Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+				SPIFFEIDTemplate: "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}",
+			},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "workload", UID: "workload"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: "pod", UID: "pod-uid"},
+			Spec:       corev1.PodSpec{NodeName: "node", ServiceAccountName: "sa"},
+		},
+	).Build()
+
+	config := spireentry.ReconcilerConfig{
+		TrustDomain:    td,
+		ClusterName:    "cluster",
+		ClusterDomain:  "cluster.local",
+		EntryClient:    spireClient,
+		WatchClassless: true,
+	}
+
+	expectedOut := &migrateOutput{
+		Adopt: []migrateOutputAdoption{{
+			Current: renderOutputEntry{
+				ID:        "registrar",
+				SPIFFEID:  "spiffe://example.org/ns/workload/sa/sa",
+				ParentID:  "spiffe://example.org/k8s-workload-registrar/registrar/node/node",
+				Selectors: []string{"k8s:pod-uid:pod-uid"},
+			},
+			Declared: renderOutputEntry{
+				SPIFFEID:   "spiffe://example.org/ns/workload/sa/sa",
+				ParentID:   "spiffe://example.org/spire/agent/k8s_psat/cluster/node-uid",
+				Selectors:  []string{"k8s:pod-uid:pod-uid"},
+				DeclaredBy: "ClusterSPIFFEID/workloads",
+			},
+		}},
+		Delete: []migrateOutputEntry{{
+			Entry: renderOutputEntry{
+				ID:        "node-alias",
+				SPIFFEID:  "spiffe://example.org/k8s-workload-registrar/registrar/node/node",
+				ParentID:  "spiffe://example.org/spire/server",
+				Selectors: []string{"k8s_psat:agent_node_name:node"},
+			},
+			Reason: "registrar node entry is not used by the controller manager",
+		}},
+		Unmatched: []migrateOutputEntry{},
+	}
+
+	t.Run("plan", func(t *testing.T) {
+		out, err := migrate(context.Background(), config, k8sClient, "registrar", false)
+		require.NoError(t, err)
+		assert.Equal(t, expectedOut, out)
+		assert.Len(t, spire.Entries(), 3)
+	})
+
+	t.Run("entry ID prefix", func(t *testing.T) {
+		config := config
+		config.EntryIDPrefix = "prefix."
+		_, err := migrate(context.Background(), config, k8sClient, "registrar", false)
+		assert.EqualError(t, err, `registrar entries can only be adopted with an entry ID prefix if entryIDPrefixCleanup is set to "", so that the adopted entries are re-keyed under the prefix`)
+
+		cleanup := "other"
+		config.EntryIDPrefixCleanup = &cleanup
+		_, err = migrate(context.Background(), config, k8sClient, "registrar", false)
+		assert.Error(t, err)
+
+		cleanup = ""
+		out, err := migrate(context.Background(), config, k8sClient, "registrar", false)
+		require.NoError(t, err)
+		assert.Equal(t, expectedOut, out)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		out, err := migrate(context.Background(), config, k8sClient, "registrar", true)
+		require.NoError(t, err)
+		expectedOut := *expectedOut
+		expectedOut.Applied = true
+		assert.Equal(t, &expectedOut, out)
+
+		entries := spire.Entries()
+		require.Len(t, entries, 2)
+		for _, entry := range entries {
+			if entry.Id == "registrar" {
+				assert.Equal(t, "/spire/agent/k8s_psat/cluster/node-uid", entry.ParentId.Path)
+			} else {
+				assert.Equal(t, "other", entry.Id)
+			}
+		}
+	})
+}
+
+func TestRunMigrateUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"extra"},
+		{"-o", "xml"},
+	} {
+		stderr := new(bytes.Buffer)
+		code := runMigrate(args, new(bytes.Buffer), stderr)
+		assert.Equal(t, 2, code, args)
+	}
+}
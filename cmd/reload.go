@@ -0,0 +1,265 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	uberzap "go.uber.org/zap"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
+	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
+)
+
+const configReloadInterval = 10 * time.Second
+
+// reloadableFields are the config file fields that are applied to the
+// running controller manager when the config file changes. Changing any
+// other field requires a restart.
+var reloadableFields = []string{
+	"className",
+	"gcInterval",
+	"ignoreNamespaces",
+	"logLevel",
+	"parentIDTemplate",
+	"watchClassless",
+}
+
+// newLiveConfig returns the reloadable part of the configuration.
+func newLiveConfig(mainConfig Config) liveconfig.Config {
+	return liveconfig.Config{
+		IgnoreNamespaces: mainConfig.ignoreNamespacesRegex,
+		ClassName:        mainConfig.ctrlConfig.ClassName,
+		WatchClassless:   mainConfig.ctrlConfig.WatchClassless,
+		ParentIDTemplate: mainConfig.parentIDTemplate,
+		GCInterval:       mainConfig.ctrlConfig.GCInterval,
+	}
+}
+
+// configSource is where the configuration is reloaded from.
+type configSource interface {
+	// load returns the configuration, and a version that changes whenever
+	// the configuration might have.
+	load(ctx context.Context) (Config, string, error)
+
+	// report is called with the outcome of reloading each new version.
+	report(ctx context.Context, reloadErr error) error
+}
+
+// fileConfigSource reloads the configuration from the config file. A
+// ConfigMap mounted as a volume is picked up the same way, once the kubelet
+// has updated the file.
+type fileConfigSource struct {
+	configFile string
+	expandEnv  bool
+}
+
+func (s fileConfigSource) load(context.Context) (Config, string, error) {
+	data, err := os.ReadFile(s.configFile)
+	if err != nil {
+		return Config{}, "", fmt.Errorf("unable to read the config file: %w", err)
+	}
+	mainConfig, err := loadConfig(s.configFile, s.expandEnv)
+	if err != nil {
+		return Config{}, "", err
+	}
+	return mainConfig, string(data), nil
+}
+
+func (fileConfigSource) report(context.Context, error) error {
+	return nil
+}
+
+// configReloader polls the config source and applies changes to the
+// reloadable fields to the running controller manager.
+type configReloader struct {
+	log        logr.Logger
+	source     configSource
+	live       *liveconfig.Value
+	logLevel   uberzap.AtomicLevel
+	triggerers []reconciler.Triggerer
+
+	// loaded is the config in effect, as loaded from the source, i.e.
+	// before the values derived at startup are filled in.
+	loaded spirev1alpha1.ControllerManagerConfig
+	// version is the version of the config last loaded from the source.
+	version string
+}
+
+func newConfigReloader(mainConfig Config, source configSource, live *liveconfig.Value, triggerers ...reconciler.Triggerer) *configReloader {
+	return &configReloader{
+		log:        ctrl.Log.WithName("config-reloader"),
+		source:     source,
+		live:       live,
+		logLevel:   mainConfig.logLevel,
+		triggerers: triggerers,
+		loaded:     mainConfig.loadedCtrlConfig,
+	}
+}
+
+// Start polls the config source until the context is done. The source is
+// loaded straight away so that changes made since startup are picked up,
+// and the config in effect reported.
+func (r *configReloader) Start(ctx context.Context) error {
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.reload(ctx); err != nil {
+			r.log.Error(err, "Unable to reload the configuration")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false so that the configuration is reloaded on
+// every replica, not only the leader.
+func (r *configReloader) NeedLeaderElection() bool {
+	return false
+}
+
+// reload applies the config from the source if it has changed since it was
+// last loaded, and reports the outcome to the source.
+func (r *configReloader) reload(ctx context.Context) error {
+	newConfig, version, err := r.source.load(ctx)
+	if err != nil {
+		return err
+	}
+	if version == r.version {
+		return nil
+	}
+	r.version = version
+
+	err = r.apply(newConfig)
+	if reportErr := r.source.report(ctx, err); reportErr != nil {
+		r.log.Error(reportErr, "Unable to report the outcome of the reload")
+	}
+	return err
+}
+
+// apply applies the config. Either every change is applied, or none are: a
+// change to a field that requires a restart, or an invalid value, fails the
+// whole reload.
+func (r *configReloader) apply(newConfig Config) error {
+	loaded := *newConfig.ctrlConfig.DeepCopy()
+	changed, err := changedConfigFields(r.loaded, loaded)
+	if err != nil {
+		return err
+	}
+	if restartRequired := restartRequiredFields(changed); len(restartRequired) > 0 {
+		return fmt.Errorf("changing %s requires a restart; no changes were applied", strings.Join(restartRequired, ", "))
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	logLevel, errs := validateConfig(&newConfig)
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration; no changes were applied: %w", errors.Join(errs...))
+	}
+	if loaded.ParentIDTemplate == r.loaded.ParentIDTemplate {
+		// Keep the template in use so that rendered entries are reused.
+		newConfig.parentIDTemplate = r.live.Load().ParentIDTemplate
+	}
+
+	r.live.Store(newLiveConfig(newConfig))
+	r.logLevel.SetLevel(logLevel)
+	r.loaded = loaded
+	r.log.Info("Config reloaded",
+		"changed", changed,
+		"ignore namespaces", newConfig.ctrlConfig.IgnoreNamespaces,
+		"gc interval", newConfig.ctrlConfig.GCInterval,
+		"class name", newConfig.ctrlConfig.ClassName,
+		"handle crs without class name", newConfig.ctrlConfig.WatchClassless,
+		"parent ID template", newConfig.ctrlConfig.ParentIDTemplate,
+		"log level", logLevel)
+
+	// Reconcile straight away with the new configuration rather than at
+	// the end of the current GC interval.
+	for _, triggerer := range r.triggerers {
+		triggerer.Trigger()
+	}
+	return nil
+}
+
+// restartRequiredFields returns the fields that are not reloadable.
+func restartRequiredFields(fields []string) []string {
+	var restartRequired []string
+	for _, field := range fields {
+		if !slices.Contains(reloadableFields, field) {
+			restartRequired = append(restartRequired, field)
+		}
+	}
+	return restartRequired
+}
+
+// changedConfigFields returns the names of the top level config fields that
+// differ between the two configs, sorted. The object metadata and status
+// are not config fields.
+func changedConfigFields(a, b spirev1alpha1.ControllerManagerConfig) ([]string, error) {
+	aFields, err := configFields(a)
+	if err != nil {
+		return nil, err
+	}
+	bFields, err := configFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for name, value := range aFields {
+		if !reflect.DeepEqual(value, bFields[name]) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range bFields {
+		if _, ok := aFields[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func configFields(config spirev1alpha1.ControllerManagerConfig) (map[string]any, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal config: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal config: %w", err)
+	}
+	for _, name := range []string{"apiVersion", "kind", "metadata", "status"} {
+		delete(fields, name)
+	}
+	return fields, nil
+}
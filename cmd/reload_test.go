@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
+)
+
+const reloadTestConfig = `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+clusterName: cluster
+trustDomain: example.org
+`
+
+type countingTriggerer int
+
+func (c *countingTriggerer) Trigger() { *c++ }
+
+func TestConfigReloader(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(extra string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(reloadTestConfig+extra), 0600))
+	}
+	writeConfig("className: a\n")
+
+	mainConfig, err := loadConfig(configFile, false)
+	require.NoError(t, err)
+	mainConfig.loadedCtrlConfig = *mainConfig.ctrlConfig.DeepCopy()
+	mainConfig.logLevel = uberzap.NewAtomicLevelAt(zapcore.InfoLevel)
+	require.Empty(t, completeConfig(&mainConfig))
+
+	live := liveconfig.New(newLiveConfig(mainConfig))
+	triggerer := new(countingTriggerer)
+	r := newConfigReloader(mainConfig, fileConfigSource{configFile: configFile}, live, triggerer)
+
+	t.Log("An unchanged config is not applied")
+	require.NoError(t, r.reload(context.Background()))
+	assert.Zero(t, *triggerer)
+
+	t.Log("Reloadable fields are applied and the reconcilers triggered")
+	writeConfig(`className: b
+watchClassless: true
+logLevel: debug
+gcInterval: 60000000000
+ignoreNamespaces: ["kube-.*"]
+parentIDTemplate: "spiffe://{{ .TrustDomain }}/node/{{ .NodeMeta.Name }}"
+`)
+	require.NoError(t, r.reload(context.Background()))
+	assert.Equal(t, 1, int(*triggerer))
+	reloaded := live.Load()
+	assert.Equal(t, "b", reloaded.ClassName)
+	assert.True(t, reloaded.WatchClassless)
+	assert.Equal(t, time.Minute, reloaded.GCInterval)
+	require.Len(t, reloaded.IgnoreNamespaces, 1)
+	assert.Equal(t, "kube-.*", reloaded.IgnoreNamespaces[0].String())
+	require.NotNil(t, reloaded.ParentIDTemplate)
+	assert.Equal(t, zapcore.DebugLevel, mainConfig.logLevel.Level())
+
+	t.Log("An unchanged parent ID template is kept")
+	writeConfig(`className: c
+logLevel: debug
+gcInterval: 60000000000
+ignoreNamespaces: ["kube-.*"]
+parentIDTemplate: "spiffe://{{ .TrustDomain }}/node/{{ .NodeMeta.Name }}"
+`)
+	require.NoError(t, r.reload(context.Background()))
+	assert.Same(t, reloaded.ParentIDTemplate, live.Load().ParentIDTemplate)
+	assert.Equal(t, "c", live.Load().ClassName)
+
+	t.Log("Fields that require a restart fail the whole reload")
+	writeConfig(`className: d
+clusterDomain: cluster.local
+spireServerSocketPath: /other.sock
+`)
+	require.EqualError(t, r.reload(context.Background()), "changing clusterDomain, spireServerSocketPath requires a restart; no changes were applied")
+	assert.Equal(t, "c", live.Load().ClassName)
+
+	t.Log("Invalid values fail the whole reload")
+	writeConfig(`className: d
+ignoreNamespaces: ["("]
+`)
+	require.ErrorContains(t, r.reload(context.Background()), "invalid configuration; no changes were applied")
+	assert.Equal(t, "c", live.Load().ClassName)
+	assert.Equal(t, 2, int(*triggerer))
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+)
+
+// stringsFlag is a flag that can be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// renderOutput is what the render command prints.
+type renderOutput struct {
+	Entries              []renderOutputEntry                               `json:"entries"`
+	ClusterSPIFFEIDs     map[string]spirev1alpha1.ClusterSPIFFEIDStatus    `json:"clusterSPIFFEIDs,omitempty"`
+	ClusterStaticEntries map[string]spirev1alpha1.ClusterStaticEntryStatus `json:"clusterStaticEntries,omitempty"`
+}
+
+type renderOutputEntry struct {
+	ID            string           `json:"id,omitempty"`
+	SPIFFEID      string           `json:"spiffeID"`
+	ParentID      string           `json:"parentID"`
+	Selectors     []string         `json:"selectors"`
+	X509SVIDTTL   *metav1.Duration `json:"x509SVIDTTL,omitempty"`
+	JWTSVIDTTL    *metav1.Duration `json:"jwtSVIDTTL,omitempty"`
+	FederatesWith []string         `json:"federatesWith,omitempty"`
+	DNSNames      []string         `json:"dnsNames,omitempty"`
+	Hint          string           `json:"hint,omitempty"`
+	Admin         bool             `json:"admin,omitempty"`
+	Downstream    bool             `json:"downstream,omitempty"`
+	StoreSVID     bool             `json:"storeSVID,omitempty"`
+	DeclaredBy    string           `json:"declaredBy,omitempty"`
+	MaskedBy      string           `json:"maskedBy,omitempty"`
+}
+
+// runRender implements the render command, which renders the entries
+// declared by ClusterSPIFFEID and ClusterStaticEntry manifests against Pod,
+// Node, Namespace and Endpoints manifests without a cluster or SPIRE
+// server. It returns the process exit code.
+func runRender(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var filesFlag stringsFlag
+	var configFileFlag string
+	var expandEnvFlag bool
+	var trustDomainFlag string
+	var clusterNameFlag string
+	var clusterDomainFlag string
+	var outputFlag string
+	flags.Var(&filesFlag, "f", "A manifest file, or a directory of .yaml, .yml and .json manifest files, to render from. May be repeated.")
+	flags.StringVar(&configFileFlag, "config", "", "The controller manager config file to render with. Flags override configuration from this file.")
+	flags.BoolVar(&expandEnvFlag, "expand-env", false, "Expand environment variables in SPIRE Controller Manager config file")
+	flags.StringVar(&trustDomainFlag, "trust-domain", "", "The trust domain to render entries in")
+	flags.StringVar(&clusterNameFlag, "cluster-name", "", "The cluster name to render entries with")
+	flags.StringVar(&clusterDomainFlag, "cluster-domain", "", "The cluster domain to render DNS names with")
+	flags.StringVar(&outputFlag, "o", "yaml", "The output format, either yaml or json")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s render -f <manifests> [flags]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(stderr, "Renders the SPIRE entries declared by ClusterSPIFFEID and ClusterStaticEntry manifests")
+		fmt.Fprintln(stderr, "against Pod, Node, Namespace and Endpoints manifests, without a cluster or SPIRE server.")
+		fmt.Fprintln(stderr, "Objects without a UID are given one derived from their name. Objects without a")
+		fmt.Fprintln(stderr, "creation timestamp are preferred in name order when their entries mask each other.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(filesFlag) == 0 || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	if outputFlag != "yaml" && outputFlag != "json" {
+		fmt.Fprintf(stderr, "invalid output format %q: expected yaml or json\n", outputFlag)
+		return 2
+	}
+
+	_, config, err := renderConfig(configFileFlag, expandEnvFlag, trustDomainFlag, clusterNameFlag, clusterDomainFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	input, err := loadRenderInput(filesFlag, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Failures to render individual entries are logged by the reconciler,
+	// as they would be in the manager, and counted in the statuses.
+	ctx := log.IntoContext(context.Background(), zap.New(zap.WriteTo(stderr)))
+	result, err := spireentry.Render(ctx, config, input)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to render entries: %v\n", err)
+		return 1
+	}
+
+	out, err := marshalRenderOutput(result, outputFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to marshal output: %v\n", err)
+		return 1
+	}
+	if _, err := stdout.Write(out); err != nil {
+		fmt.Fprintf(stderr, "failed to write output: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// renderConfig builds the configuration and the reconciler configuration
+// from the config file, if any, and the flag overrides, the same way the
+// manager would.
+func renderConfig(configFile string, expandEnv bool, trustDomain, clusterName, clusterDomain string) (Config, spireentry.ReconcilerConfig, error) {
+	mainConfig, err := loadConfig(configFile, expandEnv)
+	if err != nil {
+		return Config{}, spireentry.ReconcilerConfig{}, err
+	}
+	if configFile != "" {
+		var errs []error
+		mainConfig.ignoreNamespacesRegex, errs = compileIgnoreNamespaces(mainConfig.ctrlConfig.IgnoreNamespaces)
+		if len(errs) > 0 {
+			return Config{}, spireentry.ReconcilerConfig{}, errors.Join(errs...)
+		}
+	}
+	if trustDomain != "" {
+		mainConfig.ctrlConfig.TrustDomain = trustDomain
+	}
+	if clusterName != "" {
+		mainConfig.ctrlConfig.ClusterName = clusterName
+	}
+	if clusterDomain != "" {
+		mainConfig.ctrlConfig.ClusterDomain = clusterDomain
+	}
+	if errs := completeConfig(&mainConfig); len(errs) > 0 {
+		return Config{}, spireentry.ReconcilerConfig{}, errors.Join(errs...)
+	}
+
+	return mainConfig, newEntryReconcilerConfig(mainConfig, spiffeid.RequireTrustDomainFromString(mainConfig.ctrlConfig.TrustDomain)), nil
+}
+
+// loadRenderInput decodes the objects in the manifest files and
+// directories. Objects of kinds that are not needed to render entries are
+// skipped with a note on stderr.
+func loadRenderInput(paths []string, stderr io.Writer) (spireentry.RenderInput, error) {
+	var input spireentry.RenderInput
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	for _, path := range paths {
+		files, err := manifestFiles(path)
+		if err != nil {
+			return input, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return input, fmt.Errorf("unable to read manifest: %w", err)
+			}
+			reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+			for {
+				doc, err := reader.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					return input, fmt.Errorf("unable to read manifest %q: %w", file, err)
+				}
+				if err := addRenderInputObject(&input, decoder, doc, file, stderr); err != nil {
+					return input, err
+				}
+			}
+		}
+	}
+	return input, nil
+}
+
+// manifestFiles returns the path if it is a file, or the manifest files in
+// the directory tree if it is a directory.
+func manifestFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifests: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+			if !d.IsDir() {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifests: %w", err)
+	}
+	return files, nil
+}
+
+func addRenderInputObject(input *spireentry.RenderInput, decoder runtime.Decoder, doc []byte, file string, stderr io.Writer) error {
+	if len(bytes.TrimSpace(doc)) == 0 {
+		return nil
+	}
+	obj, gvk, err := decoder.Decode(doc, nil, nil)
+	switch {
+	case runtime.IsNotRegisteredError(err):
+		fmt.Fprintf(stderr, "Skipping %s in %q\n", gvk.Kind, file)
+		return nil
+	case runtime.IsMissingKind(err):
+		// Documents holding only comments have no kind.
+		if isEmptyYAML(doc) {
+			return nil
+		}
+		return fmt.Errorf("unable to decode manifest %q: %w", file, err)
+	case err != nil:
+		return fmt.Errorf("unable to decode manifest %q: %w", file, err)
+	}
+
+	switch obj := obj.(type) {
+	case *spirev1alpha1.ClusterSPIFFEID:
+		input.ClusterSPIFFEIDs = append(input.ClusterSPIFFEIDs, *obj)
+	case *spirev1alpha1.ClusterStaticEntry:
+		input.ClusterStaticEntries = append(input.ClusterStaticEntries, *obj)
+	case *spirev1alpha1.ClusterSPIFFEIDPolicy:
+		input.ClusterSPIFFEIDPolicies = append(input.ClusterSPIFFEIDPolicies, *obj)
+	case *corev1.Namespace:
+		input.Namespaces = append(input.Namespaces, *obj)
+	case *corev1.Pod:
+		input.Pods = append(input.Pods, *obj)
+	case *corev1.Node:
+		input.Nodes = append(input.Nodes, *obj)
+	case *corev1.Endpoints:
+		input.Endpoints = append(input.Endpoints, *obj)
+	case *corev1.List:
+		// As output by kubectl get -o yaml.
+		for _, item := range obj.Items {
+			if err := addRenderInputObject(input, decoder, item.Raw, file, stderr); err != nil {
+				return err
+			}
+		}
+	default:
+		fmt.Fprintf(stderr, "Skipping %s in %q\n", gvk.Kind, file)
+	}
+	return nil
+}
+
+func isEmptyYAML(doc []byte) bool {
+	var v interface{}
+	return yaml.Unmarshal(doc, &v) == nil && v == nil
+}
+
+func marshalRenderOutput(result *spireentry.RenderResult, format string) ([]byte, error) {
+	out := renderOutput{
+		Entries:              make([]renderOutputEntry, 0, len(result.Entries)),
+		ClusterSPIFFEIDs:     result.ClusterSPIFFEIDStatuses,
+		ClusterStaticEntries: result.ClusterStaticEntryStatuses,
+	}
+	for _, rendered := range result.Entries {
+		out.Entries = append(out.Entries, newRenderedOutputEntry(rendered))
+	}
+	return marshalOutput(out, format)
+}
+
+func newRenderedOutputEntry(rendered spireentry.RenderedEntry) renderOutputEntry {
+	outEntry := newOutputEntry(rendered.Entry)
+	outEntry.DeclaredBy = rendered.DeclaredBy.String()
+	if rendered.MaskedBy != nil {
+		outEntry.MaskedBy = rendered.MaskedBy.String()
+	}
+	return outEntry
+}
+
+func newOutputEntry(entry spireapi.Entry) renderOutputEntry {
+	outEntry := renderOutputEntry{
+		ID:         entry.ID,
+		SPIFFEID:   entry.SPIFFEID.String(),
+		ParentID:   entry.ParentID.String(),
+		Selectors:  make([]string, 0, len(entry.Selectors)),
+		DNSNames:   entry.DNSNames,
+		Hint:       entry.Hint,
+		Admin:      entry.Admin,
+		Downstream: entry.Downstream,
+		StoreSVID:  entry.StoreSVID,
+	}
+	for _, selector := range entry.Selectors {
+		outEntry.Selectors = append(outEntry.Selectors, selector.Type+":"+selector.Value)
+	}
+	for _, td := range entry.FederatesWith {
+		outEntry.FederatesWith = append(outEntry.FederatesWith, td.Name())
+	}
+	if entry.X509SVIDTTL != 0 {
+		outEntry.X509SVIDTTL = &metav1.Duration{Duration: entry.X509SVIDTTL}
+	}
+	if entry.JWTSVIDTTL != 0 {
+		outEntry.JWTSVIDTTL = &metav1.Duration{Duration: entry.JWTSVIDTTL}
+	}
+	return outEntry
+}
+
+// marshalOutput marshals the output of a command in the given format,
+// either yaml or json.
+func marshalOutput(out interface{}, format string) ([]byte, error) {
+	if format == "json" {
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return yaml.Marshal(out)
+}
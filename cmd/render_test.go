@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const renderManifests = `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ClusterSPIFFEID
+metadata:
+  name: workloads
+spec:
+  spiffeIDTemplate: "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}"
+  ttl: 1h
+  autoPopulateDNSNames: true
+---
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ClusterSPIFFEID
+metadata:
+  name: workloads-copy
+spec:
+  spiffeIDTemplate: "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}"
+  ttl: 1h
+  autoPopulateDNSNames: true
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: workload
+  namespace: workload
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: service
+  namespace: workload
+subsets:
+- addresses:
+  - ip: 10.0.0.1
+    targetRef:
+      kind: Pod
+      name: pod
+`
+
+// renderCluster is formatted as kubectl get -o yaml would.
+const renderCluster = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: workload
+- apiVersion: v1
+  kind: Node
+  metadata:
+    name: node
+    uid: node-uid
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: pod
+    namespace: workload
+    uid: pod-uid
+  spec:
+    nodeName: node
+    serviceAccountName: sa
+    containers: []
+`
+
+const renderExpected = `clusterSPIFFEIDs:
+  workloads:
+    stats:
+      entriesMasked: 0
+      entriesToSet: 1
+      entryFailures: 0
+      namespacesIgnored: 0
+      namespacesSelected: 1
+      podEntryPolicyViolations: 0
+      podEntryRenderFailures: 0
+      podsSelected: 1
+  workloads-copy:
+    stats:
+      entriesMasked: 1
+      entriesToSet: 0
+      entryFailures: 0
+      namespacesIgnored: 0
+      namespacesSelected: 1
+      podEntryPolicyViolations: 0
+      podEntryRenderFailures: 0
+      podsSelected: 1
+entries:
+- declaredBy: ClusterSPIFFEID/workloads
+  dnsNames:
+  - service
+  - service.workload
+  - service.workload.svc
+  - service.workload.svc.cluster.local
+  parentID: spiffe://example.org/spire/agent/k8s_psat/cluster/node-uid
+  selectors:
+  - k8s:pod-uid:pod-uid
+  spiffeID: spiffe://example.org/ns/workload/sa/sa
+  x509SVIDTTL: 1h0m0s
+- declaredBy: ClusterSPIFFEID/workloads-copy
+  dnsNames:
+  - service
+  - service.workload
+  - service.workload.svc
+  - service.workload.svc.cluster.local
+  maskedBy: ClusterSPIFFEID/workloads
+  parentID: spiffe://example.org/spire/agent/k8s_psat/cluster/node-uid
+  selectors:
+  - k8s:pod-uid:pod-uid
+  spiffeID: spiffe://example.org/ns/workload/sa/sa
+  x509SVIDTTL: 1h0m0s
+`
+
+func TestRunRender(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "manifests.yaml"), []byte(renderManifests), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cluster.yaml"), []byte(renderCluster), 0600))
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	code := runRender([]string{
+		"-f", dir,
+		"-trust-domain", "example.org",
+		"-cluster-name", "cluster",
+		"-cluster-domain", "cluster.local",
+	}, stdout, stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, renderExpected, stdout.String())
+	assert.Contains(t, stderr.String(), "Skipping Deployment")
+}
+
+func TestRunRenderUsage(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		args        []string
+		expectedErr string
+	}{
+		{
+			name:        "No manifests",
+			args:        []string{"-trust-domain", "example.org"},
+			expectedErr: "Usage:",
+		},
+		{
+			name:        "Invalid output format",
+			args:        []string{"-f", "manifests.yaml", "-o", "xml"},
+			expectedErr: `invalid output format "xml"`,
+		},
+		{
+			name:        "No trust domain",
+			args:        []string{"-f", "manifests.yaml", "-cluster-name", "cluster"},
+			expectedErr: "trust domain is required configuration",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stderr := new(bytes.Buffer)
+			code := runRender(test.args, new(bytes.Buffer), stderr)
+			assert.NotEqual(t, 0, code)
+			assert.Contains(t, stderr.String(), test.expectedErr)
+		})
+	}
+}
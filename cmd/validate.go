@@ -0,0 +1,129 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+)
+
+// sampleNode is the node the parent ID template is rendered against when
+// no sample node is provided.
+var sampleNode = &corev1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "sample-node",
+		UID:  "2f6b3a7e-5a0c-4d0f-9c43-0e8f1d7b9a61",
+	},
+}
+
+// runValidateConfig implements the validate-config command, which loads the
+// config file and runs every check the manager would at startup, without
+// dialing SPIRE Server or Kubernetes. Every problem found is reported. It
+// returns the process exit code.
+func runValidateConfig(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var configFileFlag string
+	var expandEnvFlag bool
+	var sampleNodeFlag string
+	flags.StringVar(&configFileFlag, "config", "", "The controller manager config file to validate")
+	flags.BoolVar(&expandEnvFlag, "expand-env", false, "Expand environment variables in SPIRE Controller Manager config file")
+	flags.StringVar(&sampleNodeFlag, "sample-node", "", "A Node manifest to render the parent ID template against. Defaults to a node with only a name and UID.")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s validate-config -config <file> [flags]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(stderr, "Validates the controller manager config file and renders the parent ID template")
+		fmt.Fprintln(stderr, "against a sample node. Exits with 1 if the configuration is invalid.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if configFileFlag == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	node := sampleNode
+	if sampleNodeFlag != "" {
+		var err error
+		node, err = loadSampleNode(sampleNodeFlag)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+
+	mainConfig, err := loadConfig(configFileFlag, expandEnvFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	_, errs := validateConfig(&mainConfig)
+
+	// The parent ID can only be rendered if the template parsed and there is
+	// a valid trust domain to render it in.
+	trustDomain, tdErr := spiffeid.TrustDomainFromString(mainConfig.ctrlConfig.TrustDomain)
+	if tdErr == nil && (mainConfig.ctrlConfig.ParentIDTemplate == "" || mainConfig.parentIDTemplate != nil) {
+		parentID, err := spireentry.RenderParentID(mainConfig.parentIDTemplate, node, trustDomain, mainConfig.ctrlConfig.ClusterName, mainConfig.ctrlConfig.ClusterDomain)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to render parent ID template against node %q: %w", node.Name, err))
+		} else {
+			fmt.Fprintf(stdout, "Parent ID for node %q: %s\n", node.Name, parentID)
+		}
+	}
+
+	if len(errs) > 0 {
+		fmt.Fprintln(stderr, "Configuration is invalid:")
+		for _, err := range errs {
+			fmt.Fprintf(stderr, "  - %v\n", err)
+		}
+		return 1
+	}
+	if mainConfig.ctrlConfig.ClusterDomain == "" {
+		fmt.Fprintln(stdout, "Cluster domain is not set and will be autodetected at startup")
+	}
+	fmt.Fprintln(stdout, "Configuration is valid")
+	return 0
+}
+
+func loadSampleNode(path string) (*corev1.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sample node: %w", err)
+	}
+	obj, _, err := serializer.NewCodecFactory(scheme).UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode sample node: %w", err)
+	}
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return nil, fmt.Errorf("sample node manifest %q is a %T, not a Node", path, obj)
+	}
+	return node, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunValidateConfig(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		config         string
+		sampleNode     string
+		expectedCode   int
+		expectedStdout []string
+		expectedErrs   []string
+	}{
+		{
+			name: "Valid",
+			config: `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+logLevel: info
+clusterName: cluster
+clusterDomain: cluster.local
+trustDomain: example.org
+`,
+			expectedStdout: []string{
+				`Parent ID for node "sample-node": spiffe://example.org/spire/agent/k8s_psat/cluster/2f6b3a7e-5a0c-4d0f-9c43-0e8f1d7b9a61`,
+				"Configuration is valid",
+			},
+		},
+		{
+			name: "Parent ID template rendered against sample node",
+			config: `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+logLevel: info
+clusterName: cluster
+clusterDomain: cluster.local
+trustDomain: example.org
+parentIDTemplate: "spiffe://{{ .TrustDomain }}/node/{{ index .NodeMeta.Labels \"zone\" }}"
+`,
+			sampleNode: `
+apiVersion: v1
+kind: Node
+metadata:
+  name: node
+  labels:
+    zone: a
+`,
+			expectedStdout: []string{
+				`Parent ID for node "node": spiffe://example.org/node/a`,
+				"Configuration is valid",
+			},
+		},
+		{
+			name: "Parent ID template fails to render against sample node",
+			config: `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+logLevel: info
+clusterName: cluster
+clusterDomain: cluster.local
+trustDomain: example.org
+parentIDTemplate: "spiffe://other.org/{{ .NodeMeta.Name }}"
+`,
+			expectedCode: 1,
+			expectedErrs: []string{
+				`failed to render parent ID template against node "sample-node": invalid SPIFFE ID: expected trust domain "example.org" but got "other.org"`,
+			},
+		},
+		{
+			name: "Invalid trust domain profiles",
+			config: `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+logLevel: info
+trustDomain: example.org
+clusterName: test
+trustDomainProfiles:
+  - name: a
+    trustDomain: a.example.org
+    spireServerSocketPath: /spire-server-a/api.sock
+  - name: a
+    trustDomain: example.org
+    spireServerSocketPath: /spire-server/api.sock
+  - trustDomain: "Not A Trust Domain"
+`,
+			expectedCode: 1,
+			expectedErrs: []string{
+				`trust domain profile "a" is defined more than once`,
+				`trust domain profile "a": trust domain "example.org" is already in use`,
+				`trust domain profile "a": SPIRE server socket path "/spire-server/api.sock" is already in use`,
+				"trust domain profile 2: name is required",
+				`trust domain profile "": invalid trust domain name`,
+				`trust domain profile "": SPIRE server socket path is required`,
+			},
+		},
+		{
+			name: "Invalid audit outputs",
+			config: `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+logLevel: info
+trustDomain: example.org
+clusterName: test
+audit:
+  file:
+    maxSizeMB: -1
+  webhook:
+    url: "ftp://audit.example.org"
+    timeout: -1s
+`,
+			expectedCode: 1,
+			expectedErrs: []string{
+				"audit file path is required",
+				"audit file max size must not be negative",
+				`audit webhook URL "ftp://audit.example.org" must be an absolute http or https URL`,
+				"audit webhook timeout must not be negative",
+			},
+		},
+		{
+			name: "Every problem is reported",
+			config: `
+apiVersion: spire.spiffe.io/v1alpha1
+kind: ControllerManagerConfig
+logLevel: loud
+ignoreNamespaces:
+  - "kube-("
+parentIDTemplate: "{{ .NodeMeta.Name"
+entryIDPrefix: prefix
+entryIDPrefixCleanup: prefix
+entryRenderWorkers: -1
+`,
+			expectedCode: 1,
+			expectedErrs: []string{
+				"unable to compile ignore namespaces regex",
+				"unable to parse log level",
+				"unable to parse parent ID template",
+				"if entryIDPrefixCleanup is specified, it can not be the same value as entryIDPrefix",
+				"trust domain is required configuration",
+				"cluster name is required configuration",
+				"entry render workers must not be negative",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "config.yaml")
+			require.NoError(t, os.WriteFile(configPath, []byte(test.config), 0600))
+			args := []string{"-config", configPath}
+			if test.sampleNode != "" {
+				nodePath := filepath.Join(dir, "node.yaml")
+				require.NoError(t, os.WriteFile(nodePath, []byte(test.sampleNode), 0600))
+				args = append(args, "-sample-node", nodePath)
+			}
+
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			code := runValidateConfig(args, stdout, stderr)
+			assert.Equal(t, test.expectedCode, code, stderr.String())
+			for _, expected := range test.expectedStdout {
+				assert.Contains(t, stdout.String(), expected)
+			}
+			for _, expected := range test.expectedErrs {
+				assert.Contains(t, stderr.String(), expected)
+			}
+		})
+	}
+}
+
+func TestRunValidateConfigUsage(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	code := runValidateConfig(nil, new(bytes.Buffer), stderr)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "Usage:")
+}
@@ -16,6 +16,22 @@ limitations under the License.
 
 package controller
 
+import (
+	"regexp"
+
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
+	"github.com/spiffe/spire-controller-manager/pkg/namespace"
+)
+
 type EntryReconciler interface {
 	Trigger()
 }
+
+// isIgnoredNamespace returns whether the namespace is ignored, by the live
+// configuration if set, or the given ignore namespaces otherwise.
+func isIgnoredNamespace(liveConfig *liveconfig.Value, ignoreNamespaces []*regexp.Regexp, ns string) bool {
+	if liveConfig != nil {
+		ignoreNamespaces = liveConfig.Load().IgnoreNamespaces
+	}
+	return namespace.IsIgnored(ignoreNamespaces, ns)
+}
@@ -20,7 +20,7 @@ import (
 	"context"
 	"regexp"
 
-	"github.com/spiffe/spire-controller-manager/pkg/namespace"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
 	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -35,6 +35,9 @@ type EndpointsReconciler struct {
 	Scheme           *runtime.Scheme
 	Triggerer        reconciler.Triggerer
 	IgnoreNamespaces []*regexp.Regexp
+
+	// LiveConfig, if set, overrides IgnoreNamespaces.
+	LiveConfig *liveconfig.Value
 }
 
 //+kubebuilder:rbac:groups=spire.spiffe.io,resources=clusterspiffeids,verbs=get;list;watch;create;update;patch;delete
@@ -48,7 +51,7 @@ type EndpointsReconciler struct {
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *EndpointsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
-	if namespace.IsIgnored(r.IgnoreNamespaces, req.Namespace) {
+	if isIgnoredNamespace(r.LiveConfig, r.IgnoreNamespaces, req.Namespace) {
 		return ctrl.Result{}, nil
 	}
 
@@ -21,7 +21,7 @@ import (
 	"fmt"
 	"regexp"
 
-	"github.com/spiffe/spire-controller-manager/pkg/namespace"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
 	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -37,6 +37,9 @@ type PodReconciler struct {
 	Triggerer            reconciler.Triggerer
 	IgnoreNamespaces     []*regexp.Regexp
 	AutoPopulateDNSNames bool
+
+	// LiveConfig, if set, overrides IgnoreNamespaces.
+	LiveConfig *liveconfig.Value
 }
 
 //+kubebuilder:rbac:groups=spire.spiffe.io,resources=clusterspiffeids,verbs=get;list;watch;create;update;patch;delete
@@ -52,7 +55,7 @@ type PodReconciler struct {
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
-	if namespace.IsIgnored(r.IgnoreNamespaces, req.Namespace) {
+	if isIgnoredNamespace(r.LiveConfig, r.IgnoreNamespaces, req.Namespace) {
 		return ctrl.Result{}, nil
 	}
 
@@ -72,21 +75,7 @@ func (r *PodReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager)
 			log.FromContext(ctx).Error(nil, "unexpected type indexing fields", "type", fmt.Sprintf("%T", rawObj), "expecteed", "*corev1.Endpoints")
 			return nil
 		}
-		var podUIDs []string
-		for _, subset := range endpoints.Subsets {
-			for _, address := range subset.Addresses {
-				if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
-					podUIDs = append(podUIDs, string(address.TargetRef.UID))
-				}
-			}
-			for _, address := range subset.NotReadyAddresses {
-				if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
-					podUIDs = append(podUIDs, string(address.TargetRef.UID))
-				}
-			}
-		}
-
-		return podUIDs
+		return reconciler.EndpointPodUIDs(endpoints)
 	})
 	if err != nil {
 		return err
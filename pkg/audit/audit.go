@@ -0,0 +1,335 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records an event for every change the controller manager
+// attempts to make to the entries and federation relationships on SPIRE
+// Server, whether or not it succeeds.
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc/codes"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+type Kind string
+
+const (
+	KindEntry                  Kind = "entry"
+	KindFederationRelationship Kind = "federationRelationship"
+)
+
+// Event is a change the controller manager attempted to make to SPIRE
+// Server.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+	Kind   Kind      `json:"kind"`
+
+	// TrustDomainProfile is the trust domain profile of the SPIRE Server
+	// that was changed, or empty for the main trust domain.
+	TrustDomainProfile string `json:"trustDomainProfile,omitempty"`
+
+	// Before is the entry or federation relationship before the change. It
+	// is not set for creates.
+	Before any `json:"before,omitempty"`
+
+	// After is the entry or federation relationship the change was to
+	// result in. It is not set for deletes.
+	After any `json:"after,omitempty"`
+
+	// ChangedFields are the fields changed by an update.
+	ChangedFields []string `json:"changedFields,omitempty"`
+
+	// Source is the object the change was declared by. It is not set for
+	// deletes of objects that are no longer declared.
+	Source *Object `json:"source,omitempty"`
+
+	// Pod is the pod a ClusterSPIFFEID entry was rendered for.
+	Pod *Object `json:"pod,omitempty"`
+
+	Result Result `json:"result"`
+}
+
+// Object identifies a Kubernetes object.
+type Object struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+}
+
+// Result is the outcome of the change, as reported by SPIRE Server.
+type Result struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// ResultFromStatus returns the result of a change from its status.
+func ResultFromStatus(status spireapi.Status) Result {
+	return Result{Code: status.Code.String(), Message: status.Message}
+}
+
+// ResultFromError returns the result of a change that failed as a whole,
+// e.g. because SPIRE Server could not be reached.
+func ResultFromError(err error) Result {
+	if err == nil {
+		return Result{Code: codes.OK.String()}
+	}
+	return Result{Code: codes.Unknown.String(), Message: err.Error()}
+}
+
+// Sink writes audit events somewhere. Sinks must be safe for concurrent
+// use, since every reconciler records events.
+type Sink interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+
+	// Write writes the events.
+	Write(ctx context.Context, events []Event) error
+
+	// Close flushes and releases the resources held by the sink.
+	Close() error
+}
+
+// DefaultQueueSize is how many batches of events may be waiting to be
+// written to each sink before further events are dropped.
+const DefaultQueueSize = 1024
+
+// Recorder records events to every sink. A nil Recorder records nothing, so
+// that reconcilers do not need to check whether auditing is enabled.
+//
+// Each sink is written to by its own goroutine from a buffered queue, so
+// that a slow sink, e.g. an unresponsive webhook, neither holds up the
+// changes being made nor the other sinks.
+type Recorder struct {
+	queues []*sinkQueue
+	now    func() time.Time
+	wg     sync.WaitGroup
+
+	mtx    sync.RWMutex
+	closed bool
+}
+
+// NewRecorder returns a recorder writing to the sinks.
+func NewRecorder(sinks ...Sink) *Recorder {
+	return newRecorder(DefaultQueueSize, sinks...)
+}
+
+func newRecorder(queueSize int, sinks ...Sink) *Recorder {
+	r := &Recorder{now: time.Now}
+	for _, sink := range sinks {
+		q := &sinkQueue{sink: sink, batches: make(chan batch, queueSize)}
+		r.queues = append(r.queues, q)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			q.run()
+		}()
+	}
+	return r
+}
+
+// Record timestamps the events and queues them to be written to every sink.
+// Failing to write to a sink, or to queue the events because the sink has
+// fallen too far behind, is logged and counted in the audit_event_failures
+// metric, but does not stop the change being made.
+func (r *Recorder) Record(ctx context.Context, events ...Event) {
+	if r == nil || len(events) == 0 {
+		return
+	}
+	now := r.now()
+	for i := range events {
+		if events[i].Time.IsZero() {
+			events[i].Time = now
+		}
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	log := log.FromContext(ctx)
+	if r.closed {
+		log.Error(errors.New("recorder is closed"), "Failed to record audit events", "count", len(events))
+		return
+	}
+	for _, q := range r.queues {
+		q.push(batch{log: log, events: events})
+	}
+}
+
+// Close writes the events still queued and closes every sink.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mtx.Lock()
+	if !r.closed {
+		r.closed = true
+		for _, q := range r.queues {
+			close(q.batches)
+		}
+	}
+	r.mtx.Unlock()
+	r.wg.Wait()
+
+	var errs []error
+	for _, q := range r.queues {
+		errs = append(errs, q.sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// batch is a set of events to write, along with the logger of the caller
+// that recorded them.
+type batch struct {
+	log    logr.Logger
+	events []Event
+}
+
+// sinkQueue holds the batches waiting to be written to a sink.
+type sinkQueue struct {
+	sink    Sink
+	batches chan batch
+}
+
+func (q *sinkQueue) push(b batch) {
+	select {
+	case q.batches <- b:
+	default:
+		b.log.Error(errors.New("queue is full"), "Failed to record audit events", "sink", q.sink.Name(), "count", len(b.events))
+		metrics.PromCounterVecs[metrics.AuditEventFailures].WithLabelValues(q.sink.Name()).Add(float64(len(b.events)))
+	}
+}
+
+func (q *sinkQueue) run() {
+	for b := range q.batches {
+		// The events are written even if the reconcile that recorded them
+		// has since been cancelled.
+		if err := q.sink.Write(context.Background(), b.events); err != nil {
+			b.log.Error(err, "Failed to record audit events", "sink", q.sink.Name(), "count", len(b.events))
+			metrics.PromCounterVecs[metrics.AuditEventFailures].WithLabelValues(q.sink.Name()).Add(float64(len(b.events)))
+		}
+	}
+}
+
+// Entry is the JSON representation of an entry in an event. The debug
+// endpoint represents entries the same way.
+type Entry struct {
+	ID             string   `json:"id,omitempty"`
+	SPIFFEID       string   `json:"spiffeID"`
+	ParentID       string   `json:"parentID"`
+	Selectors      []string `json:"selectors"`
+	X509SVIDTTL    string   `json:"x509SVIDTTL,omitempty"`
+	JWTSVIDTTL     string   `json:"jwtSVIDTTL,omitempty"`
+	FederatesWith  []string `json:"federatesWith,omitempty"`
+	DNSNames       []string `json:"dnsNames,omitempty"`
+	Hint           string   `json:"hint,omitempty"`
+	Admin          bool     `json:"admin,omitempty"`
+	Downstream     bool     `json:"downstream,omitempty"`
+	StoreSVID      bool     `json:"storeSVID,omitempty"`
+	RevisionNumber int64    `json:"revisionNumber,omitempty"`
+}
+
+// NewEntry returns the JSON representation of the entry.
+func NewEntry(entry spireapi.Entry) *Entry {
+	out := &Entry{
+		ID:             entry.ID,
+		SPIFFEID:       entry.SPIFFEID.String(),
+		ParentID:       entry.ParentID.String(),
+		Selectors:      make([]string, 0, len(entry.Selectors)),
+		DNSNames:       entry.DNSNames,
+		Hint:           entry.Hint,
+		Admin:          entry.Admin,
+		Downstream:     entry.Downstream,
+		StoreSVID:      entry.StoreSVID,
+		RevisionNumber: entry.RevisionNumber,
+	}
+	for _, selector := range entry.Selectors {
+		out.Selectors = append(out.Selectors, selector.Type+":"+selector.Value)
+	}
+	for _, td := range entry.FederatesWith {
+		out.FederatesWith = append(out.FederatesWith, td.Name())
+	}
+	if entry.X509SVIDTTL != 0 {
+		out.X509SVIDTTL = entry.X509SVIDTTL.String()
+	}
+	if entry.JWTSVIDTTL != 0 {
+		out.JWTSVIDTTL = entry.JWTSVIDTTL.String()
+	}
+	return out
+}
+
+// FederationRelationship is the JSON representation of a federation
+// relationship in an event. The trust domain bundle is not included.
+type FederationRelationship struct {
+	TrustDomain           string `json:"trustDomain"`
+	BundleEndpointURL     string `json:"bundleEndpointURL"`
+	BundleEndpointProfile string `json:"bundleEndpointProfile"`
+	EndpointSPIFFEID      string `json:"endpointSPIFFEID,omitempty"`
+}
+
+// NewFederationRelationship returns the JSON representation of the
+// federation relationship.
+func NewFederationRelationship(fr spireapi.FederationRelationship) *FederationRelationship {
+	out := &FederationRelationship{
+		TrustDomain:       fr.TrustDomain.Name(),
+		BundleEndpointURL: fr.BundleEndpointURL,
+	}
+	if fr.BundleEndpointProfile != nil {
+		out.BundleEndpointProfile = fr.BundleEndpointProfile.Name()
+	}
+	switch profile := fr.BundleEndpointProfile.(type) {
+	case spireapi.HTTPSSPIFFEProfile:
+		out.EndpointSPIFFEID = profile.EndpointSPIFFEID.String()
+	case *spireapi.HTTPSSPIFFEProfile:
+		out.EndpointSPIFFEID = profile.EndpointSPIFFEID.String()
+	}
+	return out
+}
+
+// FederationRelationshipChangedFields returns the fields that differ
+// between the federation relationships.
+func FederationRelationshipChangedFields(before, after spireapi.FederationRelationship) []string {
+	var changed []string
+	if before.BundleEndpointURL != after.BundleEndpointURL {
+		changed = append(changed, "bundleEndpointURL")
+	}
+	if before.BundleEndpointProfile == nil || after.BundleEndpointProfile == nil {
+		if before.BundleEndpointProfile != after.BundleEndpointProfile {
+			changed = append(changed, "bundleEndpointProfile")
+		}
+	} else if !before.BundleEndpointProfile.Equal(after.BundleEndpointProfile) {
+		changed = append(changed, "bundleEndpointProfile")
+	}
+	return changed
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+func TestRecorder(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ok := &memorySink{name: "ok"}
+	failing := &memorySink{name: "failing", err: errors.New("oh no")}
+	r := NewRecorder(ok, failing)
+	r.now = func() time.Time { return now }
+	failures := testutil.ToFloat64(metrics.PromCounterVecs[metrics.AuditEventFailures].WithLabelValues("failing"))
+
+	r.Record(context.Background(), Event{Action: ActionCreate}, Event{Action: ActionDelete})
+	require.NoError(t, r.Close())
+
+	// Every sink is written to, even after one fails, before it is closed.
+	require.Len(t, ok.events, 2)
+	assert.Equal(t, now, ok.events[0].Time)
+	assert.Equal(t, now, ok.events[1].Time)
+	assert.Len(t, failing.events, 2)
+	assert.Equal(t, failures+2, testutil.ToFloat64(metrics.PromCounterVecs[metrics.AuditEventFailures].WithLabelValues("failing")))
+	assert.True(t, ok.closed)
+	assert.True(t, failing.closed)
+
+	// Events recorded after the recorder is closed are dropped.
+	r.Record(context.Background(), Event{Action: ActionCreate})
+	assert.Len(t, ok.events, 2)
+}
+
+func TestRecorderDoesNotWaitForSlowSinks(t *testing.T) {
+	release := make(chan struct{})
+	slow := &memorySink{name: "slow", block: release, started: make(chan struct{}, 3)}
+	ok := &memorySink{name: "ok", written: make(chan struct{}, 3)}
+	r := newRecorder(1, slow, ok)
+	failures := testutil.ToFloat64(metrics.PromCounterVecs[metrics.AuditEventFailures].WithLabelValues("slow"))
+
+	// The slow sink holds up neither the caller nor the other sink...
+	for i := 0; i < 3; i++ {
+		r.Record(context.Background(), Event{Action: ActionCreate})
+		<-ok.written
+		if i == 0 {
+			<-slow.started
+		}
+	}
+	assert.Len(t, ok.events, 3)
+
+	// ...and the events that do not fit in its queue are dropped. The
+	// first is being written and the second is queued.
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.PromCounterVecs[metrics.AuditEventFailures].WithLabelValues("slow")))
+
+	close(release)
+	require.NoError(t, r.Close())
+	assert.Len(t, slow.events, 2)
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	r.Record(context.Background(), Event{Action: ActionCreate})
+	assert.NoError(t, r.Close())
+}
+
+func TestResult(t *testing.T) {
+	assert.Equal(t, Result{Code: "OK"}, ResultFromStatus(spireapi.Status{Code: codes.OK}))
+	assert.Equal(t, Result{Code: "AlreadyExists", Message: "similar entry"}, ResultFromStatus(spireapi.Status{Code: codes.AlreadyExists, Message: "similar entry"}))
+	assert.Equal(t, Result{Code: "Unknown", Message: "oh no"}, ResultFromError(errors.New("oh no")))
+}
+
+func TestNewEntry(t *testing.T) {
+	entry := NewEntry(spireapi.Entry{
+		ID:            "id",
+		SPIFFEID:      spiffeid.RequireFromString("spiffe://example.org/workload"),
+		ParentID:      spiffeid.RequireFromString("spiffe://example.org/node"),
+		Selectors:     []spireapi.Selector{{Type: "k8s", Value: "ns:default"}},
+		X509SVIDTTL:   time.Hour,
+		FederatesWith: []spiffeid.TrustDomain{spiffeid.RequireTrustDomainFromString("other.org")},
+		DNSNames:      []string{"workload"},
+		Admin:         true,
+	})
+	assert.Equal(t, &Entry{
+		ID:            "id",
+		SPIFFEID:      "spiffe://example.org/workload",
+		ParentID:      "spiffe://example.org/node",
+		Selectors:     []string{"k8s:ns:default"},
+		X509SVIDTTL:   "1h0m0s",
+		FederatesWith: []string{"other.org"},
+		DNSNames:      []string{"workload"},
+		Admin:         true,
+	}, entry)
+}
+
+func TestFederationRelationship(t *testing.T) {
+	web := spireapi.FederationRelationship{
+		TrustDomain:           spiffeid.RequireTrustDomainFromString("other.org"),
+		BundleEndpointURL:     "https://other.org/bundle",
+		BundleEndpointProfile: spireapi.HTTPSWebProfile{},
+	}
+	spiffe := spireapi.FederationRelationship{
+		TrustDomain:       spiffeid.RequireTrustDomainFromString("other.org"),
+		BundleEndpointURL: "https://other.org:8443",
+		BundleEndpointProfile: spireapi.HTTPSSPIFFEProfile{
+			EndpointSPIFFEID: spiffeid.RequireFromString("spiffe://other.org/spire/server"),
+		},
+	}
+
+	assert.Equal(t, &FederationRelationship{
+		TrustDomain:           "other.org",
+		BundleEndpointURL:     "https://other.org:8443",
+		BundleEndpointProfile: "https_spiffe",
+		EndpointSPIFFEID:      "spiffe://other.org/spire/server",
+	}, NewFederationRelationship(spiffe))
+
+	assert.Empty(t, FederationRelationshipChangedFields(web, web))
+	assert.Equal(t, []string{"bundleEndpointURL", "bundleEndpointProfile"}, FederationRelationshipChangedFields(web, spiffe))
+}
+
+type memorySink struct {
+	name   string
+	err    error
+	events []Event
+	closed bool
+
+	// block, if set, holds up writes until it is closed. Each write is
+	// signaled on started, if set, before it is held up, and on written,
+	// if set, once the events are appended.
+	block   chan struct{}
+	started chan struct{}
+	written chan struct{}
+}
+
+func (s *memorySink) Name() string {
+	return s.name
+}
+
+func (s *memorySink) Write(_ context.Context, events []Event) error {
+	if s.started != nil {
+		s.started <- struct{}{}
+	}
+	if s.block != nil {
+		<-s.block
+	}
+	s.events = append(s.events, events...)
+	if s.written != nil {
+		s.written <- struct{}{}
+	}
+	return s.err
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFileMaxSizeMB   = 100
+	DefaultFileMaxBackups  = 5
+	DefaultWebhookTimeout  = 5 * time.Second
+	webhookMaxErrorBodyLen = 512
+)
+
+// WriterSink writes each event as a line of JSON to a writer.
+type WriterSink struct {
+	name string
+
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+// NewStdoutSink returns a sink writing JSON lines to stdout.
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink("stdout", os.Stdout)
+}
+
+// NewWriterSink returns a sink writing JSON lines to the writer.
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{name: name, w: w}
+}
+
+func (s *WriterSink) Name() string {
+	return s.name
+}
+
+func (s *WriterSink) Write(_ context.Context, events []Event) error {
+	data, err := marshalLines(events)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// FileSinkConfig configures a FileSink.
+type FileSinkConfig struct {
+	// Path is the path of the file.
+	Path string
+
+	// MaxSizeMB is the size in megabytes the file may grow to before it is
+	// rotated. Defaults to DefaultFileMaxSizeMB.
+	MaxSizeMB int
+
+	// MaxBackups is how many rotated files are kept. Defaults to
+	// DefaultFileMaxBackups.
+	MaxBackups int
+}
+
+// FileSink writes each event as a line of JSON to a file. Once the file
+// reaches its maximum size it is renamed to <path>.1, any older files are
+// shifted up by one, and the oldest beyond the maximum number of backups is
+// removed.
+type FileSink struct {
+	config  FileSinkConfig
+	maxSize int64
+
+	mtx  sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewFileSink opens the file, appending to it if it already exists.
+func NewFileSink(config FileSinkConfig) (*FileSink, error) {
+	if config.Path == "" {
+		return nil, errors.New("audit file path is required")
+	}
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = DefaultFileMaxSizeMB
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = DefaultFileMaxBackups
+	}
+	s := &FileSink{
+		config:  config,
+		maxSize: int64(config.MaxSizeMB) * 1024 * 1024,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Write(_ context.Context, events []Event) error {
+	data, err := marshalLines(events)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.f == nil {
+		return errors.New("audit file is closed")
+	}
+	if s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit file: %w", err)
+	}
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("failed to close audit file: %w", err)
+	}
+	s.f = nil
+
+	if err := os.Remove(s.backupPath(s.config.MaxBackups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove oldest audit file: %w", err)
+	}
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate audit file: %w", err)
+		}
+	}
+	if err := os.Rename(s.config.Path, s.backupPath(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit file: %w", err)
+	}
+	return s.open()
+}
+
+func (s *FileSink) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.config.Path, n)
+}
+
+// WebhookSinkConfig configures a WebhookSink.
+type WebhookSinkConfig struct {
+	// URL is the URL the events are posted to.
+	URL string
+
+	// Timeout is how long a post may take. Defaults to
+	// DefaultWebhookTimeout.
+	Timeout time.Duration
+}
+
+// WebhookSink posts the events recorded together as a JSON array. A
+// response other than 2xx is a failure.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a sink posting events to the URL.
+func NewWebhookSink(config WebhookSinkConfig) (*WebhookSink, error) {
+	if config.URL == "" {
+		return nil, errors.New("audit webhook URL is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	return &WebhookSink{
+		url:    config.URL,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Write(ctx context.Context, events []Event) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit events: %w", err)
+	}
+	// The events are posted even if the reconcile that recorded them has
+	// been canceled, since the changes may already have been made.
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create audit webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post audit events: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorBodyLen))
+		return fmt.Errorf("audit webhook returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func marshalLines(events []Event) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return nil, fmt.Errorf("failed to marshal audit event: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterSink(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sink := NewWriterSink("buffer", buf)
+	require.NoError(t, sink.Write(context.Background(), []Event{
+		{Action: ActionCreate, Kind: KindEntry},
+		{Action: ActionDelete, Kind: KindFederationRelationship},
+	}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, ActionDelete, event.Action)
+	assert.Equal(t, KindFederationRelationship, event.Kind)
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(FileSinkConfig{Path: path, MaxBackups: 2})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	// Rotate after every write.
+	sink.maxSize = 1
+	for _, action := range []Action{ActionCreate, ActionUpdate, ActionDelete, ActionCreate} {
+		require.NoError(t, sink.Write(context.Background(), []Event{{Action: action}}))
+	}
+
+	// The oldest event is dropped once there are more than two backups.
+	assert.Equal(t, ActionCreate, readActions(t, path)[0])
+	assert.Equal(t, ActionDelete, readActions(t, path+".1")[0])
+	assert.Equal(t, ActionUpdate, readActions(t, path+".2")[0])
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, action := range []Action{ActionCreate, ActionDelete} {
+		sink, err := NewFileSink(FileSinkConfig{Path: path})
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(context.Background(), []Event{{Action: action}}))
+		require.NoError(t, sink.Close())
+	}
+	assert.Equal(t, []Action{ActionCreate, ActionDelete}, readActions(t, path))
+
+	sink, err := NewFileSink(FileSinkConfig{Path: path})
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+	assert.Error(t, sink.Write(context.Background(), []Event{{Action: ActionCreate}}))
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []Event
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("nope"))
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookSinkConfig{URL: server.URL})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(context.Background(), []Event{{Action: ActionCreate}, {Action: ActionDelete}}))
+	require.Len(t, received, 2)
+	assert.Equal(t, ActionDelete, received[1].Action)
+
+	status = http.StatusInternalServerError
+	assert.EqualError(t, sink.Write(context.Background(), []Event{{Action: ActionCreate}}), "audit webhook returned 500 Internal Server Error: nope")
+}
+
+func readActions(t *testing.T, path string) []Action {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var actions []Action
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event Event
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package entryexport exports entries that were created on SPIRE Server
+// outside of the controller manager as equivalent ClusterStaticEntries, so
+// that they can be brought under management.
+package entryexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc/codes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// Filter selects the entries to export. Zero fields do not filter.
+type Filter struct {
+	// ParentID selects entries with this parent ID.
+	ParentID spiffeid.ID
+
+	// SPIFFEIDPattern selects entries with a SPIFFE ID matching the pattern.
+	SPIFFEIDPattern *regexp.Regexp
+
+	// WithoutIDPrefix selects entries whose ID does not start with the
+	// prefix, i.e. entries not owned by a controller manager configured with
+	// it as its entry ID prefix.
+	WithoutIDPrefix string
+}
+
+// Matches returns whether the entry is selected by the filter.
+func (f Filter) Matches(entry spireapi.Entry) bool {
+	if !f.ParentID.IsZero() && entry.ParentID != f.ParentID {
+		return false
+	}
+	if f.SPIFFEIDPattern != nil && !f.SPIFFEIDPattern.MatchString(entry.SPIFFEID.String()) {
+		return false
+	}
+	if f.WithoutIDPrefix != "" && strings.HasPrefix(entry.ID, f.WithoutIDPrefix) {
+		return false
+	}
+	return true
+}
+
+// Select returns the entries selected by the filter, sorted by ID.
+func Select(entries []spireapi.Entry, filter Filter) []spireapi.Entry {
+	var selected []spireapi.Entry
+	for _, entry := range entries {
+		if filter.Matches(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].ID < selected[j].ID
+	})
+	return selected
+}
+
+// ClusterStaticEntries returns a ClusterStaticEntry declaring each entry,
+// in the same order. Each is named after the ID of its entry, adjusted to be
+// a valid object name where needed. If className is set, the
+// ClusterStaticEntries are assigned to that class.
+func ClusterStaticEntries(entries []spireapi.Entry, className string) []spirev1alpha1.ClusterStaticEntry {
+	out := make([]spirev1alpha1.ClusterStaticEntry, 0, len(entries))
+	names := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		name := objectName(entry.ID)
+		names[name]++
+		if n := names[name]; n > 1 {
+			name = fmt.Sprintf("%s-%d", name, n)
+		}
+		out = append(out, spirev1alpha1.ClusterStaticEntry{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: spirev1alpha1.GroupVersion.String(),
+				Kind:       "ClusterStaticEntry",
+			},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       clusterStaticEntrySpec(entry, className),
+		})
+	}
+	return out
+}
+
+// Undeclared returns the IDs of the entries that no declared entry has the
+// same SPIFFE ID, parent ID and selectors as, i.e. that a controller manager
+// declaring the given entries would not adopt.
+func Undeclared(entries, declared []spireapi.Entry) []string {
+	keys := make(map[string]struct{}, len(declared))
+	for _, entry := range declared {
+		keys[entryKey(entry)] = struct{}{}
+	}
+	var undeclared []string
+	for _, entry := range entries {
+		if _, ok := keys[entryKey(entry)]; !ok {
+			undeclared = append(undeclared, entry.ID)
+		}
+	}
+	return undeclared
+}
+
+// entryKey returns the SPIFFE ID, parent ID and selectors of the entry,
+// which SPIRE Server allows only one entry to have.
+func entryKey(entry spireapi.Entry) string {
+	selectors := make([]string, 0, len(entry.Selectors))
+	for _, selector := range entry.Selectors {
+		selectors = append(selectors, selector.Type+":"+selector.Value)
+	}
+	sort.Strings(selectors)
+	return strings.Join(append([]string{entry.SPIFFEID.String(), entry.ParentID.String()}, selectors...), "\x00")
+}
+
+// Retag recreates the entries with IDs that start with the prefix, so that
+// a controller manager configured with it as its entry ID prefix adopts
+// them rather than creating duplicates. The new ID is the prefix followed by
+// the original ID. Entries that already have the prefix are left alone.
+// Entries whose ID has another prefix belong to another controller manager,
+// so nothing is retagged if any are given.
+//
+// SPIRE Server does not allow an entry ID to change, nor two similar entries
+// to exist, so each entry is deleted before it is recreated. Workloads can
+// fail to be issued an SVID for the entry in between. If an entry cannot be
+// recreated, the original entry is restored. Retagging is only safe once a
+// ClusterStaticEntry declaring each entry has been applied, since the
+// controller manager deletes the retagged entries it does not declare.
+func Retag(ctx context.Context, entryClient spireapi.EntryClient, entries []spireapi.Entry, prefix string) error {
+	if prefix == "" {
+		return errors.New("entry ID prefix is required")
+	}
+
+	var toRetag []spireapi.Entry
+	var owned []string
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry.ID, prefix):
+		case strings.Contains(entry.ID, "."):
+			// Entry ID prefixes end with a dot, which SPIRE Server
+			// generated IDs never contain.
+			owned = append(owned, entry.ID)
+		default:
+			toRetag = append(toRetag, entry)
+		}
+	}
+	if len(owned) > 0 {
+		return fmt.Errorf("entries are owned by another controller manager: %s", strings.Join(owned, ", "))
+	}
+	if len(toRetag) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(toRetag))
+	for _, entry := range toRetag {
+		ids = append(ids, entry.ID)
+	}
+	statuses, err := entryClient.DeleteEntries(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to delete entries to retag: %w", err)
+	}
+
+	var errs []error
+	var deleted []spireapi.Entry
+	for i, status := range statuses {
+		if status.Code != codes.OK {
+			errs = append(errs, fmt.Errorf("failed to delete entry %q to retag: %w", ids[i], status.Err()))
+			continue
+		}
+		deleted = append(deleted, toRetag[i])
+	}
+	if len(deleted) == 0 {
+		return errors.Join(errs...)
+	}
+
+	retagged := make([]spireapi.Entry, 0, len(deleted))
+	for _, entry := range deleted {
+		entry.ID = prefix + entry.ID
+		entry.RevisionNumber = 0
+		retagged = append(retagged, entry)
+	}
+	results, err := entryClient.CreateEntries(ctx, retagged)
+	if err != nil {
+		results = make([]spireapi.EntryResult, len(retagged))
+		for i := range results {
+			results[i].Status = spireapi.Status{Code: codes.Unknown, Message: err.Error()}
+		}
+	}
+
+	var toRestore []spireapi.Entry
+	for i, result := range results {
+		if result.Code != codes.OK {
+			errs = append(errs, fmt.Errorf("failed to retag entry %q: %w", deleted[i].ID, result.Err()))
+			toRestore = append(toRestore, deleted[i])
+		}
+	}
+	if len(toRestore) > 0 {
+		results, err := entryClient.CreateEntries(ctx, toRestore)
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("failed to restore entries: %w", err))...)
+		}
+		for i, result := range results {
+			if result.Code != codes.OK {
+				errs = append(errs, fmt.Errorf("failed to restore entry %q: %w", toRestore[i].ID, result.Err()))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func clusterStaticEntrySpec(entry spireapi.Entry, className string) spirev1alpha1.ClusterStaticEntrySpec {
+	spec := spirev1alpha1.ClusterStaticEntrySpec{
+		SPIFFEID:    entry.SPIFFEID.String(),
+		ParentID:    entry.ParentID.String(),
+		Selectors:   make([]string, 0, len(entry.Selectors)),
+		X509SVIDTTL: metav1.Duration{Duration: entry.X509SVIDTTL},
+		JWTSVIDTTL:  metav1.Duration{Duration: entry.JWTSVIDTTL},
+		DNSNames:    entry.DNSNames,
+		Hint:        entry.Hint,
+		Admin:       entry.Admin,
+		Downstream:  entry.Downstream,
+		StoreSVID:   entry.StoreSVID,
+		ClassName:   className,
+	}
+	for _, selector := range entry.Selectors {
+		spec.Selectors = append(spec.Selectors, selector.Type+":"+selector.Value)
+	}
+	for _, td := range entry.FederatesWith {
+		spec.FederatesWith = append(spec.FederatesWith, td.Name())
+	}
+	return spec
+}
+
+// objectName returns the entry ID if it is a valid object name, or a valid
+// object name derived from it otherwise.
+func objectName(entryID string) string {
+	if len(validation.IsDNS1123Subdomain(entryID)) == 0 {
+		return entryID
+	}
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(entryID), "-")
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		name = name[:validation.DNS1123SubdomainMaxLength]
+	}
+	name = strings.Trim(name, ".-")
+	if name == "" {
+		return "entry"
+	}
+	return name
+}
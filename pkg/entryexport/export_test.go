@@ -0,0 +1,163 @@
+package entryexport
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/test/spirefake"
+)
+
+var (
+	td       = spiffeid.RequireTrustDomainFromString("example.org")
+	parentID = spiffeid.RequireFromString("spiffe://example.org/node")
+)
+
+func TestSelect(t *testing.T) {
+	entries := []spireapi.Entry{
+		newEntry("c", "/db", parentID),
+		newEntry("a", "/web", parentID),
+		newEntry("b", "/web", spiffeid.RequireFromString("spiffe://example.org/other")),
+		newEntry("prefix.d", "/web", parentID),
+	}
+
+	for _, test := range []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{
+			name:     "no filter",
+			expected: []string{"a", "b", "c", "prefix.d"},
+		},
+		{
+			name:     "parent ID",
+			filter:   Filter{ParentID: parentID},
+			expected: []string{"a", "c", "prefix.d"},
+		},
+		{
+			name:     "SPIFFE ID pattern",
+			filter:   Filter{SPIFFEIDPattern: regexp.MustCompile(`/web$`)},
+			expected: []string{"a", "b", "prefix.d"},
+		},
+		{
+			name:     "without ID prefix",
+			filter:   Filter{ParentID: parentID, WithoutIDPrefix: "prefix."},
+			expected: []string{"a", "c"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var ids []string
+			for _, entry := range Select(entries, test.filter) {
+				ids = append(ids, entry.ID)
+			}
+			assert.Equal(t, test.expected, ids)
+		})
+	}
+}
+
+func TestClusterStaticEntries(t *testing.T) {
+	entry := newEntry("0f9a2c5e-uuid", "/db", parentID)
+	entry.X509SVIDTTL = time.Hour
+	entry.FederatesWith = []spiffeid.TrustDomain{spiffeid.RequireTrustDomainFromString("example.net")}
+	entry.DNSNames = []string{"db"}
+	entry.Hint = "db"
+	entry.Admin = true
+
+	out := ClusterStaticEntries([]spireapi.Entry{
+		entry,
+		newEntry("Legacy_Entry", "/web", parentID),
+		newEntry("legacy-entry", "/web2", parentID),
+	}, "class")
+	require.Len(t, out, 3)
+
+	assert.Equal(t, spirev1alpha1.ClusterStaticEntry{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "spire.spiffe.io/v1alpha1",
+			Kind:       "ClusterStaticEntry",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: "0f9a2c5e-uuid"},
+		Spec: spirev1alpha1.ClusterStaticEntrySpec{
+			SPIFFEID:      "spiffe://example.org/db",
+			ParentID:      "spiffe://example.org/node",
+			Selectors:     []string{"unix:uid:0"},
+			FederatesWith: []string{"example.net"},
+			X509SVIDTTL:   metav1.Duration{Duration: time.Hour},
+			DNSNames:      []string{"db"},
+			Hint:          "db",
+			Admin:         true,
+			ClassName:     "class",
+		},
+	}, out[0])
+	assert.Equal(t, "legacy-entry", out[1].Name)
+	assert.Equal(t, "legacy-entry-2", out[2].Name)
+}
+
+func TestRetag(t *testing.T) {
+	spire := spirefake.Start(t, spirefake.Config{TrustDomain: td})
+	spire.SetEntries(
+		newAPIEntry("a", "/a"),
+		newAPIEntry("prefix.b", "/b"),
+	)
+	client, err := spireapi.DialSocket(spire.SocketPath())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	entries, err := client.ListEntries(context.Background())
+	require.NoError(t, err)
+
+	assert.EqualError(t, Retag(context.Background(), client, entries, ""), "entry ID prefix is required")
+
+	// Entries with another prefix are not taken over.
+	other := newEntry("other.c", "/c", parentID)
+	assert.EqualError(t, Retag(context.Background(), client, append(entries, other), "prefix."), "entries are owned by another controller manager: other.c")
+
+	require.NoError(t, Retag(context.Background(), client, entries, "prefix."))
+
+	retagged, err := client.ListEntries(context.Background())
+	require.NoError(t, err)
+	var ids []string
+	for _, entry := range retagged {
+		ids = append(ids, entry.ID)
+	}
+	assert.ElementsMatch(t, []string{"prefix.a", "prefix.b"}, ids)
+}
+
+func TestUndeclared(t *testing.T) {
+	a := newEntry("a", "/a", parentID)
+	b := newEntry("b", "/b", parentID)
+	declaredA := newEntry("", "/a", parentID)
+	declaredA.X509SVIDTTL = time.Hour
+	otherParent := newEntry("", "/b", spiffeid.RequireFromPath(td, "/other"))
+
+	// Only the SPIFFE ID, parent ID and selectors need to match.
+	assert.Equal(t, []string{"b"}, Undeclared([]spireapi.Entry{a, b}, []spireapi.Entry{declaredA, otherParent}))
+	assert.Empty(t, Undeclared(nil, nil))
+}
+
+func newEntry(id, path string, parentID spiffeid.ID) spireapi.Entry {
+	return spireapi.Entry{
+		ID:        id,
+		SPIFFEID:  spiffeid.RequireFromPath(td, path),
+		ParentID:  parentID,
+		Selectors: []spireapi.Selector{{Type: "unix", Value: "uid:0"}},
+	}
+}
+
+func newAPIEntry(id, path string) *apitypes.Entry {
+	return &apitypes.Entry{
+		Id:        id,
+		SpiffeId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: path},
+		ParentId:  &apitypes.SPIFFEID{TrustDomain: td.Name(), Path: parentID.Path()},
+		Selectors: []*apitypes.Selector{{Type: "unix", Value: "uid:0"}},
+	}
+}
@@ -41,6 +41,14 @@ func ListClusterSPIFFEIDs(ctx context.Context, c client.Client) ([]spirev1alpha1
 	return list.Items, nil
 }
 
+func ListClusterSPIFFEIDPolicies(ctx context.Context, c client.Client) ([]spirev1alpha1.ClusterSPIFFEIDPolicy, error) {
+	var list spirev1alpha1.ClusterSPIFFEIDPolicyList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
 func ListClusterFederatedTrustDomains(ctx context.Context, c client.Client) ([]spirev1alpha1.ClusterFederatedTrustDomain, error) {
 	var list spirev1alpha1.ClusterFederatedTrustDomainList
 	if err := c.List(ctx, &list); err != nil {
@@ -74,3 +82,19 @@ func ListNamespacePods(ctx context.Context, c client.Client, namespace string, p
 	}
 	return list.Items, nil
 }
+
+func ListPods(ctx context.Context, c client.Client) ([]corev1.Pod, error) {
+	list := new(corev1.PodList)
+	if err := c.List(ctx, list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func ListNodes(ctx context.Context, c client.Client) ([]corev1.Node, error) {
+	list := new(corev1.NodeList)
+	if err := c.List(ctx, list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -48,6 +48,33 @@ func TestListClusterSPIFFEIDs(t *testing.T) {
 	})
 }
 
+func TestListClusterSPIFFEIDPolicies(t *testing.T) {
+	foo := spirev1alpha1.ClusterSPIFFEIDPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+	}
+
+	t.Run("list fails", func(t *testing.T) {
+		client := FailList(k8stest.NewClientBuilder(t).Build())
+		actual, err := k8sapi.ListClusterSPIFFEIDPolicies(context.Background(), client)
+		assert.EqualError(t, err, errList.Error())
+		assert.Empty(t, actual)
+	})
+
+	t.Run("list empty", func(t *testing.T) {
+		client := k8stest.NewClientBuilder(t).Build()
+		actual, err := k8sapi.ListClusterSPIFFEIDPolicies(context.Background(), client)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("list not empty", func(t *testing.T) {
+		client := k8stest.NewClientBuilder(t).WithRuntimeObjects(&foo).Build()
+		actual, err := k8sapi.ListClusterSPIFFEIDPolicies(context.Background(), client)
+		assert.NoError(t, err)
+		assert.Equal(t, []spirev1alpha1.ClusterSPIFFEIDPolicy{foo}, actual)
+	})
+}
+
 func TestListClusterFederatedTrustDomains(t *testing.T) {
 	foo := spirev1alpha1.ClusterFederatedTrustDomain{
 		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
@@ -160,6 +187,66 @@ func TestListNamespacePods(t *testing.T) {
 	})
 }
 
+func TestListPods(t *testing.T) {
+	pod1 := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"},
+	}
+	pod2 := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod2"},
+	}
+
+	t.Run("list fails", func(t *testing.T) {
+		client := FailList(k8stest.NewClientBuilder(t).Build())
+		actual, err := k8sapi.ListPods(context.Background(), client)
+		assert.EqualError(t, err, errList.Error())
+		assert.Empty(t, actual)
+	})
+
+	t.Run("list empty", func(t *testing.T) {
+		client := fake.NewClientBuilder().Build()
+		actual, err := k8sapi.ListPods(context.Background(), client)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("list not empty", func(t *testing.T) {
+		client := fake.NewClientBuilder().WithRuntimeObjects(&pod1, &pod2).Build()
+		actual, err := k8sapi.ListPods(context.Background(), client)
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.Pod{pod1, pod2}, actual)
+	})
+}
+
+func TestListNodes(t *testing.T) {
+	node1 := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+	}
+	node2 := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+	}
+
+	t.Run("list fails", func(t *testing.T) {
+		client := FailList(k8stest.NewClientBuilder(t).Build())
+		actual, err := k8sapi.ListNodes(context.Background(), client)
+		assert.EqualError(t, err, errList.Error())
+		assert.Empty(t, actual)
+	})
+
+	t.Run("list empty", func(t *testing.T) {
+		client := fake.NewClientBuilder().Build()
+		actual, err := k8sapi.ListNodes(context.Background(), client)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("list not empty", func(t *testing.T) {
+		client := fake.NewClientBuilder().WithRuntimeObjects(&node1, &node2).Build()
+		actual, err := k8sapi.ListNodes(context.Background(), client)
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.Node{node1, node2}, actual)
+	})
+}
+
 func FailList(c client.Client) client.Client {
 	return failList{Client: c}
 }
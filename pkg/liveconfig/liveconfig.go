@@ -0,0 +1,59 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package liveconfig holds the parts of the controller manager configuration
+// that can be changed while it is running.
+package liveconfig
+
+import (
+	"regexp"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Config is the configuration that can be reloaded without a restart.
+type Config struct {
+	IgnoreNamespaces []*regexp.Regexp
+	ClassName        string
+	WatchClassless   bool
+	ParentIDTemplate *template.Template
+	GCInterval       time.Duration
+}
+
+// Value holds the current Config. It is safe for concurrent use. Users load
+// the Config once per unit of work, e.g. a reconcile, so that the work sees
+// either the old or the new configuration, never a mix of the two.
+type Value struct {
+	config atomic.Pointer[Config]
+}
+
+// New returns a Value holding the config.
+func New(config Config) *Value {
+	v := new(Value)
+	v.Store(config)
+	return v
+}
+
+// Load returns the current config.
+func (v *Value) Load() Config {
+	return *v.config.Load()
+}
+
+// Store replaces the current config.
+func (v *Value) Store(config Config) {
+	v.config.Store(&config)
+}
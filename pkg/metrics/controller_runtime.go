@@ -3,7 +3,18 @@ package metrics
 import "github.com/prometheus/client_golang/prometheus"
 
 const (
-	StaticEntryFailures = "cluster_static_entry_failures"
+	StaticEntryFailures   = "cluster_static_entry_failures"
+	OutdatedEntryFields   = "outdated_entry_fields"
+	EntryCacheDivergences = "entry_cache_divergences"
+	EntryIDPrefixRekeys   = "entry_id_prefix_rekeys"
+	RetiringEntries       = "retiring_entries"
+	AuditEventFailures    = "audit_event_failures"
+
+	SPIREAPIRequestDuration = "spire_api_request_duration_seconds"
+
+	// ProfileGaugePrefix prefixes the names of the gauges of the trust
+	// domain profiles.
+	ProfileGaugePrefix = "trust_domain_profile_"
 )
 
 var (
@@ -14,5 +25,66 @@ var (
 				Help: "Number of cluster static entry render failures",
 			},
 		),
+		EntryCacheDivergences: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: EntryCacheDivergences,
+				Help: "Number of entries found to differ between the entry cache and the SPIRE server on a full resync",
+			},
+		),
+		EntryIDPrefixRekeys: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: EntryIDPrefixRekeys,
+				Help: "Number of entries with the cleanup entry ID prefix replaced by entries with the new prefix",
+			},
+		),
+	}
+
+	PromCounterVecs = map[string]*prometheus.CounterVec{
+		OutdatedEntryFields: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: OutdatedEntryFields,
+				Help: "Number of times an entry field was found outdated and updated, by field",
+			},
+			[]string{"field"},
+		),
+		AuditEventFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: AuditEventFailures,
+				Help: "Number of audit events that could not be written, by sink",
+			},
+			[]string{"sink"},
+		),
+	}
+
+	// PromGauges are set by the entry reconciler of the main trust domain.
+	PromGauges = map[string]prometheus.Gauge{
+		RetiringEntries: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: RetiringEntries,
+				Help: "Number of entries that are no longer declared and are kept until the retirement grace period has passed",
+			},
+		),
+	}
+
+	// PromProfileGaugeVecs are the PromGauges of the trust domain profiles,
+	// labeled by profile.
+	PromProfileGaugeVecs = map[string]*prometheus.GaugeVec{
+		RetiringEntries: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: ProfileGaugePrefix + RetiringEntries,
+				Help: "Number of entries of a trust domain profile that are no longer declared and are kept until the retirement grace period has passed",
+			},
+			[]string{"trust_domain_profile"},
+		),
+	}
+
+	PromHistogramVecs = map[string]*prometheus.HistogramVec{
+		SPIREAPIRequestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: SPIREAPIRequestDuration,
+				Help: "Latency of SPIRE Server API calls, by method and code",
+			},
+			[]string{"method", "code"},
+		),
 	}
 )
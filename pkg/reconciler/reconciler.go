@@ -18,19 +18,54 @@ package reconciler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
+	"github.com/spiffe/spire-controller-manager/pkg/tracing"
 )
 
 const EndpointUID string = "subsets.addresses.targetRef.uid"
 
+// EndpointPodUIDs returns the UIDs of the pods targeted by the endpoints,
+// i.e. the values of the EndpointUID index.
+func EndpointPodUIDs(endpoints *corev1.Endpoints) []string {
+	var podUIDs []string
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+				podUIDs = append(podUIDs, string(address.TargetRef.UID))
+			}
+		}
+		for _, address := range subset.NotReadyAddresses {
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+				podUIDs = append(podUIDs, string(address.TargetRef.UID))
+			}
+		}
+	}
+	return podUIDs
+}
+
 type Triggerer interface {
 	Trigger()
 }
 
+// Triggerers triggers each of the triggerers, e.g. the entry reconcilers of
+// every trust domain profile.
+type Triggerers []Triggerer
+
+func (ts Triggerers) Trigger() {
+	for _, t := range ts {
+		t.Trigger()
+	}
+}
+
 type Reconciler interface {
 	Trigger()
 	Run(ctx context.Context) error
@@ -41,6 +76,14 @@ type Config struct {
 	Reconcile  func(ctx context.Context)
 	GCInterval time.Duration
 	Clock      clock.Clock
+
+	// Timeout, if set, bounds each call to Reconcile so that a hung
+	// dependency cannot stall reconciliation forever.
+	Timeout time.Duration
+
+	// LiveConfig, if set, overrides GCInterval with the GC interval of the
+	// live configuration, which is read each time the reconciler goes idle.
+	LiveConfig *liveconfig.Value
 }
 
 func New(config Config) Reconciler {
@@ -51,6 +94,8 @@ func New(config Config) Reconciler {
 		kind:       config.Kind,
 		reconcile:  config.Reconcile,
 		gcInterval: config.GCInterval,
+		timeout:    config.Timeout,
+		liveConfig: config.LiveConfig,
 		clock:      config.Clock,
 		triggerCh:  make(chan struct{}),
 	}
@@ -60,6 +105,8 @@ type reconciler struct {
 	kind       string
 	reconcile  func(ctx context.Context)
 	gcInterval time.Duration
+	timeout    time.Duration
+	liveConfig *liveconfig.Value
 	clock      clock.Clock
 	triggerCh  chan struct{}
 }
@@ -83,16 +130,20 @@ func (r *reconciler) Run(ctx context.Context) error {
 	var timer clock.Timer
 	for {
 		log.V(2).Info("Starting reconciliation")
-		r.reconcile(ctx)
+		r.reconcileOnce(ctx)
 		log.V(2).Info("Reconciliation finished")
 
 		log.V(2).Info("Waiting for next reconciliation")
 
+		gcInterval := r.gcInterval
+		if r.liveConfig != nil {
+			gcInterval = r.liveConfig.Load().GCInterval
+		}
 		if timer == nil {
-			timer = r.clock.NewTimer(r.gcInterval)
+			timer = r.clock.NewTimer(gcInterval)
 			defer timer.Stop()
 		} else {
-			timer.Reset(r.gcInterval)
+			timer.Reset(gcInterval)
 		}
 
 		select {
@@ -107,6 +158,22 @@ func (r *reconciler) Run(ctx context.Context) error {
 	}
 }
 
+func (r *reconciler) reconcileOnce(ctx context.Context) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	ctx, span := tracing.Start(ctx, "reconciler.Reconcile", attribute.String("kind", r.kind))
+	r.reconcile(ctx)
+	var err error
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = ctx.Err()
+		log.FromContext(ctx).Error(err, "Reconciliation timed out", "timeout", r.timeout)
+	}
+	tracing.End(span, err)
+}
+
 func (r *reconciler) drain() {
 	select {
 	case <-r.triggerCh:
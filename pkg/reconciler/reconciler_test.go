@@ -22,9 +22,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
 	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	testclock "k8s.io/utils/clock/testing"
 )
 
@@ -87,3 +93,114 @@ func TestReconciler(t *testing.T) {
 	t.Log("Wait until the trigger reconcile call")
 	require.Eventually(t, checkIfCalled, time.Minute, time.Millisecond*10)
 }
+
+func TestReconcilerLiveGCInterval(t *testing.T) {
+	clock := new(testclock.FakeClock)
+	live := liveconfig.New(liveconfig.Config{GCInterval: time.Second})
+
+	calledCh := make(chan struct{}, 1)
+	r := reconciler.New(reconciler.Config{
+		Kind: "test",
+		Reconcile: func(ctx context.Context) {
+			calledCh <- struct{}{}
+		},
+		GCInterval: time.Minute,
+		Clock:      clock,
+		LiveConfig: live,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = r.Run(ctx)
+	}()
+
+	t.Log("The live GC interval is used instead of the configured one")
+	<-calledCh
+	require.Eventually(t, clock.HasWaiters, time.Minute, time.Millisecond*10)
+	clock.Step(time.Second)
+	<-calledCh
+
+	t.Log("A change to the live GC interval is picked up when the reconciler next goes idle")
+	live.Store(liveconfig.Config{GCInterval: time.Hour})
+	require.Eventually(t, clock.HasWaiters, time.Minute, time.Millisecond*10)
+	clock.Step(time.Second)
+	<-calledCh
+	require.Eventually(t, clock.HasWaiters, time.Minute, time.Millisecond*10)
+	clock.Step(time.Minute)
+	assert.Never(t, func() bool { return len(calledCh) > 0 }, 100*time.Millisecond, time.Millisecond*10)
+	clock.Step(time.Hour)
+	select {
+	case <-calledCh:
+	case <-time.After(time.Minute):
+		require.Fail(t, "timed out waiting for reconcile")
+	}
+}
+
+func TestReconcilerTimeout(t *testing.T) {
+	deadlineCh := make(chan time.Time, 1)
+	r := reconciler.New(reconciler.Config{
+		Kind: "test",
+		Reconcile: func(ctx context.Context) {
+			deadline, ok := ctx.Deadline()
+			assert.True(t, ok, "expected reconcile context to have a deadline")
+			select {
+			case deadlineCh <- deadline:
+			default:
+			}
+		},
+		GCInterval: time.Hour,
+		Timeout:    time.Minute,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	go func() {
+		_ = r.Run(ctx)
+	}()
+
+	select {
+	case deadline := <-deadlineCh:
+		assert.WithinDuration(t, start.Add(time.Minute), deadline, 10*time.Second)
+	case <-time.After(time.Minute):
+		require.Fail(t, "timed out waiting for reconcile")
+	}
+}
+
+func TestReconcilerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	calledCh := make(chan bool, 1)
+	r := reconciler.New(reconciler.Config{
+		Kind: "test",
+		Reconcile: func(ctx context.Context) {
+			select {
+			case calledCh <- trace.SpanFromContext(ctx).SpanContext().IsValid():
+			default:
+			}
+		},
+		GCInterval: time.Hour,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = r.Run(ctx)
+	}()
+
+	select {
+	case hasSpan := <-calledCh:
+		assert.True(t, hasSpan, "expected reconcile context to carry a span")
+	case <-time.After(time.Minute):
+		require.Fail(t, "timed out waiting for reconcile")
+	}
+
+	require.Eventually(t, func() bool { return len(recorder.Ended()) > 0 }, time.Minute, time.Millisecond*10)
+	span := recorder.Ended()[0]
+	assert.Equal(t, "reconciler.Reconcile", span.Name())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("kind", "test")}, span.Attributes())
+}
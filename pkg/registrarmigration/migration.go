@@ -0,0 +1,311 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registrarmigration adopts the entries created by the Kubernetes
+// Workload Registrar as the entries declared by ClusterSPIFFEIDs, so that
+// workloads keep their entries throughout the migration.
+package registrarmigration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc/codes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+)
+
+// Config configures how registrar entries are recognized.
+type Config struct {
+	// TrustDomain is the trust domain of the SPIRE Server.
+	TrustDomain spiffeid.TrustDomain
+
+	// ClusterName is the cluster name the registrar was configured with.
+	ClusterName string
+}
+
+// Adoption is a registrar entry that is updated in place to become an
+// entry declared by a ClusterSPIFFEID.
+type Adoption struct {
+	// Entry is the registrar entry.
+	Entry spireapi.Entry
+
+	// Target is the declared entry the registrar entry is updated to.
+	Target spireentry.RenderedEntry
+}
+
+// Deletion is a registrar entry that is no longer needed once the
+// adoptions have been applied.
+type Deletion struct {
+	Entry  spireapi.Entry
+	Reason string
+}
+
+// Unmatched is a registrar entry with no declared entry to adopt it as.
+// Unmatched entries are left in place for review. The controller manager
+// deletes them once it starts reconciling, unless an entry ID prefix is
+// configured.
+type Unmatched struct {
+	Entry  spireapi.Entry
+	Reason string
+}
+
+// Plan is the set of changes that migrate the registrar entries.
+type Plan struct {
+	Adopt     []Adoption
+	Delete    []Deletion
+	Unmatched []Unmatched
+}
+
+// MakePlan matches the registrar entries among the current entries against
+// the entries declared by the rendered ClusterSPIFFEIDs. A registrar pod
+// entry is adopted by the declared entry for the same pod with the same
+// SPIFFE ID, unless an equivalent entry already exists, in which case the
+// registrar entry is deleted instead. The node entries the registrar parents
+// pod entries under are deleted once no entry left in place is parented
+// under them; otherwise they are left in place as well.
+func MakePlan(config Config, rendered *spireentry.RenderResult, pods []corev1.Pod, current []spireapi.Entry) (*Plan, error) {
+	if config.TrustDomain.IsZero() {
+		return nil, errors.New("trust domain is required")
+	}
+	if config.ClusterName == "" {
+		return nil, errors.New("registrar cluster name is required")
+	}
+	nodePath := fmt.Sprintf("/k8s-workload-registrar/%s/node", config.ClusterName)
+
+	// Only the preferred entries are written to SPIRE, so masked entries
+	// cannot adopt anything.
+	declaredByPodUID := make(map[types.UID][]spireentry.RenderedEntry)
+	for _, declared := range rendered.Entries {
+		if declared.MaskedBy != nil {
+			continue
+		}
+		for _, selector := range declared.Entry.Selectors {
+			if selector.Type == "k8s" && strings.HasPrefix(selector.Value, "pod-uid:") {
+				uid := types.UID(strings.TrimPrefix(selector.Value, "pod-uid:"))
+				declaredByPodUID[uid] = append(declaredByPodUID[uid], declared)
+			}
+		}
+	}
+
+	podsByUID := make(map[types.UID]*corev1.Pod, len(pods))
+	podsByName := make(map[types.NamespacedName]*corev1.Pod, len(pods))
+	for i := range pods {
+		podsByUID[pods[i].UID] = &pods[i]
+		podsByName[types.NamespacedName{Namespace: pods[i].Namespace, Name: pods[i].Name}] = &pods[i]
+	}
+
+	existing := make(map[string]struct{}, len(current))
+	for _, entry := range current {
+		existing[entryKey(entry)] = struct{}{}
+	}
+
+	plan := new(Plan)
+	adopted := make(map[string]struct{})
+	var nodeEntries []spireapi.Entry
+	for _, entry := range current {
+		if entry.SPIFFEID.TrustDomain() != config.TrustDomain {
+			continue
+		}
+		if isUnder(entry.SPIFFEID, config.TrustDomain, nodePath) {
+			nodeEntries = append(nodeEntries, entry)
+			continue
+		}
+		if !isUnder(entry.ParentID, config.TrustDomain, nodePath) {
+			continue
+		}
+
+		pod, err := registrarEntryPod(entry, podsByUID, podsByName)
+		if err != nil {
+			plan.Unmatched = append(plan.Unmatched, Unmatched{Entry: entry, Reason: err.Error()})
+			continue
+		}
+
+		var target *spireentry.RenderedEntry
+		for _, declared := range declaredByPodUID[pod.UID] {
+			if declared.Entry.SPIFFEID == entry.SPIFFEID {
+				declared := declared
+				target = &declared
+				break
+			}
+		}
+		if target == nil {
+			plan.Unmatched = append(plan.Unmatched, Unmatched{
+				Entry:  entry,
+				Reason: fmt.Sprintf("no ClusterSPIFFEID declares %s for pod %s/%s", entry.SPIFFEID, pod.Namespace, pod.Name),
+			})
+			continue
+		}
+
+		key := entryKey(target.Entry)
+		if _, ok := existing[key]; ok {
+			plan.Delete = append(plan.Delete, Deletion{
+				Entry:  entry,
+				Reason: fmt.Sprintf("%s already has an equivalent entry", target.DeclaredBy),
+			})
+			continue
+		}
+		if _, ok := adopted[key]; ok {
+			plan.Delete = append(plan.Delete, Deletion{
+				Entry:  entry,
+				Reason: fmt.Sprintf("another registrar entry is adopted by %s", target.DeclaredBy),
+			})
+			continue
+		}
+		adopted[key] = struct{}{}
+		plan.Adopt = append(plan.Adopt, Adoption{Entry: entry, Target: *target})
+	}
+
+	// Deleting a node entry would leave the workloads of the entries still
+	// parented under it without SVIDs, so it is kept until they are gone.
+	children := remainingChildren(plan, current)
+	for _, entry := range nodeEntries {
+		if n := children[entry.SPIFFEID]; n > 0 {
+			plan.Unmatched = append(plan.Unmatched, Unmatched{
+				Entry:  entry,
+				Reason: fmt.Sprintf("registrar node entry still parents %d entries that are left in place", n),
+			})
+			continue
+		}
+		plan.Delete = append(plan.Delete, Deletion{
+			Entry:  entry,
+			Reason: "registrar node entry is not used by the controller manager",
+		})
+	}
+
+	sort.Slice(plan.Adopt, func(i, j int) bool { return plan.Adopt[i].Entry.ID < plan.Adopt[j].Entry.ID })
+	sort.Slice(plan.Delete, func(i, j int) bool { return plan.Delete[i].Entry.ID < plan.Delete[j].Entry.ID })
+	sort.Slice(plan.Unmatched, func(i, j int) bool { return plan.Unmatched[i].Entry.ID < plan.Unmatched[j].Entry.ID })
+	return plan, nil
+}
+
+// remainingChildren counts the entries left in place by the plan, which are
+// neither adopted nor deleted, by parent ID.
+func remainingChildren(plan *Plan, current []spireapi.Entry) map[spiffeid.ID]int {
+	changed := make(map[string]struct{}, len(plan.Adopt)+len(plan.Delete))
+	for _, adoption := range plan.Adopt {
+		changed[adoption.Entry.ID] = struct{}{}
+	}
+	for _, deletion := range plan.Delete {
+		changed[deletion.Entry.ID] = struct{}{}
+	}
+	children := make(map[spiffeid.ID]int)
+	for _, entry := range current {
+		if _, ok := changed[entry.ID]; !ok {
+			children[entry.ParentID]++
+		}
+	}
+	return children
+}
+
+// Apply adopts the registrar entries and then deletes the entries that are
+// no longer needed. Adopted entries keep their IDs. Entries are only deleted
+// if every adoption succeeded, so that a registrar entry that could not be
+// adopted keeps working until the plan is made and applied again.
+func Apply(ctx context.Context, entryClient spireapi.EntryClient, plan *Plan) error {
+	var errs []error
+	if len(plan.Adopt) > 0 {
+		updates := make([]spireapi.EntryUpdate, 0, len(plan.Adopt))
+		for _, adoption := range plan.Adopt {
+			entry := adoption.Target.Entry
+			entry.ID = adoption.Entry.ID
+			updates = append(updates, spireapi.EntryUpdate{Entry: entry})
+		}
+		results, err := entryClient.UpdateEntries(ctx, updates)
+		if err != nil {
+			return fmt.Errorf("failed to adopt entries: %w", err)
+		}
+		for i, result := range results {
+			if result.Code != codes.OK {
+				errs = append(errs, fmt.Errorf("failed to adopt entry %q: %w", plan.Adopt[i].Entry.ID, result.Err()))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if len(plan.Delete) > 0 {
+		ids := make([]string, 0, len(plan.Delete))
+		for _, deletion := range plan.Delete {
+			ids = append(ids, deletion.Entry.ID)
+		}
+		statuses, err := entryClient.DeleteEntries(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("failed to delete entries: %w", err)
+		}
+		for i, status := range statuses {
+			if status.Code != codes.OK && status.Code != codes.NotFound {
+				errs = append(errs, fmt.Errorf("failed to delete entry %q: %w", ids[i], status.Err()))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// registrarEntryPod returns the pod a registrar entry is for, identified
+// either by a pod UID selector or by namespace and pod name selectors.
+func registrarEntryPod(entry spireapi.Entry, podsByUID map[types.UID]*corev1.Pod, podsByName map[types.NamespacedName]*corev1.Pod) (*corev1.Pod, error) {
+	var uid types.UID
+	var name types.NamespacedName
+	for _, selector := range entry.Selectors {
+		if selector.Type != "k8s" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(selector.Value, "pod-uid:"):
+			uid = types.UID(strings.TrimPrefix(selector.Value, "pod-uid:"))
+		case strings.HasPrefix(selector.Value, "ns:"):
+			name.Namespace = strings.TrimPrefix(selector.Value, "ns:")
+		case strings.HasPrefix(selector.Value, "pod-name:"):
+			name.Name = strings.TrimPrefix(selector.Value, "pod-name:")
+		}
+	}
+	switch {
+	case uid != "":
+		if pod, ok := podsByUID[uid]; ok {
+			return pod, nil
+		}
+		return nil, fmt.Errorf("pod with UID %s not found", uid)
+	case name.Namespace != "" && name.Name != "":
+		if pod, ok := podsByName[name]; ok {
+			return pod, nil
+		}
+		return nil, fmt.Errorf("pod %s not found", name)
+	default:
+		return nil, errors.New("entry does not select a single pod")
+	}
+}
+
+func isUnder(id spiffeid.ID, td spiffeid.TrustDomain, path string) bool {
+	return id.TrustDomain() == td && (id.Path() == path || strings.HasPrefix(id.Path(), path+"/"))
+}
+
+func entryKey(entry spireapi.Entry) string {
+	selectors := make([]string, 0, len(entry.Selectors))
+	for _, selector := range entry.Selectors {
+		selectors = append(selectors, selector.Type+":"+selector.Value)
+	}
+	sort.Strings(selectors)
+	return entry.SPIFFEID.String() + "|" + entry.ParentID.String() + "|" + strings.Join(selectors, "|")
+}
@@ -0,0 +1,221 @@
+package registrarmigration
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireentry"
+	"github.com/spiffe/spire-controller-manager/pkg/test/spirefake"
+)
+
+var (
+	td          = spiffeid.RequireTrustDomainFromString("example.org")
+	agentID     = spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/cluster/node-uid")
+	nodeAliasID = spiffeid.RequireFromString("spiffe://example.org/k8s-workload-registrar/cluster/node/node")
+	serverID    = spiffeid.RequireFromString("spiffe://example.org/spire/server")
+)
+
+func TestMigration(t *testing.T) {
+	pods := []corev1.Pod{
+		newPod("a", "a-uid"),
+		newPod("b", "b-uid"),
+		newPod("c", "c-uid"),
+	}
+	rendered, err := spireentry.Render(context.Background(), spireentry.ReconcilerConfig{
+		TrustDomain:    td,
+		ClusterName:    "cluster",
+		ClusterDomain:  "cluster.local",
+		WatchClassless: true,
+		Reconcile:      spirev1alpha1.ReconcileConfig{ClusterSPIFFEIDs: true},
+	}, spireentry.RenderInput{
+		ClusterSPIFFEIDs: []spirev1alpha1.ClusterSPIFFEID{{
+			ObjectMeta: metav1.ObjectMeta{Name: "workloads"},
+			Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+				SPIFFEIDTemplate: "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}",
+				TTL:              metav1.Duration{Duration: time.Hour},
+			},
+		}},
+		Namespaces: []corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "workload"}}},
+		Nodes:      []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"}}},
+		Pods:       pods,
+	})
+	require.NoError(t, err)
+
+	spire := spirefake.Start(t, spirefake.Config{TrustDomain: td})
+	spire.SetEntries(
+		// The node entry the registrar parents pod entries under.
+		&apitypes.Entry{
+			Id:       "node-alias",
+			SpiffeId: apiID(nodeAliasID),
+			ParentId: apiID(serverID),
+			Selectors: []*apitypes.Selector{
+				{Type: "k8s_psat", Value: "cluster:cluster"},
+				{Type: "k8s_psat", Value: "agent_node_name:node"},
+			},
+		},
+		// A reconcile mode entry, selecting the pod by namespace and name.
+		&apitypes.Entry{
+			Id:       "registrar-a",
+			SpiffeId: apiID(spiffeid.RequireFromString("spiffe://example.org/ns/workload/pod/a")),
+			ParentId: apiID(nodeAliasID),
+			Selectors: []*apitypes.Selector{
+				{Type: "k8s", Value: "ns:workload"},
+				{Type: "k8s", Value: "pod-name:a"},
+			},
+		},
+		// A CRD mode entry, selecting the pod by UID, that the controller
+		// manager has already created an equivalent entry for.
+		&apitypes.Entry{
+			Id:        "registrar-b",
+			SpiffeId:  apiID(spiffeid.RequireFromString("spiffe://example.org/ns/workload/pod/b")),
+			ParentId:  apiID(nodeAliasID),
+			Selectors: []*apitypes.Selector{{Type: "k8s", Value: "pod-uid:b-uid"}},
+		},
+		&apitypes.Entry{
+			Id:        "controller-b",
+			SpiffeId:  apiID(spiffeid.RequireFromString("spiffe://example.org/ns/workload/pod/b")),
+			ParentId:  apiID(agentID),
+			Selectors: []*apitypes.Selector{{Type: "k8s", Value: "pod-uid:b-uid"}},
+		},
+		// An entry with a SPIFFE ID that no ClusterSPIFFEID declares.
+		&apitypes.Entry{
+			Id:        "registrar-c",
+			SpiffeId:  apiID(spiffeid.RequireFromString("spiffe://example.org/legacy/c")),
+			ParentId:  apiID(nodeAliasID),
+			Selectors: []*apitypes.Selector{{Type: "k8s", Value: "pod-uid:c-uid"}},
+		},
+		// An entry for a pod that no longer exists.
+		&apitypes.Entry{
+			Id:       "registrar-gone",
+			SpiffeId: apiID(spiffeid.RequireFromString("spiffe://example.org/ns/workload/pod/gone")),
+			ParentId: apiID(nodeAliasID),
+			Selectors: []*apitypes.Selector{
+				{Type: "k8s", Value: "ns:workload"},
+				{Type: "k8s", Value: "pod-name:gone"},
+			},
+		},
+		// An entry not created by the registrar.
+		&apitypes.Entry{
+			Id:        "other",
+			SpiffeId:  apiID(spiffeid.RequireFromString("spiffe://example.org/other")),
+			ParentId:  apiID(serverID),
+			Selectors: []*apitypes.Selector{{Type: "unix", Value: "uid:0"}},
+		},
+	)
+	entryClient := newEntryClient(t, spire)
+	current, err := entryClient.ListEntries(context.Background())
+	require.NoError(t, err)
+
+	plan, err := MakePlan(Config{TrustDomain: td, ClusterName: "cluster"}, rendered, pods, current)
+	require.NoError(t, err)
+
+	require.Len(t, plan.Adopt, 1)
+	assert.Equal(t, "registrar-a", plan.Adopt[0].Entry.ID)
+	assert.Equal(t, agentID, plan.Adopt[0].Target.Entry.ParentID)
+	assert.Equal(t, spireentry.ObjectRef{Kind: "ClusterSPIFFEID", Name: "workloads"}, plan.Adopt[0].Target.DeclaredBy)
+
+	assert.Equal(t, []string{"registrar-b"}, deletionIDs(plan.Delete))
+	assert.Equal(t, "ClusterSPIFFEID/workloads already has an equivalent entry", plan.Delete[0].Reason)
+
+	// The node entry is kept, since the unmatched entries are still
+	// parented under it.
+	require.Len(t, plan.Unmatched, 3)
+	assert.Equal(t, "node-alias", plan.Unmatched[0].Entry.ID)
+	assert.Equal(t, "registrar node entry still parents 2 entries that are left in place", plan.Unmatched[0].Reason)
+	assert.Equal(t, "registrar-c", plan.Unmatched[1].Entry.ID)
+	assert.Equal(t, "no ClusterSPIFFEID declares spiffe://example.org/legacy/c for pod workload/c", plan.Unmatched[1].Reason)
+	assert.Equal(t, "registrar-gone", plan.Unmatched[2].Entry.ID)
+	assert.Equal(t, "pod workload/gone not found", plan.Unmatched[2].Reason)
+
+	// Once nothing left in place is parented under it, the node entry is
+	// deleted.
+	withoutUnmatched := slices.DeleteFunc(slices.Clone(current), func(entry spireapi.Entry) bool {
+		return entry.ID == "registrar-c" || entry.ID == "registrar-gone"
+	})
+	cleanPlan, err := MakePlan(Config{TrustDomain: td, ClusterName: "cluster"}, rendered, pods, withoutUnmatched)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node-alias", "registrar-b"}, deletionIDs(cleanPlan.Delete))
+	assert.Empty(t, cleanPlan.Unmatched)
+
+	require.NoError(t, Apply(context.Background(), entryClient, plan))
+
+	adopted, err := entryClient.GetEntry(context.Background(), "registrar-a")
+	require.NoError(t, err)
+	assert.Equal(t, agentID, adopted.ParentID)
+	assert.Equal(t, []spireapi.Selector{{Type: "k8s", Value: "pod-uid:a-uid"}}, adopted.Selectors)
+	assert.Equal(t, plan.Adopt[0].Target.Entry.X509SVIDTTL, adopted.X509SVIDTTL)
+
+	var ids []string
+	for _, entry := range spire.Entries() {
+		ids = append(ids, entry.Id)
+	}
+	assert.ElementsMatch(t, []string{"node-alias", "registrar-a", "controller-b", "registrar-c", "registrar-gone", "other"}, ids)
+}
+
+func TestApplyDoesNotDeleteIfAdoptionFails(t *testing.T) {
+	spire := spirefake.Start(t, spirefake.Config{TrustDomain: td})
+	spire.SetEntries(&apitypes.Entry{
+		Id:        "node-alias",
+		SpiffeId:  apiID(nodeAliasID),
+		ParentId:  apiID(serverID),
+		Selectors: []*apitypes.Selector{{Type: "k8s_psat", Value: "cluster:cluster"}},
+	})
+	entryClient := newEntryClient(t, spire)
+
+	err := Apply(context.Background(), entryClient, &Plan{
+		Adopt: []Adoption{{
+			Entry: spireapi.Entry{ID: "missing"},
+			Target: spireentry.RenderedEntry{Entry: spireapi.Entry{
+				SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/ns/workload/pod/a"),
+				ParentID:  agentID,
+				Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:a-uid"}},
+			}},
+		}},
+		Delete: []Deletion{{Entry: spireapi.Entry{ID: "node-alias"}}},
+	})
+	assert.ErrorContains(t, err, `failed to adopt entry "missing"`)
+	assert.Len(t, spire.Entries(), 1)
+}
+
+func TestMakePlanRequiresConfig(t *testing.T) {
+	_, err := MakePlan(Config{TrustDomain: td}, &spireentry.RenderResult{}, nil, nil)
+	assert.EqualError(t, err, "registrar cluster name is required")
+}
+
+func newPod(name, uid string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: name, UID: types.UID(uid)},
+		Spec:       corev1.PodSpec{NodeName: "node"},
+	}
+}
+
+func newEntryClient(t *testing.T, spire *spirefake.Server) spireapi.EntryClient {
+	client, err := spireapi.DialSocket(spire.SocketPath())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func apiID(id spiffeid.ID) *apitypes.SPIFFEID {
+	return &apitypes.SPIFFEID{TrustDomain: id.TrustDomain().Name(), Path: id.Path()}
+}
+
+func deletionIDs(deletions []Deletion) []string {
+	var ids []string
+	for _, deletion := range deletions {
+		ids = append(ids, deletion.Entry.ID)
+	}
+	return ids
+}
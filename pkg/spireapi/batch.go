@@ -16,6 +16,16 @@ limitations under the License.
 
 package spireapi
 
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+
+	"github.com/spiffe/spire-controller-manager/pkg/tracing"
+)
+
 var (
 	// TODO: optimize batch/page sizes
 	// These batch sizes are vars so they can be adjusted during tests.
@@ -31,7 +41,16 @@ var (
 	federationRelationshipListPageSize    = 200
 )
 
-func runBatch(size, batch int, fn func(start, end int) error) error {
+const (
+	batchOffsetKey = attribute.Key("batch.offset")
+	batchSizeKey   = attribute.Key("batch.size")
+	batchFailedKey = attribute.Key("batch.failed")
+)
+
+// runBatch calls fn for each batch of up to batch items out of size items,
+// stopping at the first error. Each call is traced as a span with the given
+// name.
+func runBatch(ctx context.Context, name string, size, batch int, fn func(ctx context.Context, start, end int) error) error {
 	if batch < 1 {
 		batch = size
 	}
@@ -40,7 +59,11 @@ func runBatch(size, batch int, fn func(start, end int) error) error {
 		if n > batch {
 			n = batch
 		}
-		err := fn(i, i+n)
+		batchCtx, span := tracing.Start(ctx, name,
+			batchOffsetKey.Int(i),
+			batchSizeKey.Int(n))
+		err := fn(batchCtx, i, i+n)
+		tracing.EndRPC(span, err)
 		if err != nil {
 			return err
 		}
@@ -48,3 +71,20 @@ func runBatch(size, batch int, fn func(start, end int) error) error {
 	}
 	return nil
 }
+
+// recordFailedResults records on the batch span how many items in the batch
+// were not successful.
+func recordFailedResults(ctx context.Context, failed int) {
+	trace.SpanFromContext(ctx).SetAttributes(batchFailedKey.Int(failed))
+}
+
+// countFailed returns how many of the statuses are not OK.
+func countFailed(statuses []Status) int {
+	var failed int
+	for _, status := range statuses {
+		if status.Code != codes.OK {
+			failed++
+		}
+	}
+	return failed
+}
@@ -17,12 +17,15 @@ limitations under the License.
 package spireapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"path/filepath"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
 type Client interface {
@@ -33,7 +36,31 @@ type Client interface {
 	io.Closer
 }
 
+// ClientConfig configures the connection to the SPIRE Server API.
+type ClientConfig struct {
+	// RPCTimeout bounds each call that does not already have an earlier
+	// deadline. Calls are unbounded if unset.
+	RPCTimeout time.Duration
+
+	// KeepaliveTime is how long the connection may be idle before the
+	// server is pinged. Keepalive is disabled if unset.
+	KeepaliveTime time.Duration
+
+	// KeepaliveTimeout is how long to wait for a ping to be acknowledged
+	// before the connection is closed. Defaults to the gRPC default.
+	KeepaliveTimeout time.Duration
+
+	// MaxListAttempts is the maximum number of attempts made for the
+	// idempotent list and get calls when the server is unavailable. gRPC
+	// caps this at 5. Retries are disabled if less than 2.
+	MaxListAttempts int
+}
+
 func DialSocket(path string) (Client, error) {
+	return DialSocketWithConfig(path, ClientConfig{})
+}
+
+func DialSocketWithConfig(path string, config ClientConfig) (Client, error) {
 	var target string
 	if filepath.IsAbs(path) {
 		target = "unix://" + path
@@ -41,7 +68,29 @@ func DialSocket(path string) (Client, error) {
 		target = "unix:" + path
 	}
 
-	grpcClient, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			loggingInterceptor,
+			metricsInterceptor,
+			timeoutInterceptor(config.RPCTimeout),
+		),
+	}
+	if config.KeepaliveTime > 0 {
+		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    config.KeepaliveTime,
+			Timeout: config.KeepaliveTimeout,
+		}))
+	}
+	if config.MaxListAttempts > 1 {
+		serviceConfig, err := makeRetryServiceConfig(config.MaxListAttempts)
+		if err != nil {
+			return nil, err
+		}
+		dialOptions = append(dialOptions, grpc.WithDefaultServiceConfig(serviceConfig))
+	}
+
+	grpcClient, err := grpc.NewClient(target, dialOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial API socket: %w", err)
 	}
@@ -60,3 +109,51 @@ func DialSocket(path string) (Client, error) {
 		Closer:            grpcClient,
 	}, nil
 }
+
+// makeRetryServiceConfig returns a gRPC service config that retries the
+// idempotent list and get calls when the server is unavailable. Writes are
+// never retried since their outcome is unknown when the call fails.
+func makeRetryServiceConfig(maxAttempts int) (string, error) {
+	type methodName struct {
+		Service string `json:"service"`
+		Method  string `json:"method"`
+	}
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []methodName `json:"name"`
+		RetryPolicy retryPolicy  `json:"retryPolicy"`
+	}
+	type serviceConfig struct {
+		MethodConfig []methodConfig `json:"methodConfig"`
+	}
+
+	data, err := json.Marshal(serviceConfig{
+		MethodConfig: []methodConfig{
+			{
+				Name: []methodName{
+					{Service: "spire.api.server.entry.v1.Entry", Method: "ListEntries"},
+					{Service: "spire.api.server.entry.v1.Entry", Method: "GetEntry"},
+					{Service: "spire.api.server.trustdomain.v1.TrustDomain", Method: "ListFederationRelationships"},
+					{Service: "spire.api.server.bundle.v1.Bundle", Method: "GetBundle"},
+				},
+				RetryPolicy: retryPolicy{
+					MaxAttempts:          maxAttempts,
+					InitialBackoff:       "0.1s",
+					MaxBackoff:           "1s",
+					BackoffMultiplier:    2,
+					RetryableStatusCodes: []string{"UNAVAILABLE"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal service config: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,166 @@
+package spireapi
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
+)
+
+func TestDialSocketWithConfig(t *testing.T) {
+	server := &unavailableEntryServer{}
+	socketPath := startSocketServer(t, func(s *grpc.Server) {
+		entryv1.RegisterEntryServer(s, server)
+	})
+
+	t.Run("retries idempotent calls", func(t *testing.T) {
+		client, err := DialSocketWithConfig(socketPath, ClientConfig{MaxListAttempts: 3})
+		require.NoError(t, err)
+		defer client.Close()
+
+		server.reset()
+		_, err = client.ListEntries(ctx)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(3), server.listCalls.Load())
+
+		_, err = client.GetEntry(ctx, "ID")
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(3), server.getCalls.Load())
+	})
+
+	t.Run("does not retry writes", func(t *testing.T) {
+		client, err := DialSocketWithConfig(socketPath, ClientConfig{MaxListAttempts: 3})
+		require.NoError(t, err)
+		defer client.Close()
+
+		server.reset()
+		_, err = client.DeleteEntries(ctx, []string{"ID"})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(1), server.deleteCalls.Load())
+	})
+
+	t.Run("retries disabled", func(t *testing.T) {
+		client, err := DialSocketWithConfig(socketPath, ClientConfig{})
+		require.NoError(t, err)
+		defer client.Close()
+
+		server.reset()
+		_, err = client.ListEntries(ctx)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(1), server.listCalls.Load())
+	})
+
+	t.Run("calls are bounded by the RPC timeout", func(t *testing.T) {
+		client, err := DialSocketWithConfig(socketPath, ClientConfig{RPCTimeout: 50 * time.Millisecond})
+		require.NoError(t, err)
+		defer client.Close()
+
+		server.reset()
+		server.hang.Store(true)
+		_, err = client.ListEntries(ctx)
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+
+	t.Run("calls are recorded in metrics", func(t *testing.T) {
+		assert.Positive(t, testutil.CollectAndCount(metrics.PromHistogramVecs[metrics.SPIREAPIRequestDuration]))
+	})
+}
+
+func TestTimeoutInterceptor(t *testing.T) {
+	invokerDeadline := func(interceptor grpc.UnaryClientInterceptor, ctx context.Context) (time.Time, bool) {
+		var deadline time.Time
+		var ok bool
+		err := interceptor(ctx, "/method", nil, nil, nil, func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			deadline, ok = ctx.Deadline()
+			return nil
+		})
+		require.NoError(t, err)
+		return deadline, ok
+	}
+
+	t.Run("no timeout", func(t *testing.T) {
+		_, ok := invokerDeadline(timeoutInterceptor(0), context.Background())
+		assert.False(t, ok)
+	})
+
+	t.Run("adds deadline", func(t *testing.T) {
+		deadline, ok := invokerDeadline(timeoutInterceptor(time.Minute), context.Background())
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 10*time.Second)
+	})
+
+	t.Run("keeps earlier deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		expected, _ := ctx.Deadline()
+		deadline, ok := invokerDeadline(timeoutInterceptor(time.Minute), ctx)
+		assert.True(t, ok)
+		assert.Equal(t, expected, deadline)
+	})
+}
+
+func startSocketServer(t *testing.T, registerFn func(s *grpc.Server)) string {
+	// Unix socket paths are limited in length, so t.TempDir() can't be used.
+	dir, err := os.MkdirTemp("", "spireapi")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "api.sock")
+
+	s := grpc.NewServer()
+	registerFn(s)
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	go func() { _ = s.Serve(listener) }()
+	t.Cleanup(s.Stop)
+	return socketPath
+}
+
+type unavailableEntryServer struct {
+	entryv1.UnimplementedEntryServer
+
+	hang        atomic.Bool
+	listCalls   atomic.Int32
+	getCalls    atomic.Int32
+	deleteCalls atomic.Int32
+}
+
+func (s *unavailableEntryServer) reset() {
+	s.hang.Store(false)
+	s.listCalls.Store(0)
+	s.getCalls.Store(0)
+	s.deleteCalls.Store(0)
+}
+
+func (s *unavailableEntryServer) ListEntries(ctx context.Context, _ *entryv1.ListEntriesRequest) (*entryv1.ListEntriesResponse, error) {
+	s.listCalls.Add(1)
+	if s.hang.Load() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return nil, status.Error(codes.Unavailable, "unavailable")
+}
+
+func (s *unavailableEntryServer) GetEntry(context.Context, *entryv1.GetEntryRequest) (*apitypes.Entry, error) {
+	s.getCalls.Add(1)
+	return nil, status.Error(codes.Unavailable, "unavailable")
+}
+
+func (s *unavailableEntryServer) BatchDeleteEntry(context.Context, *entryv1.BatchDeleteEntryRequest) (*entryv1.BatchDeleteEntryResponse, error) {
+	s.deleteCalls.Add(1)
+	return nil, status.Error(codes.Unavailable, "unavailable")
+}
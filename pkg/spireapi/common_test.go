@@ -15,6 +15,9 @@ import (
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -73,6 +76,16 @@ func assertErrorIs(tb testing.TB, err error, target error) {
 	}
 }
 
+// recordSpans installs a tracer provider that records ended spans for the
+// duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+	return recorder
+}
+
 func decodeKey(s string) crypto.Signer {
 	block, _ := pem.Decode([]byte(s))
 	key, _ := x509.ParsePKCS8PrivateKey(block.Bytes)
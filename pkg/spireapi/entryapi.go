@@ -19,32 +19,94 @@ package spireapi
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
-	AdminField         Field = "admin"
-	DNSNamesField      Field = "dnsNames"
-	DownstreamField    Field = "downstream"
-	FederatesWithField Field = "federatesWith"
-	HintField          Field = "hint"
-	JWTSVIDTTLField    Field = "jwtSVIDTTL"
-	StoreSVIDField     Field = "storeSVID"
-	X509SVIDTTL        Field = "x509SVIDTTL"
+	AdminField          Field = "admin"
+	CreatedAtField      Field = "createdAt"
+	DNSNamesField       Field = "dnsNames"
+	DownstreamField     Field = "downstream"
+	ExpiresAtField      Field = "expiresAt"
+	FederatesWithField  Field = "federatesWith"
+	HintField           Field = "hint"
+	JWTSVIDTTLField     Field = "jwtSVIDTTL"
+	RevisionNumberField Field = "revisionNumber"
+	StoreSVIDField      Field = "storeSVID"
+	X509SVIDTTL         Field = "x509SVIDTTL"
 )
 
 type Field string
 
+// SelectorMatchBehavior determines how the selectors in a SelectorMatch are
+// matched against the selectors of an entry.
+type SelectorMatchBehavior int
+
+const (
+	// MatchExact matches entries with exactly the given selectors.
+	MatchExact SelectorMatchBehavior = iota
+	// MatchSubset matches entries whose selectors are a subset of the given
+	// selectors.
+	MatchSubset
+	// MatchSuperset matches entries whose selectors are a superset of the
+	// given selectors.
+	MatchSuperset
+	// MatchAny matches entries that have any of the given selectors.
+	MatchAny
+)
+
+type SelectorMatch struct {
+	Selectors []Selector
+	Match     SelectorMatchBehavior
+}
+
+// EntryFilter restricts the entries returned by ListFilteredEntries. Unset
+// fields do not filter. When more than one field is set, entries must match
+// all of them.
+type EntryFilter struct {
+	BySPIFFEID  spiffeid.ID
+	ByParentID  spiffeid.ID
+	BySelectors *SelectorMatch
+	ByHint      *string
+}
+
+// EntryUpdate is an update to an existing entry. Only the listed fields are
+// updated on the entry. If Fields is nil, every field is updated.
+//
+// If CheckRevision is set, the update is skipped with codes.Aborted when the
+// revision number of the entry on the server no longer matches
+// Entry.RevisionNumber, or with codes.NotFound when the entry no longer
+// exists. This is a best-effort staleness check, not a conditional update:
+// the SPIRE API has no conditional updates, so the revisions are read for
+// each batch before it is sent and a change made in between is still
+// overwritten.
+type EntryUpdate struct {
+	Entry         Entry
+	Fields        []Field
+	CheckRevision bool
+}
+
 type EntryClient interface {
 	ListEntries(ctx context.Context) ([]Entry, error)
-	CreateEntries(ctx context.Context, entries []Entry) ([]Status, error)
-	UpdateEntries(ctx context.Context, entries []Entry) ([]Status, error)
+	// ListFilteredEntries lists the entries matching the filter. If the
+	// output mask is non-nil, only the listed fields are populated on the
+	// returned entries, in addition to the ID, SPIFFE ID, parent ID and
+	// selectors, which are always populated.
+	ListFilteredEntries(ctx context.Context, filter EntryFilter, outputMask []Field) ([]Entry, error)
+	GetEntry(ctx context.Context, entryID string) (Entry, error)
+	CreateEntries(ctx context.Context, entries []Entry) ([]EntryResult, error)
+	UpdateEntries(ctx context.Context, updates []EntryUpdate) ([]EntryResult, error)
 	DeleteEntries(ctx context.Context, entryIDs []string) ([]Status, error)
 	GetUnsupportedFields(ctx context.Context, td string) (map[Field]struct{}, error)
 }
@@ -58,12 +120,34 @@ type entryClient struct {
 }
 
 func (c entryClient) ListEntries(ctx context.Context) ([]Entry, error) {
+	return c.ListFilteredEntries(ctx, EntryFilter{}, nil)
+}
+
+func (c entryClient) ListFilteredEntries(ctx context.Context, filter EntryFilter, outputMask []Field) ([]Entry, error) {
+	apiFilter, err := entryFilterToAPI(filter)
+	if err != nil {
+		return nil, err
+	}
+	apiOutputMask, err := entryMaskToAPI(outputMask)
+	if err != nil {
+		return nil, err
+	}
+	if apiOutputMask != nil {
+		// The SPIFFE ID, parent ID and selectors are required to convert
+		// the entry from the API type.
+		apiOutputMask.SpiffeId = true
+		apiOutputMask.ParentId = true
+		apiOutputMask.Selectors = true
+	}
+
 	var entries []*apitypes.Entry
 	var pageToken string
 	for {
 		resp, err := c.api.ListEntries(ctx, &entryv1.ListEntriesRequest{
-			PageToken: pageToken,
-			PageSize:  int32(entryListPageSize),
+			Filter:     apiFilter,
+			OutputMask: apiOutputMask,
+			PageToken:  pageToken,
+			PageSize:   int32(entryListPageSize),
 		})
 		if err != nil {
 			return nil, err
@@ -77,6 +161,16 @@ func (c entryClient) ListEntries(ctx context.Context) ([]Entry, error) {
 	return entriesFromAPI(entries)
 }
 
+func (c entryClient) GetEntry(ctx context.Context, entryID string) (Entry, error) {
+	entry, err := c.api.GetEntry(ctx, &entryv1.GetEntryRequest{
+		Id: entryID,
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+	return entryFromAPI(entry)
+}
+
 func (c entryClient) GetUnsupportedFields(ctx context.Context, td string) (map[Field]struct{}, error) {
 	resp, err := c.api.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{
 		Entries: []*apitypes.Entry{
@@ -141,50 +235,268 @@ func (c entryClient) GetUnsupportedFields(ctx context.Context, td string) (map[F
 	return unsupportedFields, nil
 }
 
-func (c entryClient) CreateEntries(ctx context.Context, entries []Entry) ([]Status, error) {
-	statuses := make([]Status, 0, len(entries))
-	err := runBatch(len(entries), entryCreateBatchSize, func(start, end int) error {
+func (c entryClient) CreateEntries(ctx context.Context, entries []Entry) ([]EntryResult, error) {
+	results := make([]EntryResult, 0, len(entries))
+	err := runBatch(ctx, "spireapi.BatchCreateEntry", len(entries), entryCreateBatchSize, func(ctx context.Context, start, end int) error {
 		resp, err := c.api.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{
 			Entries: entriesToAPI(entries[start:end]),
 		})
-		if err == nil {
-			for _, result := range resp.Results {
-				statuses = append(statuses, statusFromAPI(result.Status))
+		if err != nil {
+			return err
+		}
+		var failed int
+		for _, result := range resp.Results {
+			entryResult, err := entryResultFromAPI(result.Status, result.Entry)
+			if err != nil {
+				return err
+			}
+			results = append(results, entryResult)
+			if entryResult.Code != codes.OK {
+				failed++
 			}
 		}
-		return err
+		recordFailedResults(ctx, failed)
+		return nil
 	})
-	return statuses, err
+	return results, err
 }
 
-func (c entryClient) UpdateEntries(ctx context.Context, entries []Entry) ([]Status, error) {
-	statuses := make([]Status, 0, len(entries))
-	err := runBatch(len(entries), entryUpdateBatchSize, func(start, end int) error {
-		resp, err := c.api.BatchUpdateEntry(ctx, &entryv1.BatchUpdateEntryRequest{
-			Entries: entriesToAPI(entries[start:end]),
-		})
-		if err == nil {
-			for _, result := range resp.Results {
-				statuses = append(statuses, statusFromAPI(result.Status))
+func (c entryClient) UpdateEntries(ctx context.Context, updates []EntryUpdate) ([]EntryResult, error) {
+	// The input mask applies to the whole batch, so updates are grouped by
+	// the fields being updated. Results are returned in the order of the
+	// updates.
+	type updateGroup struct {
+		mask    *apitypes.EntryMask
+		indices []int
+	}
+	var groups []*updateGroup
+	groupsByMask := make(map[string]*updateGroup)
+	for i, update := range updates {
+		key := entryMaskKey(update.Fields)
+		group, ok := groupsByMask[key]
+		if !ok {
+			mask, err := entryMaskToAPI(update.Fields)
+			if err != nil {
+				return nil, err
 			}
+			group = &updateGroup{mask: mask}
+			groupsByMask[key] = group
+			groups = append(groups, group)
 		}
-		return err
-	})
-	return statuses, err
+		group.indices = append(group.indices, i)
+	}
+
+	results := make([]EntryResult, len(updates))
+	for _, group := range groups {
+		err := runBatch(ctx, "spireapi.BatchUpdateEntry", len(group.indices), entryUpdateBatchSize, func(ctx context.Context, start, end int) error {
+			indices := make([]int, 0, end-start)
+			entries := make([]Entry, 0, end-start)
+			var failed int
+			revisions, err := c.listRevisions(ctx, updates, group.indices[start:end])
+			if err != nil {
+				return err
+			}
+			for _, i := range group.indices[start:end] {
+				if updates[i].CheckRevision {
+					st := checkRevision(updates[i].Entry, revisions)
+					if st.Code != codes.OK {
+						results[i] = EntryResult{Status: st}
+						failed++
+						continue
+					}
+				}
+				indices = append(indices, i)
+				entries = append(entries, updates[i].Entry)
+			}
+			if len(entries) == 0 {
+				recordFailedResults(ctx, failed)
+				return nil
+			}
+			resp, err := c.api.BatchUpdateEntry(ctx, &entryv1.BatchUpdateEntryRequest{
+				Entries:   entriesToAPI(entries),
+				InputMask: group.mask,
+			})
+			if err != nil {
+				return err
+			}
+			if len(resp.Results) != len(entries) {
+				return fmt.Errorf("expected %d update results but got %d", len(entries), len(resp.Results))
+			}
+			for j, result := range resp.Results {
+				entryResult, err := entryResultFromAPI(result.Status, result.Entry)
+				if err != nil {
+					return err
+				}
+				results[indices[j]] = entryResult
+				if entryResult.Code != codes.OK {
+					failed++
+				}
+			}
+			recordFailedResults(ctx, failed)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// listRevisions returns the current revision numbers, keyed by entry ID, of
+// the entries whose updates check the revision. The SPIRE API cannot filter
+// by entry ID, so the revisions are listed with one request per parent ID
+// rather than one per entry. Updates of every field may change the parent
+// ID, in which case the entries are listed with a single unfiltered request.
+func (c entryClient) listRevisions(ctx context.Context, updates []EntryUpdate, indices []int) (map[string]int64, error) {
+	var filters []EntryFilter
+	seen := make(map[spiffeid.ID]struct{})
+	for _, i := range indices {
+		if !updates[i].CheckRevision {
+			continue
+		}
+		if updates[i].Fields == nil {
+			filters = []EntryFilter{{}}
+			break
+		}
+		parentID := updates[i].Entry.ParentID
+		if _, ok := seen[parentID]; !ok {
+			seen[parentID] = struct{}{}
+			filters = append(filters, EntryFilter{ByParentID: parentID})
+		}
+	}
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	revisions := make(map[string]int64)
+	for _, filter := range filters {
+		entries, err := c.ListFilteredEntries(ctx, filter, []Field{RevisionNumberField})
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			revisions[entry.ID] = entry.RevisionNumber
+		}
+	}
+	return revisions, nil
+}
+
+// checkRevision returns an OK status if the listed revision number of the
+// entry matches the revision number of the given entry.
+func checkRevision(entry Entry, revisions map[string]int64) Status {
+	current, ok := revisions[entry.ID]
+	switch {
+	case !ok:
+		return Status{Code: codes.NotFound, Message: fmt.Sprintf("entry %q not found", entry.ID)}
+	case current != entry.RevisionNumber:
+		return Status{
+			Code:    codes.Aborted,
+			Message: fmt.Sprintf("entry %q revision changed from %d to %d", entry.ID, entry.RevisionNumber, current),
+		}
+	default:
+		return Status{Code: codes.OK}
+	}
 }
 
 func (c entryClient) DeleteEntries(ctx context.Context, entryIDs []string) ([]Status, error) {
 	statuses := make([]Status, 0, len(entryIDs))
-	err := runBatch(len(entryIDs), entryDeleteBatchSize, func(start, end int) error {
+	err := runBatch(ctx, "spireapi.BatchDeleteEntry", len(entryIDs), entryDeleteBatchSize, func(ctx context.Context, start, end int) error {
 		resp, err := c.api.BatchDeleteEntry(ctx, &entryv1.BatchDeleteEntryRequest{
 			Ids: entryIDs[start:end],
 		})
 		if err == nil {
+			batchStatuses := make([]Status, 0, len(resp.Results))
 			for _, result := range resp.Results {
-				statuses = append(statuses, statusFromAPI(result.Status))
+				batchStatuses = append(batchStatuses, statusFromAPI(result.Status))
 			}
+			statuses = append(statuses, batchStatuses...)
+			recordFailedResults(ctx, countFailed(batchStatuses))
 		}
 		return err
 	})
 	return statuses, err
 }
+
+func entryFilterToAPI(in EntryFilter) (*entryv1.ListEntriesRequest_Filter, error) {
+	out := new(entryv1.ListEntriesRequest_Filter)
+	if !in.BySPIFFEID.IsZero() {
+		out.BySpiffeId = spiffeIDToAPI(in.BySPIFFEID)
+	}
+	if !in.ByParentID.IsZero() {
+		out.ByParentId = spiffeIDToAPI(in.ByParentID)
+	}
+	if in.BySelectors != nil {
+		var match apitypes.SelectorMatch_MatchBehavior
+		switch in.BySelectors.Match {
+		case MatchExact:
+			match = apitypes.SelectorMatch_MATCH_EXACT
+		case MatchSubset:
+			match = apitypes.SelectorMatch_MATCH_SUBSET
+		case MatchSuperset:
+			match = apitypes.SelectorMatch_MATCH_SUPERSET
+		case MatchAny:
+			match = apitypes.SelectorMatch_MATCH_ANY
+		default:
+			return nil, fmt.Errorf("unrecognized selector match behavior %d", in.BySelectors.Match)
+		}
+		out.BySelectors = &apitypes.SelectorMatch{
+			Selectors: selectorsToAPI(in.BySelectors.Selectors),
+			Match:     match,
+		}
+	}
+	if in.ByHint != nil {
+		out.ByHint = wrapperspb.String(*in.ByHint)
+	}
+	return out, nil
+}
+
+// entryMaskToAPI converts the fields to an entry mask. A nil set of fields
+// results in a nil mask, which the API treats as all fields.
+func entryMaskToAPI(fields []Field) (*apitypes.EntryMask, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	mask := new(apitypes.EntryMask)
+	for _, field := range fields {
+		switch field {
+		case AdminField:
+			mask.Admin = true
+		case CreatedAtField:
+			mask.CreatedAt = true
+		case ExpiresAtField:
+			mask.ExpiresAt = true
+		case RevisionNumberField:
+			mask.RevisionNumber = true
+		case DNSNamesField:
+			mask.DnsNames = true
+		case DownstreamField:
+			mask.Downstream = true
+		case FederatesWithField:
+			mask.FederatesWith = true
+		case HintField:
+			mask.Hint = true
+		case JWTSVIDTTLField:
+			mask.JwtSvidTtl = true
+		case StoreSVIDField:
+			mask.StoreSvid = true
+		case X509SVIDTTL:
+			mask.X509SvidTtl = true
+		default:
+			return nil, fmt.Errorf("unrecognized entry mask field %q", field)
+		}
+	}
+	return mask, nil
+}
+
+// entryMaskKey returns a key that is the same for any two sets of fields
+// that result in the same entry mask.
+func entryMaskKey(fields []Field) string {
+	if fields == nil {
+		return "*"
+	}
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, string(field))
+	}
+	sort.Strings(keys)
+	return strings.Join(slices.Compact(keys), ",")
+}
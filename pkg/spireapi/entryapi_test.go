@@ -2,6 +2,7 @@ package spireapi
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"sync"
 	"testing"
@@ -12,9 +13,14 @@ import (
 	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/spiffe/spire-controller-manager/pkg/tracing"
 )
 
 func init() {
@@ -92,6 +98,117 @@ func TestEntryAPIListEntries(t *testing.T) {
 	}
 }
 
+func TestEntryAPIListFilteredEntries(t *testing.T) {
+	server, client := startEntryAPIServer(t)
+
+	otherParentID := spiffeid.RequireFromString("spiffe://domain.test/other")
+	entry4 := Entry{
+		ID:            "E4",
+		ParentID:      otherParentID,
+		SPIFFEID:      spiffeid.RequireFromString("spiffe://domain.test/workload4"),
+		Selectors:     []Selector{{Type: "T1", Value: "V1"}, {Type: "T4", Value: "V4"}},
+		X509SVIDTTL:   time.Minute,
+		JWTSVIDTTL:    time.Minute,
+		FederatesWith: []spiffeid.TrustDomain{domain1},
+		Admin:         true,
+		Downstream:    true,
+		DNSNames:      []string{"workload4"},
+		Hint:          "hint",
+		StoreSVID:     true,
+	}
+	server.setEntries(t, entry1, entry2, entry3, entry4)
+
+	hint := "hint"
+	masked := func(entry Entry, fields ...Field) Entry {
+		out := Entry{ID: entry.ID, SPIFFEID: entry.SPIFFEID, ParentID: entry.ParentID, Selectors: entry.Selectors}
+		for _, field := range fields {
+			switch field {
+			case X509SVIDTTL:
+				out.X509SVIDTTL = entry.X509SVIDTTL
+			case DNSNamesField:
+				out.DNSNames = entry.DNSNames
+			}
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		desc          string
+		filter        EntryFilter
+		outputMask    []Field
+		expectEntries []Entry
+		expectErr     string
+	}{
+		{
+			desc:          "no filter",
+			expectEntries: []Entry{entry1, entry2, entry3, entry4},
+		},
+		{
+			desc:          "by parent ID",
+			filter:        EntryFilter{ByParentID: entry1.ParentID},
+			expectEntries: []Entry{entry1, entry2, entry3},
+		},
+		{
+			desc:          "by SPIFFE ID",
+			filter:        EntryFilter{BySPIFFEID: entry2.SPIFFEID},
+			expectEntries: []Entry{entry2},
+		},
+		{
+			desc:          "by hint",
+			filter:        EntryFilter{ByHint: &hint},
+			expectEntries: []Entry{entry4},
+		},
+		{
+			desc:          "by selectors exact",
+			filter:        EntryFilter{BySelectors: &SelectorMatch{Selectors: []Selector{{Type: "T1", Value: "V1"}}, Match: MatchExact}},
+			expectEntries: []Entry{entry1},
+		},
+		{
+			desc:          "by selectors superset",
+			filter:        EntryFilter{BySelectors: &SelectorMatch{Selectors: []Selector{{Type: "T1", Value: "V1"}}, Match: MatchSuperset}},
+			expectEntries: []Entry{entry1, entry4},
+		},
+		{
+			desc:          "by selectors any",
+			filter:        EntryFilter{BySelectors: &SelectorMatch{Selectors: []Selector{{Type: "T2", Value: "V2"}, {Type: "T4", Value: "V4"}}, Match: MatchAny}},
+			expectEntries: []Entry{entry2, entry4},
+		},
+		{
+			desc:      "by selectors with unrecognized match behavior",
+			filter:    EntryFilter{BySelectors: &SelectorMatch{Match: SelectorMatchBehavior(99)}},
+			expectErr: "unrecognized selector match behavior 99",
+		},
+		{
+			desc:          "empty output mask",
+			filter:        EntryFilter{ByParentID: otherParentID},
+			outputMask:    []Field{},
+			expectEntries: []Entry{masked(entry4)},
+		},
+		{
+			desc:          "output mask",
+			filter:        EntryFilter{ByParentID: otherParentID},
+			outputMask:    []Field{X509SVIDTTL, DNSNamesField},
+			expectEntries: []Entry{masked(entry4, X509SVIDTTL, DNSNamesField)},
+		},
+		{
+			desc:       "unrecognized entry mask field",
+			outputMask: []Field{"bogus"},
+			expectErr:  `unrecognized entry mask field "bogus"`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			actualEntries, err := client.ListFilteredEntries(ctx, tc.filter, tc.outputMask)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				assert.Empty(t, actualEntries)
+				return
+			}
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.expectEntries, actualEntries)
+		})
+	}
+}
+
 func TestCreateEntries(t *testing.T) {
 	server, client := startEntryAPIServer(t)
 
@@ -144,19 +261,56 @@ func TestCreateEntries(t *testing.T) {
 		t.Run(tc.desc, func(t *testing.T) {
 			server.setEntries(t, tc.withEntries...)
 			server.batchCreateEntriesErr = tc.expectErr
-			actualStatus, err := client.CreateEntries(ctx, tc.createEntries)
+			actualResults, err := client.CreateEntries(ctx, tc.createEntries)
 			if tc.expectErr != nil {
 				assertErrorIs(t, err, tc.expectErr)
-				assert.Empty(t, actualStatus)
+				assert.Empty(t, actualResults)
 				return
 			}
 			assert.NoError(t, err)
-			assert.Equal(t, tc.expectStatus, actualStatus)
+			assertEntryResults(t, server, tc.expectStatus, actualResults)
 			assert.ElementsMatch(t, tc.expectEntries, server.getEntries(t))
 		})
 	}
 }
 
+func TestCreateEntriesTracing(t *testing.T) {
+	server, client := startEntryAPIServer(t)
+	recorder := recordSpans(t)
+
+	server.setEntries(t, entry1)
+	_, err := client.CreateEntries(ctx, []Entry{entry1, entry2, entry3})
+	require.NoError(t, err)
+
+	server.batchCreateEntriesErr = status.Error(codes.Internal, "oh no")
+	_, err = client.CreateEntries(ctx, []Entry{entry1})
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	for _, span := range spans {
+		assert.Equal(t, "spireapi.BatchCreateEntry", span.Name())
+	}
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		batchOffsetKey.Int(0),
+		batchSizeKey.Int(2),
+		batchFailedKey.Int(1),
+		tracing.GRPCStatusCodeKey.String("OK"),
+	}, spans[0].Attributes())
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		batchOffsetKey.Int(2),
+		batchSizeKey.Int(1),
+		batchFailedKey.Int(0),
+		tracing.GRPCStatusCodeKey.String("OK"),
+	}, spans[1].Attributes())
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		batchOffsetKey.Int(0),
+		batchSizeKey.Int(1),
+		tracing.GRPCStatusCodeKey.String("Internal"),
+	}, spans[2].Attributes())
+	assert.Equal(t, otelcodes.Error, spans[2].Status().Code)
+}
+
 func TestGetUnsupportedFields(t *testing.T) {
 	for _, tc := range []struct {
 		desc                   string
@@ -226,18 +380,30 @@ func TestUpdateEntries(t *testing.T) {
 		entry.X509SVIDTTL = ttl
 		return entry
 	}
+	dupWithHint := func(entry Entry, hint string) Entry {
+		entry.Hint = hint
+		return entry
+	}
+	updates := func(fields []Field, entries ...Entry) []EntryUpdate {
+		var updates []EntryUpdate
+		for _, entry := range entries {
+			updates = append(updates, EntryUpdate{Entry: entry, Fields: fields})
+		}
+		return updates
+	}
 
 	entry1Old := dupWithTTL(entry1, 1*time.Second)
 	entry2Old := dupWithTTL(entry2, 2*time.Second)
 	entry3Old := dupWithTTL(entry3, 3*time.Second)
 
 	for _, tc := range []struct {
-		desc          string
-		withEntries   []Entry
-		updateEntries []Entry
-		expectEntries []Entry
-		expectStatus  []Status
-		expectErr     error
+		desc             string
+		withEntries      []Entry
+		updateEntries    []EntryUpdate
+		expectEntries    []Entry
+		expectStatus     []Status
+		expectInputMasks []*apitypes.EntryMask
+		expectErr        error
 	}{
 		{
 			desc:          "empty",
@@ -246,52 +412,175 @@ func TestUpdateEntries(t *testing.T) {
 		},
 		{
 			desc:          "RPC error",
-			updateEntries: []Entry{entry1},
+			updateEntries: updates(nil, entry1),
 			expectErr:     status.Error(codes.Internal, "oh no"),
 		},
 		{
-			desc:          "not found",
-			updateEntries: []Entry{entry1},
-			expectStatus:  []Status{{Code: codes.NotFound, Message: `entry "E1" not found`}},
+			desc:             "not found",
+			updateEntries:    updates(nil, entry1),
+			expectStatus:     []Status{{Code: codes.NotFound, Message: `entry "E1" not found`}},
+			expectInputMasks: []*apitypes.EntryMask{nil},
 		},
 		{
-			desc:          "less than a batch",
-			withEntries:   []Entry{entry1},
-			updateEntries: []Entry{entry1},
-			expectEntries: []Entry{entry1},
-			expectStatus:  []Status{ok},
+			desc:             "less than a batch",
+			withEntries:      []Entry{entry1},
+			updateEntries:    updates(nil, entry1),
+			expectEntries:    []Entry{entry1},
+			expectStatus:     []Status{ok},
+			expectInputMasks: []*apitypes.EntryMask{nil},
 		},
 		{
-			desc:          "exactly a batch",
-			withEntries:   []Entry{entry1Old, entry2Old},
-			updateEntries: []Entry{entry1, entry2},
-			expectEntries: []Entry{entry1, entry2},
-			expectStatus:  []Status{ok, ok},
+			desc:             "exactly a batch",
+			withEntries:      []Entry{entry1Old, entry2Old},
+			updateEntries:    updates(nil, entry1, entry2),
+			expectEntries:    []Entry{entry1, entry2},
+			expectStatus:     []Status{ok, ok},
+			expectInputMasks: []*apitypes.EntryMask{nil},
 		},
 		{
-			desc:          "more than a batch",
-			withEntries:   []Entry{entry1Old, entry2Old, entry3Old},
-			updateEntries: []Entry{entry1, entry2, entry3},
-			expectEntries: []Entry{entry1, entry2, entry3},
+			desc:             "more than a batch",
+			withEntries:      []Entry{entry1Old, entry2Old, entry3Old},
+			updateEntries:    updates(nil, entry1, entry2, entry3),
+			expectEntries:    []Entry{entry1, entry2, entry3},
+			expectStatus:     []Status{ok, ok, ok},
+			expectInputMasks: []*apitypes.EntryMask{nil, nil},
+		},
+		{
+			desc:        "masked fields only",
+			withEntries: []Entry{dupWithHint(entry1Old, "old")},
+			// Only the TTL is in the mask, so the hint is left alone.
+			updateEntries:    updates([]Field{X509SVIDTTL}, dupWithHint(entry1, "new")),
+			expectEntries:    []Entry{dupWithHint(entry1, "old")},
+			expectStatus:     []Status{ok},
+			expectInputMasks: []*apitypes.EntryMask{{X509SvidTtl: true}},
+		},
+		{
+			desc:        "grouped by mask",
+			withEntries: []Entry{entry1Old, dupWithHint(entry2, "old"), entry3Old},
+			updateEntries: []EntryUpdate{
+				{Entry: entry1, Fields: []Field{X509SVIDTTL}},
+				{Entry: dupWithHint(entry2, "new"), Fields: []Field{HintField}},
+				{Entry: entry3, Fields: []Field{X509SVIDTTL}},
+			},
+			expectEntries: []Entry{entry1, dupWithHint(entry2, "new"), entry3},
 			expectStatus:  []Status{ok, ok, ok},
+			expectInputMasks: []*apitypes.EntryMask{
+				{X509SvidTtl: true},
+				{Hint: true},
+			},
+		},
+		{
+			desc:        "statuses in update order",
+			withEntries: []Entry{entry2},
+			updateEntries: []EntryUpdate{
+				{Entry: entry1, Fields: []Field{X509SVIDTTL}},
+				{Entry: dupWithHint(entry2, "new"), Fields: []Field{HintField}},
+				{Entry: entry3, Fields: []Field{X509SVIDTTL}},
+			},
+			expectEntries: []Entry{dupWithHint(entry2, "new")},
+			expectStatus: []Status{
+				{Code: codes.NotFound, Message: `entry "E1" not found`},
+				ok,
+				{Code: codes.NotFound, Message: `entry "E3" not found`},
+			},
+			expectInputMasks: []*apitypes.EntryMask{
+				{X509SvidTtl: true},
+				{Hint: true},
+			},
+		},
+		{
+			desc:          "unrecognized field",
+			withEntries:   []Entry{entry1},
+			updateEntries: updates([]Field{"bogus"}, entry1),
+			expectErr:     errors.New(`unrecognized entry mask field "bogus"`),
 		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			server.setEntries(t, tc.withEntries...)
+			server.updateInputMasks = nil
 			server.batchUpdateEntriesErr = tc.expectErr
-			actualStatus, err := client.UpdateEntries(ctx, tc.updateEntries)
+			actualResults, err := client.UpdateEntries(ctx, tc.updateEntries)
 			if tc.expectErr != nil {
-				assertErrorIs(t, err, tc.expectErr)
-				assert.Empty(t, actualStatus)
+				assert.EqualError(t, err, tc.expectErr.Error())
+				assert.Empty(t, actualResults)
 				return
 			}
 			assert.NoError(t, err)
-			assert.Equal(t, tc.expectStatus, actualStatus)
+			assertEntryResults(t, server, tc.expectStatus, actualResults)
 			assert.ElementsMatch(t, tc.expectEntries, server.getEntries(t))
+			require.Len(t, server.updateInputMasks, len(tc.expectInputMasks))
+			for i, expectInputMask := range tc.expectInputMasks {
+				assert.True(t, proto.Equal(expectInputMask, server.updateInputMasks[i]), "unexpected input mask %d: %v", i, server.updateInputMasks[i])
+			}
 		})
 	}
 }
 
+func TestGetEntry(t *testing.T) {
+	server, client := startEntryAPIServer(t)
+
+	withRevision := entry1
+	withRevision.RevisionNumber = 2
+	withRevision.CreatedAt = now
+	server.setEntries(t, withRevision)
+
+	t.Run("found", func(t *testing.T) {
+		actual, err := client.GetEntry(ctx, entry1ID)
+		require.NoError(t, err)
+		assert.Equal(t, withRevision, actual)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := client.GetEntry(ctx, entry2ID)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("RPC error", func(t *testing.T) {
+		server.getEntryErr = status.Error(codes.Internal, "oh no")
+		defer func() { server.getEntryErr = nil }()
+		_, err := client.GetEntry(ctx, entry1ID)
+		assertErrorIs(t, err, server.getEntryErr)
+	})
+}
+
+func TestUpdateEntriesCheckRevision(t *testing.T) {
+	server, client := startEntryAPIServer(t)
+
+	withRevision := func(entry Entry, revision int64, ttl time.Duration) Entry {
+		entry.RevisionNumber = revision
+		entry.X509SVIDTTL = ttl
+		return entry
+	}
+
+	server.setEntries(t, withRevision(entry1, 1, time.Second), withRevision(entry2, 2, time.Second))
+
+	results, err := client.UpdateEntries(ctx, []EntryUpdate{
+		{Entry: withRevision(entry1, 1, time.Minute), Fields: []Field{X509SVIDTTL}, CheckRevision: true},
+		{Entry: withRevision(entry2, 1, time.Minute), Fields: []Field{X509SVIDTTL}, CheckRevision: true},
+		{Entry: withRevision(entry3, 1, time.Minute), Fields: []Field{X509SVIDTTL}, CheckRevision: true},
+	})
+	require.NoError(t, err)
+	assertEntryResults(t, server, []Status{
+		{Code: codes.OK},
+		{Code: codes.Aborted, Message: `entry "E2" revision changed from 1 to 2`},
+		{Code: codes.NotFound, Message: `entry "E3" not found`},
+	}, results)
+	assert.ElementsMatch(t, []Entry{
+		withRevision(entry1, 1, time.Minute),
+		withRevision(entry2, 2, time.Second),
+	}, server.getEntries(t))
+
+	t.Run("RPC error", func(t *testing.T) {
+		server.listEntriesErr = status.Error(codes.Internal, "oh no")
+		defer func() { server.listEntriesErr = nil }()
+		results, err := client.UpdateEntries(ctx, []EntryUpdate{
+			{Entry: withRevision(entry1, 1, time.Minute), CheckRevision: true},
+		})
+		assertErrorIs(t, err, server.listEntriesErr)
+		assert.Empty(t, results)
+	})
+}
+
 func TestDeleteEntries(t *testing.T) {
 	server, client := startEntryAPIServer(t)
 
@@ -370,8 +659,10 @@ type entryServer struct {
 	entries []*apitypes.Entry
 
 	clearUnsupportedFields bool
+	updateInputMasks       []*apitypes.EntryMask
 
 	listEntriesErr        error
+	getEntryErr           error
 	batchCreateEntriesErr error
 	batchUpdateEntriesErr error
 	batchDeleteEntriesErr error
@@ -383,9 +674,16 @@ func (s *entryServer) ListEntries(_ context.Context, req *entryv1.ListEntriesReq
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
 
-	start, end, more := listBounds(req.PageToken, int(req.PageSize), len(s.entries), func(i int) string { return s.entries[i].Id })
-	for _, entry := range s.entries[start:end] {
-		resp.Entries = append(resp.Entries, entry)
+	var entries []*apitypes.Entry
+	for _, entry := range s.entries {
+		if entryMatchesFilter(entry, req.Filter) {
+			entries = append(entries, entry)
+		}
+	}
+
+	start, end, more := listBounds(req.PageToken, int(req.PageSize), len(entries), func(i int) string { return entries[i].Id })
+	for _, entry := range entries[start:end] {
+		resp.Entries = append(resp.Entries, applyEntryMask(entry, req.OutputMask))
 		if more {
 			resp.NextPageToken = entry.Id
 		}
@@ -394,6 +692,21 @@ func (s *entryServer) ListEntries(_ context.Context, req *entryv1.ListEntriesReq
 	return resp, s.listEntriesErr
 }
 
+func (s *entryServer) GetEntry(_ context.Context, req *entryv1.GetEntryRequest) (*apitypes.Entry, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.getEntryErr != nil {
+		return nil, s.getEntryErr
+	}
+	for _, entry := range s.entries {
+		if entry.Id == req.Id {
+			return applyEntryMask(entry, req.OutputMask), nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "entry %q not found", req.Id)
+}
+
 func (s *entryServer) BatchCreateEntry(_ context.Context, req *entryv1.BatchCreateEntryRequest) (*entryv1.BatchCreateEntryResponse, error) {
 	resp := new(entryv1.BatchCreateEntryResponse)
 
@@ -424,8 +737,13 @@ func (s *entryServer) BatchCreateEntry(_ context.Context, req *entryv1.BatchCrea
 func (s *entryServer) BatchUpdateEntry(_ context.Context, req *entryv1.BatchUpdateEntryRequest) (*entryv1.BatchUpdateEntryResponse, error) {
 	resp := new(entryv1.BatchUpdateEntryResponse)
 
+	s.mtx.Lock()
+	s.updateInputMasks = append(s.updateInputMasks, req.InputMask)
+	s.mtx.Unlock()
+
 	for _, entry := range req.Entries {
-		st := status.Convert(s.updateEntry(entry))
+		updated, err := s.updateEntry(entry, req.InputMask)
+		st := status.Convert(err)
 		result := &entryv1.BatchUpdateEntryResponse_Result{
 			Status: &apitypes.Status{
 				Code:    int32(st.Code()),
@@ -433,7 +751,7 @@ func (s *entryServer) BatchUpdateEntry(_ context.Context, req *entryv1.BatchUpda
 			},
 		}
 		if st.Code() == codes.OK {
-			result.Entry = entry
+			result.Entry = updated
 		}
 		resp.Results = append(resp.Results, result)
 	}
@@ -463,6 +781,26 @@ func (s *entryServer) clearEntries() {
 	s.mtx.Unlock()
 }
 
+// assertEntryResults asserts that the results have the expected statuses
+// and that successful results carry the entry as stored by the server.
+func assertEntryResults(t *testing.T, server *entryServer, expectStatus []Status, results []EntryResult) {
+	t.Helper()
+	serverEntries := make(map[string]Entry)
+	for _, entry := range server.getEntries(t) {
+		serverEntries[entry.ID] = entry
+	}
+	statuses := make([]Status, 0, len(results))
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+		if result.Code == codes.OK {
+			assert.Equal(t, serverEntries[result.Entry.ID], result.Entry)
+		} else {
+			assert.Zero(t, result.Entry)
+		}
+	}
+	assert.Equal(t, expectStatus, statuses)
+}
+
 func (s *entryServer) getEntries(t *testing.T) []Entry {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
@@ -474,7 +812,11 @@ func (s *entryServer) getEntries(t *testing.T) []Entry {
 func (s *entryServer) setEntries(t *testing.T, entries ...Entry) {
 	s.clearEntries()
 	for _, entry := range entries {
-		err := s.createEntry(entryToAPI(entry))
+		apiEntry := entryToAPI(entry)
+		// entryToAPI does not send the fields managed by the server.
+		apiEntry.RevisionNumber = entry.RevisionNumber
+		apiEntry.CreatedAt = timeToAPI(entry.CreatedAt)
+		err := s.createEntry(apiEntry)
 		require.NoError(t, err, "test setup failure creating entry")
 	}
 }
@@ -493,7 +835,7 @@ func (s *entryServer) createEntry(entry *apitypes.Entry) error {
 	return nil
 }
 
-func (s *entryServer) updateEntry(entry *apitypes.Entry) error {
+func (s *entryServer) updateEntry(entry *apitypes.Entry, mask *apitypes.EntryMask) (*apitypes.Entry, error) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
@@ -501,10 +843,47 @@ func (s *entryServer) updateEntry(entry *apitypes.Entry) error {
 		return s.entries[i].Id >= entry.Id
 	})
 	if !(n < len(s.entries) && s.entries[n].Id == entry.Id) {
-		return status.Errorf(codes.NotFound, "entry %q not found", entry.Id)
+		return nil, status.Errorf(codes.NotFound, "entry %q not found", entry.Id)
+	}
+	if mask != nil {
+		updated := proto.Clone(s.entries[n]).(*apitypes.Entry)
+		if mask.SpiffeId {
+			updated.SpiffeId = entry.SpiffeId
+		}
+		if mask.ParentId {
+			updated.ParentId = entry.ParentId
+		}
+		if mask.Selectors {
+			updated.Selectors = entry.Selectors
+		}
+		if mask.X509SvidTtl {
+			updated.X509SvidTtl = entry.X509SvidTtl
+		}
+		if mask.JwtSvidTtl {
+			updated.JwtSvidTtl = entry.JwtSvidTtl
+		}
+		if mask.FederatesWith {
+			updated.FederatesWith = entry.FederatesWith
+		}
+		if mask.Admin {
+			updated.Admin = entry.Admin
+		}
+		if mask.Downstream {
+			updated.Downstream = entry.Downstream
+		}
+		if mask.DnsNames {
+			updated.DnsNames = entry.DnsNames
+		}
+		if mask.Hint {
+			updated.Hint = entry.Hint
+		}
+		if mask.StoreSvid {
+			updated.StoreSvid = entry.StoreSvid
+		}
+		entry = updated
 	}
 	s.entries[n] = entry
-	return nil
+	return entry, nil
 }
 
 func (s *entryServer) deleteEntry(td string) error {
@@ -520,3 +899,102 @@ func (s *entryServer) deleteEntry(td string) error {
 	s.entries = s.entries[:n+copy(s.entries[n:], s.entries[n+1:])]
 	return nil
 }
+
+func entryMatchesFilter(entry *apitypes.Entry, filter *entryv1.ListEntriesRequest_Filter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.BySpiffeId != nil && !proto.Equal(entry.SpiffeId, filter.BySpiffeId) {
+		return false
+	}
+	if filter.ByParentId != nil && !proto.Equal(entry.ParentId, filter.ByParentId) {
+		return false
+	}
+	if filter.ByHint != nil && entry.Hint != filter.ByHint.Value {
+		return false
+	}
+	if filter.BySelectors != nil {
+		has := func(selectors []*apitypes.Selector, selector *apitypes.Selector) bool {
+			for _, s := range selectors {
+				if proto.Equal(s, selector) {
+					return true
+				}
+			}
+			return false
+		}
+		contains := func(as, bs []*apitypes.Selector) bool {
+			for _, b := range bs {
+				if !has(as, b) {
+					return false
+				}
+			}
+			return true
+		}
+		switch filter.BySelectors.Match {
+		case apitypes.SelectorMatch_MATCH_EXACT:
+			return contains(entry.Selectors, filter.BySelectors.Selectors) && contains(filter.BySelectors.Selectors, entry.Selectors)
+		case apitypes.SelectorMatch_MATCH_SUBSET:
+			return contains(filter.BySelectors.Selectors, entry.Selectors)
+		case apitypes.SelectorMatch_MATCH_SUPERSET:
+			return contains(entry.Selectors, filter.BySelectors.Selectors)
+		case apitypes.SelectorMatch_MATCH_ANY:
+			for _, selector := range filter.BySelectors.Selectors {
+				if has(entry.Selectors, selector) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func applyEntryMask(entry *apitypes.Entry, mask *apitypes.EntryMask) *apitypes.Entry {
+	if mask == nil {
+		return entry
+	}
+	out := &apitypes.Entry{Id: entry.Id}
+	if mask.SpiffeId {
+		out.SpiffeId = entry.SpiffeId
+	}
+	if mask.ParentId {
+		out.ParentId = entry.ParentId
+	}
+	if mask.Selectors {
+		out.Selectors = entry.Selectors
+	}
+	if mask.X509SvidTtl {
+		out.X509SvidTtl = entry.X509SvidTtl
+	}
+	if mask.JwtSvidTtl {
+		out.JwtSvidTtl = entry.JwtSvidTtl
+	}
+	if mask.FederatesWith {
+		out.FederatesWith = entry.FederatesWith
+	}
+	if mask.Admin {
+		out.Admin = entry.Admin
+	}
+	if mask.Downstream {
+		out.Downstream = entry.Downstream
+	}
+	if mask.DnsNames {
+		out.DnsNames = entry.DnsNames
+	}
+	if mask.Hint {
+		out.Hint = entry.Hint
+	}
+	if mask.StoreSvid {
+		out.StoreSvid = entry.StoreSvid
+	}
+	if mask.RevisionNumber {
+		out.RevisionNumber = entry.RevisionNumber
+	}
+	if mask.CreatedAt {
+		out.CreatedAt = entry.CreatedAt
+	}
+	if mask.ExpiresAt {
+		out.ExpiresAt = entry.ExpiresAt
+	}
+	return out
+}
@@ -62,7 +62,7 @@ func (c trustDomainClient) ListFederationRelationships(ctx context.Context) ([]F
 
 func (c trustDomainClient) CreateFederationRelationships(ctx context.Context, federationRelationships []FederationRelationship) ([]Status, error) {
 	var statuses []Status
-	err := runBatch(len(federationRelationships), federationRelationshipCreateBatchSize, func(start, end int) error {
+	err := runBatch(ctx, "spireapi.BatchCreateFederationRelationship", len(federationRelationships), federationRelationshipCreateBatchSize, func(ctx context.Context, start, end int) error {
 		toCreate, err := federationRelationshipsToAPI(federationRelationships[start:end])
 		if err != nil {
 			return err
@@ -71,9 +71,12 @@ func (c trustDomainClient) CreateFederationRelationships(ctx context.Context, fe
 			FederationRelationships: toCreate,
 		})
 		if err == nil {
+			batchStatuses := make([]Status, 0, len(resp.Results))
 			for _, result := range resp.Results {
-				statuses = append(statuses, statusFromAPI(result.Status))
+				batchStatuses = append(batchStatuses, statusFromAPI(result.Status))
 			}
+			statuses = append(statuses, batchStatuses...)
+			recordFailedResults(ctx, countFailed(batchStatuses))
 		}
 		return err
 	})
@@ -82,7 +85,7 @@ func (c trustDomainClient) CreateFederationRelationships(ctx context.Context, fe
 
 func (c trustDomainClient) UpdateFederationRelationships(ctx context.Context, federationRelationships []FederationRelationship) ([]Status, error) {
 	var statuses []Status
-	err := runBatch(len(federationRelationships), federationRelationshipUpdateBatchSize, func(start, end int) error {
+	err := runBatch(ctx, "spireapi.BatchUpdateFederationRelationship", len(federationRelationships), federationRelationshipUpdateBatchSize, func(ctx context.Context, start, end int) error {
 		toUpdate, err := federationRelationshipsToAPI(federationRelationships[start:end])
 		if err != nil {
 			return err
@@ -91,9 +94,12 @@ func (c trustDomainClient) UpdateFederationRelationships(ctx context.Context, fe
 			FederationRelationships: toUpdate,
 		})
 		if err == nil {
+			batchStatuses := make([]Status, 0, len(resp.Results))
 			for _, result := range resp.Results {
-				statuses = append(statuses, statusFromAPI(result.Status))
+				batchStatuses = append(batchStatuses, statusFromAPI(result.Status))
 			}
+			statuses = append(statuses, batchStatuses...)
+			recordFailedResults(ctx, countFailed(batchStatuses))
 		}
 		return err
 	})
@@ -102,14 +108,17 @@ func (c trustDomainClient) UpdateFederationRelationships(ctx context.Context, fe
 
 func (c trustDomainClient) DeleteFederationRelationships(ctx context.Context, tds []spiffeid.TrustDomain) ([]Status, error) {
 	var statuses []Status
-	err := runBatch(len(tds), federationRelationshipDeleteBatchSize, func(start, end int) error {
+	err := runBatch(ctx, "spireapi.BatchDeleteFederationRelationship", len(tds), federationRelationshipDeleteBatchSize, func(ctx context.Context, start, end int) error {
 		resp, err := c.api.BatchDeleteFederationRelationship(ctx, &trustdomainv1.BatchDeleteFederationRelationshipRequest{
 			TrustDomains: trustDomainsToAPI(tds[start:end]),
 		})
 		if err == nil {
+			batchStatuses := make([]Status, 0, len(resp.Results))
 			for _, result := range resp.Results {
-				statuses = append(statuses, statusFromAPI(result.Status))
+				batchStatuses = append(batchStatuses, statusFromAPI(result.Status))
 			}
+			statuses = append(statuses, batchStatuses...)
+			recordFailedResults(ctx, countFailed(batchStatuses))
 		}
 		return err
 	})
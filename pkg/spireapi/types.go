@@ -45,6 +45,16 @@ type Entry struct {
 	DNSNames      []string
 	Hint          string
 	StoreSVID     bool
+
+	// RevisionNumber is incremented by the server each time the entry is
+	// updated. It is ignored when creating or updating entries.
+	RevisionNumber int64
+	// CreatedAt is when the entry was created. It is ignored when creating
+	// or updating entries.
+	CreatedAt time.Time
+	// ExpiresAt is when the entry expires. The zero value means the entry
+	// does not expire.
+	ExpiresAt time.Time
 }
 
 type Selector struct {
@@ -124,6 +134,14 @@ func (s Status) Err() error {
 	return status.Error(s.Code, s.Message)
 }
 
+// EntryResult is the result of creating or updating an entry. Entry holds
+// the entry as returned by the server and is only set if the operation
+// succeeded.
+type EntryResult struct {
+	Status
+	Entry Entry
+}
+
 func ValidateBundleEndpointURL(s string) error {
 	if s == "" {
 		return errors.New("bundle endpoint URL is missing")
@@ -156,6 +174,7 @@ func entryToAPI(in Entry) *apitypes.Entry {
 		Downstream:    in.Downstream,
 		Hint:          in.Hint,
 		StoreSvid:     in.StoreSVID,
+		ExpiresAt:     timeToAPI(in.ExpiresAt),
 	}
 }
 
@@ -195,21 +214,42 @@ func entryFromAPI(in *apitypes.Entry) (Entry, error) {
 	}
 
 	return Entry{
-		ID:            in.Id,
-		SPIFFEID:      spiffeID,
-		ParentID:      parentID,
-		Selectors:     selectors,
-		X509SVIDTTL:   time.Duration(in.X509SvidTtl) * time.Second,
-		JWTSVIDTTL:    time.Duration(in.JwtSvidTtl) * time.Second,
-		FederatesWith: federatesWith,
-		Admin:         in.Admin,
-		DNSNames:      in.DnsNames,
-		Downstream:    in.Downstream,
-		Hint:          in.Hint,
-		StoreSVID:     in.StoreSvid,
+		ID:             in.Id,
+		SPIFFEID:       spiffeID,
+		ParentID:       parentID,
+		Selectors:      selectors,
+		X509SVIDTTL:    time.Duration(in.X509SvidTtl) * time.Second,
+		JWTSVIDTTL:     time.Duration(in.JwtSvidTtl) * time.Second,
+		FederatesWith:  federatesWith,
+		Admin:          in.Admin,
+		DNSNames:       in.DnsNames,
+		Downstream:     in.Downstream,
+		Hint:           in.Hint,
+		StoreSVID:      in.StoreSvid,
+		RevisionNumber: in.RevisionNumber,
+		CreatedAt:      timeFromAPI(in.CreatedAt),
+		ExpiresAt:      timeFromAPI(in.ExpiresAt),
 	}, nil
 }
 
+// timeToAPI converts the time to seconds since the Unix epoch. The zero time
+// is converted to zero, which the API treats as unset.
+func timeToAPI(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// timeFromAPI converts seconds since the Unix epoch to a time. Zero, which
+// the API uses for unset, is converted to the zero time.
+func timeFromAPI(secs int64) time.Time {
+	if secs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0).UTC()
+}
+
 func entriesFromAPI(ins []*apitypes.Entry) ([]Entry, error) {
 	var outs []Entry
 	if ins != nil {
@@ -587,6 +627,18 @@ func jwtAuthorityFromAPI(in *apitypes.JWTKey) (string, crypto.PublicKey, error)
 	return in.KeyId, publicKey, nil
 }
 
+func entryResultFromAPI(inStatus *apitypes.Status, inEntry *apitypes.Entry) (EntryResult, error) {
+	out := EntryResult{Status: statusFromAPI(inStatus)}
+	if out.Code == codes.OK && inEntry != nil {
+		entry, err := entryFromAPI(inEntry)
+		if err != nil {
+			return EntryResult{}, err
+		}
+		out.Entry = entry
+	}
+	return out, nil
+}
+
 func statusFromAPI(in *apitypes.Status) Status {
 	if in == nil {
 		return Status{
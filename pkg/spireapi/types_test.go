@@ -33,6 +33,7 @@ var (
 		Downstream:    true,
 		DNSNames:      []string{"dnsname"},
 		StoreSVID:     true,
+		ExpiresAt:     time.Unix(1700000000, 0).UTC(),
 	}
 
 	apiEntry = &apitypes.Entry{
@@ -52,6 +53,7 @@ var (
 		Downstream:    true,
 		DnsNames:      []string{"dnsname"},
 		StoreSvid:     true,
+		ExpiresAt:     1700000000,
 	}
 )
 
@@ -232,6 +234,39 @@ func TestEntryFromAPI(t *testing.T) {
 			},
 			expectErr: "invalid federatesWith field: invalid trust domain: trust domain characters are limited to lowercase letters, numbers, dots, dashes, and underscores",
 		},
+		{
+			desc: "success",
+			makeEntry: func(base *apitypes.Entry) *apitypes.Entry {
+				return base
+			},
+			expectEntry: entry,
+		},
+		{
+			desc: "success with read-only fields",
+			makeEntry: func(base *apitypes.Entry) *apitypes.Entry {
+				base.RevisionNumber = 3
+				base.CreatedAt = 1600000000
+				return base
+			},
+			expectEntry: func() Entry {
+				e := entry
+				e.RevisionNumber = 3
+				e.CreatedAt = time.Unix(1600000000, 0).UTC()
+				return e
+			}(),
+		},
+		{
+			desc: "success without expiry",
+			makeEntry: func(base *apitypes.Entry) *apitypes.Entry {
+				base.ExpiresAt = 0
+				return base
+			},
+			expectEntry: func() Entry {
+				e := entry
+				e.ExpiresAt = time.Time{}
+				return e
+			}(),
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			entry, err := entryFromAPI(tc.makeEntry(proto.Clone(apiEntry).(*apitypes.Entry)))
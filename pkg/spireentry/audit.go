@@ -0,0 +1,76 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/spiffe/spire-controller-manager/pkg/audit"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+// createdEntryEvent returns the audit event for creating the declared entry.
+// The ID assigned by SPIRE Server, if any, is included in the entry.
+func (r *entryReconciler) createdEntryEvent(declared declaredEntry, result spireapi.EntryResult) audit.Event {
+	after := declared.Entry
+	if after.ID == "" {
+		after.ID = result.Entry.ID
+	}
+	return r.entryEvent(audit.ActionCreate, nil, &after, nil, declared, audit.ResultFromStatus(result.Status))
+}
+
+// updatedEntryEvent returns the audit event for updating the outdated
+// fields of the current entry to those of the declared entry.
+func (r *entryReconciler) updatedEntryEvent(update declaredEntryUpdate, result audit.Result) audit.Event {
+	return r.entryEvent(audit.ActionUpdate, &update.Current, &update.Entry, update.Fields, update.declaredEntry, result)
+}
+
+// deletedEntryEvent returns the audit event for deleting the entry. Deleted
+// entries are no longer declared, so the event has no source.
+func (r *entryReconciler) deletedEntryEvent(entry spireapi.Entry, result audit.Result) audit.Event {
+	return r.entryEvent(audit.ActionDelete, &entry, nil, nil, declaredEntry{}, result)
+}
+
+func (r *entryReconciler) entryEvent(action audit.Action, before, after *spireapi.Entry, fields []spireapi.Field, declared declaredEntry, result audit.Result) audit.Event {
+	event := audit.Event{
+		Action:             action,
+		Kind:               audit.KindEntry,
+		TrustDomainProfile: r.config.TrustDomainProfile,
+		Result:             result,
+	}
+	if before != nil {
+		event.Before = audit.NewEntry(*before)
+	}
+	if after != nil {
+		event.After = audit.NewEntry(*after)
+	}
+	for _, field := range fields {
+		event.ChangedFields = append(event.ChangedFields, string(field))
+	}
+	if declared.By != nil {
+		ref := objectRef(declared.By)
+		event.Source = &audit.Object{Kind: ref.Kind, Name: ref.Name, UID: declared.By.GetUID()}
+	}
+	if declared.Pod != nil {
+		event.Pod = podAuditObject(declared.Pod)
+	}
+	return event
+}
+
+func podAuditObject(pod *corev1.Pod) *audit.Object {
+	return &audit.Object{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}
+}
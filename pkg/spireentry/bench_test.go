@@ -0,0 +1,198 @@
+package spireentry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The scale benchmarks reconcile synthetic clusters against the fake entry
+// client. Each size can be run on its own, e.g.:
+//
+//	go test ./pkg/spireentry -run '^$' -bench 'BenchmarkReconcileScale/pods=10000/' -benchtime 10x
+
+const (
+	scaleClusterSPIFFEIDs  = 30
+	scalePodsPerNamespace  = 100
+	scaleNodes             = 100
+	scaleChurnPerIteration = 0.01
+)
+
+var scalePodCounts = []int{10000, 50000, 100000}
+
+// BenchmarkReconcileScale measures a reconcile in the steady state, where
+// nothing has changed since the last reconcile and so no entries are
+// written. The cached variant diffs against the entry cache, as triggered
+// reconciles do between full resyncs. The resync variant lists every entry
+// from SPIRE first.
+func BenchmarkReconcileScale(b *testing.B) {
+	for _, pods := range scalePodCounts {
+		for _, resync := range []bool{false, true} {
+			name := fmt.Sprintf("pods=%d/crs=%d/cached", pods, scaleClusterSPIFFEIDs)
+			if resync {
+				name = fmt.Sprintf("pods=%d/crs=%d/resync", pods, scaleClusterSPIFFEIDs)
+			}
+			b.Run(name, func(b *testing.B) {
+				cluster := newScaleCluster(pods)
+				entryClient := newEntryClient()
+				r := newTestEntryReconciler(cluster.build(b), entryClient)
+				r.config.GCInterval = time.Hour
+
+				// Prime SPIRE with the declared entries.
+				r.reconcile(context.Background())
+				require.Len(b, entryClient.getEntries(), pods)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if resync {
+						r.nextFullEntryList = time.Time{}
+					}
+					r.reconcile(context.Background())
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkReconcileScaleChurn measures a reconcile after a fraction of the
+// pods have been replaced, as happens during a rolling update. Each
+// reconcile deletes the entries for the old pods and creates entries for
+// the new ones.
+func BenchmarkReconcileScaleChurn(b *testing.B) {
+	for _, pods := range scalePodCounts {
+		b.Run(fmt.Sprintf("pods=%d/crs=%d/churn=%d", pods, scaleClusterSPIFFEIDs, int(float64(pods)*scaleChurnPerIteration)), func(b *testing.B) {
+			cluster := newScaleCluster(pods)
+			k8sClient := cluster.build(b)
+			entryClient := newEntryClient()
+			r := newTestEntryReconciler(k8sClient, entryClient)
+			r.config.GCInterval = time.Hour
+
+			r.reconcile(context.Background())
+			require.Len(b, entryClient.getEntries(), pods)
+
+			churn := int(float64(pods) * scaleChurnPerIteration)
+			generation := 0
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				generation++
+				for j := 0; j < churn; j++ {
+					replacePod(b, k8sClient, cluster, (i*churn+j)%len(cluster.pods), generation)
+				}
+				b.StartTimer()
+
+				r.reconcile(context.Background())
+			}
+			b.StopTimer()
+			require.Len(b, entryClient.getEntries(), pods)
+		})
+	}
+}
+
+func BenchmarkMakeEntryKey(b *testing.B) {
+	entry := spireapi.Entry{
+		SPIFFEID: spiffeid.RequireFromString("spiffe://example.org/ns/namespace/sa/service-account"),
+		ParentID: spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/cluster/node-uid"),
+		Selectors: []spireapi.Selector{
+			{Type: "k8s", Value: "pod-uid:6d6b5d53-c4d5-4bd2-9a52-4b0f2e1f6c1e"},
+			{Type: "k8s", Value: "ns:namespace"},
+			{Type: "k8s", Value: "sa:service-account"},
+		},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = makeEntryKey(entry)
+	}
+}
+
+func BenchmarkSortDeclaredEntriesByPreference(b *testing.B) {
+	now := time.Now()
+	declared := make([]declaredEntry, 0, scaleClusterSPIFFEIDs)
+	for i := 0; i < scaleClusterSPIFFEIDs; i++ {
+		declared = append(declared, declaredEntry{
+			By: &ClusterSPIFFEID{ClusterSPIFFEID: spirev1alpha1.ClusterSPIFFEID{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: fmt.Sprintf("cr-%d", i),
+					UID:  types.UID(fmt.Sprintf("cr-uid-%d", i)),
+					// Reverse creation order so that every sort moves
+					// entries.
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Duration(i) * time.Second)),
+				},
+			}},
+		})
+	}
+	entries := make([]declaredEntry, len(declared))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		copy(entries, declared)
+		sortDeclaredEntriesByPreference(entries)
+	}
+}
+
+func BenchmarkRenderPodEntry(b *testing.B) {
+	spec, err := spirev1alpha1.ParseClusterSPIFFEIDSpec(&spirev1alpha1.ClusterSPIFFEIDSpec{
+		SPIFFEIDTemplate:          "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}",
+		DNSNameTemplates:          []string{"{{ .PodMeta.Name }}.{{ .PodMeta.Namespace }}.svc.{{ .ClusterDomain }}"},
+		WorkloadSelectorTemplates: []string{"k8s:ns:{{ .PodMeta.Namespace }}"},
+	})
+	require.NoError(b, err)
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod", UID: "pod-uid"},
+		Spec:       corev1.PodSpec{NodeName: "node", ServiceAccountName: "service-account"},
+	}
+	td := spiffeid.RequireTrustDomainFromString(trustDomain)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := renderPodEntry(spec, node, pod, &corev1.EndpointsList{}, td, clusterName, clusterDomain, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// newScaleCluster returns a cluster with the given number of pods spread
+// over namespaces of scalePodsPerNamespace pods. Each non-fallback
+// ClusterSPIFFEID selects an equal share of the namespaces, and a fallback
+// ClusterSPIFFEID covers every pod, so each pod has exactly one entry.
+func newScaleCluster(pods int) *testCluster {
+	cluster := newTestCluster(pods/scalePodsPerNamespace, scalePodsPerNamespace, scaleNodes)
+	for i, namespace := range cluster.namespaces {
+		namespace.Labels["shard"] = fmt.Sprint(i % scaleClusterSPIFFEIDs)
+	}
+	for i := 0; i < scaleClusterSPIFFEIDs; i++ {
+		clusterSPIFFEID := newTestClusterSPIFFEID(fmt.Sprintf("cr-%d", i), "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+		clusterSPIFFEID.Spec.NamespaceSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{"shard": fmt.Sprint(i)},
+		}
+		cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, clusterSPIFFEID)
+	}
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("fallback", "spiffe://example.org/fallback/{{ .PodMeta.Name }}", true),
+	)
+	return cluster
+}
+
+// replacePod replaces the pod at the index with a new pod of the same
+// name, as a controller would when rolling out a new revision.
+func replacePod(tb testing.TB, k8sClient client.Client, cluster *testCluster, index, generation int) {
+	old := cluster.pods[index]
+	require.NoError(tb, k8sClient.Delete(context.Background(), old))
+
+	pod := old.DeepCopy()
+	pod.ResourceVersion = ""
+	pod.UID = types.UID(fmt.Sprintf("%s-%d", old.UID, generation))
+	require.NoError(tb, k8sClient.Create(context.Background(), pod))
+	cluster.pods[index] = pod
+}
@@ -58,3 +58,20 @@ func (by *ClusterSPIFFEID) IncrementEntrySuccess() {
 func (by *ClusterSPIFFEID) IncrementEntryFailures() {
 	by.NextStatus.Stats.EntryFailures++
 }
+
+// AddPolicyViolation records that the entry rendered for a pod violates the
+// policy for the reason. Violations with the same policy and reason are
+// counted together.
+func (by *ClusterSPIFFEID) AddPolicyViolation(policy, reason string) {
+	for i, violation := range by.NextStatus.PolicyViolations {
+		if violation.Policy == policy && violation.Reason == reason {
+			by.NextStatus.PolicyViolations[i].Pods++
+			return
+		}
+	}
+	by.NextStatus.PolicyViolations = append(by.NextStatus.PolicyViolations, spirev1alpha1.ClusterSPIFFEIDPolicyViolation{
+		Policy: policy,
+		Reason: reason,
+		Pods:   1,
+	})
+}
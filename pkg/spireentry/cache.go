@@ -0,0 +1,223 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+// specCache caches parsed ClusterSPIFFEID specs so that the templates are
+// only compiled when a ClusterSPIFFEID changes. Specs are keyed by UID and
+// only reused while the generation is unchanged. The zero value is ready
+// for use. It is not safe for concurrent use.
+type specCache struct {
+	specs map[types.UID]cachedSpec
+}
+
+type cachedSpec struct {
+	generation int64
+	spec       *spirev1alpha1.ParsedClusterSPIFFEIDSpec
+	err        error
+}
+
+// Parse returns the parsed spec for the ClusterSPIFFEID, parsing it only if
+// it has not been parsed at the current generation.
+func (c *specCache) Parse(clusterSPIFFEID *ClusterSPIFFEID) (*spirev1alpha1.ParsedClusterSPIFFEIDSpec, error) {
+	if cached, ok := c.specs[clusterSPIFFEID.UID]; ok && cached.generation == clusterSPIFFEID.Generation {
+		return cached.spec, cached.err
+	}
+	spec, err := spirev1alpha1.ParseClusterSPIFFEIDSpec(&clusterSPIFFEID.Spec)
+	if c.specs == nil {
+		c.specs = make(map[types.UID]cachedSpec)
+	}
+	c.specs[clusterSPIFFEID.UID] = cachedSpec{
+		generation: clusterSPIFFEID.Generation,
+		spec:       spec,
+		err:        err,
+	}
+	return spec, err
+}
+
+// Prune removes the specs for ClusterSPIFFEIDs that no longer exist.
+func (c *specCache) Prune(clusterSPIFFEIDs []*ClusterSPIFFEID) {
+	if len(c.specs) == 0 {
+		return
+	}
+	keep := make(map[types.UID]struct{}, len(clusterSPIFFEIDs))
+	for _, clusterSPIFFEID := range clusterSPIFFEIDs {
+		keep[clusterSPIFFEID.UID] = struct{}{}
+	}
+	for uid := range c.specs {
+		if _, ok := keep[uid]; !ok {
+			delete(c.specs, uid)
+		}
+	}
+}
+
+// renderKey identifies the inputs that went into rendering a pod entry for
+// a ClusterSPIFFEID. If none of them have changed, the previously rendered
+// entry can be reused.
+type renderKey struct {
+	clusterSPIFFEIDUID        types.UID
+	clusterSPIFFEIDGeneration int64
+	podUID                    types.UID
+	podResourceVersion        string
+	nodeUID                   types.UID
+	nodeResourceVersion       string
+	endpointsVersion          string
+}
+
+// renderMemo holds the entries rendered during a reconcile. The memo from the
+// previous reconcile is only read from while rendering, and a new memo is
+// built from the results, so entries for pods that have gone away do not
+// accumulate.
+type renderMemo map[renderKey]*spireapi.Entry
+
+// makeRenderKey returns the render key for a pod entry. Objects without a
+// resourceVersion cannot be tracked, in which case false is returned and the
+// entry should not be memoized.
+func makeRenderKey(clusterSPIFFEID *ClusterSPIFFEID, pod *corev1.Pod, node *corev1.Node, endpointsList *corev1.EndpointsList) (renderKey, bool) {
+	if pod.ResourceVersion == "" || node.ResourceVersion == "" {
+		return renderKey{}, false
+	}
+	endpointsVersion, ok := makeEndpointsVersion(endpointsList)
+	if !ok {
+		return renderKey{}, false
+	}
+	return renderKey{
+		clusterSPIFFEIDUID:        clusterSPIFFEID.UID,
+		clusterSPIFFEIDGeneration: clusterSPIFFEID.Generation,
+		podUID:                    pod.UID,
+		podResourceVersion:        pod.ResourceVersion,
+		nodeUID:                   node.UID,
+		nodeResourceVersion:       node.ResourceVersion,
+		endpointsVersion:          endpointsVersion,
+	}, true
+}
+
+func makeEndpointsVersion(endpointsList *corev1.EndpointsList) (string, bool) {
+	if len(endpointsList.Items) == 0 {
+		return "", true
+	}
+	versions := make([]string, 0, len(endpointsList.Items))
+	for _, endpoints := range endpointsList.Items {
+		if endpoints.ResourceVersion == "" {
+			return "", false
+		}
+		versions = append(versions, endpoints.Namespace+"/"+endpoints.Name+"@"+endpoints.ResourceVersion)
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ","), true
+}
+
+// entryCache is the reconciler's view of the entries it owns on the SPIRE
+// server. It is replaced whenever entries are listed from the server and
+// kept up to date in between from the results of the reconciler's own
+// creates, updates and deletes. When the outcome of an operation is unknown,
+// the cache is invalidated so that the next reconcile lists the entries
+// again. The zero value is an invalid cache. It is not safe for concurrent
+// use.
+type entryCache struct {
+	entries map[string]spireapi.Entry
+}
+
+// Valid returns true if the cache can be used in place of listing entries.
+func (c *entryCache) Valid() bool {
+	return c.entries != nil
+}
+
+// Invalidate drops the cached entries.
+func (c *entryCache) Invalidate() {
+	c.entries = nil
+}
+
+// Replace replaces the cached entries with those listed from the server.
+func (c *entryCache) Replace(entries []spireapi.Entry) {
+	c.entries = make(map[string]spireapi.Entry, len(entries))
+	for _, entry := range entries {
+		c.entries[entry.ID] = entry
+	}
+}
+
+// Entries returns the cached entries, sorted by ID.
+func (c *entryCache) Entries() []spireapi.Entry {
+	entries := make([]spireapi.Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Put adds or replaces an entry. It is a no-op if the cache is invalid.
+func (c *entryCache) Put(entry spireapi.Entry) {
+	if c.entries != nil {
+		c.entries[entry.ID] = entry
+	}
+}
+
+// Delete removes an entry. It is a no-op if the cache is invalid.
+func (c *entryCache) Delete(entryID string) {
+	delete(c.entries, entryID)
+}
+
+// Divergences returns how many entries differ between the cache and the
+// given entries listed from the server. Entries are compared by ID, key and
+// revision number only, since listed entries only carry the fields in the
+// output mask. If parentIDs is non-nil, the entries were only listed for
+// those parent IDs and cached entries under other parent IDs are not
+// compared.
+func (c *entryCache) Divergences(listed []spireapi.Entry, parentIDs []spiffeid.ID) int {
+	divergences := 0
+	seen := make(map[string]struct{}, len(listed))
+	for _, entry := range listed {
+		seen[entry.ID] = struct{}{}
+		cached, ok := c.entries[entry.ID]
+		if !ok || cached.RevisionNumber != entry.RevisionNumber || makeEntryKey(cached) != makeEntryKey(entry) {
+			divergences++
+		}
+	}
+	var listedParentIDs map[spiffeid.ID]struct{}
+	if parentIDs != nil {
+		listedParentIDs = make(map[spiffeid.ID]struct{}, len(parentIDs))
+		for _, parentID := range parentIDs {
+			listedParentIDs[parentID] = struct{}{}
+		}
+	}
+	for id, cached := range c.entries {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		if listedParentIDs != nil {
+			if _, ok := listedParentIDs[cached.ParentID]; !ok {
+				continue
+			}
+		}
+		divergences++
+	}
+	return divergences
+}
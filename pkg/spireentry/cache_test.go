@@ -0,0 +1,181 @@
+package spireentry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSpecCache(t *testing.T) {
+	newClusterSPIFFEID := func(uid types.UID, generation int64, spiffeIDTemplate string) *ClusterSPIFFEID {
+		return &ClusterSPIFFEID{
+			ClusterSPIFFEID: spirev1alpha1.ClusterSPIFFEID{
+				ObjectMeta: metav1.ObjectMeta{UID: uid, Generation: generation},
+				Spec:       spirev1alpha1.ClusterSPIFFEIDSpec{SPIFFEIDTemplate: spiffeIDTemplate},
+			},
+		}
+	}
+
+	var cache specCache
+
+	t.Run("parses on first use", func(t *testing.T) {
+		spec, err := cache.Parse(newClusterSPIFFEID("a", 1, "spiffe://example.org/a"))
+		require.NoError(t, err)
+		require.NotNil(t, spec)
+	})
+
+	t.Run("reuses spec at same generation", func(t *testing.T) {
+		spec1, err := cache.Parse(newClusterSPIFFEID("a", 1, "spiffe://example.org/a"))
+		require.NoError(t, err)
+		spec2, err := cache.Parse(newClusterSPIFFEID("a", 1, "spiffe://example.org/a"))
+		require.NoError(t, err)
+		assert.Same(t, spec1, spec2)
+	})
+
+	t.Run("reparses when generation changes", func(t *testing.T) {
+		spec1, err := cache.Parse(newClusterSPIFFEID("a", 1, "spiffe://example.org/a"))
+		require.NoError(t, err)
+		spec2, err := cache.Parse(newClusterSPIFFEID("a", 2, "spiffe://example.org/a"))
+		require.NoError(t, err)
+		assert.NotSame(t, spec1, spec2)
+	})
+
+	t.Run("caches parse failures", func(t *testing.T) {
+		_, err := cache.Parse(newClusterSPIFFEID("b", 1, ""))
+		require.EqualError(t, err, "empty SPIFFEID template")
+		_, err = cache.Parse(newClusterSPIFFEID("b", 1, ""))
+		require.EqualError(t, err, "empty SPIFFEID template")
+		_, err = cache.Parse(newClusterSPIFFEID("b", 2, "spiffe://example.org/b"))
+		require.NoError(t, err)
+	})
+
+	t.Run("prune removes stale specs", func(t *testing.T) {
+		cache.Prune([]*ClusterSPIFFEID{newClusterSPIFFEID("b", 2, "spiffe://example.org/b")})
+		assert.Len(t, cache.specs, 1)
+		assert.Contains(t, cache.specs, types.UID("b"))
+	})
+}
+
+func TestRenderMemo(t *testing.T) {
+	cluster := newTestCluster(1, 2, 1)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	k8sClient := cluster.build(t)
+	r := newTestEntryReconciler(k8sClient, newEntryClient())
+
+	render := func() {
+		clusterSPIFFEIDs, _, err := r.listClusterSPIFFEIDs(context.Background())
+		require.NoError(t, err)
+		snapshot, err := loadK8sSnapshot(context.Background(), k8sClient)
+		require.NoError(t, err)
+		r.addClusterSPIFFEIDEntriesState(context.Background(), make(entriesState), clusterSPIFFEIDs, snapshot, nil)
+	}
+	keyFor := func(podUID types.UID) renderKey {
+		for key := range r.renderMemo {
+			if key.podUID == podUID {
+				return key
+			}
+		}
+		t.Fatalf("no memoized entry for pod %q", podUID)
+		return renderKey{}
+	}
+
+	render()
+	require.Len(t, r.renderMemo, 2)
+	key0 := keyFor("pod-uid-0-0")
+	key1 := keyFor("pod-uid-0-1")
+	entry0, entry1 := r.renderMemo[key0], r.renderMemo[key1]
+
+	t.Run("unchanged inputs reuse rendered entries", func(t *testing.T) {
+		render()
+		require.Len(t, r.renderMemo, 2)
+		assert.Same(t, entry0, r.renderMemo[key0])
+		assert.Same(t, entry1, r.renderMemo[key1])
+	})
+
+	t.Run("pod change re-renders entry", func(t *testing.T) {
+		pod := new(corev1.Pod)
+		require.NoError(t, k8sClient.Get(context.Background(), types.NamespacedName{Namespace: "ns-0", Name: "pod-0-0"}, pod))
+		pod.Labels = map[string]string{"changed": "true"}
+		require.NoError(t, k8sClient.Update(context.Background(), pod))
+
+		render()
+		require.Len(t, r.renderMemo, 2)
+		newKey0 := keyFor("pod-uid-0-0")
+		assert.NotEqual(t, key0, newKey0)
+		assert.NotSame(t, entry0, r.renderMemo[newKey0])
+		assert.Equal(t, *entry0, *r.renderMemo[newKey0])
+		assert.Same(t, entry1, r.renderMemo[key1])
+	})
+
+	t.Run("deleted pod is dropped from memo", func(t *testing.T) {
+		require.NoError(t, k8sClient.Delete(context.Background(), &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns-0", Name: "pod-0-1"},
+		}))
+		render()
+		require.Len(t, r.renderMemo, 1)
+		_, ok := r.renderMemo[key1]
+		assert.False(t, ok)
+	})
+}
+
+func TestEntryCache(t *testing.T) {
+	newEntry := func(id string, revision int64) spireapi.Entry {
+		return spireapi.Entry{
+			ID:             id,
+			ParentID:       spiffeid.RequireFromString("spiffe://example.org/parent"),
+			SPIFFEID:       spiffeid.RequireFromString("spiffe://example.org/" + id),
+			RevisionNumber: revision,
+		}
+	}
+
+	var cache entryCache
+
+	t.Run("zero value is invalid", func(t *testing.T) {
+		assert.False(t, cache.Valid())
+		cache.Put(newEntry("a", 0))
+		assert.Empty(t, cache.Entries())
+	})
+
+	t.Run("replace makes cache valid", func(t *testing.T) {
+		cache.Replace(nil)
+		assert.True(t, cache.Valid())
+		cache.Replace([]spireapi.Entry{newEntry("b", 0), newEntry("a", 0)})
+		assert.Equal(t, []spireapi.Entry{newEntry("a", 0), newEntry("b", 0)}, cache.Entries())
+	})
+
+	t.Run("put and delete", func(t *testing.T) {
+		cache.Put(newEntry("a", 1))
+		cache.Put(newEntry("c", 0))
+		cache.Delete("b")
+		assert.Equal(t, []spireapi.Entry{newEntry("a", 1), newEntry("c", 0)}, cache.Entries())
+	})
+
+	t.Run("divergences", func(t *testing.T) {
+		assert.Equal(t, 0, cache.Divergences([]spireapi.Entry{newEntry("a", 1), newEntry("c", 0)}, nil))
+		// a has a different revision, c is missing and d is unexpected.
+		assert.Equal(t, 3, cache.Divergences([]spireapi.Entry{newEntry("a", 2), newEntry("d", 0)}, nil))
+		rekeyed := newEntry("a", 1)
+		rekeyed.SPIFFEID = spiffeid.RequireFromString("spiffe://example.org/other")
+		assert.Equal(t, 1, cache.Divergences([]spireapi.Entry{rekeyed, newEntry("c", 0)}, nil))
+		// Cached entries under parent IDs that were not listed are not
+		// missing.
+		assert.Equal(t, 0, cache.Divergences(nil, []spiffeid.ID{spiffeid.RequireFromString("spiffe://example.org/unlisted")}))
+		assert.Equal(t, 1, cache.Divergences([]spireapi.Entry{newEntry("a", 1)}, []spiffeid.ID{spiffeid.RequireFromString("spiffe://example.org/parent")}))
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		cache.Invalidate()
+		assert.False(t, cache.Valid())
+		assert.Empty(t, cache.Entries())
+	})
+}
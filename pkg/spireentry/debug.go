@@ -0,0 +1,216 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/audit"
+	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+// ReconcileState is the state computed by a reconcile.
+type ReconcileState struct {
+	StartedAt time.Time
+
+	// Duration is how long the whole reconcile took. DeclareDuration,
+	// ListDuration and ApplyDuration are how long was spent determining the
+	// declared entries, listing the current entries and applying the plan.
+	Duration        time.Duration
+	DeclareDuration time.Duration
+	ListDuration    time.Duration
+	ApplyDuration   time.Duration
+
+	// Err is the error that cut the reconcile short, if any. Failures to
+	// render or write individual entries are counted in the statuses.
+	Err error
+
+	UnsupportedFields []spireapi.Field
+
+	// Entries is the plan: the declared and current entries and what the
+	// reconcile did with them.
+	Entries []InspectedEntry
+
+	ClusterSPIFFEIDStatuses    map[string]spirev1alpha1.ClusterSPIFFEIDStatus
+	ClusterStaticEntryStatuses map[string]spirev1alpha1.ClusterStaticEntryStatus
+}
+
+// Debugger records the state computed by the last reconcile so that it can
+// be served for debugging. Set it in the ReconcilerConfig to enable it.
+type Debugger struct {
+	mtx  sync.Mutex
+	last *ReconcileState
+}
+
+func NewDebugger() *Debugger {
+	return &Debugger{}
+}
+
+// Last returns the state computed by the last reconcile, or nil if there
+// has not been one yet.
+func (d *Debugger) Last() *ReconcileState {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.last
+}
+
+func (d *Debugger) record(state *ReconcileState) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.last = state
+}
+
+// Handler returns an HTTP handler that serves the state computed by the
+// last reconcile as JSON on GET, and triggers a reconcile on POST.
+func (d *Debugger) Handler(triggerer reconciler.Triggerer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			state := d.Last()
+			if state == nil {
+				http.Error(w, "no reconcile has finished yet", http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			_ = encoder.Encode(newDebugState(state))
+		case http.MethodPost:
+			triggerer.Trigger()
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// ProfileDebugHandler returns an HTTP handler that passes requests on to the
+// handler of the trust domain profile named by the profile query parameter.
+// The main trust domain is keyed by the empty name, and is served if the
+// parameter is not set.
+func ProfileDebugHandler(handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		profile := req.URL.Query().Get("profile")
+		handler, ok := handlers[profile]
+		if !ok {
+			http.Error(w, fmt.Sprintf("trust domain profile %q is not configured", profile), http.StatusNotFound)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// debugState is the JSON representation of a ReconcileState.
+type debugState struct {
+	StartedAt            time.Time                                         `json:"startedAt"`
+	Duration             metav1.Duration                                   `json:"duration"`
+	DeclareDuration      metav1.Duration                                   `json:"declareDuration"`
+	ListDuration         metav1.Duration                                   `json:"listDuration"`
+	ApplyDuration        metav1.Duration                                   `json:"applyDuration"`
+	Error                string                                            `json:"error,omitempty"`
+	UnsupportedFields    []spireapi.Field                                  `json:"unsupportedFields"`
+	Entries              []debugInspectedEntry                             `json:"entries"`
+	ClusterSPIFFEIDs     map[string]spirev1alpha1.ClusterSPIFFEIDStatus    `json:"clusterSPIFFEIDs"`
+	ClusterStaticEntries map[string]spirev1alpha1.ClusterStaticEntryStatus `json:"clusterStaticEntries"`
+}
+
+type debugInspectedEntry struct {
+	Action         EntryAction      `json:"action"`
+	OutdatedFields []spireapi.Field `json:"outdatedFields,omitempty"`
+	Declared       []debugEntry     `json:"declared,omitempty"`
+	Current        []debugEntry     `json:"current,omitempty"`
+	Deleted        []string         `json:"deleted,omitempty"`
+	Rekeyed        []string         `json:"rekeyed,omitempty"`
+	Retiring       []string         `json:"retiring,omitempty"`
+}
+
+type debugEntry struct {
+	*audit.Entry
+	DeclaredBy string `json:"declaredBy,omitempty"`
+	MaskedBy   string `json:"maskedBy,omitempty"`
+}
+
+func newDebugState(state *ReconcileState) debugState {
+	out := debugState{
+		StartedAt:            state.StartedAt,
+		Duration:             metav1.Duration{Duration: state.Duration},
+		DeclareDuration:      metav1.Duration{Duration: state.DeclareDuration},
+		ListDuration:         metav1.Duration{Duration: state.ListDuration},
+		ApplyDuration:        metav1.Duration{Duration: state.ApplyDuration},
+		UnsupportedFields:    state.UnsupportedFields,
+		Entries:              make([]debugInspectedEntry, 0, len(state.Entries)),
+		ClusterSPIFFEIDs:     state.ClusterSPIFFEIDStatuses,
+		ClusterStaticEntries: state.ClusterStaticEntryStatuses,
+	}
+	if state.Err != nil {
+		out.Error = state.Err.Error()
+	}
+	for _, inspected := range state.Entries {
+		outEntry := debugInspectedEntry{
+			Action:         inspected.Action,
+			OutdatedFields: inspected.OutdatedFields,
+		}
+		for _, declared := range inspected.Declared {
+			entry := newDebugEntry(declared.Entry)
+			entry.DeclaredBy = declared.DeclaredBy.String()
+			if declared.MaskedBy != nil {
+				entry.MaskedBy = declared.MaskedBy.String()
+			}
+			outEntry.Declared = append(outEntry.Declared, entry)
+		}
+		for _, current := range inspected.Current {
+			outEntry.Current = append(outEntry.Current, newDebugEntry(current))
+		}
+		for _, deleted := range inspected.Deleted {
+			outEntry.Deleted = append(outEntry.Deleted, deleted.ID)
+		}
+		for _, rekeyed := range inspected.Rekeyed {
+			outEntry.Rekeyed = append(outEntry.Rekeyed, rekeyed.ID)
+		}
+		for _, retiring := range inspected.Retiring {
+			outEntry.Retiring = append(outEntry.Retiring, retiring.ID)
+		}
+		out.Entries = append(out.Entries, outEntry)
+	}
+	return out
+}
+
+func newDebugEntry(entry spireapi.Entry) debugEntry {
+	return debugEntry{Entry: audit.NewEntry(entry)}
+}
+
+// sortedFields returns the fields in the set, sorted.
+func sortedFields(fields map[spireapi.Field]struct{}) []spireapi.Field {
+	out := make([]spireapi.Field, 0, len(fields))
+	for field := range fields {
+		out = append(out, field)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i] < out[j]
+	})
+	return out
+}
@@ -0,0 +1,146 @@
+package spireentry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDebugger(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	pods := newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+	pods.Spec.TTL = metav1.Duration{Duration: time.Hour}
+	pods.CreationTimestamp = metav1.NewTime(time.Unix(1, 0))
+	duplicate := newTestClusterSPIFFEID("duplicate", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+	duplicate.CreationTimestamp = metav1.NewTime(time.Unix(2, 0))
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, pods, duplicate)
+
+	entryClient := newEntryClient(
+		spireapi.Entry{
+			ID:          "existing",
+			ParentID:    spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+			SPIFFEID:    spiffeid.RequireFromString("spiffe://example.org/ns/ns-0/pod/pod-0-0"),
+			Selectors:   []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+			X509SVIDTTL: time.Minute,
+		},
+		spireapi.Entry{
+			ID:        "stale",
+			ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+			SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/old"),
+			Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+		},
+	)
+	entryClient.unsupportedFields = map[spireapi.Field]struct{}{
+		spireapi.HintField: {},
+	}
+
+	debugger := NewDebugger()
+	assert.Nil(t, debugger.Last())
+
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	r.config.Debugger = debugger
+	r.reconcile(context.Background())
+
+	state := debugger.Last()
+	require.NotNil(t, state)
+	assert.NoError(t, state.Err)
+	assert.NotZero(t, state.Duration)
+	assert.Equal(t, []spireapi.Field{spireapi.HintField}, state.UnsupportedFields)
+	require.Len(t, state.Entries, 2)
+
+	// Entries are sorted by SPIFFE ID.
+	updated := state.Entries[0]
+	assert.Equal(t, EntryActionUpdate, updated.Action)
+	assert.Equal(t, []spireapi.Field{spireapi.X509SVIDTTL}, updated.OutdatedFields)
+	require.Len(t, updated.Declared, 2)
+	assert.Equal(t, ObjectRef{Kind: "ClusterSPIFFEID", Name: "pods"}, updated.Declared[0].DeclaredBy)
+	assert.Equal(t, &ObjectRef{Kind: "ClusterSPIFFEID", Name: "pods"}, updated.Declared[1].MaskedBy)
+
+	deleted := state.Entries[1]
+	assert.Equal(t, EntryActionDelete, deleted.Action)
+	require.Len(t, deleted.Deleted, 1)
+	assert.Equal(t, "stale", deleted.Deleted[0].ID)
+
+	assert.Equal(t, 1, state.ClusterSPIFFEIDStatuses["pods"].Stats.EntriesToSet)
+	assert.Equal(t, 1, state.ClusterSPIFFEIDStatuses["duplicate"].Stats.EntriesMasked)
+
+	t.Run("GET serves the last state", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		debugger.Handler(&triggerer{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/entries", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var out debugState
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+		require.Len(t, out.Entries, 2)
+		assert.Equal(t, EntryActionUpdate, out.Entries[0].Action)
+		assert.Equal(t, "existing", out.Entries[0].Current[0].ID)
+		assert.Equal(t, "ClusterSPIFFEID/pods", out.Entries[0].Declared[1].MaskedBy)
+		assert.Equal(t, "1h0m0s", out.Entries[0].Declared[0].X509SVIDTTL)
+		assert.Equal(t, []string{"stale"}, out.Entries[1].Deleted)
+	})
+
+	t.Run("GET before the first reconcile", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewDebugger().Handler(&triggerer{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/entries", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("POST triggers a reconcile", func(t *testing.T) {
+		triggerer := &triggerer{}
+		rec := httptest.NewRecorder()
+		debugger.Handler(triggerer).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/entries", nil))
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, 1, triggerer.triggers)
+	})
+
+	t.Run("other methods are not allowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		debugger.Handler(&triggerer{}).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/debug/entries", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, "GET, POST", rec.Header().Get("Allow"))
+	})
+}
+
+func TestProfileDebugHandler(t *testing.T) {
+	mainTriggerer := &triggerer{}
+	other := &triggerer{}
+	handler := ProfileDebugHandler(map[string]http.Handler{
+		"":      NewDebugger().Handler(mainTriggerer),
+		"other": NewDebugger().Handler(other),
+	})
+
+	serve := func(target string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		return rec.Code
+	}
+
+	// The main trust domain is served without a profile.
+	assert.Equal(t, http.StatusAccepted, serve("/debug/entries"))
+	assert.Equal(t, 1, mainTriggerer.triggers)
+	assert.Equal(t, 0, other.triggers)
+
+	assert.Equal(t, http.StatusAccepted, serve("/debug/entries?profile=other"))
+	assert.Equal(t, 1, mainTriggerer.triggers)
+	assert.Equal(t, 1, other.triggers)
+
+	assert.Equal(t, http.StatusNotFound, serve("/debug/entries?profile=missing"))
+}
+
+type triggerer struct {
+	triggers int
+}
+
+func (t *triggerer) Trigger() {
+	t.triggers++
+}
@@ -76,19 +76,9 @@ func renderPodEntry(spec *spirev1alpha1.ParsedClusterSPIFFEIDSpec, node *corev1.
 		{Type: "k8s", Value: fmt.Sprintf("pod-uid:%s", pod.UID)},
 	}
 
-	data := &templateData{
-		TrustDomain:   trustDomain.Name(),
-		ClusterName:   clusterName,
-		ClusterDomain: clusterDomain,
-		NodeMeta:      &node.ObjectMeta,
-		NodeSpec:      &node.Spec,
-	}
+	data := newNodeTemplateData(node, trustDomain, clusterName, clusterDomain)
 
-	if parentIDTemplate == nil {
-		parentIDTemplate = defaultParentIDTemplate
-	}
-
-	parentID, err := renderSPIFFEID(parentIDTemplate, data, trustDomain)
+	parentID, err := renderParentID(parentIDTemplate, data, trustDomain)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render parent ID: %w", err)
 	}
@@ -130,6 +120,19 @@ func renderPodEntry(spec *spirev1alpha1.ParsedClusterSPIFFEIDSpec, node *corev1.
 	}, nil
 }
 
+// RenderParentID renders the parent ID of the entries for pods on the node.
+// The default parent ID template is used if the template is nil.
+func RenderParentID(parentIDTemplate *template.Template, node *corev1.Node, trustDomain spiffeid.TrustDomain, clusterName, clusterDomain string) (spiffeid.ID, error) {
+	return renderParentID(parentIDTemplate, newNodeTemplateData(node, trustDomain, clusterName, clusterDomain), trustDomain)
+}
+
+func renderParentID(parentIDTemplate *template.Template, data *templateData, trustDomain spiffeid.TrustDomain) (spiffeid.ID, error) {
+	if parentIDTemplate == nil {
+		parentIDTemplate = defaultParentIDTemplate
+	}
+	return renderSPIFFEID(parentIDTemplate, data, trustDomain)
+}
+
 type templateData struct {
 	TrustDomain   string
 	ClusterName   string
@@ -140,6 +143,16 @@ type templateData struct {
 	NodeSpec      *corev1.NodeSpec
 }
 
+func newNodeTemplateData(node *corev1.Node, trustDomain spiffeid.TrustDomain, clusterName, clusterDomain string) *templateData {
+	return &templateData{
+		TrustDomain:   trustDomain.Name(),
+		ClusterName:   clusterName,
+		ClusterDomain: clusterDomain,
+		NodeMeta:      &node.ObjectMeta,
+		NodeSpec:      &node.Spec,
+	}
+}
+
 func renderSPIFFEID(tmpl *template.Template, data *templateData, expectTD spiffeid.TrustDomain) (spiffeid.ID, error) {
 	rendered, err := renderTemplate(tmpl, data)
 	if err != nil {
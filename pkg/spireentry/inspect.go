@@ -0,0 +1,419 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/namespace"
+	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+// EntryAction is what the next reconcile would do with an entry.
+type EntryAction string
+
+const (
+	EntryActionNone   EntryAction = "none"
+	EntryActionCreate EntryAction = "create"
+	EntryActionUpdate EntryAction = "update"
+	EntryActionDelete EntryAction = "delete"
+	EntryActionRekey  EntryAction = "rekey"
+	EntryActionRetire EntryAction = "retire"
+)
+
+// InspectedEntry describes the declared and current entries that share a
+// SPIFFE ID, parent ID and set of selectors.
+type InspectedEntry struct {
+	// Declared are the declared entries, most preferred first. All but the
+	// first are masked.
+	Declared []RenderedEntry
+
+	// Current are the entries on SPIRE Server.
+	Current []spireapi.Entry
+
+	// Action is what the next reconcile would do.
+	Action EntryAction
+
+	// OutdatedFields are the fields of the current entry that the next
+	// reconcile would update.
+	OutdatedFields []spireapi.Field
+
+	// Deleted are the current entries the next reconcile would delete.
+	Deleted []spireapi.Entry
+
+	// Rekeyed are the entries with the cleanup prefix that the next
+	// reconcile would delete and replace with the declared entry.
+	Rekeyed []spireapi.Entry
+
+	// Retiring are the current entries that are no longer declared but are
+	// kept until the retirement grace period has passed.
+	Retiring []spireapi.Entry
+}
+
+// Inspection is the entry state as the entry reconciler sees it, used to
+// explain why entries exist or do not.
+type Inspection struct {
+	Entries []InspectedEntry
+
+	r     *entryReconciler
+	input RenderInput
+}
+
+// Inspect determines the declared entries from the input objects, in the
+// same way as the reconciler, and compares them against the entries on
+// SPIRE Server. Nothing is written to SPIRE Server, so the fields SPIRE
+// Server does not support are given rather than probed for as the
+// reconciler does; any other field is treated as supported. Entries that
+// are no longer declared are reported as retiring if a retirement grace
+// period is configured, since when they were retired is only known to the
+// reconciler. The K8sClient in the config is ignored.
+func Inspect(ctx context.Context, config ReconcilerConfig, input RenderInput, unsupportedFields map[spireapi.Field]struct{}) (*Inspection, error) {
+	r, err := newOfflineReconciler(config, input)
+	if err != nil {
+		return nil, err
+	}
+	state, _, _, err := r.declareEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currentEntries, deleteOnlyEntries, err := r.listEntries(ctx, state, unsupportedFields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SPIRE entries: %w", err)
+	}
+	for _, entry := range currentEntries {
+		state.AddCurrent(entry)
+	}
+	deleteOnlyEntries, rekeyed := planRekeys(state, deleteOnlyEntries)
+	var retiring map[string]time.Time
+	if config.EntryRetirementGracePeriod > 0 {
+		retiring = make(map[string]time.Time)
+		for _, entry := range retiredEntries(state) {
+			retiring[entry.ID] = time.Now()
+		}
+	}
+
+	return &Inspection{
+		Entries: inspectEntries(state, deleteOnlyEntries, rekeyed, retiring, unsupportedFields),
+		r:       r,
+		input:   input,
+	}, nil
+}
+
+// inspectEntries inspects each entry state and the entries that are only
+// to be deleted, sorted by SPIFFE ID, parent ID and entry ID. The entries
+// with the cleanup prefix to be re-keyed are given by key, and the entries
+// being retired by ID.
+func inspectEntries(state entriesState, deleteOnlyEntries []spireapi.Entry, rekeyed map[entryKey]spireapi.Entry, retiring map[string]time.Time, unsupportedFields map[spireapi.Field]struct{}) []InspectedEntry {
+	entries := make([]InspectedEntry, 0, len(state)+len(deleteOnlyEntries))
+	for key, s := range state {
+		entries = append(entries, inspectEntryState(s, rekeyed[key], retiring, unsupportedFields))
+	}
+	for _, entry := range deleteOnlyEntries {
+		entries = append(entries, InspectedEntry{
+			Current: []spireapi.Entry{entry},
+			Action:  EntryActionDelete,
+			Deleted: []spireapi.Entry{entry},
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := inspectedEntryID(entries[i]), inspectedEntryID(entries[j])
+		switch {
+		case a.SPIFFEID != b.SPIFFEID:
+			return a.SPIFFEID.String() < b.SPIFFEID.String()
+		case a.ParentID != b.ParentID:
+			return a.ParentID.String() < b.ParentID.String()
+		default:
+			return a.ID < b.ID
+		}
+	})
+	return entries
+}
+
+// inspectEntryState mirrors the decisions made for each entry state in
+// reconcile. The old entry is the entry with the cleanup prefix that the
+// declared entry would replace, if any.
+func inspectEntryState(s *entryState, old spireapi.Entry, retiring map[string]time.Time, unsupportedFields map[spireapi.Field]struct{}) InspectedEntry {
+	inspected := InspectedEntry{Current: s.Current}
+
+	sortDeclaredEntriesByPreference(s.Declared)
+	if len(s.Declared) > 0 {
+		preferredBy := objectRef(s.Declared[0].By)
+		inspected.Declared = append(inspected.Declared, RenderedEntry{
+			Entry:      s.Declared[0].Entry,
+			DeclaredBy: preferredBy,
+		})
+		for _, otherEntry := range s.Declared[1:] {
+			inspected.Declared = append(inspected.Declared, RenderedEntry{
+				Entry:      otherEntry.Entry,
+				DeclaredBy: objectRef(otherEntry.By),
+				MaskedBy:   &preferredBy,
+			})
+		}
+	}
+
+	current := s.Current
+	switch {
+	case len(s.Declared) > 0 && len(current) == 0 && old.ID != "":
+		inspected.Action = EntryActionRekey
+		inspected.Rekeyed = []spireapi.Entry{old}
+	case len(s.Declared) > 0 && len(current) == 0:
+		inspected.Action = EntryActionCreate
+	case len(s.Declared) > 0:
+		inspected.OutdatedFields = getOutdatedEntryFields(s.Declared[0].Entry, current[0], unsupportedFields)
+		if len(inspected.OutdatedFields) > 0 {
+			inspected.Action = EntryActionUpdate
+		} else {
+			inspected.Action = EntryActionNone
+		}
+		current = current[1:]
+	}
+	for _, entry := range filterJoinTokenEntries(current) {
+		if _, ok := retiring[entry.ID]; ok && len(s.Declared) == 0 {
+			inspected.Retiring = append(inspected.Retiring, entry)
+		} else {
+			inspected.Deleted = append(inspected.Deleted, entry)
+		}
+	}
+	if inspected.Action == "" {
+		switch {
+		case len(inspected.Deleted) > 0:
+			inspected.Action = EntryActionDelete
+		case len(inspected.Retiring) > 0:
+			inspected.Action = EntryActionRetire
+		default:
+			inspected.Action = EntryActionNone
+		}
+	}
+	return inspected
+}
+
+// inspectedEntryID returns an entry representative of the inspected entry,
+// for sorting.
+func inspectedEntryID(inspected InspectedEntry) spireapi.Entry {
+	if len(inspected.Current) > 0 {
+		return inspected.Current[0]
+	}
+	return inspected.Declared[0].Entry
+}
+
+// ByEntryID returns the inspected entries that include the current entry
+// with the given ID.
+func (i *Inspection) ByEntryID(id string) []InspectedEntry {
+	return i.filter(func(entry spireapi.Entry) bool {
+		return entry.ID == id
+	})
+}
+
+// BySPIFFEID returns the inspected entries with the given SPIFFE ID.
+func (i *Inspection) BySPIFFEID(id spiffeid.ID) []InspectedEntry {
+	return i.filter(func(entry spireapi.Entry) bool {
+		return entry.SPIFFEID == id
+	})
+}
+
+func (i *Inspection) filter(match func(spireapi.Entry) bool) []InspectedEntry {
+	var out []InspectedEntry
+	for _, inspected := range i.Entries {
+		matched := slices.ContainsFunc(inspected.Current, match) ||
+			slices.ContainsFunc(inspected.Declared, func(declared RenderedEntry) bool {
+				return match(declared.Entry)
+			})
+		if matched {
+			out = append(out, inspected)
+		}
+	}
+	return out
+}
+
+// PodExplanation explains which entries exist for a pod and why.
+type PodExplanation struct {
+	// Entries are the inspected entries for the pod.
+	Entries []InspectedEntry
+
+	// ClusterSPIFFEIDs explains whether each ClusterSPIFFEID applies to
+	// the pod, sorted by name.
+	ClusterSPIFFEIDs []PodMatch
+}
+
+// PodMatch explains whether a ClusterSPIFFEID applies to a pod.
+type PodMatch struct {
+	ClusterSPIFFEID string
+
+	// Applied is true if the ClusterSPIFFEID declares an entry for the pod.
+	Applied bool
+
+	// Reason explains why the ClusterSPIFFEID does or does not apply.
+	Reason string
+}
+
+// ExplainPod explains the entries for the pod, including why each
+// ClusterSPIFFEID that does not declare an entry for the pod does not.
+func (i *Inspection) ExplainPod(ctx context.Context, namespaceName, podName string) (*PodExplanation, error) {
+	pod := findObject(i.input.Pods, func(pod *corev1.Pod) bool {
+		return pod.Namespace == namespaceName && pod.Name == podName
+	})
+	if pod == nil {
+		return nil, fmt.Errorf("pod %s/%s not found", namespaceName, podName)
+	}
+	ns := findObject(i.input.Namespaces, func(ns *corev1.Namespace) bool {
+		return ns.Name == namespaceName
+	})
+	if ns == nil {
+		return nil, fmt.Errorf("namespace %s not found", namespaceName)
+	}
+
+	podUIDSelector := spireapi.Selector{Type: "k8s", Value: fmt.Sprintf("pod-uid:%s", pod.UID)}
+	explanation := &PodExplanation{}
+	appliedBy := make(map[string]spiffeid.ID)
+	for _, inspected := range i.Entries {
+		var matched bool
+		for _, declared := range inspected.Declared {
+			if slices.Contains(declared.Entry.Selectors, podUIDSelector) {
+				matched = true
+				if declared.DeclaredBy.Kind == "ClusterSPIFFEID" {
+					appliedBy[declared.DeclaredBy.Name] = declared.Entry.SPIFFEID
+				}
+			}
+		}
+		if matched || slices.ContainsFunc(inspected.Current, func(entry spireapi.Entry) bool {
+			return slices.Contains(entry.Selectors, podUIDSelector)
+		}) {
+			explanation.Entries = append(explanation.Entries, inspected)
+		}
+	}
+
+	// Fallback ClusterSPIFFEIDs only apply if no other ClusterSPIFFEID does.
+	var nonFallbackApplied string
+	for _, clusterSPIFFEID := range i.input.ClusterSPIFFEIDs {
+		if _, ok := appliedBy[clusterSPIFFEID.Name]; ok && !clusterSPIFFEID.Spec.Fallback {
+			nonFallbackApplied = clusterSPIFFEID.Name
+			break
+		}
+	}
+
+	for _, clusterSPIFFEID := range i.input.ClusterSPIFFEIDs {
+		match := PodMatch{ClusterSPIFFEID: clusterSPIFFEID.Name}
+		if id, ok := appliedBy[clusterSPIFFEID.Name]; ok {
+			match.Applied = true
+			match.Reason = fmt.Sprintf("declares entry for %s", id)
+		} else {
+			match.Reason = i.explainNotApplied(ctx, &clusterSPIFFEID, ns, pod, nonFallbackApplied)
+		}
+		explanation.ClusterSPIFFEIDs = append(explanation.ClusterSPIFFEIDs, match)
+	}
+	sort.Slice(explanation.ClusterSPIFFEIDs, func(a, b int) bool {
+		return explanation.ClusterSPIFFEIDs[a].ClusterSPIFFEID < explanation.ClusterSPIFFEIDs[b].ClusterSPIFFEID
+	})
+	return explanation, nil
+}
+
+// explainNotApplied walks through the same checks as the reconciler to find
+// why the ClusterSPIFFEID does not declare an entry for the pod.
+func (i *Inspection) explainNotApplied(ctx context.Context, clusterSPIFFEID *spirev1alpha1.ClusterSPIFFEID, ns *corev1.Namespace, pod *corev1.Pod, nonFallbackApplied string) string {
+	config := i.r.config
+	switch {
+	case !config.Reconcile.ClusterSPIFFEIDs:
+		return "ClusterSPIFFEIDs are not reconciled"
+	case !i.r.reconcileClass(clusterSPIFFEID.Spec.ClassName):
+		return fmt.Sprintf("className %q is not handled by this controller manager", clusterSPIFFEID.Spec.ClassName)
+	}
+	if reason := i.explainTrustDomainProfile(clusterSPIFFEID.Spec.TrustDomainProfile); reason != "" {
+		return reason
+	}
+	spec, err := spirev1alpha1.ParseClusterSPIFFEIDSpec(&clusterSPIFFEID.Spec)
+	if err != nil {
+		return fmt.Sprintf("spec is invalid: %v", err)
+	}
+	switch {
+	case spec.NamespaceSelector != nil && !spec.NamespaceSelector.Matches(labels.Set(ns.Labels)):
+		return fmt.Sprintf("namespaceSelector %q does not match the labels of namespace %s", spec.NamespaceSelector, ns.Name)
+	case namespace.IsIgnored(config.IgnoreNamespaces, ns.Name):
+		return fmt.Sprintf("namespace %s is ignored", ns.Name)
+	case spec.PodSelector != nil && !spec.PodSelector.Matches(labels.Set(pod.Labels)):
+		return fmt.Sprintf("podSelector %q does not match the labels of the pod", spec.PodSelector)
+	case clusterSPIFFEID.Spec.Fallback && nonFallbackApplied != "":
+		return fmt.Sprintf("fallback is not used since ClusterSPIFFEID %s applies to the pod", nonFallbackApplied)
+	}
+
+	node := findObject(i.input.Nodes, func(node *corev1.Node) bool {
+		return node.Name == pod.Spec.NodeName
+	})
+	if node == nil {
+		return fmt.Sprintf("node %q of the pod was not found", pod.Spec.NodeName)
+	}
+	endpointsList := &corev1.EndpointsList{}
+	if spec.AutoPopulateDNSNames {
+		if err := config.K8sClient.List(ctx, endpointsList, client.InNamespace(pod.Namespace), client.MatchingFields{reconciler.EndpointUID: string(pod.UID)}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Sprintf("failed to list endpoints: %v", err)
+		}
+	}
+	entry, err := renderPodEntry(spec, node, pod, endpointsList, config.TrustDomain, config.ClusterName, config.ClusterDomain, config.ParentIDTemplate)
+	if err != nil {
+		return fmt.Sprintf("failed to render entry: %v", err)
+	}
+
+	policies, err := i.r.listClusterSPIFFEIDPolicies(ctx)
+	if err != nil {
+		return fmt.Sprintf("failed to list ClusterSPIFFEIDPolicies: %v", err)
+	}
+	if violations := checkPolicies(policiesForNamespace(policies, ns), spec, entry); len(violations) > 0 {
+		reasons := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			reasons = append(reasons, fmt.Sprintf("ClusterSPIFFEIDPolicy %s: %s", violation.policy, violation.reason))
+		}
+		return fmt.Sprintf("entry violates %s", strings.Join(reasons, "; "))
+	}
+	return "unknown"
+}
+
+// explainTrustDomainProfile returns why objects targeting the trust domain
+// profile are not reconciled, or an empty string if they are.
+func (i *Inspection) explainTrustDomainProfile(profile string) string {
+	config := i.r.config
+	switch {
+	case i.r.reconcileTrustDomainProfile(profile):
+		return ""
+	case profile == "":
+		return "targets the main trust domain, which is not handled by this reconciler"
+	case !slices.Contains(config.TrustDomainProfiles, profile):
+		return fmt.Sprintf("trustDomainProfile %q is not configured", profile)
+	default:
+		return fmt.Sprintf("trustDomainProfile %q is handled by its own reconciler", profile)
+	}
+}
+
+func findObject[T any](objs []T, match func(*T) bool) *T {
+	for i := range objs {
+		if match(&objs[i]) {
+			return &objs[i]
+		}
+	}
+	return nil
+}
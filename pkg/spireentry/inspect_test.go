@@ -0,0 +1,226 @@
+package spireentry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInspect(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString(trustDomain)
+	podSPIFFEID := spiffeid.RequireFromString("spiffe://example.org/ns/workload/pod/pod")
+	parentID := spiffeid.RequireFromPathf(td, "/spire/agent/k8s_psat/%s/node-uid", clusterName)
+	podUIDSelector := spireapi.Selector{Type: "k8s", Value: "pod-uid:pod-uid"}
+
+	clusterSPIFFEID := func(name string, mutate func(spec *spirev1alpha1.ClusterSPIFFEIDSpec)) spirev1alpha1.ClusterSPIFFEID {
+		clusterSPIFFEID := *newTestClusterSPIFFEID(name, "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+		if mutate != nil {
+			mutate(&clusterSPIFFEID.Spec)
+		}
+		return clusterSPIFFEID
+	}
+	input := RenderInput{
+		ClusterSPIFFEIDs: []spirev1alpha1.ClusterSPIFFEID{
+			clusterSPIFFEID("a", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+			}),
+			clusterSPIFFEID("b", nil),
+			clusterSPIFFEID("fallback", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.Fallback = true
+			}),
+			clusterSPIFFEID("other-team", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}}
+			}),
+			clusterSPIFFEID("db", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.PodSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}
+			}),
+			clusterSPIFFEID("classy", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.ClassName = "other"
+			}),
+			clusterSPIFFEID("broken", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.SPIFFEIDTemplate = "spiffe://other.org/{{ .PodMeta.Name }}"
+			}),
+			clusterSPIFFEID("admin", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.Admin = true
+			}),
+			clusterSPIFFEID("edge", func(spec *spirev1alpha1.ClusterSPIFFEIDSpec) {
+				spec.TrustDomainProfile = "edge"
+			}),
+		},
+		ClusterSPIFFEIDPolicies: []spirev1alpha1.ClusterSPIFFEIDPolicy{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "no-admin"},
+				Spec: spirev1alpha1.ClusterSPIFFEIDPolicySpec{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				},
+			},
+		},
+		Namespaces: []corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "workload", Labels: map[string]string{"team": "a"}}},
+		},
+		Nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"}},
+		},
+		Pods: []corev1.Pod{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: "pod", UID: "pod-uid", Labels: map[string]string{"app": "web"}},
+				Spec:       corev1.PodSpec{NodeName: "node"},
+			},
+		},
+	}
+
+	entryClient := newEntryClient(
+		spireapi.Entry{
+			ID:        "current",
+			SPIFFEID:  podSPIFFEID,
+			ParentID:  parentID,
+			Selectors: []spireapi.Selector{podUIDSelector},
+			Hint:      "stale",
+		},
+		spireapi.Entry{
+			ID:        "undeclared",
+			SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/old"),
+			ParentID:  parentID,
+			Selectors: []spireapi.Selector{podUIDSelector},
+		},
+	)
+
+	inspection, err := Inspect(context.Background(), ReconcilerConfig{
+		TrustDomain:    td,
+		ClusterName:    clusterName,
+		ClusterDomain:  clusterDomain,
+		EntryClient:    entryClient,
+		WatchClassless: true,
+		Reconcile: spirev1alpha1.ReconcileConfig{
+			ClusterSPIFFEIDs:     true,
+			ClusterStaticEntries: true,
+		},
+	}, input, nil)
+	require.NoError(t, err)
+
+	t.Run("by entry ID", func(t *testing.T) {
+		inspected := inspection.ByEntryID("current")
+		require.Len(t, inspected, 1)
+		assert.Equal(t, EntryActionUpdate, inspected[0].Action)
+		assert.Equal(t, []spireapi.Field{spireapi.HintField}, inspected[0].OutdatedFields)
+		assert.Empty(t, inspected[0].Deleted)
+		require.Len(t, inspected[0].Declared, 2)
+		assert.Equal(t, ObjectRef{Kind: "ClusterSPIFFEID", Name: "a"}, inspected[0].Declared[0].DeclaredBy)
+		assert.Nil(t, inspected[0].Declared[0].MaskedBy)
+		assert.Equal(t, ObjectRef{Kind: "ClusterSPIFFEID", Name: "b"}, inspected[0].Declared[1].DeclaredBy)
+		assert.Equal(t, &ObjectRef{Kind: "ClusterSPIFFEID", Name: "a"}, inspected[0].Declared[1].MaskedBy)
+
+		assert.Empty(t, inspection.ByEntryID("missing"))
+	})
+
+	t.Run("by SPIFFE ID", func(t *testing.T) {
+		inspected := inspection.BySPIFFEID(spiffeid.RequireFromString("spiffe://example.org/old"))
+		require.Len(t, inspected, 1)
+		assert.Equal(t, EntryActionDelete, inspected[0].Action)
+		assert.Empty(t, inspected[0].Declared)
+		require.Len(t, inspected[0].Deleted, 1)
+		assert.Equal(t, "undeclared", inspected[0].Deleted[0].ID)
+	})
+
+	t.Run("pod", func(t *testing.T) {
+		explanation, err := inspection.ExplainPod(context.Background(), "workload", "pod")
+		require.NoError(t, err)
+		assert.Len(t, explanation.Entries, 2)
+		assert.Equal(t, []PodMatch{
+			{ClusterSPIFFEID: "a", Applied: true, Reason: "declares entry for spiffe://example.org/ns/workload/pod/pod"},
+			{ClusterSPIFFEID: "admin", Reason: "entry violates ClusterSPIFFEIDPolicy no-admin: admin is not allowed"},
+			{ClusterSPIFFEID: "b", Applied: true, Reason: "declares entry for spiffe://example.org/ns/workload/pod/pod"},
+			{ClusterSPIFFEID: "broken", Reason: `failed to render entry: failed to render SPIFFE ID: invalid SPIFFE ID: expected trust domain "example.org" but got "other.org"`},
+			{ClusterSPIFFEID: "classy", Reason: `className "other" is not handled by this controller manager`},
+			{ClusterSPIFFEID: "db", Reason: `podSelector "app=db" does not match the labels of the pod`},
+			{ClusterSPIFFEID: "edge", Reason: `trustDomainProfile "edge" is not configured`},
+			{ClusterSPIFFEID: "fallback", Reason: "fallback is not used since ClusterSPIFFEID a applies to the pod"},
+			{ClusterSPIFFEID: "other-team", Reason: `namespaceSelector "team=b" does not match the labels of namespace workload`},
+		}, explanation.ClusterSPIFFEIDs)
+
+		_, err = inspection.ExplainPod(context.Background(), "workload", "missing")
+		assert.EqualError(t, err, "pod workload/missing not found")
+	})
+
+	// Inspecting never writes to SPIRE Server.
+	assert.Len(t, entryClient.getEntries(), 2)
+	assert.Zero(t, entryClient.updateCalls)
+}
+
+func TestInspectRekeyedAndRetiringEntries(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString(trustDomain)
+	podSPIFFEID := spiffeid.RequireFromString("spiffe://example.org/ns/workload/pod/pod")
+	parentID := spiffeid.RequireFromPathf(td, "/spire/agent/k8s_psat/%s/node-uid", clusterName)
+
+	input := RenderInput{
+		ClusterSPIFFEIDs: []spirev1alpha1.ClusterSPIFFEID{
+			*newTestClusterSPIFFEID("pods", "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+		},
+		Namespaces: []corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "workload"}},
+		},
+		Nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"}},
+		},
+		Pods: []corev1.Pod{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: "pod", UID: "pod-uid"},
+				Spec:       corev1.PodSpec{NodeName: "node"},
+			},
+		},
+	}
+	entryClient := newEntryClient(
+		spireapi.Entry{
+			ID:        "old.pod",
+			SPIFFEID:  podSPIFFEID,
+			ParentID:  parentID,
+			Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid"}},
+		},
+		spireapi.Entry{
+			ID:        "new.gone",
+			SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/gone"),
+			ParentID:  parentID,
+			Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:gone"}},
+		},
+	)
+
+	cleanup := "old."
+	inspection, err := Inspect(context.Background(), ReconcilerConfig{
+		TrustDomain:                td,
+		ClusterName:                clusterName,
+		ClusterDomain:              clusterDomain,
+		EntryClient:                entryClient,
+		WatchClassless:             true,
+		EntryIDPrefix:              "new.",
+		EntryIDPrefixCleanup:       &cleanup,
+		EntryRetirementGracePeriod: time.Minute,
+		Reconcile: spirev1alpha1.ReconcileConfig{
+			ClusterSPIFFEIDs: true,
+		},
+	}, input, nil)
+	require.NoError(t, err)
+
+	// The old entry is replaced rather than deleted outright...
+	inspected := inspection.BySPIFFEID(podSPIFFEID)
+	require.Len(t, inspected, 1)
+	assert.Equal(t, EntryActionRekey, inspected[0].Action)
+	require.Len(t, inspected[0].Rekeyed, 1)
+	assert.Equal(t, "old.pod", inspected[0].Rekeyed[0].ID)
+	assert.Empty(t, inspected[0].Deleted)
+
+	// ...and the undeclared entry is kept for the grace period.
+	inspected = inspection.ByEntryID("new.gone")
+	require.Len(t, inspected, 1)
+	assert.Equal(t, EntryActionRetire, inspected[0].Action)
+	require.Len(t, inspected[0].Retiring, 1)
+	assert.Equal(t, "new.gone", inspected[0].Retiring[0].ID)
+	assert.Empty(t, inspected[0].Deleted)
+}
@@ -27,22 +27,25 @@ import (
 )
 
 const (
-	clusterStaticEntryLogKey = "clusterStaticEntry"
-	clusterSPIFFEIDLogKey    = "clusterSPIFFEID"
-	namespaceLogKey          = "namespace"
-	podLogKey                = "pod"
-	idKey                    = "id"
-	parentIDKey              = "parentID"
-	spiffeIDKey              = "spiffeID"
-	selectorsKey             = "selectors"
-	x509SVIDTTLKey           = "x509SVIDTTL"
-	jwtSVIDTTLKey            = "jwtSVIDTTL"
-	federatesWithKey         = "federatesWith"
-	dnsNamesKey              = "dnsNames"
-	adminKey                 = "admin"
-	downstreamKey            = "downstream"
-	hintKey                  = "hint"
-	storeSVIDKey             = "storeSVID"
+	clusterStaticEntryLogKey    = "clusterStaticEntry"
+	clusterSPIFFEIDLogKey       = "clusterSPIFFEID"
+	clusterSPIFFEIDPolicyLogKey = "clusterSPIFFEIDPolicy"
+	namespaceLogKey             = "namespace"
+	podLogKey                   = "pod"
+	trustDomainProfileLogKey    = "trustDomainProfile"
+	idKey                       = "id"
+	parentIDKey                 = "parentID"
+	spiffeIDKey                 = "spiffeID"
+	selectorsKey                = "selectors"
+	x509SVIDTTLKey              = "x509SVIDTTL"
+	jwtSVIDTTLKey               = "jwtSVIDTTL"
+	federatesWithKey            = "federatesWith"
+	dnsNamesKey                 = "dnsNames"
+	adminKey                    = "admin"
+	downstreamKey               = "downstream"
+	hintKey                     = "hint"
+	storeSVIDKey                = "storeSVID"
+	outdatedFieldsLogKey        = "outdatedFields"
 )
 
 func objectName(o metav1.Object) string {
@@ -83,6 +86,12 @@ func stringFromSelectors(selectors []spireapi.Selector) string {
 	})
 }
 
+func stringFromFields(fields []spireapi.Field) string {
+	return renderList(len(fields), func(i int, w io.StringWriter) {
+		_, _ = w.WriteString(string(fields[i]))
+	})
+}
+
 func stringList(ss []string) string {
 	return renderList(len(ss), func(i int, w io.StringWriter) {
 		_, _ = w.WriteString(ss[i])
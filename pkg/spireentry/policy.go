@@ -0,0 +1,101 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/k8sapi"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+// clusterSPIFFEIDPolicy is a parsed ClusterSPIFFEIDPolicy. An invalid policy
+// applies to every namespace and is violated by every entry, so that a
+// broken policy does not silently allow anything.
+type clusterSPIFFEIDPolicy struct {
+	name string
+	spec *spirev1alpha1.ParsedClusterSPIFFEIDPolicySpec
+	err  error
+}
+
+// policyViolation is a reason an entry violates a policy.
+type policyViolation struct {
+	policy string
+	reason string
+}
+
+func (r *entryReconciler) listClusterSPIFFEIDPolicies(ctx context.Context) ([]*clusterSPIFFEIDPolicy, error) {
+	log := log.FromContext(ctx)
+
+	policies, err := k8sapi.ListClusterSPIFFEIDPolicies(ctx, r.config.K8sClient)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*clusterSPIFFEIDPolicy, 0, len(policies))
+	for i := range policies {
+		spec, err := spirev1alpha1.ParseClusterSPIFFEIDPolicySpec(&policies[i].Spec)
+		if err != nil {
+			log.Error(err, "Invalid ClusterSPIFFEIDPolicy; no pod entries will be set until it is fixed", clusterSPIFFEIDPolicyLogKey, policies[i].Name)
+		}
+		out = append(out, &clusterSPIFFEIDPolicy{
+			name: policies[i].Name,
+			spec: spec,
+			err:  err,
+		})
+	}
+	// Sort by name so that violations are reported in a stable order.
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].name < out[j].name
+	})
+	return out, nil
+}
+
+// policiesForNamespace returns the policies that apply to the pods in the
+// namespace.
+func policiesForNamespace(policies []*clusterSPIFFEIDPolicy, namespace *corev1.Namespace) []*clusterSPIFFEIDPolicy {
+	var out []*clusterSPIFFEIDPolicy
+	for _, policy := range policies {
+		if policy.err != nil || policy.spec.AppliesToNamespace(namespace) {
+			out = append(out, policy)
+		}
+	}
+	return out
+}
+
+// checkPolicies returns the reasons the entry rendered from the spec
+// violates the policies.
+func checkPolicies(policies []*clusterSPIFFEIDPolicy, spec *spirev1alpha1.ParsedClusterSPIFFEIDSpec, entry *spireapi.Entry) []policyViolation {
+	var violations []policyViolation
+	for _, policy := range policies {
+		if policy.err != nil {
+			violations = append(violations, policyViolation{policy: policy.name, reason: fmt.Sprintf("policy is invalid: %v", policy.err)})
+			continue
+		}
+		reasons := policy.spec.CheckSpec(spec)
+		reasons = append(reasons, policy.spec.CheckSPIFFEIDPath(entry.SPIFFEID.Path())...)
+		for _, reason := range reasons {
+			violations = append(violations, policyViolation{policy: policy.name, reason: reason})
+		}
+	}
+	return violations
+}
@@ -23,9 +23,12 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"runtime"
 	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -34,19 +37,24 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/labels"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/audit"
 	"github.com/spiffe/spire-controller-manager/pkg/k8sapi"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
 	"github.com/spiffe/spire-controller-manager/pkg/metrics"
 	"github.com/spiffe/spire-controller-manager/pkg/namespace"
 	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
 	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/tracing"
 )
 
 const (
@@ -76,20 +84,73 @@ type ReconcilerConfig struct {
 	EntryIDPrefix        string
 	EntryIDPrefixCleanup *string
 
+	// EntryRetirementGracePeriod, if set, is how long an entry that is no
+	// longer declared is kept before it is deleted, so that agents have
+	// time to sync the entry replacing it, if any.
+	EntryRetirementGracePeriod time.Duration
+
+	// ListEntriesByParentID, if set, only lists the entries under the parent
+	// IDs that have declared entries, instead of every entry on the SPIRE
+	// server, when the entry cache has to be rebuilt between full lists.
+	// All entries are still listed every GCInterval so that entries under
+	// parent IDs that are no longer in use are cleaned up.
+	ListEntriesByParentID bool
+
+	// CheckEntryRevisions, if set, skips the update of an entry whose
+	// revision on the SPIRE server no longer matches the listed one, and
+	// re-reads and re-diffs it instead. See spireapi.EntryUpdate for why
+	// this is best-effort.
+	CheckEntryRevisions bool
+
+	// RenderWorkers is the number of workers used to render pod entries
+	// for ClusterSPIFFEIDs. Defaults to GOMAXPROCS when unset.
+	RenderWorkers int
+
 	// GCInterval how long to sit idle (i.e. untriggered) before doing
-	// another reconcile.
+	// another reconcile. Entries are listed from the SPIRE server at most
+	// once per interval, unless the entry cache has been invalidated.
 	GCInterval time.Duration
+
+	// ReconcileTimeout, if set, bounds each reconcile.
+	ReconcileTimeout time.Duration
+
+	// Debugger, if set, records the state computed by each reconcile.
+	Debugger *Debugger
+
+	// Auditor, if set, records an audit event for every entry the
+	// reconciler creates, updates or deletes.
+	Auditor *audit.Recorder
+
+	// TrustDomainProfile is the name of the trust domain profile that
+	// TrustDomain and EntryClient belong to, or empty for the main trust
+	// domain. Only the ClusterSPIFFEIDs and ClusterStaticEntries that target
+	// the profile are reconciled.
+	TrustDomainProfile string
+
+	// TrustDomainProfiles are the names of every configured trust domain
+	// profile. The reconciler for the main trust domain reports objects that
+	// target a profile that is not one of these.
+	TrustDomainProfiles []string
+
+	// LiveConfig, if set, overrides IgnoreNamespaces, ClassName,
+	// WatchClassless, ParentIDTemplate and GCInterval. It is loaded at the
+	// start of each reconcile, so changes apply from the next reconcile.
+	LiveConfig *liveconfig.Value
 }
 
 func Reconciler(config ReconcilerConfig) reconciler.Reconciler {
 	r := &entryReconciler{
-		config:      config,
-		promCounter: metrics.PromCounters,
+		config:         config,
+		promCounter:    metrics.PromCounters,
+		promCounterVec: metrics.PromCounterVecs,
+		promGauge:      profileGauges(config.TrustDomainProfile),
 	}
 	return reconciler.New(reconciler.Config{
 		Kind:       "entry",
 		Reconcile:  r.reconcile,
 		GCInterval: config.GCInterval,
+		Timeout:    config.ReconcileTimeout,
+		LiveConfig: config.LiveConfig,
 	})
 }
 
@@ -98,55 +159,94 @@ type entryReconciler struct {
 
 	unsupportedFields        map[spireapi.Field]struct{}
 	promCounter              map[string]prometheus.Counter
+	promCounterVec           map[string]*prometheus.CounterVec
+	promGauge                map[string]prometheus.Gauge
 	nextGetUnsupportedFields time.Time
+
+	// specs caches the parsed ClusterSPIFFEID specs across reconciles.
+	specs specCache
+	// renderMemo holds the pod entries rendered in the previous reconcile.
+	renderMemo renderMemo
+	// entries caches the entries owned by the reconciler between lists.
+	entries entryCache
+	// nextFullEntryList is when all entries should next be listed.
+	nextFullEntryList time.Time
+	// entriesListedInFull is whether the current entries, listed or cached,
+	// were listed from every parent ID rather than only the declared ones.
+	entriesListedInFull bool
+	// retiring holds when each entry that is no longer declared was first
+	// found to be retired, by entry ID.
+	retiring map[string]time.Time
 }
 
 func (r *entryReconciler) reconcile(ctx context.Context) {
+	if r.config.TrustDomainProfile != "" {
+		ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues(trustDomainProfileLogKey, r.config.TrustDomainProfile))
+	}
 	log := log.FromContext(ctx)
 
+	var debugState *ReconcileState
+	if r.config.Debugger != nil {
+		debugState = &ReconcileState{StartedAt: time.Now()}
+		defer func() {
+			debugState.Duration = time.Since(debugState.StartedAt)
+			r.config.Debugger.record(debugState)
+		}()
+	}
+
+	r.loadLiveConfig()
+
 	if time.Now().After(r.nextGetUnsupportedFields) {
 		r.recalculateUnsupportFields(ctx, log)
 	}
 	unsupportedFields := r.unsupportedFields
 
-	// Load current entries from SPIRE server.
-	currentEntries, deleteOnlyEntries, err := r.listEntries(ctx)
+	phaseStart := time.Now()
+	state, clusterStaticEntries, clusterSPIFFEIDs, err := r.declareEntries(ctx)
+	if debugState != nil {
+		debugState.UnsupportedFields = sortedFields(unsupportedFields)
+		debugState.DeclareDuration = time.Since(phaseStart)
+		debugState.Err = err
+	}
 	if err != nil {
-		log.Error(err, "Failed to list SPIRE entries")
+		log.Error(err, "Failed to determine declared entries")
 		return
 	}
 
-	// Populate the existing state
-	state := make(entriesState)
+	// Load current entries from the cache, or from the SPIRE server when the
+	// cache is invalid or a full resync is due, and populate the existing
+	// state. This happens after the declared state has been determined so
+	// that, when listing by parent ID, only the parent IDs with declared
+	// entries need to be listed.
+	phaseStart = time.Now()
+	currentEntries, deleteOnlyEntries, err := r.listEntries(ctx, state, unsupportedFields)
+	if debugState != nil {
+		debugState.ListDuration = time.Since(phaseStart)
+		debugState.Err = err
+	}
+	if err != nil {
+		log.Error(err, "Failed to list SPIRE entries")
+		return
+	}
 	for _, entry := range currentEntries {
 		state.AddCurrent(entry)
 	}
 
-	clusterStaticEntries := []*ClusterStaticEntry{}
-	if r.config.Reconcile.ClusterStaticEntries {
-		// Load and add entry state for ClusterStaticEntries
-		clusterStaticEntries, err = r.listClusterStaticEntries(ctx)
-		if err != nil {
-			log.Error(err, "Failed to list ClusterStaticEntries")
-			return
-		}
-		r.addClusterStaticEntryEntriesState(ctx, state, clusterStaticEntries)
-	}
+	// Entries with the cleanup prefix that match a declared entry are
+	// re-keyed rather than deleted ahead of their replacements.
+	deleteOnlyEntries, rekeyed := planRekeys(state, deleteOnlyEntries)
 
-	clusterSPIFFEIDs := []*ClusterSPIFFEID{}
-	if r.config.Reconcile.ClusterSPIFFEIDs {
-		// Load and add entry state for ClusterSPIFFEIDs
-		clusterSPIFFEIDs, err = r.listClusterSPIFFEIDs(ctx)
-		if err != nil {
-			log.Error(err, "Failed to list ClusterSPIFFEIDs")
-			return
-		}
-		r.addClusterSPIFFEIDEntriesState(ctx, state, clusterSPIFFEIDs)
+	// Entries that are no longer declared at all are retired, while
+	// duplicates of a declared entry are deleted straight away.
+	toDelete := r.retireEntries(ctx, state, time.Now())
+
+	if debugState != nil {
+		debugState.Entries = inspectEntries(state, deleteOnlyEntries, rekeyed, r.retiring, unsupportedFields)
 	}
 
-	var toDelete []spireapi.Entry
 	var toCreate []declaredEntry
-	var toUpdate []declaredEntry
+	var toRekey []rekey
+	var toUpdate []declaredEntryUpdate
 
 	for _, s := range state {
 		// Sort declared entries.
@@ -168,31 +268,68 @@ func (r *entryReconciler) reconcile(ctx context.Context) {
 				if preferredEntry.Entry.ID == "" && r.config.EntryIDPrefix != "" {
 					preferredEntry.Entry.ID = fmt.Sprintf("%s%s", r.config.EntryIDPrefix, uuid.New())
 				}
-				toCreate = append(toCreate, preferredEntry)
+				if old, ok := rekeyed[makeEntryKey(preferredEntry.Entry)]; ok {
+					toRekey = append(toRekey, rekey{declaredEntry: preferredEntry, Old: old})
+				} else {
+					toCreate = append(toCreate, preferredEntry)
+				}
 			} else {
 				preferredEntry.Entry.ID = s.Current[0].ID
+				// Borrow the revision as well so the update is skipped if
+				// the entry is seen to have changed since it was listed.
+				// This is best-effort; see spireapi.EntryUpdate.
+				preferredEntry.Entry.RevisionNumber = s.Current[0].RevisionNumber
 				if outdatedFields := getOutdatedEntryFields(preferredEntry.Entry, s.Current[0], unsupportedFields); len(outdatedFields) != 0 {
-					// Current field does not match. Nothing to do.
-					toUpdate = append(toUpdate, preferredEntry)
+					// Only the outdated fields are sent in the update so
+					// that other fields are left untouched.
+					toUpdate = append(toUpdate, declaredEntryUpdate{
+						declaredEntry: preferredEntry,
+						Current:       s.Current[0],
+						Fields:        outdatedFields,
+					})
+					for _, field := range outdatedFields {
+						r.promCounterVec[metrics.OutdatedEntryFields].WithLabelValues(string(field)).Inc()
+					}
 				}
 				s.Current = s.Current[1:]
 			}
-		}
 
-		// Any remaining current entries that are not associated with join tokens
-		// should be removed as they aren't going to be reused for the entry update.
-		toDelete = append(toDelete, filterJoinTokenEntries(s.Current)...)
+			// Any remaining current entries that are not associated with join tokens
+			// should be removed as they aren't going to be reused for the entry update.
+			toDelete = append(toDelete, filterJoinTokenEntries(s.Current)...)
+		}
 	}
 
-	toDelete = append(toDelete, deleteOnlyEntries...)
-	if len(toDelete) > 0 {
-		r.deleteEntries(ctx, toDelete)
+	// Entries with the cleanup prefix are deleted or re-keyed first, since
+	// SPIRE Server rejects creating their replacements while they exist.
+	// Other entries are deleted last, so that an entry being replaced by one
+	// with a different key is only deleted once its replacement exists.
+	phaseStart = time.Now()
+	if len(deleteOnlyEntries) > 0 {
+		r.deleteEntries(ctx, deleteOnlyEntries)
+	}
+	if len(toRekey) > 0 {
+		r.rekeyEntries(ctx, toRekey)
 	}
 	if len(toCreate) > 0 {
 		r.createEntries(ctx, toCreate)
 	}
 	if len(toUpdate) > 0 {
-		r.updateEntries(ctx, toUpdate)
+		r.updateEntries(ctx, toUpdate, unsupportedFields)
+	}
+	if len(toDelete) > 0 {
+		r.deleteEntries(ctx, toDelete)
+	}
+	if debugState != nil {
+		debugState.ApplyDuration = time.Since(phaseStart)
+		debugState.ClusterSPIFFEIDStatuses = make(map[string]spirev1alpha1.ClusterSPIFFEIDStatus, len(clusterSPIFFEIDs))
+		for _, clusterSPIFFEID := range clusterSPIFFEIDs {
+			debugState.ClusterSPIFFEIDStatuses[clusterSPIFFEID.Name] = clusterSPIFFEID.NextStatus
+		}
+		debugState.ClusterStaticEntryStatuses = make(map[string]spirev1alpha1.ClusterStaticEntryStatus, len(clusterStaticEntries))
+		for _, clusterStaticEntry := range clusterStaticEntries {
+			debugState.ClusterStaticEntryStatuses[clusterStaticEntry.Name] = clusterStaticEntry.NextStatus
+		}
 	}
 
 	// Update the ClusterStaticEntry statuses
@@ -214,7 +351,7 @@ func (r *entryReconciler) reconcile(ctx context.Context) {
 	for _, clusterSPIFFEID := range clusterSPIFFEIDs {
 		log := log.WithValues(clusterSPIFFEIDLogKey, objectName(clusterSPIFFEID))
 
-		if clusterSPIFFEID.Status == clusterSPIFFEID.NextStatus {
+		if equality.Semantic.DeepEqual(clusterSPIFFEID.Status, clusterSPIFFEID.NextStatus) {
 			continue
 		}
 		clusterSPIFFEID.Status = clusterSPIFFEID.NextStatus
@@ -226,10 +363,110 @@ func (r *entryReconciler) reconcile(ctx context.Context) {
 	}
 }
 
+// declareEntries returns the entry state declared by the ClusterStaticEntries
+// and ClusterSPIFFEIDs being reconciled, along with those objects so that
+// their statuses can be updated.
+func (r *entryReconciler) declareEntries(ctx context.Context) (entriesState, []*ClusterStaticEntry, []*ClusterSPIFFEID, error) {
+	state := make(entriesState)
+
+	// Objects targeting a trust domain profile that is not configured
+	// declare no entries, but are returned so that their status says why.
+	var err error
+	clusterStaticEntries := []*ClusterStaticEntry{}
+	if r.config.Reconcile.ClusterStaticEntries {
+		// Load and add entry state for ClusterStaticEntries
+		var unconfigured []*ClusterStaticEntry
+		clusterStaticEntries, unconfigured, err = r.listClusterStaticEntries(ctx)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to list ClusterStaticEntries: %w", err)
+		}
+		r.addClusterStaticEntryEntriesState(ctx, state, clusterStaticEntries)
+		clusterStaticEntries = append(clusterStaticEntries, unconfigured...)
+	}
+
+	clusterSPIFFEIDs := []*ClusterSPIFFEID{}
+	var unconfiguredClusterSPIFFEIDs []*ClusterSPIFFEID
+	if r.config.Reconcile.ClusterSPIFFEIDs {
+		// Load and add entry state for ClusterSPIFFEIDs
+		clusterSPIFFEIDs, unconfiguredClusterSPIFFEIDs, err = r.listClusterSPIFFEIDs(ctx)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to list ClusterSPIFFEIDs: %w", err)
+		}
+		r.specs.Prune(clusterSPIFFEIDs)
+		if len(clusterSPIFFEIDs) == 0 {
+			r.renderMemo = nil
+		} else {
+			// Take a single indexed snapshot of the namespaces, pods and
+			// nodes that every ClusterSPIFFEID is evaluated against.
+			snapshot, err := loadK8sSnapshot(ctx, r.config.K8sClient)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to load Kubernetes snapshot: %w", err)
+			}
+			policies, err := r.listClusterSPIFFEIDPolicies(ctx)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to list ClusterSPIFFEIDPolicies: %w", err)
+			}
+			r.addClusterSPIFFEIDEntriesState(ctx, state, clusterSPIFFEIDs, snapshot, policies)
+		}
+	}
+	return state, clusterStaticEntries, append(clusterSPIFFEIDs, unconfiguredClusterSPIFFEIDs...), nil
+}
+
+// loadLiveConfig applies the live configuration, if any, to the reconcile
+// about to start. Pod entries rendered with a different parent ID template
+// are not reused.
+func (r *entryReconciler) loadLiveConfig() {
+	if r.config.LiveConfig == nil {
+		return
+	}
+	live := r.config.LiveConfig.Load()
+	if live.ParentIDTemplate != r.config.ParentIDTemplate {
+		r.renderMemo = nil
+	}
+	r.config.IgnoreNamespaces = live.IgnoreNamespaces
+	r.config.ClassName = live.ClassName
+	r.config.WatchClassless = live.WatchClassless
+	r.config.ParentIDTemplate = live.ParentIDTemplate
+	r.config.GCInterval = live.GCInterval
+}
+
 func (r *entryReconciler) reconcileClass(className string) bool {
 	return (className == "" && r.config.WatchClassless) || className == r.config.ClassName
 }
 
+// reconcileTrustDomainProfile returns whether objects targeting the trust
+// domain profile are reconciled.
+func (r *entryReconciler) reconcileTrustDomainProfile(profile string) bool {
+	return profile == r.config.TrustDomainProfile
+}
+
+// unconfiguredTrustDomainProfile returns whether the trust domain profile
+// is not configured. Objects targeting such a profile are logged, and have
+// their status updated, by the reconciler for the main trust domain, since
+// no reconciler picks them up.
+func (r *entryReconciler) unconfiguredTrustDomainProfile(ctx context.Context, logKey string, obj metav1.Object, profile string) bool {
+	if r.config.TrustDomainProfile != "" || profile == "" || slices.Contains(r.config.TrustDomainProfiles, profile) {
+		return false
+	}
+	log.FromContext(ctx).Error(nil, "Ignoring object that targets a trust domain profile that is not configured",
+		logKey, objectName(obj),
+		trustDomainProfileLogKey, profile)
+	return true
+}
+
+// profileGauges returns the gauges for the trust domain profile, which are
+// unlabeled for the main trust domain.
+func profileGauges(profile string) map[string]prometheus.Gauge {
+	if profile == "" {
+		return metrics.PromGauges
+	}
+	gauges := make(map[string]prometheus.Gauge, len(metrics.PromProfileGaugeVecs))
+	for name, gaugeVec := range metrics.PromProfileGaugeVecs {
+		gauges[name] = gaugeVec.WithLabelValues(profile)
+	}
+	return gauges
+}
+
 func (r *entryReconciler) recalculateUnsupportFields(ctx context.Context, log logr.Logger) {
 	unsupportedFields, err := r.getUnsupportedFields(ctx)
 	if err != nil {
@@ -282,13 +519,61 @@ func (r *entryReconciler) shouldProcessOrDeleteEntryID(entry spireapi.Entry) (bo
 	return false, false
 }
 
-func (r *entryReconciler) listEntries(ctx context.Context) ([]spireapi.Entry, []spireapi.Entry, error) {
-	// TODO: cache?
+func (r *entryReconciler) listEntries(ctx context.Context, state entriesState, unsupportedFields map[spireapi.Field]struct{}) (_ []spireapi.Entry, _ []spireapi.Entry, err error) {
+	ctx, span := tracing.Start(ctx, "spireentry.ListEntries")
+	defer func() { tracing.End(span, err) }()
+
+	// Between full resyncs, the entries are served from the cache, which
+	// has been kept up to date with the changes made by this reconciler.
+	if r.entries.Valid() && time.Now().Before(r.nextFullEntryList) {
+		entries := r.entries.Entries()
+		span.SetAttributes(cachedKey.Bool(true), countKey.Int(len(entries)))
+		return entries, nil, nil
+	}
+
 	var deleteOnlyEntries []spireapi.Entry
 	var currentEntries []spireapi.Entry
-	tmpvals, err := r.config.EntryClient.ListEntries(ctx)
-	if err != nil {
-		return currentEntries, deleteOnlyEntries, err
+
+	// Only the fields compared when determining if an entry is outdated
+	// are requested, unless changes are audited, in which case entries are
+	// listed in full so that the audit events record them as they were.
+	var outputMask []spireapi.Field
+	if r.config.Auditor == nil {
+		outputMask = make([]spireapi.Field, 0, len(entryOutputMask))
+		for _, field := range entryOutputMask {
+			if _, ok := unsupportedFields[field]; !ok {
+				outputMask = append(outputMask, field)
+			}
+		}
+	}
+
+	var tmpvals []spireapi.Entry
+	// listedParentIDs is nil when every entry is listed.
+	var listedParentIDs []spiffeid.ID
+	fullList := !r.config.ListEntriesByParentID || !time.Now().Before(r.nextFullEntryList)
+	span.SetAttributes(cachedKey.Bool(false), fullListKey.Bool(fullList))
+	r.entriesListedInFull = fullList
+	if !fullList {
+		listedParentIDs = declaredParentIDs(state)
+		for _, parentID := range listedParentIDs {
+			entries, err := r.config.EntryClient.ListFilteredEntries(ctx, spireapi.EntryFilter{ByParentID: parentID}, outputMask)
+			if err != nil {
+				r.entries.Invalidate()
+				return currentEntries, deleteOnlyEntries, err
+			}
+			tmpvals = append(tmpvals, entries...)
+		}
+	} else {
+		var err error
+		tmpvals, err = r.config.EntryClient.ListFilteredEntries(ctx, spireapi.EntryFilter{}, outputMask)
+		if err != nil {
+			r.entries.Invalidate()
+			return currentEntries, deleteOnlyEntries, err
+		}
+		// Listing by parent ID does not find entries under parent IDs that
+		// no longer have declared entries, and the cache may have drifted
+		// from the server, so periodically list everything.
+		r.nextFullEntryList = time.Now().Add(r.config.GCInterval)
 	}
 	for _, value := range tmpvals {
 		proc, del := r.shouldProcessOrDeleteEntryID(value)
@@ -299,6 +584,14 @@ func (r *entryReconciler) listEntries(ctx context.Context) ([]spireapi.Entry, []
 			deleteOnlyEntries = append(deleteOnlyEntries, value)
 		}
 	}
+	if r.entries.Valid() {
+		if divergences := r.entries.Divergences(currentEntries, listedParentIDs); divergences > 0 {
+			log.FromContext(ctx).Info("Entry cache diverged from SPIRE server", "divergences", divergences)
+			r.promCounter[metrics.EntryCacheDivergences].Add(float64(divergences))
+		}
+	}
+	r.entries.Replace(currentEntries)
+	span.SetAttributes(countKey.Int(len(currentEntries)))
 	return currentEntries, deleteOnlyEntries, nil
 }
 
@@ -306,44 +599,66 @@ func (r *entryReconciler) getUnsupportedFields(ctx context.Context) (map[spireap
 	return r.config.EntryClient.GetUnsupportedFields(ctx, r.config.TrustDomain.Name())
 }
 
-func (r *entryReconciler) listClusterStaticEntries(ctx context.Context) ([]*ClusterStaticEntry, error) {
+// listClusterStaticEntries returns the ClusterStaticEntries to reconcile,
+// and those targeting a trust domain profile that is not configured.
+func (r *entryReconciler) listClusterStaticEntries(ctx context.Context) (_ []*ClusterStaticEntry, _ []*ClusterStaticEntry, err error) {
+	ctx, span := tracing.Start(ctx, "spireentry.ListClusterStaticEntries")
+	defer func() { tracing.End(span, err) }()
+
 	clusterStaticEntries, err := k8sapi.ListClusterStaticEntries(ctx, r.config.K8sClient)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	span.SetAttributes(countKey.Int(len(clusterStaticEntries)))
 	out := make([]*ClusterStaticEntry, 0, len(clusterStaticEntries))
+	var unconfigured []*ClusterStaticEntry
 	for _, clusterStaticEntry := range clusterStaticEntries {
-		if r.reconcileClass(clusterStaticEntry.Spec.ClassName) {
+		profile := clusterStaticEntry.Spec.TrustDomainProfile
+		switch {
+		case !r.reconcileClass(clusterStaticEntry.Spec.ClassName):
+		case r.reconcileTrustDomainProfile(profile):
 			out = append(out, &ClusterStaticEntry{
 				ClusterStaticEntry: clusterStaticEntry,
 			})
+		case r.unconfiguredTrustDomainProfile(ctx, clusterStaticEntryLogKey, &clusterStaticEntry, profile):
+			unconfigured = append(unconfigured, &ClusterStaticEntry{
+				ClusterStaticEntry: clusterStaticEntry,
+				NextStatus:         spirev1alpha1.ClusterStaticEntryStatus{UnconfiguredTrustDomainProfile: profile},
+			})
 		}
 	}
-	return out, nil
+	return out, unconfigured, nil
 }
 
-func (r *entryReconciler) listClusterSPIFFEIDs(ctx context.Context) ([]*ClusterSPIFFEID, error) {
+// listClusterSPIFFEIDs returns the ClusterSPIFFEIDs to reconcile, and those
+// targeting a trust domain profile that is not configured.
+func (r *entryReconciler) listClusterSPIFFEIDs(ctx context.Context) (_ []*ClusterSPIFFEID, _ []*ClusterSPIFFEID, err error) {
+	ctx, span := tracing.Start(ctx, "spireentry.ListClusterSPIFFEIDs")
+	defer func() { tracing.End(span, err) }()
+
 	clusterSPIFFEIDs, err := k8sapi.ListClusterSPIFFEIDs(ctx, r.config.K8sClient)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	span.SetAttributes(countKey.Int(len(clusterSPIFFEIDs)))
 	out := make([]*ClusterSPIFFEID, 0, len(clusterSPIFFEIDs))
+	var unconfigured []*ClusterSPIFFEID
 	for _, clusterSPIFFEID := range clusterSPIFFEIDs {
-		if r.reconcileClass(clusterSPIFFEID.Spec.ClassName) {
+		profile := clusterSPIFFEID.Spec.TrustDomainProfile
+		switch {
+		case !r.reconcileClass(clusterSPIFFEID.Spec.ClassName):
+		case r.reconcileTrustDomainProfile(profile):
 			out = append(out, &ClusterSPIFFEID{
 				ClusterSPIFFEID: clusterSPIFFEID,
 			})
+		case r.unconfiguredTrustDomainProfile(ctx, clusterSPIFFEIDLogKey, &clusterSPIFFEID, profile):
+			unconfigured = append(unconfigured, &ClusterSPIFFEID{
+				ClusterSPIFFEID: clusterSPIFFEID,
+				NextStatus:      spirev1alpha1.ClusterSPIFFEIDStatus{UnconfiguredTrustDomainProfile: profile},
+			})
 		}
 	}
-	return out, nil
-}
-
-func (r *entryReconciler) listNamespaces(ctx context.Context, namespaceSelector labels.Selector) ([]corev1.Namespace, error) {
-	return k8sapi.ListNamespaces(ctx, r.config.K8sClient, namespaceSelector)
-}
-
-func (r *entryReconciler) listNamespacePods(ctx context.Context, namespace string, podSelector labels.Selector) ([]corev1.Pod, error) {
-	return k8sapi.ListNamespacePods(ctx, r.config.K8sClient, namespace, podSelector)
+	return out, unconfigured, nil
 }
 
 func (r *entryReconciler) addClusterStaticEntryEntriesState(ctx context.Context, state entriesState, clusterStaticEntries []*ClusterStaticEntry) {
@@ -358,12 +673,11 @@ func (r *entryReconciler) addClusterStaticEntryEntriesState(ctx context.Context,
 			continue
 		}
 		clusterStaticEntry.NextStatus.Rendered = true
-		state.AddDeclared(*entry, clusterStaticEntry)
+		state.AddDeclared(*entry, clusterStaticEntry, nil)
 	}
 }
 
-func (r *entryReconciler) addClusterSPIFFEIDEntriesState(ctx context.Context, state entriesState, clusterSPIFFEIDs []*ClusterSPIFFEID) {
-	log := log.FromContext(ctx)
+func (r *entryReconciler) addClusterSPIFFEIDEntriesState(ctx context.Context, state entriesState, clusterSPIFFEIDs []*ClusterSPIFFEID, snapshot *k8sSnapshot, policies []*clusterSPIFFEIDPolicy) {
 	podsWithNonFallbackApplied := make(map[types.UID]struct{})
 	// Process all the fallback clusterSPIFFEIDs last.
 	slices.SortStableFunc(clusterSPIFFEIDs, func(x, y *ClusterSPIFFEID) int {
@@ -375,10 +689,38 @@ func (r *entryReconciler) addClusterSPIFFEIDEntriesState(ctx context.Context, st
 		}
 		return -1
 	})
+
+	// Rendering happens in two rounds: first all of the non-fallback
+	// ClusterSPIFFEIDs, then the fallback ClusterSPIFFEIDs, since the latter
+	// depend on which pods the former applied to. Within each round the
+	// entries are rendered concurrently and then merged into the state in
+	// job order so that the resulting state is deterministic.
+	firstFallback := slices.IndexFunc(clusterSPIFFEIDs, func(clusterSPIFFEID *ClusterSPIFFEID) bool {
+		return clusterSPIFFEID.Spec.Fallback
+	})
+	if firstFallback < 0 {
+		firstFallback = len(clusterSPIFFEIDs)
+	}
+	nextRenderMemo := make(renderMemo, len(r.renderMemo))
+	for _, round := range [][]*ClusterSPIFFEID{clusterSPIFFEIDs[:firstFallback], clusterSPIFFEIDs[firstFallback:]} {
+		spans := startRenderSpans(ctx, round)
+		jobs := r.makeRenderJobs(ctx, round, snapshot, policies, podsWithNonFallbackApplied)
+		r.mergeRenderJobs(ctx, state, r.renderJobs(ctx, jobs, snapshot), podsWithNonFallbackApplied, nextRenderMemo)
+		endRenderSpans(round, spans)
+	}
+	r.renderMemo = nextRenderMemo
+}
+
+// makeRenderJobs selects the pods for each ClusterSPIFFEID and returns a
+// render job for each one that needs an entry rendered, along with the
+// policies that apply to the pod.
+func (r *entryReconciler) makeRenderJobs(ctx context.Context, clusterSPIFFEIDs []*ClusterSPIFFEID, snapshot *k8sSnapshot, policies []*clusterSPIFFEIDPolicy, podsWithNonFallbackApplied map[types.UID]struct{}) []renderJob {
+	log := log.FromContext(ctx)
+	var jobs []renderJob
 	for _, clusterSPIFFEID := range clusterSPIFFEIDs {
 		log := log.WithValues(clusterSPIFFEIDLogKey, objectName(clusterSPIFFEID))
 
-		spec, err := spirev1alpha1.ParseClusterSPIFFEIDSpec(&clusterSPIFFEID.Spec)
+		spec, err := r.specs.Parse(clusterSPIFFEID)
 		if err != nil {
 			// TODO: should this be prevented via admission webhook? should
 			// we dump this failure into the status?
@@ -386,132 +728,417 @@ func (r *entryReconciler) addClusterSPIFFEIDEntriesState(ctx context.Context, st
 			continue
 		}
 
-		// List namespaces applicable to the ClusterSPIFFEID
-		namespaces, err := r.listNamespaces(ctx, spec.NamespaceSelector)
-		if err != nil {
-			log.Error(err, "Failed to list namespaces")
-			continue
-		}
+		// Select namespaces applicable to the ClusterSPIFFEID
+		namespaces := snapshot.SelectNamespaces(spec.NamespaceSelector)
 
 		clusterSPIFFEID.NextStatus.Stats.NamespacesSelected += len(namespaces)
 
-		for i := range namespaces {
-			if namespace.IsIgnored(r.config.IgnoreNamespaces, namespaces[i].Name) {
+		for _, ns := range namespaces {
+			if namespace.IsIgnored(r.config.IgnoreNamespaces, ns.Name) {
 				clusterSPIFFEID.NextStatus.Stats.NamespacesIgnored++
 				continue
 			}
 
-			log := log.WithValues(namespaceLogKey, objectName(&namespaces[i]))
-
-			pods, err := r.listNamespacePods(ctx, namespaces[i].Name, spec.PodSelector)
-			switch {
-			case err == nil:
-			case apierrors.IsNotFound(err):
-				continue
-			default:
-				log.Error(err, "Failed to list namespace pods")
-				continue
-			}
+			pods := snapshot.SelectPods(ns.Name, spec.PodSelector)
+			nsPolicies := policiesForNamespace(policies, ns)
 
 			clusterSPIFFEID.NextStatus.Stats.PodsSelected += len(pods)
-			for i := range pods {
-				log := log.WithValues(podLogKey, objectName(&pods[i]))
-				if _, ok := podsWithNonFallbackApplied[pods[i].UID]; ok && clusterSPIFFEID.Spec.Fallback {
+			for _, pod := range pods {
+				if _, ok := podsWithNonFallbackApplied[pod.UID]; ok && clusterSPIFFEID.Spec.Fallback {
 					continue
 				}
+				jobs = append(jobs, renderJob{
+					clusterSPIFFEID: clusterSPIFFEID,
+					spec:            spec,
+					pod:             pod,
+					policies:        nsPolicies,
+				})
+			}
+		}
+	}
+	return jobs
+}
+
+// renderJob is a single pod entry to be rendered for a ClusterSPIFFEID.
+type renderJob struct {
+	clusterSPIFFEID *ClusterSPIFFEID
+	spec            *spirev1alpha1.ParsedClusterSPIFFEIDSpec
+	pod             *corev1.Pod
+	policies        []*clusterSPIFFEIDPolicy
+
+	entry      *spireapi.Entry
+	err        error
+	key        renderKey
+	memoizable bool
+}
+
+// renderJobs renders the pod entries for the given jobs across a bounded
+// pool of workers. The jobs are returned in the same order, with the result
+// of rendering populated. Entries whose inputs are unchanged since the
+// previous reconcile are taken from the render memo instead of re-rendered.
+func (r *entryReconciler) renderJobs(ctx context.Context, jobs []renderJob, snapshot *k8sSnapshot) []renderJob {
+	workers := r.renderWorkers()
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				n := int(next.Add(1)) - 1
+				if n >= len(jobs) {
+					return
+				}
+				r.renderPodEntry(ctx, &jobs[n], snapshot)
+			}
+		}()
+	}
+	wg.Wait()
+	return jobs
+}
 
-				entry, err := r.renderPodEntry(ctx, spec, &pods[i])
-				switch {
-				case err != nil:
-					log.Error(err, "Failed to render entry")
-					clusterSPIFFEID.NextStatus.Stats.PodEntryRenderFailures++
-				case entry != nil:
-					// renderPodEntry will return a nil entry if requisite k8s
-					// objects disappeared from underneath.
-					state.AddDeclared(*entry, clusterSPIFFEID)
-					if !clusterSPIFFEID.Spec.Fallback {
-						podsWithNonFallbackApplied[pods[i].UID] = struct{}{}
-					}
+// mergeRenderJobs adds the rendered entries to the state in job order and
+// updates the ClusterSPIFFEID stats accordingly.
+func (r *entryReconciler) mergeRenderJobs(ctx context.Context, state entriesState, jobs []renderJob, podsWithNonFallbackApplied map[types.UID]struct{}, nextRenderMemo renderMemo) {
+	log := log.FromContext(ctx)
+	for _, job := range jobs {
+		switch {
+		case job.err != nil:
+			log.Error(job.err, "Failed to render entry", clusterSPIFFEIDLogKey, objectName(job.clusterSPIFFEID), podLogKey, objectName(job.pod))
+			job.clusterSPIFFEID.NextStatus.Stats.PodEntryRenderFailures++
+		case job.entry != nil:
+			// renderPodEntry will return a nil entry if requisite k8s
+			// objects disappeared from underneath.
+			if violations := checkPolicies(job.policies, job.spec, job.entry); len(violations) > 0 {
+				// Like a render failure, the pod is left to the fallback
+				// ClusterSPIFFEIDs.
+				for _, violation := range violations {
+					log.Error(nil, "Entry violates ClusterSPIFFEIDPolicy", clusterSPIFFEIDLogKey, objectName(job.clusterSPIFFEID), podLogKey, objectName(job.pod), clusterSPIFFEIDPolicyLogKey, violation.policy, "reason", violation.reason)
+					job.clusterSPIFFEID.AddPolicyViolation(violation.policy, violation.reason)
 				}
+				job.clusterSPIFFEID.NextStatus.Stats.PodEntryPolicyViolations++
+				continue
+			}
+			state.AddDeclared(*job.entry, job.clusterSPIFFEID, job.pod)
+			if job.memoizable {
+				nextRenderMemo[job.key] = job.entry
+			}
+			if !job.clusterSPIFFEID.Spec.Fallback {
+				podsWithNonFallbackApplied[job.pod.UID] = struct{}{}
 			}
 		}
 	}
 }
 
-func (r *entryReconciler) renderPodEntry(ctx context.Context, spec *spirev1alpha1.ParsedClusterSPIFFEIDSpec, pod *corev1.Pod) (*spireapi.Entry, error) {
-	// TODO: should we be caching this? probably not since it grabs from the
-	// controller client, which is cached already.
-	node := new(corev1.Node)
-	if err := r.config.K8sClient.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
-		return nil, client.IgnoreNotFound(err)
+func (r *entryReconciler) renderWorkers() int {
+	if r.config.RenderWorkers > 0 {
+		return r.config.RenderWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// renderPodEntry renders the entry for the render job. The previous render
+// memo is only read from, so this is safe to call concurrently.
+func (r *entryReconciler) renderPodEntry(ctx context.Context, job *renderJob, snapshot *k8sSnapshot) {
+	node := snapshot.GetNode(job.pod.Spec.NodeName)
+	if node == nil {
+		return
 	}
 	endpointsList := &corev1.EndpointsList{}
-	if spec.AutoPopulateDNSNames {
-		if err := r.config.K8sClient.List(ctx, endpointsList, client.InNamespace(pod.Namespace), client.MatchingFields{reconciler.EndpointUID: string(pod.UID)}); err != nil && !apierrors.IsNotFound(err) {
-			return nil, err
+	if job.spec.AutoPopulateDNSNames {
+		if err := r.config.K8sClient.List(ctx, endpointsList, client.InNamespace(job.pod.Namespace), client.MatchingFields{reconciler.EndpointUID: string(job.pod.UID)}); err != nil && !apierrors.IsNotFound(err) {
+			job.err = err
+			return
 		}
 	}
-	return renderPodEntry(spec, node, pod, endpointsList, r.config.TrustDomain, r.config.ClusterName, r.config.ClusterDomain, r.config.ParentIDTemplate)
+	job.key, job.memoizable = makeRenderKey(job.clusterSPIFFEID, job.pod, node, endpointsList)
+	if job.memoizable {
+		if entry, ok := r.renderMemo[job.key]; ok {
+			job.entry = entry
+			return
+		}
+	}
+	job.entry, job.err = renderPodEntry(job.spec, node, job.pod, endpointsList, r.config.TrustDomain, r.config.ClusterName, r.config.ClusterDomain, r.config.ParentIDTemplate)
 }
 
-func (r *entryReconciler) createEntries(ctx context.Context, declaredEntries []declaredEntry) {
+// createEntries creates the declared entries, returning how many were
+// created.
+func (r *entryReconciler) createEntries(ctx context.Context, declaredEntries []declaredEntry) int {
 	log := log.FromContext(ctx)
-	statuses, err := r.config.EntryClient.CreateEntries(ctx, entriesFromDeclaredEntries(declaredEntries))
+	results, err := r.config.EntryClient.CreateEntries(ctx, entriesFromDeclaredEntries(declaredEntries))
 	if err != nil {
+		events := make([]audit.Event, 0, len(declaredEntries))
 		for _, declaredEntry := range declaredEntries {
 			declaredEntry.By.IncrementEntryFailures()
+			events = append(events, r.entryEvent(audit.ActionCreate, nil, &declaredEntry.Entry, nil, declaredEntry, audit.ResultFromError(err)))
 		}
+		r.config.Auditor.Record(ctx, events...)
+		r.entries.Invalidate()
 		log.Error(err, "Failed to update entries")
-		return
+		return 0
 	}
-	for i, status := range statuses {
-		switch status.Code {
+	created := 0
+	events := make([]audit.Event, 0, len(results))
+	for i, result := range results {
+		events = append(events, r.createdEntryEvent(declaredEntries[i], result))
+		switch result.Code {
 		case codes.OK:
 			log.Info("Created entry", entryLogFields(declaredEntries[i].Entry)...)
 			declaredEntries[i].By.IncrementEntrySuccess()
+			r.entries.Put(result.Entry)
+			created++
 		default:
 			declaredEntries[i].By.IncrementEntryFailures()
-			log.Error(status.Err(), "Failed to create entry", entryLogFields(declaredEntries[i].Entry)...)
+			r.entries.Invalidate()
+			log.Error(result.Err(), "Failed to create entry", entryLogFields(declaredEntries[i].Entry)...)
 		}
 	}
+	r.config.Auditor.Record(ctx, events...)
+	return created
 }
 
-func (r *entryReconciler) updateEntries(ctx context.Context, declaredEntries []declaredEntry) {
+func (r *entryReconciler) updateEntries(ctx context.Context, declaredEntryUpdates []declaredEntryUpdate, unsupportedFields map[spireapi.Field]struct{}) {
 	log := log.FromContext(ctx)
-	statuses, err := r.config.EntryClient.UpdateEntries(ctx, entriesFromDeclaredEntries(declaredEntries))
+	results, err := r.config.EntryClient.UpdateEntries(ctx, entryUpdatesFromDeclaredEntryUpdates(declaredEntryUpdates, r.config.CheckEntryRevisions))
 	if err != nil {
-		for _, declaredEntry := range declaredEntries {
-			declaredEntry.By.IncrementEntryFailures()
+		events := make([]audit.Event, 0, len(declaredEntryUpdates))
+		for _, declaredEntryUpdate := range declaredEntryUpdates {
+			declaredEntryUpdate.By.IncrementEntryFailures()
+			events = append(events, r.updatedEntryEvent(declaredEntryUpdate, audit.ResultFromError(err)))
 		}
+		r.config.Auditor.Record(ctx, events...)
+		r.entries.Invalidate()
 		log.Error(err, "Failed to update entries")
 		return
 	}
-	for i, status := range statuses {
-		switch status.Code {
+	var conflicts []declaredEntryUpdate
+	events := make([]audit.Event, 0, len(results))
+	for i, result := range results {
+		events = append(events, r.updatedEntryEvent(declaredEntryUpdates[i], audit.ResultFromStatus(result.Status)))
+		logFields := append(entryLogFields(declaredEntryUpdates[i].Entry), outdatedFieldsLogKey, stringFromFields(declaredEntryUpdates[i].Fields))
+		switch result.Code {
 		case codes.OK:
-			log.Info("Updated entry", entryLogFields(declaredEntries[i].Entry)...)
+			log.Info("Updated entry", logFields...)
+			r.entries.Put(result.Entry)
+		case codes.Aborted:
+			log.Info("Entry was changed concurrently; re-reading", logFields...)
+			conflicts = append(conflicts, declaredEntryUpdates[i])
 		default:
-			declaredEntries[i].By.IncrementEntryFailures()
-			log.Error(status.Err(), "Failed to update entry", entryLogFields(declaredEntries[i].Entry)...)
+			declaredEntryUpdates[i].By.IncrementEntryFailures()
+			r.entries.Invalidate()
+			log.Error(result.Err(), "Failed to update entry", logFields...)
+		}
+	}
+	r.config.Auditor.Record(ctx, events...)
+	if len(conflicts) > 0 {
+		r.retryConflictingUpdates(ctx, conflicts, unsupportedFields)
+	}
+}
+
+// retryConflictingUpdates handles updates that were skipped because the
+// entry was seen to have changed after it was listed. Each entry is re-read and diffed
+// again. If it still needs updating, the update is retried once against the
+// new revision. A second conflict is counted as a failure and left for the
+// next reconcile.
+func (r *entryReconciler) retryConflictingUpdates(ctx context.Context, conflicts []declaredEntryUpdate, unsupportedFields map[spireapi.Field]struct{}) {
+	log := log.FromContext(ctx)
+	var retries []declaredEntryUpdate
+	for _, conflict := range conflicts {
+		current, err := r.config.EntryClient.GetEntry(ctx, conflict.Entry.ID)
+		switch {
+		case status.Code(err) == codes.NotFound:
+			// The entry was deleted out from under us. The next reconcile
+			// will create it again if it is still declared.
+			log.Info("Entry was deleted concurrently; skipping update", entryLogFields(conflict.Entry)...)
+			r.entries.Delete(conflict.Entry.ID)
+			continue
+		case err != nil:
+			conflict.By.IncrementEntryFailures()
+			r.entries.Invalidate()
+			log.Error(err, "Failed to re-read entry", entryLogFields(conflict.Entry)...)
+			continue
+		}
+		r.entries.Put(current)
+		if makeEntryKey(current) != makeEntryKey(conflict.Entry) {
+			// The entry no longer describes the same workload and will be
+			// sorted out by the next reconcile.
+			log.Info("Entry was re-keyed concurrently; skipping update", entryLogFields(current)...)
+			continue
+		}
+		outdatedFields := getOutdatedEntryFields(conflict.Entry, current, unsupportedFields)
+		if len(outdatedFields) == 0 {
+			log.Info("Entry is already up to date after concurrent change", entryLogFields(current)...)
+			continue
+		}
+		conflict.Entry.RevisionNumber = current.RevisionNumber
+		conflict.Current = current
+		conflict.Fields = outdatedFields
+		retries = append(retries, conflict)
+	}
+	if len(retries) == 0 {
+		return
+	}
+
+	results, err := r.config.EntryClient.UpdateEntries(ctx, entryUpdatesFromDeclaredEntryUpdates(retries, r.config.CheckEntryRevisions))
+	if err != nil {
+		events := make([]audit.Event, 0, len(retries))
+		for _, retry := range retries {
+			retry.By.IncrementEntryFailures()
+			events = append(events, r.updatedEntryEvent(retry, audit.ResultFromError(err)))
+		}
+		r.config.Auditor.Record(ctx, events...)
+		r.entries.Invalidate()
+		log.Error(err, "Failed to update entries")
+		return
+	}
+	events := make([]audit.Event, 0, len(results))
+	for i, result := range results {
+		events = append(events, r.updatedEntryEvent(retries[i], audit.ResultFromStatus(result.Status)))
+		logFields := append(entryLogFields(retries[i].Entry), outdatedFieldsLogKey, stringFromFields(retries[i].Fields))
+		switch result.Code {
+		case codes.OK:
+			log.Info("Updated entry", logFields...)
+			r.entries.Put(result.Entry)
+		default:
+			retries[i].By.IncrementEntryFailures()
+			r.entries.Invalidate()
+			log.Error(result.Err(), "Failed to update entry", logFields...)
 		}
 	}
+	r.config.Auditor.Record(ctx, events...)
 }
 
-func (r *entryReconciler) deleteEntries(ctx context.Context, entries []spireapi.Entry) {
+// retiredEntries returns the current entries that are no longer declared,
+// other than those associated with join tokens.
+func retiredEntries(state entriesState) []spireapi.Entry {
+	var entries []spireapi.Entry
+	for _, s := range state {
+		if len(s.Declared) == 0 {
+			entries = append(entries, filterJoinTokenEntries(s.Current)...)
+		}
+	}
+	return entries
+}
+
+// retireEntries returns the entries that are no longer declared and have
+// been retired for at least the retirement grace period, which are to be
+// deleted. The rest are kept until the grace period has passed. When the
+// entries were only listed by parent ID, the entries under the other parent
+// IDs keep when they were retired until the next full list, so that their
+// grace period does not start over.
+func (r *entryReconciler) retireEntries(ctx context.Context, state entriesState, now time.Time) []spireapi.Entry {
+	entries := retiredEntries(state)
+	if r.config.EntryRetirementGracePeriod <= 0 {
+		return entries
+	}
+	log := log.FromContext(ctx)
+
+	retiring := make(map[string]time.Time)
+	if !r.entriesListedInFull {
+		listed := make(map[string]struct{})
+		for _, s := range state {
+			for _, entry := range s.Current {
+				listed[entry.ID] = struct{}{}
+			}
+		}
+		for id, retiredAt := range r.retiring {
+			if _, ok := listed[id]; !ok {
+				retiring[id] = retiredAt
+			}
+		}
+	}
+	var toDelete []spireapi.Entry
+	for _, entry := range entries {
+		retiredAt, ok := r.retiring[entry.ID]
+		if !ok {
+			retiredAt = now
+			log.Info("Retiring entry that is no longer declared", append(entryLogFields(entry), "gracePeriod", r.config.EntryRetirementGracePeriod)...)
+		}
+		if now.Sub(retiredAt) >= r.config.EntryRetirementGracePeriod {
+			toDelete = append(toDelete, entry)
+			continue
+		}
+		retiring[entry.ID] = retiredAt
+	}
+	r.retiring = retiring
+	r.promGauge[metrics.RetiringEntries].Set(float64(len(retiring)))
+	return toDelete
+}
+
+// deleteEntries deletes the entries, returning the IDs of those that no
+// longer exist.
+func (r *entryReconciler) deleteEntries(ctx context.Context, entries []spireapi.Entry) map[string]struct{} {
 	log := log.FromContext(ctx)
 	statuses, err := r.config.EntryClient.DeleteEntries(ctx, idsFromEntries(entries))
 	if err != nil {
+		events := make([]audit.Event, 0, len(entries))
+		for _, entry := range entries {
+			events = append(events, r.deletedEntryEvent(entry, audit.ResultFromError(err)))
+		}
+		r.config.Auditor.Record(ctx, events...)
+		r.entries.Invalidate()
 		log.Error(err, "Failed to delete entries")
-		return
+		return nil
 	}
+	deleted := make(map[string]struct{}, len(statuses))
+	events := make([]audit.Event, 0, len(statuses))
 	for i, status := range statuses {
+		events = append(events, r.deletedEntryEvent(entries[i], audit.ResultFromStatus(status)))
 		switch status.Code {
 		case codes.OK:
 			log.Info("Deleted entry", entryLogFields(entries[i])...)
+			r.entries.Delete(entries[i].ID)
+			deleted[entries[i].ID] = struct{}{}
+		case codes.NotFound:
+			r.entries.Delete(entries[i].ID)
+			deleted[entries[i].ID] = struct{}{}
+			log.Error(status.Err(), "Failed to delete entry", entryLogFields(entries[i])...)
 		default:
+			r.entries.Invalidate()
 			log.Error(status.Err(), "Failed to delete entry", entryLogFields(entries[i])...)
 		}
 	}
+	r.config.Auditor.Record(ctx, events...)
+	return deleted
+}
+
+// entryOutputMask is the set of fields requested when listing entries. It
+// must include every field compared by getOutdatedEntryFields, as well as
+// the revision number that updates check before they are sent.
+var entryOutputMask = []spireapi.Field{
+	spireapi.X509SVIDTTL,
+	spireapi.JWTSVIDTTLField,
+	spireapi.FederatesWithField,
+	spireapi.AdminField,
+	spireapi.DownstreamField,
+	spireapi.DNSNamesField,
+	spireapi.HintField,
+	spireapi.StoreSVIDField,
+	spireapi.RevisionNumberField,
+	spireapi.CreatedAtField,
+}
+
+// declaredParentIDs returns the unique parent IDs of the declared entries,
+// in sorted order.
+func declaredParentIDs(state entriesState) []spiffeid.ID {
+	seen := make(map[spiffeid.ID]struct{})
+	var parentIDs []spiffeid.ID
+	for _, s := range state {
+		for _, declared := range s.Declared {
+			if _, ok := seen[declared.Entry.ParentID]; !ok {
+				seen[declared.Entry.ParentID] = struct{}{}
+				parentIDs = append(parentIDs, declared.Entry.ParentID)
+			}
+		}
+	}
+	sort.Slice(parentIDs, func(i, j int) bool {
+		return parentIDs[i].String() < parentIDs[j].String()
+	})
+	return parentIDs
 }
 
 type entriesState map[entryKey]*entryState
@@ -521,11 +1148,14 @@ func (es entriesState) AddCurrent(entry spireapi.Entry) {
 	s.Current = append(s.Current, entry)
 }
 
-func (es entriesState) AddDeclared(entry spireapi.Entry, by byObject) {
+// AddDeclared adds an entry declared by the object. The pod is the pod a
+// ClusterSPIFFEID entry was rendered for, and nil for other entries.
+func (es entriesState) AddDeclared(entry spireapi.Entry, by byObject, pod *corev1.Pod) {
 	s := es.stateFor(entry)
 	s.Declared = append(s.Declared, declaredEntry{
 		Entry: entry,
 		By:    by,
+		Pod:   pod,
 	})
 }
 
@@ -547,6 +1177,15 @@ type entryState struct {
 type declaredEntry struct {
 	Entry spireapi.Entry
 	By    byObject
+	Pod   *corev1.Pod
+}
+
+// declaredEntryUpdate is a declared entry that needs to be updated, along
+// with the current entry and the fields that are outdated.
+type declaredEntryUpdate struct {
+	declaredEntry
+	Current spireapi.Entry
+	Fields  []spireapi.Field
 }
 
 type entryKey string
@@ -636,9 +1275,7 @@ func getOutdatedEntryFields(newEntry, oldEntry spireapi.Entry, unsupportedFields
 		outdated = append(outdated, spireapi.X509SVIDTTL)
 	}
 	if oldEntry.JWTSVIDTTL != newEntry.JWTSVIDTTL {
-		if _, ok := unsupportedFields[spireapi.JWTSVIDTTLField]; !ok {
-			outdated = append(outdated, spireapi.JWTSVIDTTLField)
-		}
+		outdated = append(outdated, spireapi.JWTSVIDTTLField)
 	}
 	if !trustDomainsMatch(oldEntry.FederatesWith, newEntry.FederatesWith) {
 		outdated = append(outdated, spireapi.FederatesWithField)
@@ -653,17 +1290,17 @@ func getOutdatedEntryFields(newEntry, oldEntry spireapi.Entry, unsupportedFields
 		outdated = append(outdated, spireapi.DNSNamesField)
 	}
 	if oldEntry.Hint != newEntry.Hint {
-		if _, ok := unsupportedFields[spireapi.HintField]; !ok {
-			outdated = append(outdated, spireapi.HintField)
-		}
+		outdated = append(outdated, spireapi.HintField)
 	}
 	if oldEntry.StoreSVID != newEntry.StoreSVID {
-		if _, ok := unsupportedFields[spireapi.StoreSVIDField]; !ok {
-			outdated = append(outdated, spireapi.StoreSVIDField)
-		}
+		outdated = append(outdated, spireapi.StoreSVIDField)
 	}
 
-	return outdated
+	// Fields the SPIRE server does not support are never updated.
+	return slices.DeleteFunc(outdated, func(field spireapi.Field) bool {
+		_, unsupported := unsupportedFields[field]
+		return unsupported
+	})
 }
 
 func trustDomainsMatch(as, bs []spiffeid.TrustDomain) bool {
@@ -712,6 +1349,18 @@ func entriesFromDeclaredEntries(declaredEntries []declaredEntry) []spireapi.Entr
 	return entries
 }
 
+func entryUpdatesFromDeclaredEntryUpdates(declaredEntryUpdates []declaredEntryUpdate, checkRevision bool) []spireapi.EntryUpdate {
+	updates := make([]spireapi.EntryUpdate, 0, len(declaredEntryUpdates))
+	for _, declaredEntryUpdate := range declaredEntryUpdates {
+		updates = append(updates, spireapi.EntryUpdate{
+			Entry:         declaredEntryUpdate.Entry,
+			Fields:        declaredEntryUpdate.Fields,
+			CheckRevision: checkRevision,
+		})
+	}
+	return updates
+}
+
 func idsFromEntries(entries []spireapi.Entry) []string {
 	ids := make([]string, 0, len(entries))
 	for _, entry := range entries {
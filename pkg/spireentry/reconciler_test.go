@@ -1,11 +1,32 @@
 package spireentry
 
 import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
 	"testing"
+	"text/template"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/audit"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
 	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func TestMakeEntryKey(t *testing.T) {
@@ -123,3 +144,850 @@ func TestFilterJoinTokenEntries(t *testing.T) {
 		})
 	}
 }
+
+func TestListEntriesByParentID(t *testing.T) {
+	cluster := newTestCluster(1, 2, 2)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	staleEntry := func(id string) spireapi.Entry {
+		return spireapi.Entry{
+			ID:        id,
+			ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/gone"),
+			SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/ns/ns-0/pod/gone"),
+			Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:" + id}},
+		}
+	}
+	entryClient := newEntryClient(staleEntry("stale-1"))
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	r.config.ListEntriesByParentID = true
+	r.config.GCInterval = time.Hour
+
+	entryIDs := func() []string {
+		var ids []string
+		for _, entry := range entryClient.getEntries() {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+
+	// The first reconcile lists every entry.
+	r.reconcile(context.Background())
+	require.Equal(t, []spireapi.EntryFilter{{}}, entryClient.getListFilters())
+	require.Equal(t, []string{"00000001", "00000002"}, entryIDs())
+
+	// Subsequent reconciles that cannot use the entry cache only list the
+	// entries under the parent IDs that have declared entries, so the stale
+	// entry is not noticed...
+	require.NoError(t, entryClient.setEntry(staleEntry("stale-2")))
+	r.entries.Invalidate()
+	r.reconcile(context.Background())
+	require.Equal(t, []spireapi.EntryFilter{
+		{ByParentID: spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0")},
+		{ByParentID: spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-1")},
+	}, entryClient.getListFilters())
+	require.Equal(t, []string{"00000001", "00000002", "stale-2"}, entryIDs())
+
+	// ...until the next full list.
+	r.nextFullEntryList = time.Time{}
+	r.reconcile(context.Background())
+	require.Equal(t, []spireapi.EntryFilter{{}}, entryClient.getListFilters())
+	require.Equal(t, []string{"00000001", "00000002"}, entryIDs())
+}
+
+func TestReconcileUsesEntryCache(t *testing.T) {
+	cluster := newTestCluster(1, 2, 1)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	entryClient := newEntryClient()
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	r.config.GCInterval = time.Hour
+	divergences := testutil.ToFloat64(r.promCounter[metrics.EntryCacheDivergences])
+
+	// The first reconcile lists every entry and caches the created entries.
+	r.reconcile(context.Background())
+	require.Equal(t, []spireapi.EntryFilter{{}}, entryClient.getListFilters())
+	require.Len(t, entryClient.getEntries(), 2)
+	assert.Equal(t, entryClient.getEntries(), r.entries.Entries())
+
+	// Triggered reconciles diff against the cache without listing, so an
+	// entry deleted behind the reconciler's back is not noticed...
+	_, err := entryClient.DeleteEntries(context.Background(), []string{"00000001"})
+	require.NoError(t, err)
+	r.reconcile(context.Background())
+	require.Empty(t, entryClient.getListFilters())
+	require.Len(t, entryClient.getEntries(), 1)
+
+	// ...until the next full resync, which records the divergence.
+	r.nextFullEntryList = time.Time{}
+	r.reconcile(context.Background())
+	require.Equal(t, []spireapi.EntryFilter{{}}, entryClient.getListFilters())
+	require.Len(t, entryClient.getEntries(), 2)
+	assert.Equal(t, entryClient.getEntries(), r.entries.Entries())
+	assert.Equal(t, divergences+1, testutil.ToFloat64(r.promCounter[metrics.EntryCacheDivergences]))
+}
+
+func TestReconcileRetiresEntries(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	pods := newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, pods)
+	entryClient := newEntryClient()
+	k8sClient := cluster.build(t)
+	r := newTestEntryReconciler(k8sClient, entryClient)
+	r.config.EntryRetirementGracePeriod = time.Minute
+
+	r.reconcile(context.Background())
+	require.Equal(t, []string{"create 00000001"}, entryClient.writes)
+
+	// Changing the template retires the old entry rather than deleting it.
+	require.NoError(t, k8sClient.Get(context.Background(), client.ObjectKeyFromObject(pods), pods))
+	pods.Spec.SPIFFEIDTemplate = "spiffe://example.org/pod/{{ .PodMeta.Name }}"
+	pods.Generation++ // the fake client does not bump the generation
+	require.NoError(t, k8sClient.Update(context.Background(), pods))
+	entryClient.writes = nil
+	r.reconcile(context.Background())
+	require.Equal(t, []string{"create 00000002"}, entryClient.writes)
+	require.Contains(t, r.retiring, "00000001")
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.promGauge[metrics.RetiringEntries]))
+
+	// It is kept until the grace period has passed...
+	entryClient.writes = nil
+	r.reconcile(context.Background())
+	require.Empty(t, entryClient.writes)
+
+	// ...and deleted after it.
+	r.retiring["00000001"] = time.Now().Add(-time.Minute)
+	r.reconcile(context.Background())
+	require.Equal(t, []string{"delete 00000001"}, entryClient.writes)
+	assert.Empty(t, r.retiring)
+	assert.Zero(t, testutil.ToFloat64(r.promGauge[metrics.RetiringEntries]))
+}
+
+func TestReconcileKeepsRetirementOfUnlistedEntries(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	entryClient := newEntryClient(spireapi.Entry{
+		ID:        "orphan",
+		ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/gone"),
+		SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/orphan"),
+		Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:gone"}},
+	})
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	r.config.ListEntriesByParentID = true
+	r.config.EntryRetirementGracePeriod = time.Minute
+
+	r.reconcile(context.Background())
+	require.Contains(t, r.retiring, "orphan")
+	retiredAt := time.Now().Add(-2 * time.Minute)
+	r.retiring["orphan"] = retiredAt
+
+	// Listing by parent ID does not find the entry, which keeps when it was
+	// retired rather than starting its grace period over.
+	r.entries.Invalidate()
+	r.nextFullEntryList = time.Now().Add(time.Hour)
+	entryClient.writes = nil
+	r.reconcile(context.Background())
+	listFilters := entryClient.getListFilters()
+	require.False(t, listFilters[len(listFilters)-1].ByParentID.IsZero())
+	assert.Empty(t, entryClient.writes)
+	assert.Equal(t, map[string]time.Time{"orphan": retiredAt}, r.retiring)
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.promGauge[metrics.RetiringEntries]))
+
+	// The next full list finds it past its grace period.
+	r.nextFullEntryList = time.Time{}
+	r.reconcile(context.Background())
+	assert.Equal(t, []string{"delete orphan"}, entryClient.writes)
+	assert.Empty(t, r.retiring)
+}
+
+func TestProfileGauges(t *testing.T) {
+	// The main trust domain keeps the unlabeled gauges.
+	assert.Same(t, metrics.PromGauges[metrics.RetiringEntries], profileGauges("")[metrics.RetiringEntries])
+
+	profileGauges("other")[metrics.RetiringEntries].Set(2)
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.PromProfileGaugeVecs[metrics.RetiringEntries].WithLabelValues("other")))
+}
+
+func TestReconcileCreatesBeforeDeleting(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	entryClient := newEntryClient(spireapi.Entry{
+		ID:        "old",
+		ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+		SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/old/pod-0-0"),
+		Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+	})
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+
+	r.reconcile(context.Background())
+	require.Equal(t, []string{"create 00000001", "delete old"}, entryClient.writes)
+}
+
+func TestReconcileRecordsAuditEvents(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	pods := newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, pods)
+	k8sClient := cluster.build(t)
+	entryClient := newEntryClient(spireapi.Entry{
+		ID:        "old",
+		ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+		SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/old/pod-0-0"),
+		Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+	})
+	sink := &auditSink{}
+	r := newTestEntryReconciler(k8sClient, entryClient)
+	r.config.Auditor = audit.NewRecorder(sink)
+
+	// Closing the recorder writes out the events recorded by the reconcile.
+	r.reconcile(context.Background())
+	require.NoError(t, r.config.Auditor.Close())
+	events := sink.take()
+
+	// Entries are listed in full so that the events record them as they
+	// were.
+	assert.Equal(t, [][]spireapi.Field{nil}, entryClient.listOutputMasks)
+	require.Len(t, events, 2)
+
+	created := events[0]
+	assert.Equal(t, audit.ActionCreate, created.Action)
+	assert.Equal(t, audit.KindEntry, created.Kind)
+	assert.Nil(t, created.Before)
+	require.IsType(t, &audit.Entry{}, created.After)
+	assert.Equal(t, "00000001", created.After.(*audit.Entry).ID)
+	assert.Equal(t, "spiffe://example.org/ns/ns-0/pod/pod-0-0", created.After.(*audit.Entry).SPIFFEID)
+	assert.Equal(t, &audit.Object{Kind: "ClusterSPIFFEID", Name: "pods", UID: pods.UID}, created.Source)
+	assert.Equal(t, &audit.Object{Kind: "Pod", Namespace: "ns-0", Name: "pod-0-0", UID: "pod-uid-0-0"}, created.Pod)
+	assert.Equal(t, audit.Result{Code: "OK"}, created.Result)
+	assert.False(t, created.Time.IsZero())
+
+	deleted := events[1]
+	assert.Equal(t, audit.ActionDelete, deleted.Action)
+	require.IsType(t, &audit.Entry{}, deleted.Before)
+	assert.Equal(t, "old", deleted.Before.(*audit.Entry).ID)
+	assert.Nil(t, deleted.After)
+	assert.Nil(t, deleted.Source)
+	assert.Equal(t, audit.Result{Code: "OK"}, deleted.Result)
+
+	// Updates record the entry before and after, and the fields changed.
+	require.NoError(t, k8sClient.Get(context.Background(), client.ObjectKeyFromObject(pods), pods))
+	pods.Spec.TTL = metav1.Duration{Duration: time.Hour}
+	pods.Generation++ // the fake client does not bump the generation
+	require.NoError(t, k8sClient.Update(context.Background(), pods))
+	r.config.Auditor = audit.NewRecorder(sink)
+	r.reconcile(context.Background())
+	require.NoError(t, r.config.Auditor.Close())
+	events = sink.take()
+	require.Len(t, events, 1)
+
+	updated := events[0]
+	assert.Equal(t, audit.ActionUpdate, updated.Action)
+	assert.Equal(t, "", updated.Before.(*audit.Entry).X509SVIDTTL)
+	assert.Equal(t, "1h0m0s", updated.After.(*audit.Entry).X509SVIDTTL)
+	assert.Equal(t, []string{string(spireapi.X509SVIDTTL)}, updated.ChangedFields)
+	assert.Equal(t, &audit.Object{Kind: "ClusterSPIFFEID", Name: "pods", UID: pods.UID}, updated.Source)
+	assert.Equal(t, audit.Result{Code: "OK"}, updated.Result)
+}
+
+func TestReconcileEnforcesClusterSPIFFEIDPolicies(t *testing.T) {
+	cluster := newTestCluster(2, 1, 1)
+	pods := newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+	fallback := newTestClusterSPIFFEID("fallback", "spiffe://example.org/allowed/{{ .PodMeta.Name }}", true)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, pods, fallback)
+	k8sClient := cluster.build(t)
+	require.NoError(t, k8sClient.Create(context.Background(), &spirev1alpha1.ClusterSPIFFEIDPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allowed"},
+		Spec: spirev1alpha1.ClusterSPIFFEIDPolicySpec{
+			NamespaceSelector:    &metav1.LabelSelector{MatchLabels: map[string]string{"index": "0"}},
+			SPIFFEIDPathPatterns: []string{"/allowed/.+"},
+		},
+	}))
+	entryClient := newEntryClient()
+	r := newTestEntryReconciler(k8sClient, entryClient)
+
+	r.reconcile(context.Background())
+
+	// The pod in the namespace the policy applies to falls back to the
+	// entry that satisfies it.
+	var spiffeIDs []string
+	for _, entry := range entryClient.getEntries() {
+		spiffeIDs = append(spiffeIDs, entry.SPIFFEID.String())
+	}
+	sort.Strings(spiffeIDs)
+	assert.Equal(t, []string{
+		"spiffe://example.org/allowed/pod-0-0",
+		"spiffe://example.org/ns/ns-1/pod/pod-1-0",
+	}, spiffeIDs)
+
+	require.NoError(t, k8sClient.Get(context.Background(), client.ObjectKeyFromObject(pods), pods))
+	assert.Equal(t, 1, pods.Status.Stats.PodEntryPolicyViolations)
+	assert.Equal(t, []spirev1alpha1.ClusterSPIFFEIDPolicyViolation{
+		{Policy: "allowed", Reason: "SPIFFE ID path does not match any allowed pattern", Pods: 1},
+	}, pods.Status.PolicyViolations)
+}
+
+func TestReconcileLiveConfig(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	entryClient := newEntryClient()
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	live := liveconfig.New(liveconfig.Config{
+		IgnoreNamespaces: []*regexp.Regexp{regexp.MustCompile("ns-0")},
+		GCInterval:       time.Hour,
+	})
+	r.config.LiveConfig = live
+
+	r.reconcile(context.Background())
+	assert.Empty(t, entryClient.writes)
+
+	live.Store(liveconfig.Config{GCInterval: time.Hour})
+	r.reconcile(context.Background())
+	require.Equal(t, []string{"create 00000001"}, entryClient.writes)
+
+	// A new parent ID template re-renders the entries.
+	entryClient.writes = nil
+	live.Store(liveconfig.Config{
+		ParentIDTemplate: template.Must(template.New("").Parse("spiffe://{{ .TrustDomain }}/node/{{ .NodeMeta.Name }}")),
+		GCInterval:       time.Hour,
+	})
+	r.reconcile(context.Background())
+	require.Equal(t, []string{"create 00000002", "delete 00000001"}, entryClient.writes)
+
+	entryClient.writes = nil
+	live.Store(liveconfig.Config{ClassName: "other", GCInterval: time.Hour})
+	r.reconcile(context.Background())
+	require.Equal(t, []string{"delete 00000002"}, entryClient.writes)
+}
+
+func TestReconcileTrustDomainProfiles(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	main := newTestClusterSPIFFEID("main", "spiffe://example.org/pod/{{ .PodMeta.Name }}", false)
+	other := newTestClusterSPIFFEID("other", "spiffe://other.example.org/pod/{{ .PodMeta.Name }}", false)
+	other.Spec.TrustDomainProfile = "other"
+	unknown := newTestClusterSPIFFEID("unknown", "spiffe://unknown.example.org/pod/{{ .PodMeta.Name }}", false)
+	unknown.Spec.TrustDomainProfile = "unknown"
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, main, other, unknown)
+	k8sClient := cluster.build(t)
+
+	mainEntryClient := newEntryClient()
+	mainReconciler := newTestEntryReconciler(k8sClient, mainEntryClient)
+	mainReconciler.config.TrustDomainProfiles = []string{"other"}
+	otherEntryClient := newEntryClient()
+	otherReconciler := newTestEntryReconciler(k8sClient, otherEntryClient)
+	otherReconciler.config.TrustDomain = spiffeid.RequireTrustDomainFromString("other.example.org")
+	otherReconciler.config.TrustDomainProfile = "other"
+	otherReconciler.config.TrustDomainProfiles = []string{"other"}
+
+	// Each reconciler only declares the entries of the ClusterSPIFFEIDs
+	// targeting its profile, and only manages the entries on its server.
+	mainReconciler.reconcile(context.Background())
+	otherReconciler.reconcile(context.Background())
+	require.Len(t, mainEntryClient.getEntries(), 1)
+	assert.Equal(t, "spiffe://example.org/pod/pod-0-0", mainEntryClient.getEntries()[0].SPIFFEID.String())
+	assert.Equal(t, "spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0", mainEntryClient.getEntries()[0].ParentID.String())
+	require.Len(t, otherEntryClient.getEntries(), 1)
+	assert.Equal(t, "spiffe://other.example.org/pod/pod-0-0", otherEntryClient.getEntries()[0].SPIFFEID.String())
+	assert.Equal(t, "spiffe://other.example.org/spire/agent/k8s_psat/test/node-uid-0", otherEntryClient.getEntries()[0].ParentID.String())
+
+	// Neither reconciler updates the status of the other's objects. The
+	// status of objects targeting a profile that is not configured says so.
+	for _, clusterSPIFFEID := range []*spirev1alpha1.ClusterSPIFFEID{main, other, unknown} {
+		require.NoError(t, k8sClient.Get(context.Background(), client.ObjectKeyFromObject(clusterSPIFFEID), clusterSPIFFEID))
+	}
+	assert.Equal(t, 1, main.Status.Stats.EntriesToSet)
+	assert.Empty(t, main.Status.UnconfiguredTrustDomainProfile)
+	assert.Equal(t, 1, other.Status.Stats.EntriesToSet)
+	assert.Empty(t, other.Status.UnconfiguredTrustDomainProfile)
+	assert.Zero(t, unknown.Status.Stats)
+	assert.Equal(t, "unknown", unknown.Status.UnconfiguredTrustDomainProfile)
+
+	// Once the profile is configured, the status is cleared by the
+	// reconciler of the profile.
+	unknownEntryClient := newEntryClient()
+	unknownReconciler := newTestEntryReconciler(k8sClient, unknownEntryClient)
+	unknownReconciler.config.TrustDomain = spiffeid.RequireTrustDomainFromString("unknown.example.org")
+	unknownReconciler.config.TrustDomainProfile = "unknown"
+	unknownReconciler.config.TrustDomainProfiles = []string{"other", "unknown"}
+	unknownReconciler.reconcile(context.Background())
+	require.NoError(t, k8sClient.Get(context.Background(), client.ObjectKeyFromObject(unknown), unknown))
+	assert.Equal(t, 1, unknown.Status.Stats.EntriesToSet)
+	assert.Empty(t, unknown.Status.UnconfiguredTrustDomainProfile)
+}
+
+func TestReconcileTracing(t *testing.T) {
+	cluster := newTestCluster(2, 2, 1)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	entryClient := newEntryClient()
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	r.config.GCInterval = time.Hour
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	var seen int
+	spansByName := func() map[string][]attribute.KeyValue {
+		ended := recorder.Ended()
+		spans := make(map[string][]attribute.KeyValue)
+		for _, span := range ended[seen:] {
+			spans[span.Name()] = span.Attributes()
+		}
+		seen = len(ended)
+		return spans
+	}
+
+	// The first reconcile lists every entry from the server.
+	r.reconcile(context.Background())
+	spans := spansByName()
+	assert.Equal(t, []attribute.KeyValue{countKey.Int(1)}, spans["spireentry.ListClusterSPIFFEIDs"])
+	assert.Equal(t, []attribute.KeyValue{
+		clusterSPIFFEIDKey.String("pods"),
+		fallbackKey.Bool(false),
+		namespacesSelectedKey.Int(2),
+		namespacesIgnoredKey.Int(0),
+		podsSelectedKey.Int(4),
+		renderFailuresKey.Int(0),
+	}, spans["spireentry.RenderClusterSPIFFEID"])
+	assert.Equal(t, []attribute.KeyValue{
+		cachedKey.Bool(false),
+		fullListKey.Bool(true),
+		countKey.Int(0),
+	}, spans["spireentry.ListEntries"])
+
+	// The next reconcile is served from the cache.
+	r.reconcile(context.Background())
+	spans = spansByName()
+	assert.Equal(t, []attribute.KeyValue{
+		cachedKey.Bool(true),
+		countKey.Int(4),
+	}, spans["spireentry.ListEntries"])
+}
+
+func TestGetOutdatedEntryFields(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("domain.test")
+	oldEntry := spireapi.Entry{
+		X509SVIDTTL:   time.Minute,
+		JWTSVIDTTL:    time.Minute,
+		FederatesWith: []spiffeid.TrustDomain{td},
+		DNSNames:      []string{"a", "b"},
+		Hint:          "old",
+	}
+
+	t.Run("no fields outdated", func(t *testing.T) {
+		newEntry := oldEntry
+		newEntry.DNSNames = []string{"b", "a"}
+		assert.Empty(t, getOutdatedEntryFields(newEntry, oldEntry, nil))
+	})
+
+	t.Run("all fields outdated", func(t *testing.T) {
+		newEntry := spireapi.Entry{Admin: true, Downstream: true, StoreSVID: true}
+		assert.Equal(t, []spireapi.Field{
+			spireapi.X509SVIDTTL,
+			spireapi.JWTSVIDTTLField,
+			spireapi.FederatesWithField,
+			spireapi.AdminField,
+			spireapi.DownstreamField,
+			spireapi.DNSNamesField,
+			spireapi.HintField,
+			spireapi.StoreSVIDField,
+		}, getOutdatedEntryFields(newEntry, oldEntry, nil))
+	})
+
+	t.Run("unsupported fields are omitted", func(t *testing.T) {
+		newEntry := spireapi.Entry{Admin: true}
+		assert.Equal(t, []spireapi.Field{
+			spireapi.FederatesWithField,
+			spireapi.AdminField,
+			spireapi.DNSNamesField,
+		}, getOutdatedEntryFields(newEntry, oldEntry, map[spireapi.Field]struct{}{
+			spireapi.X509SVIDTTL:     {},
+			spireapi.JWTSVIDTTLField: {},
+			spireapi.HintField:       {},
+		}))
+	})
+}
+
+func TestReconcileUpdatesOnlyOutdatedFields(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	clusterSPIFFEID := newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+	clusterSPIFFEID.Spec.Hint = "new"
+	clusterSPIFFEID.Spec.TTL = metav1.Duration{Duration: time.Hour}
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, clusterSPIFFEID)
+
+	existing := spireapi.Entry{
+		ID:          "existing",
+		ParentID:    spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+		SPIFFEID:    spiffeid.RequireFromString("spiffe://example.org/ns/ns-0/pod/pod-0-0"),
+		Selectors:   []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+		X509SVIDTTL: time.Minute,
+		Hint:        "old",
+	}
+	entryClient := newEntryClient(existing)
+	entryClient.unsupportedFields = map[spireapi.Field]struct{}{
+		spireapi.HintField: {},
+	}
+
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	x509SVIDTTLUpdates := testutil.ToFloat64(r.promCounterVec[metrics.OutdatedEntryFields].WithLabelValues(string(spireapi.X509SVIDTTL)))
+	hintUpdates := testutil.ToFloat64(r.promCounterVec[metrics.OutdatedEntryFields].WithLabelValues(string(spireapi.HintField)))
+
+	r.reconcile(context.Background())
+
+	// The TTL is updated but the hint is left alone since it is not
+	// supported by the server.
+	expected := existing
+	expected.X509SVIDTTL = time.Hour
+	expected.RevisionNumber = 1
+	assert.Equal(t, []spireapi.Entry{expected}, entryClient.getEntries())
+	assert.Equal(t, x509SVIDTTLUpdates+1, testutil.ToFloat64(r.promCounterVec[metrics.OutdatedEntryFields].WithLabelValues(string(spireapi.X509SVIDTTL))))
+	assert.Equal(t, hintUpdates, testutil.ToFloat64(r.promCounterVec[metrics.OutdatedEntryFields].WithLabelValues(string(spireapi.HintField))))
+}
+
+func TestReconcileRetriesUpdateConflicts(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	clusterSPIFFEID := newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+	clusterSPIFFEID.Spec.TTL = metav1.Duration{Duration: time.Hour}
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, clusterSPIFFEID)
+	k8sClient := cluster.build(t)
+
+	existing := spireapi.Entry{
+		ID:             "existing",
+		ParentID:       spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+		SPIFFEID:       spiffeid.RequireFromString("spiffe://example.org/ns/ns-0/pod/pod-0-0"),
+		Selectors:      []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+		X509SVIDTTL:    time.Minute,
+		RevisionNumber: 5,
+	}
+
+	// concurrentWrite returns a beforeUpdate hook that applies the given
+	// change to the existing entry the first n times it is called.
+	concurrentWrite := func(n int, change func(*spireapi.Entry)) func(map[string]spireapi.Entry) {
+		return func(entries map[string]spireapi.Entry) {
+			if n == 0 {
+				return
+			}
+			n--
+			entry := entries[existing.ID]
+			change(&entry)
+			entry.RevisionNumber++
+			entries[existing.ID] = entry
+		}
+	}
+
+	t.Run("re-diffs and retries after conflict", func(t *testing.T) {
+		entryClient := newEntryClient(existing)
+		entryClient.beforeUpdate = concurrentWrite(1, func(entry *spireapi.Entry) {
+			entry.Hint = "other writer"
+		})
+		r := newTestEntryReconciler(k8sClient, entryClient)
+		r.config.CheckEntryRevisions = true
+		r.reconcile(context.Background())
+
+		// The re-diff picks up the concurrent change to the hint, which is
+		// reverted along with the TTL against the new revision.
+		expected := existing
+		expected.X509SVIDTTL = time.Hour
+		expected.RevisionNumber = 7
+		assert.Equal(t, []spireapi.Entry{expected}, entryClient.getEntries())
+		assert.Equal(t, 2, entryClient.updateCalls)
+	})
+
+	t.Run("skips retry when already up to date", func(t *testing.T) {
+		entryClient := newEntryClient(existing)
+		entryClient.beforeUpdate = concurrentWrite(1, func(entry *spireapi.Entry) {
+			entry.X509SVIDTTL = time.Hour
+		})
+		r := newTestEntryReconciler(k8sClient, entryClient)
+		r.config.CheckEntryRevisions = true
+		r.reconcile(context.Background())
+
+		expected := existing
+		expected.X509SVIDTTL = time.Hour
+		expected.RevisionNumber = 6
+		assert.Equal(t, []spireapi.Entry{expected}, entryClient.getEntries())
+		assert.Equal(t, 1, entryClient.updateCalls)
+	})
+
+	t.Run("gives up after second conflict", func(t *testing.T) {
+		entryClient := newEntryClient(existing)
+		entryClient.beforeUpdate = concurrentWrite(2, func(entry *spireapi.Entry) {
+			entry.Hint += "!"
+		})
+		r := newTestEntryReconciler(k8sClient, entryClient)
+		r.config.CheckEntryRevisions = true
+		r.reconcile(context.Background())
+
+		expected := existing
+		expected.Hint = "!!"
+		expected.RevisionNumber = 7
+		assert.Equal(t, []spireapi.Entry{expected}, entryClient.getEntries())
+		assert.Equal(t, 2, entryClient.updateCalls)
+	})
+
+	t.Run("skips retry when entry was deleted", func(t *testing.T) {
+		entryClient := newEntryClient(existing)
+		entryClient.beforeUpdate = func(entries map[string]spireapi.Entry) {
+			delete(entries, existing.ID)
+		}
+		r := newTestEntryReconciler(k8sClient, entryClient)
+		r.config.CheckEntryRevisions = true
+		r.reconcile(context.Background())
+
+		assert.Empty(t, entryClient.getEntries())
+		assert.Equal(t, 1, entryClient.updateCalls)
+	})
+
+	t.Run("updates regardless of revision unless checked", func(t *testing.T) {
+		entryClient := newEntryClient(existing)
+		entryClient.beforeUpdate = concurrentWrite(1, func(entry *spireapi.Entry) {
+			entry.Hint = "other writer"
+		})
+		r := newTestEntryReconciler(k8sClient, entryClient)
+		r.reconcile(context.Background())
+
+		// Only the outdated TTL is sent, so the concurrent change to the
+		// hint survives until the next reconcile reverts it.
+		expected := existing
+		expected.X509SVIDTTL = time.Hour
+		expected.Hint = "other writer"
+		expected.RevisionNumber = 7
+		assert.Equal(t, []spireapi.Entry{expected}, entryClient.getEntries())
+		assert.Equal(t, 1, entryClient.updateCalls)
+	})
+}
+
+type auditSink struct {
+	mtx    sync.Mutex
+	events []audit.Event
+}
+
+func (s *auditSink) Name() string {
+	return "test"
+}
+
+func (s *auditSink) Write(_ context.Context, events []audit.Event) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *auditSink) Close() error {
+	return nil
+}
+
+// take returns the events written since the last call.
+func (s *auditSink) take() []audit.Event {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+type entryClient struct {
+	mtx               sync.Mutex
+	entries           map[string]spireapi.Entry
+	nextID            int
+	unsupportedFields map[spireapi.Field]struct{}
+
+	// listFilters and listOutputMasks record the filter and output mask of
+	// each list call.
+	listFilters     []spireapi.EntryFilter
+	listOutputMasks [][]spireapi.Field
+
+	// beforeUpdate, if set, is called with the entries before each update
+	// call is applied, to simulate concurrent writers.
+	beforeUpdate func(entries map[string]spireapi.Entry)
+	updateCalls  int
+
+	// deleteErr, if set, fails every delete call.
+	deleteErr error
+
+	// writes records the IDs of the entries created and deleted, in order.
+	writes []string
+}
+
+func newEntryClient(entries ...spireapi.Entry) *entryClient {
+	c := &entryClient{entries: make(map[string]spireapi.Entry)}
+	for _, entry := range entries {
+		c.entries[entry.ID] = entry
+	}
+	return c
+}
+
+func (c *entryClient) ListEntries(ctx context.Context) ([]spireapi.Entry, error) {
+	return c.ListFilteredEntries(ctx, spireapi.EntryFilter{}, nil)
+}
+
+func (c *entryClient) ListFilteredEntries(_ context.Context, filter spireapi.EntryFilter, outputMask []spireapi.Field) ([]spireapi.Entry, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.listFilters = append(c.listFilters, filter)
+	c.listOutputMasks = append(c.listOutputMasks, outputMask)
+	entries := make([]spireapi.Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		if !filter.ByParentID.IsZero() && entry.ParentID != filter.ByParentID {
+			continue
+		}
+		if !filter.BySPIFFEID.IsZero() && entry.SPIFFEID != filter.BySPIFFEID {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+func (c *entryClient) CreateEntries(_ context.Context, entries []spireapi.Entry) ([]spireapi.EntryResult, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	results := make([]spireapi.EntryResult, 0, len(entries))
+entries:
+	for _, entry := range entries {
+		// SPIRE Server rejects an entry similar to an existing one.
+		for _, existing := range c.entries {
+			if makeEntryKey(existing) == makeEntryKey(entry) {
+				results = append(results, spireapi.EntryResult{Status: spireapi.Status{Code: codes.AlreadyExists}, Entry: existing})
+				continue entries
+			}
+		}
+		if entry.ID == "" {
+			c.nextID++
+			entry.ID = fmt.Sprintf("%08d", c.nextID)
+		}
+		c.entries[entry.ID] = entry
+		c.writes = append(c.writes, "create "+entry.ID)
+		results = append(results, spireapi.EntryResult{Status: spireapi.Status{Code: codes.OK}, Entry: entry})
+	}
+	return results, nil
+}
+
+func (c *entryClient) UpdateEntries(_ context.Context, updates []spireapi.EntryUpdate) ([]spireapi.EntryResult, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.updateCalls++
+	if c.beforeUpdate != nil {
+		c.beforeUpdate(c.entries)
+	}
+	results := make([]spireapi.EntryResult, 0, len(updates))
+	for _, update := range updates {
+		entry, ok := c.entries[update.Entry.ID]
+		if !ok {
+			results = append(results, spireapi.EntryResult{Status: spireapi.Status{Code: codes.NotFound}})
+			continue
+		}
+		if update.CheckRevision && update.Entry.RevisionNumber != entry.RevisionNumber {
+			results = append(results, spireapi.EntryResult{Status: spireapi.Status{Code: codes.Aborted}})
+			continue
+		}
+		if update.Fields == nil {
+			entry = update.Entry
+		}
+		for _, field := range update.Fields {
+			switch field {
+			case spireapi.X509SVIDTTL:
+				entry.X509SVIDTTL = update.Entry.X509SVIDTTL
+			case spireapi.JWTSVIDTTLField:
+				entry.JWTSVIDTTL = update.Entry.JWTSVIDTTL
+			case spireapi.FederatesWithField:
+				entry.FederatesWith = update.Entry.FederatesWith
+			case spireapi.AdminField:
+				entry.Admin = update.Entry.Admin
+			case spireapi.DownstreamField:
+				entry.Downstream = update.Entry.Downstream
+			case spireapi.DNSNamesField:
+				entry.DNSNames = update.Entry.DNSNames
+			case spireapi.HintField:
+				entry.Hint = update.Entry.Hint
+			case spireapi.StoreSVIDField:
+				entry.StoreSVID = update.Entry.StoreSVID
+			default:
+				return nil, fmt.Errorf("unexpected field %q", field)
+			}
+		}
+		entry.RevisionNumber++
+		c.entries[entry.ID] = entry
+		results = append(results, spireapi.EntryResult{Status: spireapi.Status{Code: codes.OK}, Entry: entry})
+	}
+	return results, nil
+}
+
+func (c *entryClient) GetEntry(_ context.Context, entryID string) (spireapi.Entry, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	entry, ok := c.entries[entryID]
+	if !ok {
+		return spireapi.Entry{}, status.Errorf(codes.NotFound, "entry %q not found", entryID)
+	}
+	return entry, nil
+}
+
+func (c *entryClient) DeleteEntries(_ context.Context, entryIDs []string) ([]spireapi.Status, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.deleteErr != nil {
+		return nil, c.deleteErr
+	}
+	statuses := make([]spireapi.Status, 0, len(entryIDs))
+	for _, id := range entryIDs {
+		if _, ok := c.entries[id]; !ok {
+			statuses = append(statuses, spireapi.Status{Code: codes.NotFound})
+			continue
+		}
+		delete(c.entries, id)
+		c.writes = append(c.writes, "delete "+id)
+		statuses = append(statuses, spireapi.Status{Code: codes.OK})
+	}
+	return statuses, nil
+}
+
+func (c *entryClient) GetUnsupportedFields(context.Context, string) (map[spireapi.Field]struct{}, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	unsupportedFields := make(map[spireapi.Field]struct{})
+	for field := range c.unsupportedFields {
+		unsupportedFields[field] = struct{}{}
+	}
+	return unsupportedFields, nil
+}
+
+func (c *entryClient) getEntries() []spireapi.Entry {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	entries := make([]spireapi.Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+func (c *entryClient) setEntry(entry spireapi.Entry) error {
+	results, err := c.CreateEntries(context.Background(), []spireapi.Entry{entry})
+	if err != nil {
+		return err
+	}
+	return results[0].Err()
+}
+
+func (c *entryClient) getListFilters() []spireapi.EntryFilter {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	filters := c.listFilters
+	c.listFilters = nil
+	return filters
+}
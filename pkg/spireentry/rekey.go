@@ -0,0 +1,94 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+// rekeyBatchSize is how many old entries are deleted at a time before their
+// replacements are created.
+const rekeyBatchSize = 50
+
+// rekey is a declared entry to be created with the new entry ID prefix in
+// place of an old entry with the cleanup prefix.
+type rekey struct {
+	declaredEntry
+	Old spireapi.Entry
+}
+
+// planRekeys splits the entries with the cleanup prefix into those to delete,
+// which no longer match a declared entry or duplicate another old entry, and
+// those to re-key, by key, so that their replacements can be created as
+// re-keys.
+func planRekeys(state entriesState, deleteOnlyEntries []spireapi.Entry) ([]spireapi.Entry, map[entryKey]spireapi.Entry) {
+	var toDelete []spireapi.Entry
+	toRekey := make(map[entryKey]spireapi.Entry)
+	for _, entry := range deleteOnlyEntries {
+		key := makeEntryKey(entry)
+		s, ok := state[key]
+		if _, dup := toRekey[key]; !ok || len(s.Declared) == 0 || len(s.Current) > 0 || dup {
+			toDelete = append(toDelete, entry)
+			continue
+		}
+		toRekey[key] = entry
+	}
+	return toDelete, toRekey
+}
+
+// rekeyEntries replaces the old entries with their replacements. SPIRE
+// Server rejects an entry that has the same parent ID, SPIFFE ID and
+// selectors as an existing one, so the replacement cannot be created until
+// the old entry is gone. Instead of deleting every old entry before creating
+// any replacement, old entries are deleted a batch at a time, with their
+// replacements created straight after, keeping the window without an entry
+// as short as possible. This is not free of downtime: agents that sync in
+// between drop the entry until their next sync. A replacement is only
+// created once its old entry has been deleted; the others are retried by
+// the next reconcile, as are replacements that fail to be created, whose
+// workloads have no entry until then.
+func (r *entryReconciler) rekeyEntries(ctx context.Context, rekeys []rekey) {
+	log := log.FromContext(ctx)
+
+	for start := 0; start < len(rekeys); start += rekeyBatchSize {
+		batch := rekeys[start:min(start+rekeyBatchSize, len(rekeys))]
+
+		toDelete := make([]spireapi.Entry, 0, len(batch))
+		for _, rekey := range batch {
+			toDelete = append(toDelete, rekey.Old)
+		}
+		deleted := r.deleteEntries(ctx, toDelete)
+
+		var toCreate []declaredEntry
+		for _, rekey := range batch {
+			if _, ok := deleted[rekey.Old.ID]; ok {
+				log.Info("Re-keying entry", append(entryLogFields(rekey.Entry), "old", rekey.Old.ID)...)
+				toCreate = append(toCreate, rekey.declaredEntry)
+			}
+		}
+		if len(toCreate) == 0 {
+			continue
+		}
+		created := r.createEntries(ctx, toCreate)
+		r.promCounter[metrics.EntryIDPrefixRekeys].Add(float64(created))
+	}
+}
@@ -0,0 +1,97 @@
+package spireentry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+func TestReconcileRekeysEntries(t *testing.T) {
+	for _, test := range []struct {
+		name                  string
+		listEntriesByParentID bool
+	}{
+		{name: "full list"},
+		{name: "list by parent ID", listEntriesByParentID: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := newTestCluster(1, 1, 1)
+			cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+				newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+			)
+			entryClient := newEntryClient(
+				spireapi.Entry{
+					ID:        "old.declared",
+					ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+					SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/ns/ns-0/pod/pod-0-0"),
+					Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+				},
+				spireapi.Entry{
+					ID:        "old.undeclared",
+					ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+					SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/gone"),
+					Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:gone"}},
+				},
+			)
+			cleanup := "old."
+			r := newTestEntryReconciler(cluster.build(t), entryClient)
+			r.config.EntryIDPrefix = "new."
+			r.config.EntryIDPrefixCleanup = &cleanup
+			if test.listEntriesByParentID {
+				// The cache is invalid, so only the declared parent IDs are
+				// listed until the next full list.
+				r.config.ListEntriesByParentID = true
+				r.nextFullEntryList = time.Now().Add(time.Hour)
+			}
+			rekeys := testutil.ToFloat64(r.promCounter[metrics.EntryIDPrefixRekeys])
+
+			r.reconcile(context.Background())
+
+			// The old entry that is no longer declared is deleted, and the
+			// other is deleted just before its replacement is created.
+			var writes []string
+			for _, write := range entryClient.writes {
+				if strings.HasPrefix(write, "create new.") {
+					write = "create new.*"
+				}
+				writes = append(writes, write)
+			}
+			assert.Equal(t, []string{"delete old.undeclared", "delete old.declared", "create new.*"}, writes)
+			assert.Equal(t, rekeys+1, testutil.ToFloat64(r.promCounter[metrics.EntryIDPrefixRekeys]))
+			if test.listEntriesByParentID {
+				assert.False(t, entryClient.getListFilters()[0].ByParentID.IsZero())
+			}
+		})
+	}
+}
+
+func TestReconcileRekeyKeepsEntryWhenDeleteFails(t *testing.T) {
+	cluster := newTestCluster(1, 1, 1)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+	entryClient := newEntryClient(spireapi.Entry{
+		ID:        "old.declared",
+		ParentID:  spiffeid.RequireFromString("spiffe://example.org/spire/agent/k8s_psat/test/node-uid-0"),
+		SPIFFEID:  spiffeid.RequireFromString("spiffe://example.org/ns/ns-0/pod/pod-0-0"),
+		Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:pod-uid-0-0"}},
+	})
+	entryClient.deleteErr = errors.New("oh no")
+	cleanup := "old."
+	r := newTestEntryReconciler(cluster.build(t), entryClient)
+	r.config.EntryIDPrefix = "new."
+	r.config.EntryIDPrefixCleanup = &cleanup
+
+	// The replacement is not attempted while the old entry exists.
+	r.reconcile(context.Background())
+	assert.Empty(t, entryClient.writes)
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/k8sapi"
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
+	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+// RenderInput holds the objects that entries are rendered from offline.
+type RenderInput struct {
+	ClusterSPIFFEIDs        []spirev1alpha1.ClusterSPIFFEID
+	ClusterStaticEntries    []spirev1alpha1.ClusterStaticEntry
+	ClusterSPIFFEIDPolicies []spirev1alpha1.ClusterSPIFFEIDPolicy
+	Namespaces              []corev1.Namespace
+	Pods                    []corev1.Pod
+	Nodes                   []corev1.Node
+	Endpoints               []corev1.Endpoints
+}
+
+// RenderResult is the outcome of rendering entries offline.
+type RenderResult struct {
+	// Entries are the declared entries, sorted by SPIFFE ID, parent ID and
+	// then by the object that declared them. Entries that are masked by an
+	// equivalent entry from another object are included.
+	Entries []RenderedEntry
+
+	// ClusterSPIFFEIDStatuses are the statuses the ClusterSPIFFEIDs would
+	// have, keyed by name.
+	ClusterSPIFFEIDStatuses map[string]spirev1alpha1.ClusterSPIFFEIDStatus
+
+	// ClusterStaticEntryStatuses are the statuses the ClusterStaticEntries
+	// would have, keyed by name. Set is never true since nothing is written
+	// to SPIRE.
+	ClusterStaticEntryStatuses map[string]spirev1alpha1.ClusterStaticEntryStatus
+}
+
+// RenderedEntry is an entry declared by a ClusterSPIFFEID or
+// ClusterStaticEntry.
+type RenderedEntry struct {
+	Entry spireapi.Entry
+
+	// DeclaredBy is the object that declared the entry.
+	DeclaredBy ObjectRef
+
+	// MaskedBy, if set, is the object whose equivalent entry is preferred
+	// over this one. Masked entries are not written to SPIRE.
+	MaskedBy *ObjectRef
+}
+
+// ObjectRef identifies a cluster-scoped object by kind and name.
+type ObjectRef struct {
+	Kind string
+	Name string
+}
+
+func (ref ObjectRef) String() string {
+	return ref.Kind + "/" + ref.Name
+}
+
+// Render renders the entries declared by the ClusterSPIFFEIDs and
+// ClusterStaticEntries in the input against the namespaces, pods, nodes and
+// endpoints in the input, exactly as the reconciler would, without talking
+// to Kubernetes or SPIRE. The EntryClient and K8sClient in the config are
+// ignored.
+//
+// Manifests written by hand usually lack UIDs. Objects without one are
+// given a UID derived from their name so that the rendered pod-uid
+// selectors and parent IDs are stable, and pod references in endpoints
+// without a UID are resolved to the pod they name.
+func Render(ctx context.Context, config ReconcilerConfig, input RenderInput) (*RenderResult, error) {
+	config.EntryClient = nil
+	r, err := newOfflineReconciler(config, input)
+	if err != nil {
+		return nil, err
+	}
+	state, clusterStaticEntries, clusterSPIFFEIDs, err := r.declareEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RenderResult{
+		ClusterSPIFFEIDStatuses:    make(map[string]spirev1alpha1.ClusterSPIFFEIDStatus),
+		ClusterStaticEntryStatuses: make(map[string]spirev1alpha1.ClusterStaticEntryStatus),
+	}
+	for _, s := range state {
+		sortDeclaredEntriesByPreference(s.Declared)
+		if len(s.Declared) == 0 {
+			continue
+		}
+		preferredEntry := s.Declared[0]
+		preferredEntry.By.IncrementEntriesToSet()
+		preferredBy := objectRef(preferredEntry.By)
+		result.Entries = append(result.Entries, RenderedEntry{
+			Entry:      preferredEntry.Entry,
+			DeclaredBy: preferredBy,
+		})
+		for _, otherEntry := range s.Declared[1:] {
+			otherEntry.By.IncrementEntriesMasked()
+			result.Entries = append(result.Entries, RenderedEntry{
+				Entry:      otherEntry.Entry,
+				DeclaredBy: objectRef(otherEntry.By),
+				MaskedBy:   &preferredBy,
+			})
+		}
+	}
+	sort.Slice(result.Entries, func(i, j int) bool {
+		a, b := result.Entries[i], result.Entries[j]
+		switch {
+		case a.Entry.SPIFFEID != b.Entry.SPIFFEID:
+			return a.Entry.SPIFFEID.String() < b.Entry.SPIFFEID.String()
+		case a.Entry.ParentID != b.Entry.ParentID:
+			return a.Entry.ParentID.String() < b.Entry.ParentID.String()
+		default:
+			return a.DeclaredBy.String() < b.DeclaredBy.String()
+		}
+	})
+
+	for _, clusterSPIFFEID := range clusterSPIFFEIDs {
+		result.ClusterSPIFFEIDStatuses[clusterSPIFFEID.Name] = clusterSPIFFEID.NextStatus
+	}
+	for _, clusterStaticEntry := range clusterStaticEntries {
+		result.ClusterStaticEntryStatuses[clusterStaticEntry.Name] = clusterStaticEntry.NextStatus
+	}
+	return result, nil
+}
+
+// ListRenderInput lists the objects entries are rendered from in the
+// cluster.
+func ListRenderInput(ctx context.Context, c client.Client) (RenderInput, error) {
+	var input RenderInput
+	var err error
+	if input.ClusterSPIFFEIDs, err = k8sapi.ListClusterSPIFFEIDs(ctx, c); err != nil {
+		return input, fmt.Errorf("failed to list ClusterSPIFFEIDs: %w", err)
+	}
+	if input.ClusterStaticEntries, err = k8sapi.ListClusterStaticEntries(ctx, c); err != nil {
+		return input, fmt.Errorf("failed to list ClusterStaticEntries: %w", err)
+	}
+	if input.ClusterSPIFFEIDPolicies, err = k8sapi.ListClusterSPIFFEIDPolicies(ctx, c); err != nil {
+		return input, fmt.Errorf("failed to list ClusterSPIFFEIDPolicies: %w", err)
+	}
+	if input.Namespaces, err = k8sapi.ListNamespaces(ctx, c, nil); err != nil {
+		return input, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	if input.Pods, err = k8sapi.ListPods(ctx, c); err != nil {
+		return input, fmt.Errorf("failed to list pods: %w", err)
+	}
+	if input.Nodes, err = k8sapi.ListNodes(ctx, c); err != nil {
+		return input, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	endpointsList := new(corev1.EndpointsList)
+	if err := c.List(ctx, endpointsList); err != nil {
+		return input, fmt.Errorf("failed to list endpoints: %w", err)
+	}
+	input.Endpoints = endpointsList.Items
+	return input, nil
+}
+
+// newOfflineReconciler returns an entry reconciler that reads the input
+// objects from an in-memory client, indexed the same way as the manager's
+// cache.
+func newOfflineReconciler(config ReconcilerConfig, input RenderInput) (*entryReconciler, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := spirev1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	objs, err := renderInputObjects(input)
+	if err != nil {
+		return nil, err
+	}
+	config.K8sClient = fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithIndex(&corev1.Endpoints{}, reconciler.EndpointUID, func(obj client.Object) []string {
+			return reconciler.EndpointPodUIDs(obj.(*corev1.Endpoints))
+		}).
+		Build()
+
+	return &entryReconciler{
+		config:         config,
+		promCounter:    metrics.PromCounters,
+		promCounterVec: metrics.PromCounterVecs,
+		promGauge:      profileGauges(config.TrustDomainProfile),
+	}, nil
+}
+
+// renderInputObjects returns copies of the input objects, with UIDs filled
+// in where they are missing.
+func renderInputObjects(input RenderInput) ([]client.Object, error) {
+	var objs []client.Object
+	for i := range input.ClusterSPIFFEIDs {
+		obj := input.ClusterSPIFFEIDs[i].DeepCopy()
+		defaultUID(obj, obj.Name)
+		objs = append(objs, obj)
+	}
+	for i := range input.ClusterStaticEntries {
+		obj := input.ClusterStaticEntries[i].DeepCopy()
+		defaultUID(obj, obj.Name)
+		objs = append(objs, obj)
+	}
+	for i := range input.ClusterSPIFFEIDPolicies {
+		obj := input.ClusterSPIFFEIDPolicies[i].DeepCopy()
+		defaultUID(obj, obj.Name)
+		objs = append(objs, obj)
+	}
+	for i := range input.Namespaces {
+		obj := input.Namespaces[i].DeepCopy()
+		defaultUID(obj, obj.Name)
+		objs = append(objs, obj)
+	}
+	for i := range input.Nodes {
+		obj := input.Nodes[i].DeepCopy()
+		defaultUID(obj, obj.Name)
+		objs = append(objs, obj)
+	}
+	podUIDs := make(map[types.NamespacedName]types.UID, len(input.Pods))
+	for i := range input.Pods {
+		obj := input.Pods[i].DeepCopy()
+		defaultUID(obj, obj.Namespace+"/"+obj.Name)
+		podUIDs[types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}] = obj.UID
+		objs = append(objs, obj)
+	}
+	for i := range input.Endpoints {
+		obj := input.Endpoints[i].DeepCopy()
+		defaultUID(obj, obj.Namespace+"/"+obj.Name)
+		for j := range obj.Subsets {
+			if err := resolvePodRefs(obj, obj.Subsets[j].Addresses, podUIDs); err != nil {
+				return nil, err
+			}
+			if err := resolvePodRefs(obj, obj.Subsets[j].NotReadyAddresses, podUIDs); err != nil {
+				return nil, err
+			}
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+func resolvePodRefs(endpoints *corev1.Endpoints, addresses []corev1.EndpointAddress, podUIDs map[types.NamespacedName]types.UID) error {
+	for _, address := range addresses {
+		ref := address.TargetRef
+		if ref == nil || ref.Kind != "Pod" || ref.UID != "" {
+			continue
+		}
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = endpoints.Namespace
+		}
+		uid, ok := podUIDs[types.NamespacedName{Namespace: namespace, Name: ref.Name}]
+		if !ok {
+			return fmt.Errorf("endpoints %s/%s reference pod %s/%s which was not provided", endpoints.Namespace, endpoints.Name, namespace, ref.Name)
+		}
+		ref.UID = uid
+	}
+	return nil
+}
+
+func defaultUID(obj client.Object, uid string) {
+	if obj.GetUID() == "" {
+		obj.SetUID(types.UID(uid))
+	}
+}
+
+func objectRef(by byObject) ObjectRef {
+	switch by := by.(type) {
+	case *ClusterSPIFFEID:
+		return ObjectRef{Kind: "ClusterSPIFFEID", Name: by.Name}
+	case *ClusterStaticEntry:
+		return ObjectRef{Kind: "ClusterStaticEntry", Name: by.Name}
+	default:
+		return ObjectRef{Kind: fmt.Sprintf("%T", by)}
+	}
+}
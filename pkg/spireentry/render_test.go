@@ -0,0 +1,142 @@
+package spireentry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRender(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString(trustDomain)
+	input := RenderInput{
+		ClusterSPIFFEIDs: []spirev1alpha1.ClusterSPIFFEID{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "a"},
+				Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+					SPIFFEIDTemplate:     "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}",
+					AutoPopulateDNSNames: true,
+				},
+			},
+			{
+				// Declares the same entry as "a", which is preferred since
+				// it sorts first.
+				ObjectMeta: metav1.ObjectMeta{Name: "b"},
+				Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+					SPIFFEIDTemplate:     "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}",
+					AutoPopulateDNSNames: true,
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "broken"},
+				Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+					SPIFFEIDTemplate: "spiffe://other.org/{{ .PodMeta.Name }}",
+				},
+			},
+		},
+		ClusterStaticEntries: []spirev1alpha1.ClusterStaticEntry{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "static"},
+				Spec: spirev1alpha1.ClusterStaticEntrySpec{
+					SPIFFEID:  "spiffe://example.org/static",
+					ParentID:  "spiffe://example.org/parent",
+					Selectors: []string{"unix:uid:1000"},
+				},
+			},
+		},
+		Namespaces: []corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "workload"}},
+		},
+		Nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node"}},
+		},
+		Pods: []corev1.Pod{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: "pod"},
+				Spec:       corev1.PodSpec{NodeName: "node", ServiceAccountName: "sa"},
+			},
+		},
+		Endpoints: []corev1.Endpoints{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: "service"},
+				Subsets: []corev1.EndpointSubset{{
+					Addresses: []corev1.EndpointAddress{{
+						TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "pod"},
+					}},
+				}},
+			},
+		},
+	}
+
+	result, err := Render(context.Background(), ReconcilerConfig{
+		TrustDomain:    td,
+		ClusterName:    clusterName,
+		ClusterDomain:  clusterDomain,
+		WatchClassless: true,
+		Reconcile: spirev1alpha1.ReconcileConfig{
+			ClusterSPIFFEIDs:     true,
+			ClusterStaticEntries: true,
+		},
+	}, input)
+	require.NoError(t, err)
+
+	podEntry := spireapi.Entry{
+		SPIFFEID:      spiffeid.RequireFromString("spiffe://example.org/ns/workload/sa/sa"),
+		ParentID:      spiffeid.RequireFromPathf(td, "/spire/agent/k8s_psat/%s/node", clusterName),
+		Selectors:     []spireapi.Selector{{Type: "k8s", Value: "pod-uid:workload/pod"}},
+		FederatesWith: []spiffeid.TrustDomain{},
+		DNSNames: []string{
+			"service",
+			"service.workload",
+			"service.workload.svc",
+			"service.workload.svc." + clusterDomain,
+		},
+	}
+	assert.Equal(t, []RenderedEntry{
+		{
+			Entry:      podEntry,
+			DeclaredBy: ObjectRef{Kind: "ClusterSPIFFEID", Name: "a"},
+		},
+		{
+			Entry:      podEntry,
+			DeclaredBy: ObjectRef{Kind: "ClusterSPIFFEID", Name: "b"},
+			MaskedBy:   &ObjectRef{Kind: "ClusterSPIFFEID", Name: "a"},
+		},
+		{
+			Entry: spireapi.Entry{
+				SPIFFEID:      spiffeid.RequireFromString("spiffe://example.org/static"),
+				ParentID:      spiffeid.RequireFromString("spiffe://example.org/parent"),
+				Selectors:     []spireapi.Selector{{Type: "unix", Value: "uid:1000"}},
+				FederatesWith: []spiffeid.TrustDomain{},
+			},
+			DeclaredBy: ObjectRef{Kind: "ClusterStaticEntry", Name: "static"},
+		},
+	}, result.Entries)
+
+	assert.Equal(t, 1, result.ClusterSPIFFEIDStatuses["a"].Stats.EntriesToSet)
+	assert.Equal(t, 1, result.ClusterSPIFFEIDStatuses["b"].Stats.EntriesMasked)
+	assert.Equal(t, 1, result.ClusterSPIFFEIDStatuses["broken"].Stats.PodEntryRenderFailures)
+	assert.Equal(t, spirev1alpha1.ClusterStaticEntryStatus{Rendered: true}, result.ClusterStaticEntryStatuses["static"])
+}
+
+func TestRenderRejectsUnknownEndpointsPod(t *testing.T) {
+	_, err := Render(context.Background(), ReconcilerConfig{}, RenderInput{
+		Endpoints: []corev1.Endpoints{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "workload", Name: "service"},
+				Subsets: []corev1.EndpointSubset{{
+					Addresses: []corev1.EndpointAddress{{
+						TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "missing"},
+					}},
+				}},
+			},
+		},
+	})
+	require.EqualError(t, err, "endpoints workload/service reference pod workload/missing which was not provided")
+}
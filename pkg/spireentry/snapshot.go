@@ -0,0 +1,120 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/spiffe/spire-controller-manager/pkg/k8sapi"
+)
+
+// k8sSnapshot is an indexed, point-in-time view of the namespaces, pods and
+// nodes in the cluster. It is built once per reconcile so that the selectors
+// of every ClusterSPIFFEID can be evaluated against it without repeatedly
+// listing (and deep copying) objects out of the controller cache.
+type k8sSnapshot struct {
+	namespaces      []*corev1.Namespace
+	podsByNamespace map[string][]*corev1.Pod
+	nodesByName     map[string]*corev1.Node
+}
+
+func loadK8sSnapshot(ctx context.Context, c client.Client) (*k8sSnapshot, error) {
+	namespaces, err := k8sapi.ListNamespaces(ctx, c, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	pods, err := k8sapi.ListPods(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	nodes, err := k8sapi.ListNodes(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return newK8sSnapshot(namespaces, pods, nodes), nil
+}
+
+func newK8sSnapshot(namespaces []corev1.Namespace, pods []corev1.Pod, nodes []corev1.Node) *k8sSnapshot {
+	s := &k8sSnapshot{
+		namespaces:      make([]*corev1.Namespace, 0, len(namespaces)),
+		podsByNamespace: make(map[string][]*corev1.Pod, len(namespaces)),
+		nodesByName:     make(map[string]*corev1.Node, len(nodes)),
+	}
+	for i := range namespaces {
+		s.namespaces = append(s.namespaces, &namespaces[i])
+	}
+	for i := range pods {
+		s.podsByNamespace[pods[i].Namespace] = append(s.podsByNamespace[pods[i].Namespace], &pods[i])
+	}
+	for i := range nodes {
+		s.nodesByName[nodes[i].Name] = &nodes[i]
+	}
+
+	// Sort by name so that evaluation order does not depend on the order
+	// the cache happened to return objects in.
+	sort.Slice(s.namespaces, func(i, j int) bool {
+		return s.namespaces[i].Name < s.namespaces[j].Name
+	})
+	for _, pods := range s.podsByNamespace {
+		sort.Slice(pods, func(i, j int) bool {
+			return pods[i].Name < pods[j].Name
+		})
+	}
+	return s
+}
+
+// SelectNamespaces returns the namespaces matching the selector. A nil
+// selector matches every namespace.
+func (s *k8sSnapshot) SelectNamespaces(selector labels.Selector) []*corev1.Namespace {
+	if selector == nil {
+		return s.namespaces
+	}
+	var out []*corev1.Namespace
+	for _, namespace := range s.namespaces {
+		if selector.Matches(labels.Set(namespace.Labels)) {
+			out = append(out, namespace)
+		}
+	}
+	return out
+}
+
+// SelectPods returns the pods in the namespace matching the selector. A nil
+// selector matches every pod in the namespace.
+func (s *k8sSnapshot) SelectPods(namespace string, selector labels.Selector) []*corev1.Pod {
+	pods := s.podsByNamespace[namespace]
+	if selector == nil {
+		return pods
+	}
+	var out []*corev1.Pod
+	for _, pod := range pods {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			out = append(out, pod)
+		}
+	}
+	return out
+}
+
+// GetNode returns the node with the given name, or nil if it does not exist.
+func (s *k8sSnapshot) GetNode(name string) *corev1.Node {
+	return s.nodesByName[name]
+}
@@ -0,0 +1,335 @@
+package spireentry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/metrics"
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+	"github.com/spiffe/spire-controller-manager/pkg/test/k8stest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestK8sSnapshot(t *testing.T) {
+	ns1 := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: map[string]string{"widget": "foo"}}}
+	ns2 := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns2", Labels: map[string]string{"widget": "bar"}}}
+	pod1 := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1", Labels: map[string]string{"app": "a"}}}
+	pod2 := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod2", Labels: map[string]string{"app": "b"}}}
+	pod3 := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod3", Labels: map[string]string{"app": "a"}}}
+	node1 := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+	snapshot := newK8sSnapshot(
+		[]corev1.Namespace{ns2, ns1},
+		[]corev1.Pod{pod3, pod2, pod1},
+		[]corev1.Node{node1},
+	)
+
+	selector := func(matchLabels map[string]string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: matchLabels}
+	}
+	parse := func(nsSelector, podSelector *metav1.LabelSelector) *spirev1alpha1.ParsedClusterSPIFFEIDSpec {
+		spec, err := spirev1alpha1.ParseClusterSPIFFEIDSpec(&spirev1alpha1.ClusterSPIFFEIDSpec{
+			SPIFFEIDTemplate:  "spiffe://example.org/foo",
+			NamespaceSelector: nsSelector,
+			PodSelector:       podSelector,
+		})
+		require.NoError(t, err)
+		return spec
+	}
+	namespaceNames := func(namespaces []*corev1.Namespace) []string {
+		var names []string
+		for _, namespace := range namespaces {
+			names = append(names, namespace.Name)
+		}
+		return names
+	}
+	podNames := func(pods []*corev1.Pod) []string {
+		var names []string
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		return names
+	}
+
+	t.Run("select all namespaces", func(t *testing.T) {
+		spec := parse(nil, nil)
+		assert.Equal(t, []string{"ns1", "ns2"}, namespaceNames(snapshot.SelectNamespaces(spec.NamespaceSelector)))
+	})
+
+	t.Run("select namespaces by label", func(t *testing.T) {
+		spec := parse(selector(ns2.Labels), nil)
+		assert.Equal(t, []string{"ns2"}, namespaceNames(snapshot.SelectNamespaces(spec.NamespaceSelector)))
+	})
+
+	t.Run("select all pods in namespace", func(t *testing.T) {
+		spec := parse(nil, nil)
+		assert.Equal(t, []string{"pod1", "pod2"}, podNames(snapshot.SelectPods("ns1", spec.PodSelector)))
+	})
+
+	t.Run("select pods by label", func(t *testing.T) {
+		spec := parse(nil, selector(pod1.Labels))
+		assert.Equal(t, []string{"pod1"}, podNames(snapshot.SelectPods("ns1", spec.PodSelector)))
+		assert.Equal(t, []string{"pod3"}, podNames(snapshot.SelectPods("ns2", spec.PodSelector)))
+	})
+
+	t.Run("select pods in unknown namespace", func(t *testing.T) {
+		spec := parse(nil, nil)
+		assert.Empty(t, snapshot.SelectPods("ns3", spec.PodSelector))
+	})
+
+	t.Run("get node", func(t *testing.T) {
+		assert.Equal(t, "node1", snapshot.GetNode("node1").Name)
+		assert.Nil(t, snapshot.GetNode("node2"))
+	})
+}
+
+func TestReconcileClusterSPIFFEIDsFromSnapshot(t *testing.T) {
+	cluster := newTestCluster(2, 3, 2)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("fallback", "spiffe://example.org/fallback/{{ .PodMeta.Name }}", true),
+		newTestClusterSPIFFEID("pods", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+	)
+
+	// A pod scheduled to a node that no longer exists does not get an entry.
+	cluster.pods = append(cluster.pods, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns-0", Name: "orphan", UID: "orphan"},
+		Spec:       corev1.PodSpec{NodeName: "missing"},
+	})
+
+	k8sClient := cluster.build(t)
+	entryClient := newEntryClient()
+	r := newTestEntryReconciler(k8sClient, entryClient)
+	r.reconcile(context.Background())
+
+	var spiffeIDs []string
+	for _, entry := range entryClient.getEntries() {
+		spiffeIDs = append(spiffeIDs, entry.SPIFFEID.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"spiffe://example.org/ns/ns-0/pod/pod-0-0",
+		"spiffe://example.org/ns/ns-0/pod/pod-0-1",
+		"spiffe://example.org/ns/ns-0/pod/pod-0-2",
+		"spiffe://example.org/ns/ns-1/pod/pod-1-0",
+		"spiffe://example.org/ns/ns-1/pod/pod-1-1",
+		"spiffe://example.org/ns/ns-1/pod/pod-1-2",
+	}, spiffeIDs)
+
+	clusterSPIFFEID := new(spirev1alpha1.ClusterSPIFFEID)
+	require.NoError(t, k8sClient.Get(context.Background(), types.NamespacedName{Name: "pods"}, clusterSPIFFEID))
+	assert.Equal(t, spirev1alpha1.ClusterSPIFFEIDStats{
+		NamespacesSelected: 2,
+		PodsSelected:       7,
+		EntriesToSet:       6,
+	}, clusterSPIFFEID.Status.Stats)
+}
+
+func TestRenderWorkersProduceDeterministicState(t *testing.T) {
+	cluster := newTestCluster(4, 25, 3)
+	cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs,
+		newTestClusterSPIFFEID("fallback", "spiffe://example.org/fallback/{{ .PodMeta.Name }}", true),
+		newTestClusterSPIFFEID("a", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+		newTestClusterSPIFFEID("b", "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false),
+		newTestClusterSPIFFEID("c", "spiffe://example.org/node/{{ .PodSpec.NodeName }}", false),
+	)
+	// Only select a subset of namespaces with a non-fallback CR so that the
+	// fallback applies to the rest.
+	for _, clusterSPIFFEID := range cluster.clusterSPIFFEIDs {
+		if !clusterSPIFFEID.Spec.Fallback {
+			clusterSPIFFEID.Spec.NamespaceSelector = &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "index", Operator: metav1.LabelSelectorOpIn, Values: []string{"0", "1"}},
+				},
+			}
+		}
+	}
+	k8sClient := cluster.build(t)
+
+	type declared struct {
+		By    types.UID
+		Entry spireapi.Entry
+	}
+	renderState := func(workers int) (map[entryKey][]declared, map[types.UID]spirev1alpha1.ClusterSPIFFEIDStats) {
+		r := newTestEntryReconciler(k8sClient, newEntryClient())
+		r.config.RenderWorkers = workers
+
+		clusterSPIFFEIDs, _, err := r.listClusterSPIFFEIDs(context.Background())
+		require.NoError(t, err)
+		snapshot, err := loadK8sSnapshot(context.Background(), k8sClient)
+		require.NoError(t, err)
+
+		state := make(entriesState)
+		r.addClusterSPIFFEIDEntriesState(context.Background(), state, clusterSPIFFEIDs, snapshot, nil)
+
+		out := make(map[entryKey][]declared)
+		for key, s := range state {
+			sortDeclaredEntriesByPreference(s.Declared)
+			for _, d := range s.Declared {
+				out[key] = append(out[key], declared{By: d.By.GetUID(), Entry: d.Entry})
+			}
+		}
+		stats := make(map[types.UID]spirev1alpha1.ClusterSPIFFEIDStats)
+		for _, clusterSPIFFEID := range clusterSPIFFEIDs {
+			stats[clusterSPIFFEID.UID] = clusterSPIFFEID.NextStatus.Stats
+		}
+		return out, stats
+	}
+
+	expectedState, expectedStats := renderState(1)
+	require.NotEmpty(t, expectedState)
+	for _, workers := range []int{2, 8, 1000} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			actualState, actualStats := renderState(workers)
+			assert.Equal(t, expectedState, actualState)
+			assert.Equal(t, expectedStats, actualStats)
+		})
+	}
+
+	// The fallback only applies to the pods in the namespaces that were not
+	// selected by any of the other ClusterSPIFFEIDs.
+	fallbackEntries := 0
+	for _, declared := range expectedState {
+		for _, d := range declared {
+			if d.By == "fallback" {
+				fallbackEntries++
+			}
+		}
+	}
+	assert.Equal(t, 50, fallbackEntries)
+}
+
+func BenchmarkReconcileClusterSPIFFEIDs(b *testing.B) {
+	for _, bb := range []struct {
+		clusterSPIFFEIDs int
+		namespaces       int
+		podsPerNamespace int
+	}{
+		{clusterSPIFFEIDs: 1, namespaces: 10, podsPerNamespace: 100},
+		{clusterSPIFFEIDs: 60, namespaces: 10, podsPerNamespace: 100},
+		{clusterSPIFFEIDs: 60, namespaces: 100, podsPerNamespace: 10},
+	} {
+		b.Run(fmt.Sprintf("crs=%d/namespaces=%d/pods=%d", bb.clusterSPIFFEIDs, bb.namespaces, bb.namespaces*bb.podsPerNamespace), func(b *testing.B) {
+			cluster := newTestCluster(bb.namespaces, bb.podsPerNamespace, 10)
+			for i := 0; i < bb.clusterSPIFFEIDs; i++ {
+				// Each ClusterSPIFFEID selects a single namespace so that the
+				// declared entries stay the same as the number of CRs grows.
+				clusterSPIFFEID := newTestClusterSPIFFEID(fmt.Sprintf("cr-%d", i), "spiffe://example.org/ns/{{ .PodMeta.Namespace }}/pod/{{ .PodMeta.Name }}", false)
+				clusterSPIFFEID.Spec.NamespaceSelector = &metav1.LabelSelector{
+					MatchLabels: map[string]string{"index": fmt.Sprint(i % bb.namespaces)},
+				}
+				cluster.clusterSPIFFEIDs = append(cluster.clusterSPIFFEIDs, clusterSPIFFEID)
+			}
+			r := newTestEntryReconciler(cluster.build(b), newEntryClient())
+
+			// Prime the SPIRE state so that the benchmark measures the
+			// steady state.
+			r.reconcile(context.Background())
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.reconcile(context.Background())
+			}
+		})
+	}
+}
+
+type testCluster struct {
+	namespaces       []*corev1.Namespace
+	pods             []*corev1.Pod
+	nodes            []*corev1.Node
+	clusterSPIFFEIDs []*spirev1alpha1.ClusterSPIFFEID
+}
+
+func newTestCluster(numNamespaces, podsPerNamespace, numNodes int) *testCluster {
+	c := new(testCluster)
+	for i := 0; i < numNodes; i++ {
+		c.nodes = append(c.nodes, &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("node-%d", i),
+				UID:  types.UID(fmt.Sprintf("node-uid-%d", i)),
+			},
+		})
+	}
+	for i := 0; i < numNamespaces; i++ {
+		namespace := fmt.Sprintf("ns-%d", i)
+		c.namespaces = append(c.namespaces, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   namespace,
+				Labels: map[string]string{"index": fmt.Sprint(i)},
+			},
+		})
+		for j := 0; j < podsPerNamespace; j++ {
+			c.pods = append(c.pods, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: namespace,
+					Name:      fmt.Sprintf("pod-%d-%d", i, j),
+					UID:       types.UID(fmt.Sprintf("pod-uid-%d-%d", i, j)),
+				},
+				Spec: corev1.PodSpec{
+					NodeName: fmt.Sprintf("node-%d", j%max(numNodes, 1)),
+				},
+			})
+		}
+	}
+	return c
+}
+
+func (c *testCluster) build(tb testing.TB) client.Client {
+	var objects []client.Object
+	for _, namespace := range c.namespaces {
+		objects = append(objects, namespace)
+	}
+	for _, pod := range c.pods {
+		objects = append(objects, pod)
+	}
+	for _, node := range c.nodes {
+		objects = append(objects, node)
+	}
+	for _, clusterSPIFFEID := range c.clusterSPIFFEIDs {
+		objects = append(objects, clusterSPIFFEID)
+	}
+	return k8stest.NewClientBuilder(tb).
+		WithObjects(objects...).
+		WithStatusSubresource(&spirev1alpha1.ClusterSPIFFEID{}, &spirev1alpha1.ClusterStaticEntry{}).
+		Build()
+}
+
+func newTestClusterSPIFFEID(name, spiffeIDTemplate string, fallback bool) *spirev1alpha1.ClusterSPIFFEID {
+	return &spirev1alpha1.ClusterSPIFFEID{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(name),
+		},
+		Spec: spirev1alpha1.ClusterSPIFFEIDSpec{
+			SPIFFEIDTemplate: spiffeIDTemplate,
+			Fallback:         fallback,
+		},
+	}
+}
+
+func newTestEntryReconciler(k8sClient client.Client, entryClient *entryClient) *entryReconciler {
+	return &entryReconciler{
+		config: ReconcilerConfig{
+			TrustDomain:   spiffeid.RequireTrustDomainFromString(trustDomain),
+			ClusterName:   clusterName,
+			ClusterDomain: clusterDomain,
+			EntryClient:   entryClient,
+			K8sClient:     k8sClient,
+			Reconcile: spirev1alpha1.ReconcileConfig{
+				ClusterSPIFFEIDs:     true,
+				ClusterStaticEntries: true,
+			},
+		},
+		promCounter:    metrics.PromCounters,
+		promCounterVec: metrics.PromCounterVecs,
+		promGauge:      profileGauges(""),
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireentry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/spiffe/spire-controller-manager/pkg/tracing"
+)
+
+const (
+	countKey              = attribute.Key("count")
+	cachedKey             = attribute.Key("cached")
+	fullListKey           = attribute.Key("fullList")
+	clusterSPIFFEIDKey    = attribute.Key("clusterSPIFFEID")
+	fallbackKey           = attribute.Key("fallback")
+	namespacesSelectedKey = attribute.Key("namespacesSelected")
+	namespacesIgnoredKey  = attribute.Key("namespacesIgnored")
+	podsSelectedKey       = attribute.Key("podsSelected")
+	renderFailuresKey     = attribute.Key("renderFailures")
+)
+
+// startRenderSpans starts a span for rendering each of the ClusterSPIFFEIDs
+// in a round. The ClusterSPIFFEIDs in a round are rendered concurrently, so
+// each span covers the whole round.
+func startRenderSpans(ctx context.Context, clusterSPIFFEIDs []*ClusterSPIFFEID) []trace.Span {
+	spans := make([]trace.Span, 0, len(clusterSPIFFEIDs))
+	for _, clusterSPIFFEID := range clusterSPIFFEIDs {
+		_, span := tracing.Start(ctx, "spireentry.RenderClusterSPIFFEID",
+			clusterSPIFFEIDKey.String(clusterSPIFFEID.Name),
+			fallbackKey.Bool(clusterSPIFFEID.Spec.Fallback))
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// endRenderSpans records the rendering stats of each ClusterSPIFFEID on its
+// span and ends it.
+func endRenderSpans(clusterSPIFFEIDs []*ClusterSPIFFEID, spans []trace.Span) {
+	for i, clusterSPIFFEID := range clusterSPIFFEIDs {
+		stats := clusterSPIFFEID.NextStatus.Stats
+		spans[i].SetAttributes(
+			namespacesSelectedKey.Int(stats.NamespacesSelected),
+			namespacesIgnoredKey.Int(stats.NamespacesIgnored),
+			podsSelectedKey.Int(stats.PodsSelected),
+			renderFailuresKey.Int(stats.PodEntryRenderFailures))
+		spans[i].End()
+	}
+}
@@ -23,7 +23,9 @@ import (
 
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
+	"github.com/spiffe/spire-controller-manager/pkg/audit"
 	"github.com/spiffe/spire-controller-manager/pkg/k8sapi"
+	"github.com/spiffe/spire-controller-manager/pkg/liveconfig"
 	"github.com/spiffe/spire-controller-manager/pkg/reconciler"
 	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
 	"google.golang.org/grpc/codes"
@@ -40,24 +42,43 @@ type ReconcilerConfig struct {
 	// GCInterval how long to sit idle (i.e. untriggered) before doing
 	// another reconcile.
 	GCInterval time.Duration
+
+	// ReconcileTimeout, if set, bounds each reconcile.
+	ReconcileTimeout time.Duration
+
+	// Auditor, if set, records an audit event for every federation
+	// relationship the reconciler creates, updates or deletes.
+	Auditor *audit.Recorder
+
+	// LiveConfig, if set, overrides ClassName, WatchClassless and
+	// GCInterval. It is loaded at the start of each reconcile.
+	LiveConfig *liveconfig.Value
 }
 
 func Reconciler(config ReconcilerConfig) reconciler.Reconciler {
 	return reconciler.New(reconciler.Config{
 		Kind: "federation relationship",
 		Reconcile: func(ctx context.Context) {
-			Reconcile(ctx, config.TrustDomainClient, config.K8sClient, config.ClassName, config.WatchClassless)
+			className, watchClassless := config.ClassName, config.WatchClassless
+			if config.LiveConfig != nil {
+				live := config.LiveConfig.Load()
+				className, watchClassless = live.ClassName, live.WatchClassless
+			}
+			Reconcile(ctx, config.TrustDomainClient, config.K8sClient, className, watchClassless, config.Auditor)
 		},
 		GCInterval: config.GCInterval,
+		Timeout:    config.ReconcileTimeout,
+		LiveConfig: config.LiveConfig,
 	})
 }
 
-func Reconcile(ctx context.Context, trustDomainClient spireapi.TrustDomainClient, k8sClient client.Client, className string, watchClassless bool) {
+func Reconcile(ctx context.Context, trustDomainClient spireapi.TrustDomainClient, k8sClient client.Client, className string, watchClassless bool, auditor *audit.Recorder) {
 	r := &federationRelationshipReconciler{
 		trustDomainClient: trustDomainClient,
 		k8sClient:         k8sClient,
 		className:         className,
 		watchClassless:    watchClassless,
+		auditor:           auditor,
 	}
 	r.reconcile(ctx)
 }
@@ -67,6 +88,7 @@ type federationRelationshipReconciler struct {
 	k8sClient         client.Client
 	className         string
 	watchClassless    bool
+	auditor           *audit.Recorder
 }
 
 func (r *federationRelationshipReconciler) reconcile(ctx context.Context) {
@@ -85,8 +107,8 @@ func (r *federationRelationshipReconciler) reconcile(ctx context.Context) {
 	}
 
 	var toDelete []spireapi.FederationRelationship
-	var toCreate []spireapi.FederationRelationship
-	var toUpdate []spireapi.FederationRelationship
+	var toCreate []*clusterFederatedTrustDomainState
+	var toUpdate []federationRelationshipUpdate
 
 	for trustDomain, federationRelationship := range currentRelationships {
 		if _, ok := clusterFederatedTrustDomains[trustDomain]; !ok {
@@ -97,9 +119,12 @@ func (r *federationRelationshipReconciler) reconcile(ctx context.Context) {
 		currentRelationship, ok := currentRelationships[trustDomain]
 		switch {
 		case !ok:
-			toCreate = append(toCreate, clusterFederatedTrustDomain.FederationRelationship)
+			toCreate = append(toCreate, clusterFederatedTrustDomain)
 		case !currentRelationship.Equal(clusterFederatedTrustDomain.FederationRelationship):
-			toUpdate = append(toUpdate, clusterFederatedTrustDomain.FederationRelationship)
+			toUpdate = append(toUpdate, federationRelationshipUpdate{
+				clusterFederatedTrustDomainState: clusterFederatedTrustDomain,
+				Current:                          currentRelationship,
+			})
 		}
 	}
 
@@ -175,16 +200,28 @@ func (r *federationRelationshipReconciler) listClusterFederatedTrustDomains(ctx
 	return out, nil
 }
 
-func (r *federationRelationshipReconciler) createFederationRelationships(ctx context.Context, federationRelationships []spireapi.FederationRelationship) {
+func (r *federationRelationshipReconciler) createFederationRelationships(ctx context.Context, states []*clusterFederatedTrustDomainState) {
 	log := log.FromContext(ctx)
 
+	federationRelationships := make([]spireapi.FederationRelationship, 0, len(states))
+	for _, state := range states {
+		federationRelationships = append(federationRelationships, state.FederationRelationship)
+	}
+
 	statuses, err := r.trustDomainClient.CreateFederationRelationships(ctx, federationRelationships)
 	if err != nil {
+		events := make([]audit.Event, 0, len(states))
+		for _, state := range states {
+			events = append(events, createdFederationRelationshipEvent(state, audit.ResultFromError(err)))
+		}
+		r.auditor.Record(ctx, events...)
 		log.Error(err, "Failed to create federation relationships")
 		return
 	}
 
+	events := make([]audit.Event, 0, len(statuses))
 	for i, status := range statuses {
+		events = append(events, createdFederationRelationshipEvent(states[i], audit.ResultFromStatus(status)))
 		switch status.Code {
 		case codes.OK:
 			log.Info("Created federation relationship", federationRelationshipFields(federationRelationships[i])...)
@@ -192,18 +229,31 @@ func (r *federationRelationshipReconciler) createFederationRelationships(ctx con
 			log.Error(status.Err(), "Failed to create federation relationship", federationRelationshipFields(federationRelationships[i])...)
 		}
 	}
+	r.auditor.Record(ctx, events...)
 }
 
-func (r *federationRelationshipReconciler) updateFederationRelationships(ctx context.Context, federationRelationships []spireapi.FederationRelationship) {
+func (r *federationRelationshipReconciler) updateFederationRelationships(ctx context.Context, updates []federationRelationshipUpdate) {
 	log := log.FromContext(ctx)
 
+	federationRelationships := make([]spireapi.FederationRelationship, 0, len(updates))
+	for _, update := range updates {
+		federationRelationships = append(federationRelationships, update.FederationRelationship)
+	}
+
 	statuses, err := r.trustDomainClient.UpdateFederationRelationships(ctx, federationRelationships)
 	if err != nil {
+		events := make([]audit.Event, 0, len(updates))
+		for _, update := range updates {
+			events = append(events, updatedFederationRelationshipEvent(update, audit.ResultFromError(err)))
+		}
+		r.auditor.Record(ctx, events...)
 		log.Error(err, "Failed to update federation relationships")
 		return
 	}
 
+	events := make([]audit.Event, 0, len(statuses))
 	for i, status := range statuses {
+		events = append(events, updatedFederationRelationshipEvent(updates[i], audit.ResultFromStatus(status)))
 		switch status.Code {
 		case codes.OK:
 			log.Info("Updated federation relationship", federationRelationshipFields(federationRelationships[i])...)
@@ -211,6 +261,7 @@ func (r *federationRelationshipReconciler) updateFederationRelationships(ctx con
 			log.Error(status.Err(), "Failed to update federation relationship", federationRelationshipFields(federationRelationships[i])...)
 		}
 	}
+	r.auditor.Record(ctx, events...)
 }
 
 func (r *federationRelationshipReconciler) deleteFederationRelationships(ctx context.Context, federationRelationships []spireapi.FederationRelationship) {
@@ -218,11 +269,18 @@ func (r *federationRelationshipReconciler) deleteFederationRelationships(ctx con
 
 	statuses, err := r.trustDomainClient.DeleteFederationRelationships(ctx, trustDomainIDsFromFederationRelationships(federationRelationships))
 	if err != nil {
+		events := make([]audit.Event, 0, len(federationRelationships))
+		for _, federationRelationship := range federationRelationships {
+			events = append(events, deletedFederationRelationshipEvent(federationRelationship, audit.ResultFromError(err)))
+		}
+		r.auditor.Record(ctx, events...)
 		log.Error(err, "Failed to delete federation relationships")
 		return
 	}
 
+	events := make([]audit.Event, 0, len(statuses))
 	for i, status := range statuses {
+		events = append(events, deletedFederationRelationshipEvent(federationRelationships[i], audit.ResultFromStatus(status)))
 		switch status.Code {
 		case codes.OK:
 			log.Info("Deleted federation relationship", federationRelationshipFields(federationRelationships[i])...)
@@ -230,6 +288,41 @@ func (r *federationRelationshipReconciler) deleteFederationRelationships(ctx con
 			log.Error(status.Err(), "Failed to delete federation relationship", federationRelationshipFields(federationRelationships[i])...)
 		}
 	}
+	r.auditor.Record(ctx, events...)
+}
+
+func createdFederationRelationshipEvent(state *clusterFederatedTrustDomainState, result audit.Result) audit.Event {
+	return audit.Event{
+		Action: audit.ActionCreate,
+		Kind:   audit.KindFederationRelationship,
+		After:  audit.NewFederationRelationship(state.FederationRelationship),
+		Source: state.auditSource(),
+		Result: result,
+	}
+}
+
+func updatedFederationRelationshipEvent(update federationRelationshipUpdate, result audit.Result) audit.Event {
+	return audit.Event{
+		Action:        audit.ActionUpdate,
+		Kind:          audit.KindFederationRelationship,
+		Before:        audit.NewFederationRelationship(update.Current),
+		After:         audit.NewFederationRelationship(update.FederationRelationship),
+		ChangedFields: audit.FederationRelationshipChangedFields(update.Current, update.FederationRelationship),
+		Source:        update.auditSource(),
+		Result:        result,
+	}
+}
+
+// deletedFederationRelationshipEvent returns the audit event for deleting
+// the federation relationship. Deleted relationships are no longer declared,
+// so the event has no source.
+func deletedFederationRelationshipEvent(federationRelationship spireapi.FederationRelationship, result audit.Result) audit.Event {
+	return audit.Event{
+		Action: audit.ActionDelete,
+		Kind:   audit.KindFederationRelationship,
+		Before: audit.NewFederationRelationship(federationRelationship),
+		Result: result,
+	}
 }
 
 func trustDomainIDsFromFederationRelationships(frs []spireapi.FederationRelationship) []spiffeid.TrustDomain {
@@ -246,6 +339,21 @@ type clusterFederatedTrustDomainState struct {
 	NextStatus                  spirev1alpha1.ClusterFederatedTrustDomainStatus
 }
 
+func (s *clusterFederatedTrustDomainState) auditSource() *audit.Object {
+	return &audit.Object{
+		Kind: "ClusterFederatedTrustDomain",
+		Name: s.ClusterFederatedTrustDomain.Name,
+		UID:  s.ClusterFederatedTrustDomain.UID,
+	}
+}
+
+// federationRelationshipUpdate is a declared federation relationship that
+// differs from the current one.
+type federationRelationshipUpdate struct {
+	*clusterFederatedTrustDomainState
+	Current spireapi.FederationRelationship
+}
+
 func sortClusterFederatedTrustDomainsByCreationDate(cftds []spirev1alpha1.ClusterFederatedTrustDomain) {
 	sort.Slice(cftds, func(a, b int) bool {
 		if cftds[a].CreationTimestamp.Time.Before(cftds[b].CreationTimestamp.Time) {
@@ -6,16 +6,21 @@ import (
 	spirev1alpha1 "github.com/spiffe/spire-controller-manager/api/v1alpha1"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
-func NewClientBuilder(t *testing.T) *fake.ClientBuilder {
+func NewClientBuilder(t testing.TB) *fake.ClientBuilder {
 	return WithScheme(t, fake.NewClientBuilder())
 }
 
-func WithScheme(t *testing.T, b *fake.ClientBuilder) *fake.ClientBuilder {
+func WithScheme(t testing.TB, b *fake.ClientBuilder) *fake.ClientBuilder {
+	return b.WithScheme(NewScheme(t))
+}
+
+func NewScheme(t testing.TB) *runtime.Scheme {
 	scheme := runtime.NewScheme()
-	err := spirev1alpha1.AddToScheme(scheme)
-	require.NoError(t, err)
-	return b.WithScheme(scheme)
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, spirev1alpha1.AddToScheme(scheme))
+	return scheme
 }
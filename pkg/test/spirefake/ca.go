@@ -0,0 +1,132 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spirefake
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+const (
+	caTTL = 24 * time.Hour
+
+	// defaultX509SVIDTTL matches the SPIRE Server default.
+	defaultX509SVIDTTL = time.Hour
+)
+
+// ca is a self-signed CA that mints X509-SVIDs for the trust domain.
+type ca struct {
+	td   spiffeid.TrustDomain
+	key  crypto.Signer
+	cert *x509.Certificate
+}
+
+func newCA(td spiffeid.TrustDomain, now time.Time) (*ca, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"SPIRE"}, CommonName: "fake SPIRE Server CA"},
+		URIs:                  []*url.URL{td.ID().URL()},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(caTTL),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+	return &ca{td: td, key: key, cert: cert}, nil
+}
+
+// mintX509SVID signs an X509-SVID for the CSR. The SVID expires after the
+// TTL, or the default TTL if zero, but never after the CA.
+func (c *ca) mintX509SVID(csrDER []byte, ttl time.Duration, now time.Time) (*x509.Certificate, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("malformed CSR: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid CSR signature: %w", err)
+	}
+	if len(csr.URIs) != 1 {
+		return nil, errors.New("CSR must have exactly one URI SAN")
+	}
+	id, err := spiffeid.FromURI(csr.URIs[0])
+	if err != nil {
+		return nil, fmt.Errorf("CSR URI SAN is not a valid SPIFFE ID: %w", err)
+	}
+	if id.TrustDomain() != c.td {
+		return nil, fmt.Errorf("CSR SPIFFE ID %q is not a member of trust domain %q", id, c.td)
+	}
+
+	if ttl == 0 {
+		ttl = defaultX509SVIDTTL
+	}
+	notAfter := now.Add(ttl)
+	if notAfter.After(c.cert.NotAfter) {
+		notAfter = c.cert.NotAfter
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		URIs:                  csr.URIs,
+		DNSNames:              csr.DNSNames,
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, c.cert, csr.PublicKey, c.key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(certDER)
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
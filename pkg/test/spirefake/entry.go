@@ -0,0 +1,472 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spirefake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type entryServer struct {
+	entryv1.UnimplementedEntryServer
+
+	s *Server
+}
+
+func (e entryServer) ListEntries(_ context.Context, req *entryv1.ListEntriesRequest) (*entryv1.ListEntriesResponse, error) {
+	entries, nextPageToken := e.s.entries.List(req.Filter, req.PageToken, int(req.PageSize))
+	resp := &entryv1.ListEntriesResponse{NextPageToken: nextPageToken}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, applyEntryMask(entry, req.OutputMask))
+	}
+	return resp, nil
+}
+
+func (e entryServer) GetEntry(_ context.Context, req *entryv1.GetEntryRequest) (*apitypes.Entry, error) {
+	entry, err := e.s.entries.Get(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return applyEntryMask(entry, req.OutputMask), nil
+}
+
+func (e entryServer) BatchCreateEntry(_ context.Context, req *entryv1.BatchCreateEntryRequest) (*entryv1.BatchCreateEntryResponse, error) {
+	resp := new(entryv1.BatchCreateEntryResponse)
+	for _, entry := range req.Entries {
+		created, err := e.s.entries.Create(entry)
+		result := &entryv1.BatchCreateEntryResponse_Result{Status: statusToAPI(err)}
+		if created != nil {
+			result.Entry = applyEntryMask(created, req.OutputMask)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+func (e entryServer) BatchUpdateEntry(_ context.Context, req *entryv1.BatchUpdateEntryRequest) (*entryv1.BatchUpdateEntryResponse, error) {
+	resp := new(entryv1.BatchUpdateEntryResponse)
+	for _, entry := range req.Entries {
+		updated, err := e.s.entries.Update(entry, req.InputMask)
+		result := &entryv1.BatchUpdateEntryResponse_Result{Status: statusToAPI(err)}
+		if err == nil {
+			result.Entry = applyEntryMask(updated, req.OutputMask)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+func (e entryServer) BatchDeleteEntry(_ context.Context, req *entryv1.BatchDeleteEntryRequest) (*entryv1.BatchDeleteEntryResponse, error) {
+	resp := new(entryv1.BatchDeleteEntryResponse)
+	for _, id := range req.Ids {
+		resp.Results = append(resp.Results, &entryv1.BatchDeleteEntryResponse_Result{
+			Status: statusToAPI(e.s.entries.Delete(id)),
+			Id:     id,
+		})
+	}
+	return resp, nil
+}
+
+// entryStore holds the entries on the server, keyed by ID.
+type entryStore struct {
+	now func() time.Time
+
+	mtx     sync.RWMutex
+	entries map[string]*apitypes.Entry
+}
+
+func newEntryStore(now func() time.Time) *entryStore {
+	return &entryStore{
+		now:     now,
+		entries: make(map[string]*apitypes.Entry),
+	}
+}
+
+func (s *entryStore) All() []*apitypes.Entry {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return cloneEntries(s.sorted())
+}
+
+func (s *entryStore) Set(entries []*apitypes.Entry) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.entries = make(map[string]*apitypes.Entry, len(entries))
+	for _, entry := range cloneEntries(entries) {
+		s.entries[entry.Id] = entry
+	}
+}
+
+// List returns a page of the entries matching the filter, in ID order,
+// starting after the entry with the ID in the page token. A page size of
+// zero returns every remaining entry.
+func (s *entryStore) List(filter *entryv1.ListEntriesRequest_Filter, pageToken string, pageSize int) ([]*apitypes.Entry, string) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var entries []*apitypes.Entry
+	for _, entry := range s.sorted() {
+		if entry.Id > pageToken && entryMatchesFilter(entry, filter) {
+			entries = append(entries, entry)
+		}
+	}
+	var nextPageToken string
+	if pageSize > 0 && len(entries) > pageSize {
+		entries = entries[:pageSize]
+		nextPageToken = entries[pageSize-1].Id
+	}
+	return cloneEntries(entries), nextPageToken
+}
+
+func (s *entryStore) Get(id string) (*apitypes.Entry, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "entry %q not found", id)
+	}
+	return proto.Clone(entry).(*apitypes.Entry), nil
+}
+
+// Create creates the entry. As with SPIRE Server, if a similar entry
+// already exists, an AlreadyExists error is returned along with the
+// existing entry.
+func (s *entryStore) Create(entry *apitypes.Entry) (*apitypes.Entry, error) {
+	if err := validateEntry(entry); err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if similar := s.findSimilar(entry); similar != nil {
+		return proto.Clone(similar).(*apitypes.Entry), status.Error(codes.AlreadyExists, "similar entry already exists")
+	}
+
+	entry = proto.Clone(entry).(*apitypes.Entry)
+	if entry.Id == "" {
+		entry.Id = uuid.NewString()
+	} else if _, ok := s.entries[entry.Id]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "entry %q already exists", entry.Id)
+	}
+	entry.CreatedAt = s.now().Unix()
+	entry.RevisionNumber = 0
+	s.entries[entry.Id] = entry
+	return proto.Clone(entry).(*apitypes.Entry), nil
+}
+
+// Update updates the fields of the entry in the mask, or every field if
+// the mask is nil, and bumps the revision number.
+func (s *entryStore) Update(entry *apitypes.Entry, mask *apitypes.EntryMask) (*apitypes.Entry, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	existing, ok := s.entries[entry.Id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "entry %q not found", entry.Id)
+	}
+
+	if mask == nil {
+		mask = &apitypes.EntryMask{
+			SpiffeId:      true,
+			ParentId:      true,
+			Selectors:     true,
+			X509SvidTtl:   true,
+			JwtSvidTtl:    true,
+			FederatesWith: true,
+			Admin:         true,
+			Downstream:    true,
+			DnsNames:      true,
+			Hint:          true,
+			StoreSvid:     true,
+			ExpiresAt:     true,
+		}
+	}
+	updated := proto.Clone(existing).(*apitypes.Entry)
+	if mask.SpiffeId {
+		updated.SpiffeId = entry.SpiffeId
+	}
+	if mask.ParentId {
+		updated.ParentId = entry.ParentId
+	}
+	if mask.Selectors {
+		updated.Selectors = entry.Selectors
+	}
+	if mask.X509SvidTtl {
+		updated.X509SvidTtl = entry.X509SvidTtl
+	}
+	if mask.JwtSvidTtl {
+		updated.JwtSvidTtl = entry.JwtSvidTtl
+	}
+	if mask.FederatesWith {
+		updated.FederatesWith = entry.FederatesWith
+	}
+	if mask.Admin {
+		updated.Admin = entry.Admin
+	}
+	if mask.Downstream {
+		updated.Downstream = entry.Downstream
+	}
+	if mask.DnsNames {
+		updated.DnsNames = entry.DnsNames
+	}
+	if mask.Hint {
+		updated.Hint = entry.Hint
+	}
+	if mask.StoreSvid {
+		updated.StoreSvid = entry.StoreSvid
+	}
+	if mask.ExpiresAt {
+		updated.ExpiresAt = entry.ExpiresAt
+	}
+	if err := validateEntry(updated); err != nil {
+		return nil, err
+	}
+	if similar := s.findSimilar(updated); similar != nil && similar.Id != updated.Id {
+		return nil, status.Error(codes.AlreadyExists, "similar entry already exists")
+	}
+	updated.RevisionNumber++
+	s.entries[updated.Id] = updated
+	return proto.Clone(updated).(*apitypes.Entry), nil
+}
+
+func (s *entryStore) Delete(id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.entries[id]; !ok {
+		return status.Errorf(codes.NotFound, "entry %q not found", id)
+	}
+	delete(s.entries, id)
+	return nil
+}
+
+// sorted returns the entries in ID order. The lock must be held.
+func (s *entryStore) sorted() []*apitypes.Entry {
+	entries := make([]*apitypes.Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+	return entries
+}
+
+// findSimilar returns an entry with the same parent ID, SPIFFE ID and
+// selectors as the given entry, if any. The lock must be held.
+func (s *entryStore) findSimilar(entry *apitypes.Entry) *apitypes.Entry {
+	for _, existing := range s.entries {
+		if proto.Equal(existing.ParentId, entry.ParentId) &&
+			proto.Equal(existing.SpiffeId, entry.SpiffeId) &&
+			selectorsMatch(existing.Selectors, entry.Selectors, apitypes.SelectorMatch_MATCH_EXACT) {
+			return existing
+		}
+	}
+	return nil
+}
+
+func validateEntry(entry *apitypes.Entry) error {
+	if err := validateSPIFFEID(entry.ParentId); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid parent ID: %v", err)
+	}
+	if err := validateSPIFFEID(entry.SpiffeId); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid SPIFFE ID: %v", err)
+	}
+	if len(entry.Selectors) == 0 {
+		return status.Error(codes.InvalidArgument, "selector list is empty")
+	}
+	for _, selector := range entry.Selectors {
+		switch {
+		case selector.Type == "":
+			return status.Error(codes.InvalidArgument, "missing selector type")
+		case selector.Value == "":
+			return status.Error(codes.InvalidArgument, "missing selector value")
+		}
+	}
+	for _, td := range entry.FederatesWith {
+		if _, err := spiffeid.TrustDomainFromString(td); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid federated trust domain: %v", err)
+		}
+	}
+	if entry.X509SvidTtl < 0 {
+		return status.Error(codes.InvalidArgument, "X509SvidTtl is not allowed to be negative")
+	}
+	if entry.JwtSvidTtl < 0 {
+		return status.Error(codes.InvalidArgument, "JwtSvidTtl is not allowed to be negative")
+	}
+	return nil
+}
+
+func validateSPIFFEID(id *apitypes.SPIFFEID) error {
+	if id == nil {
+		return errors.New("missing")
+	}
+	td, err := spiffeid.TrustDomainFromString(id.TrustDomain)
+	if err != nil {
+		return err
+	}
+	if _, err := spiffeid.FromPath(td, id.Path); err != nil {
+		return fmt.Errorf("%q: %w", id.Path, err)
+	}
+	return nil
+}
+
+func entryMatchesFilter(entry *apitypes.Entry, filter *entryv1.ListEntriesRequest_Filter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.BySpiffeId != nil && !proto.Equal(entry.SpiffeId, filter.BySpiffeId) {
+		return false
+	}
+	if filter.ByParentId != nil && !proto.Equal(entry.ParentId, filter.ByParentId) {
+		return false
+	}
+	if filter.ByHint != nil && entry.Hint != filter.ByHint.Value {
+		return false
+	}
+	if filter.ByDownstream != nil && entry.Downstream != filter.ByDownstream.Value {
+		return false
+	}
+	if filter.BySelectors != nil && !selectorsMatch(entry.Selectors, filter.BySelectors.Selectors, filter.BySelectors.Match) {
+		return false
+	}
+	if filter.ByFederatesWith != nil && !setsMatch(entry.FederatesWith, filter.ByFederatesWith.TrustDomains, int32(filter.ByFederatesWith.Match)) {
+		return false
+	}
+	return true
+}
+
+// selectorsMatch returns whether the entry selectors match the filter
+// selectors according to the match behavior.
+func selectorsMatch(entrySelectors, filterSelectors []*apitypes.Selector, match apitypes.SelectorMatch_MatchBehavior) bool {
+	selectorStrings := func(selectors []*apitypes.Selector) []string {
+		out := make([]string, 0, len(selectors))
+		for _, selector := range selectors {
+			out = append(out, selector.Type+":"+selector.Value)
+		}
+		return out
+	}
+	return setsMatch(selectorStrings(entrySelectors), selectorStrings(filterSelectors), int32(match))
+}
+
+// setsMatch returns whether the entry values match the filter values
+// according to the match behavior, which has the same values for both the
+// selector and federates with matches.
+func setsMatch(entryValues, filterValues []string, match int32) bool {
+	contains := func(as, bs []string) bool {
+		for _, b := range bs {
+			if !slices.Contains(as, b) {
+				return false
+			}
+		}
+		return true
+	}
+	switch apitypes.SelectorMatch_MatchBehavior(match) {
+	case apitypes.SelectorMatch_MATCH_EXACT:
+		return contains(entryValues, filterValues) && contains(filterValues, entryValues)
+	case apitypes.SelectorMatch_MATCH_SUBSET:
+		return contains(filterValues, entryValues)
+	case apitypes.SelectorMatch_MATCH_SUPERSET:
+		return contains(entryValues, filterValues)
+	case apitypes.SelectorMatch_MATCH_ANY:
+		for _, value := range filterValues {
+			if slices.Contains(entryValues, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func applyEntryMask(entry *apitypes.Entry, mask *apitypes.EntryMask) *apitypes.Entry {
+	if mask == nil {
+		return entry
+	}
+	out := &apitypes.Entry{Id: entry.Id}
+	if mask.SpiffeId {
+		out.SpiffeId = entry.SpiffeId
+	}
+	if mask.ParentId {
+		out.ParentId = entry.ParentId
+	}
+	if mask.Selectors {
+		out.Selectors = entry.Selectors
+	}
+	if mask.X509SvidTtl {
+		out.X509SvidTtl = entry.X509SvidTtl
+	}
+	if mask.JwtSvidTtl {
+		out.JwtSvidTtl = entry.JwtSvidTtl
+	}
+	if mask.FederatesWith {
+		out.FederatesWith = entry.FederatesWith
+	}
+	if mask.Admin {
+		out.Admin = entry.Admin
+	}
+	if mask.Downstream {
+		out.Downstream = entry.Downstream
+	}
+	if mask.DnsNames {
+		out.DnsNames = entry.DnsNames
+	}
+	if mask.Hint {
+		out.Hint = entry.Hint
+	}
+	if mask.StoreSvid {
+		out.StoreSvid = entry.StoreSvid
+	}
+	if mask.RevisionNumber {
+		out.RevisionNumber = entry.RevisionNumber
+	}
+	if mask.CreatedAt {
+		out.CreatedAt = entry.CreatedAt
+	}
+	if mask.ExpiresAt {
+		out.ExpiresAt = entry.ExpiresAt
+	}
+	return out
+}
+
+func cloneEntries(entries []*apitypes.Entry) []*apitypes.Entry {
+	out := make([]*apitypes.Entry, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, proto.Clone(entry).(*apitypes.Entry))
+	}
+	return out
+}
+
+func statusToAPI(err error) *apitypes.Status {
+	st := status.Convert(err)
+	return &apitypes.Status{
+		Code:    int32(st.Code()),
+		Message: st.Message(),
+	}
+}
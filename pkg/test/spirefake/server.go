@@ -0,0 +1,249 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package spirefake provides an in-memory SPIRE Server for tests. It serves
+// the Entry, TrustDomain, SVID and Bundle APIs on a Unix socket so that the
+// real spireapi client, and the reconcilers built on it, can be exercised
+// without a SPIRE deployment.
+package spirefake
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
+	trustdomainv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/trustdomain/v1"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// Full gRPC method names of the calls served by the fake, for use with
+// InjectFault, SetLatency and Calls.
+const (
+	ListEntriesMethod                       = "/spire.api.server.entry.v1.Entry/ListEntries"
+	GetEntryMethod                          = "/spire.api.server.entry.v1.Entry/GetEntry"
+	BatchCreateEntryMethod                  = "/spire.api.server.entry.v1.Entry/BatchCreateEntry"
+	BatchUpdateEntryMethod                  = "/spire.api.server.entry.v1.Entry/BatchUpdateEntry"
+	BatchDeleteEntryMethod                  = "/spire.api.server.entry.v1.Entry/BatchDeleteEntry"
+	ListFederationRelationshipsMethod       = "/spire.api.server.trustdomain.v1.TrustDomain/ListFederationRelationships"
+	GetFederationRelationshipMethod         = "/spire.api.server.trustdomain.v1.TrustDomain/GetFederationRelationship"
+	BatchCreateFederationRelationshipMethod = "/spire.api.server.trustdomain.v1.TrustDomain/BatchCreateFederationRelationship"
+	BatchUpdateFederationRelationshipMethod = "/spire.api.server.trustdomain.v1.TrustDomain/BatchUpdateFederationRelationship"
+	BatchDeleteFederationRelationshipMethod = "/spire.api.server.trustdomain.v1.TrustDomain/BatchDeleteFederationRelationship"
+	MintX509SVIDMethod                      = "/spire.api.server.svid.v1.SVID/MintX509SVID"
+	GetBundleMethod                         = "/spire.api.server.bundle.v1.Bundle/GetBundle"
+)
+
+// Config configures the fake server.
+type Config struct {
+	// TrustDomain is the trust domain of the server. Defaults to
+	// example.org.
+	TrustDomain spiffeid.TrustDomain
+
+	// SocketPath is the path of the Unix socket the server listens on.
+	// Defaults to a socket in a temporary directory owned by the test.
+	SocketPath string
+
+	// Clock returns the current time. Defaults to time.Now.
+	Clock func() time.Time
+}
+
+// Server is an in-memory SPIRE Server.
+type Server struct {
+	td         spiffeid.TrustDomain
+	socketPath string
+	now        func() time.Time
+	ca         *ca
+
+	entries                 *entryStore
+	federationRelationships *federationRelationshipStore
+
+	mtx     sync.Mutex
+	faults  map[string]*fault
+	latency map[string]time.Duration
+	calls   map[string]int
+}
+
+type fault struct {
+	err error
+	// remaining is how many more calls fail, or negative if every call
+	// fails until the fault is cleared.
+	remaining int
+}
+
+// Start starts a fake server that is stopped when the test finishes.
+func Start(tb testing.TB, config Config) *Server {
+	if config.TrustDomain.IsZero() {
+		config.TrustDomain = spiffeid.RequireTrustDomainFromString("example.org")
+	}
+	if config.SocketPath == "" {
+		config.SocketPath = filepath.Join(tb.TempDir(), "api.sock")
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+
+	ca, err := newCA(config.TrustDomain, config.Clock())
+	require.NoError(tb, err, "failed to create fake SPIRE Server CA")
+
+	s := &Server{
+		td:                      config.TrustDomain,
+		socketPath:              config.SocketPath,
+		now:                     config.Clock,
+		ca:                      ca,
+		entries:                 newEntryStore(config.Clock),
+		federationRelationships: newFederationRelationshipStore(),
+		faults:                  make(map[string]*fault),
+		latency:                 make(map[string]time.Duration),
+		calls:                   make(map[string]int),
+	}
+
+	listener, err := net.Listen("unix", config.SocketPath)
+	require.NoError(tb, err, "failed to listen on fake SPIRE Server socket")
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(s.intercept))
+	entryv1.RegisterEntryServer(server, entryServer{s: s})
+	trustdomainv1.RegisterTrustDomainServer(server, trustDomainServer{s: s})
+	svidv1.RegisterSVIDServer(server, svidServer{s: s})
+	bundlev1.RegisterBundleServer(server, bundleServer{s: s})
+
+	go func() { _ = server.Serve(listener) }()
+	tb.Cleanup(server.Stop)
+	return s
+}
+
+// SocketPath returns the path of the Unix socket the server listens on,
+// suitable for spireapi.DialSocket.
+func (s *Server) SocketPath() string {
+	return s.socketPath
+}
+
+// TrustDomain returns the trust domain of the server.
+func (s *Server) TrustDomain() spiffeid.TrustDomain {
+	return s.td
+}
+
+// X509Authority returns the CA certificate that X509-SVIDs are signed by.
+func (s *Server) X509Authority() *x509.Certificate {
+	return s.ca.cert
+}
+
+// Entries returns the entries on the server, sorted by ID.
+func (s *Server) Entries() []*apitypes.Entry {
+	return s.entries.All()
+}
+
+// SetEntries replaces the entries on the server. Entries are stored as
+// given, including server-managed fields like the revision number.
+func (s *Server) SetEntries(entries ...*apitypes.Entry) {
+	s.entries.Set(entries)
+}
+
+// FederationRelationships returns the federation relationships on the
+// server, sorted by trust domain.
+func (s *Server) FederationRelationships() []*apitypes.FederationRelationship {
+	return s.federationRelationships.All()
+}
+
+// SetFederationRelationships replaces the federation relationships on the
+// server.
+func (s *Server) SetFederationRelationships(federationRelationships ...*apitypes.FederationRelationship) {
+	s.federationRelationships.Set(federationRelationships)
+}
+
+// InjectFault makes the next count calls to the method fail with the error.
+// If count is not positive, every call fails until the fault is cleared.
+func (s *Server) InjectFault(method string, err error, count int) {
+	if count < 1 {
+		count = -1
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.faults[method] = &fault{err: err, remaining: count}
+}
+
+// SetLatency delays every call to the method by the latency. An empty
+// method delays every call.
+func (s *Server) SetLatency(method string, latency time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.latency[method] = latency
+}
+
+// ClearFaults clears any injected faults and latency.
+func (s *Server) ClearFaults() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.faults = make(map[string]*fault)
+	s.latency = make(map[string]time.Duration)
+}
+
+// Calls returns how many times the method has been called, including calls
+// that failed with an injected fault.
+func (s *Server) Calls(method string) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.calls[method]
+}
+
+func (s *Server) intercept(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	latency, err := s.beginCall(info.FullMethod)
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// beginCall records the call and returns the latency and fault, if any,
+// that apply to it.
+func (s *Server) beginCall(method string) (time.Duration, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.calls[method]++
+
+	latency := s.latency[""] + s.latency[method]
+
+	f, ok := s.faults[method]
+	if !ok {
+		return latency, nil
+	}
+	if f.remaining > 0 {
+		f.remaining--
+		if f.remaining == 0 {
+			delete(s.faults, method)
+		}
+	}
+	return latency, f.err
+}
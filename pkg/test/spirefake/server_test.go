@@ -0,0 +1,253 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spirefake
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spiffe/spire-controller-manager/pkg/spireapi"
+)
+
+var (
+	ctx = context.Background()
+
+	td       = spiffeid.RequireTrustDomainFromString("example.org")
+	parentID = spiffeid.RequireFromPath(td, "/parent")
+)
+
+func startAndDial(t *testing.T, config spireapi.ClientConfig) (*Server, spireapi.Client) {
+	server := Start(t, Config{TrustDomain: td})
+	client, err := spireapi.DialSocketWithConfig(server.SocketPath(), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+func makeEntry(i int) spireapi.Entry {
+	return spireapi.Entry{
+		SPIFFEID:  spiffeid.RequireFromPathf(td, "/workload-%d", i),
+		ParentID:  parentID,
+		Selectors: []spireapi.Selector{{Type: "k8s", Value: fmt.Sprintf("pod-uid:%d", i)}},
+	}
+}
+
+func TestEntries(t *testing.T) {
+	server, client := startAndDial(t, spireapi.ClientConfig{})
+
+	// Create enough entries to span more than one list page.
+	var entries []spireapi.Entry
+	for i := 0; i < 250; i++ {
+		entries = append(entries, makeEntry(i))
+	}
+	results, err := client.CreateEntries(ctx, entries)
+	require.NoError(t, err)
+	require.Len(t, results, len(entries))
+	for _, result := range results {
+		require.Equal(t, codes.OK, result.Code, result.Message)
+		require.NotEmpty(t, result.Entry.ID)
+	}
+
+	listed, err := client.ListEntries(ctx)
+	require.NoError(t, err)
+	assert.Len(t, listed, len(entries))
+	assert.Len(t, server.Entries(), len(entries))
+
+	t.Run("similar entries are rejected", func(t *testing.T) {
+		results, err := client.CreateEntries(ctx, []spireapi.Entry{makeEntry(0)})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, codes.AlreadyExists, results[0].Code)
+	})
+
+	t.Run("invalid entries are rejected", func(t *testing.T) {
+		entry := makeEntry(1000)
+		entry.Selectors = nil
+		results, err := client.CreateEntries(ctx, []spireapi.Entry{entry})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, codes.InvalidArgument, results[0].Code)
+	})
+
+	t.Run("updates bump the revision", func(t *testing.T) {
+		entry := results[0].Entry
+		entry.Hint = "updated"
+		updated, err := client.UpdateEntries(ctx, []spireapi.EntryUpdate{
+			{Entry: entry, Fields: []spireapi.Field{spireapi.HintField}},
+		})
+		require.NoError(t, err)
+		require.Len(t, updated, 1)
+		require.Equal(t, codes.OK, updated[0].Code, updated[0].Message)
+		assert.Equal(t, "updated", updated[0].Entry.Hint)
+		assert.Equal(t, entry.RevisionNumber+1, updated[0].Entry.RevisionNumber)
+
+		// A conditional update with the stale revision is aborted.
+		updated, err = client.UpdateEntries(ctx, []spireapi.EntryUpdate{
+			{Entry: entry, Fields: []spireapi.Field{spireapi.HintField}, CheckRevision: true},
+		})
+		require.NoError(t, err)
+		require.Len(t, updated, 1)
+		assert.Equal(t, codes.Aborted, updated[0].Code)
+	})
+
+	t.Run("filtered list", func(t *testing.T) {
+		listed, err := client.ListFilteredEntries(ctx, spireapi.EntryFilter{
+			BySelectors: &spireapi.SelectorMatch{
+				Selectors: []spireapi.Selector{{Type: "k8s", Value: "pod-uid:7"}},
+				Match:     spireapi.MatchExact,
+			},
+		}, nil)
+		require.NoError(t, err)
+		require.Len(t, listed, 1)
+		assert.Equal(t, entries[7].SPIFFEID, listed[0].SPIFFEID)
+	})
+
+	t.Run("deletes", func(t *testing.T) {
+		statuses, err := client.DeleteEntries(ctx, []string{results[1].Entry.ID, "missing"})
+		require.NoError(t, err)
+		require.Len(t, statuses, 2)
+		assert.Equal(t, codes.OK, statuses[0].Code)
+		assert.Equal(t, codes.NotFound, statuses[1].Code)
+
+		_, err = client.GetEntry(ctx, results[1].Entry.ID)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("all fields are supported", func(t *testing.T) {
+		unsupported, err := client.GetUnsupportedFields(ctx, td.Name())
+		require.NoError(t, err)
+		assert.Empty(t, unsupported)
+	})
+}
+
+func TestFederationRelationships(t *testing.T) {
+	server, client := startAndDial(t, spireapi.ClientConfig{})
+
+	domain1 := spiffeid.RequireTrustDomainFromString("domain1")
+	fr := spireapi.FederationRelationship{
+		TrustDomain:           domain1,
+		BundleEndpointURL:     "https://domain1/bundle",
+		BundleEndpointProfile: spireapi.HTTPSWebProfile{},
+	}
+
+	statuses, err := client.CreateFederationRelationships(ctx, []spireapi.FederationRelationship{fr, fr})
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, codes.OK, statuses[0].Code, statuses[0].Message)
+	assert.Equal(t, codes.AlreadyExists, statuses[1].Code)
+
+	fr.BundleEndpointProfile = spireapi.HTTPSSPIFFEProfile{EndpointSPIFFEID: spiffeid.RequireFromPath(domain1, "/server")}
+	statuses, err = client.UpdateFederationRelationships(ctx, []spireapi.FederationRelationship{fr})
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, codes.OK, statuses[0].Code, statuses[0].Message)
+
+	listed, err := client.ListFederationRelationships(ctx)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.True(t, fr.Equal(listed[0]))
+
+	statuses, err = client.DeleteFederationRelationships(ctx, []spiffeid.TrustDomain{domain1, domain1})
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, codes.OK, statuses[0].Code)
+	assert.Equal(t, codes.NotFound, statuses[1].Code)
+	assert.Empty(t, server.FederationRelationships())
+}
+
+func TestMintX509SVID(t *testing.T) {
+	_, client := startAndDial(t, spireapi.ClientConfig{})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	id := spiffeid.RequireFromPath(td, "/workload")
+	svid, err := client.MintX509SVID(ctx, spireapi.X509SVIDParams{
+		Key: key,
+		ID:  id,
+		TTL: 10 * time.Minute,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, id, svid.ID)
+	require.Len(t, svid.CertChain, 1)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), svid.ExpiresAt, time.Minute)
+
+	bundle, err := client.GetBundle(ctx)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	for _, authority := range bundle.X509Authorities() {
+		roots.AddCert(authority)
+	}
+	_, err = svid.CertChain[0].Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.MintX509SVID(ctx, spireapi.X509SVIDParams{
+		Key: key,
+		ID:  spiffeid.RequireFromPath(spiffeid.RequireTrustDomainFromString("other.org"), "/workload"),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestFaults(t *testing.T) {
+	server, client := startAndDial(t, spireapi.ClientConfig{RPCTimeout: 50 * time.Millisecond})
+
+	t.Run("counted fault", func(t *testing.T) {
+		server.InjectFault(ListEntriesMethod, status.Error(codes.Unavailable, "ohno"), 2)
+		for i := 0; i < 2; i++ {
+			_, err := client.ListEntries(ctx)
+			assert.Equal(t, codes.Unavailable, status.Code(err))
+		}
+		_, err := client.ListEntries(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, server.Calls(ListEntriesMethod))
+	})
+
+	t.Run("persistent fault", func(t *testing.T) {
+		server.InjectFault(GetBundleMethod, status.Error(codes.Internal, "ohno"), 0)
+		for i := 0; i < 3; i++ {
+			_, err := client.GetBundle(ctx)
+			assert.Equal(t, codes.Internal, status.Code(err))
+		}
+		server.ClearFaults()
+		_, err := client.GetBundle(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		server.SetLatency(ListEntriesMethod, time.Second)
+		_, err := client.ListEntries(ctx)
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		server.ClearFaults()
+		_, err = client.ListEntries(ctx)
+		assert.NoError(t, err)
+	})
+}
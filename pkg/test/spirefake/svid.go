@@ -0,0 +1,80 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spirefake
+
+import (
+	"context"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
+	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// bundleRefreshHint is the refresh hint advertised in the bundle, in
+// seconds.
+const bundleRefreshHint = 300
+
+type svidServer struct {
+	svidv1.UnimplementedSVIDServer
+
+	s *Server
+}
+
+func (v svidServer) MintX509SVID(_ context.Context, req *svidv1.MintX509SVIDRequest) (*svidv1.MintX509SVIDResponse, error) {
+	if req.Ttl < 0 {
+		return nil, status.Error(codes.InvalidArgument, "TTL must not be negative")
+	}
+	cert, err := v.s.ca.mintX509SVID(req.Csr, time.Duration(req.Ttl)*time.Second, v.s.now())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to mint X509-SVID: %v", err)
+	}
+	id, err := spiffeid.FromURI(cert.URIs[0])
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "minted X509-SVID has an invalid SPIFFE ID: %v", err)
+	}
+	return &svidv1.MintX509SVIDResponse{
+		Svid: &apitypes.X509SVID{
+			CertChain: [][]byte{cert.Raw},
+			Id: &apitypes.SPIFFEID{
+				TrustDomain: id.TrustDomain().Name(),
+				Path:        id.Path(),
+			},
+			ExpiresAt: cert.NotAfter.Unix(),
+		},
+	}, nil
+}
+
+type bundleServer struct {
+	bundlev1.UnimplementedBundleServer
+
+	s *Server
+}
+
+func (b bundleServer) GetBundle(context.Context, *bundlev1.GetBundleRequest) (*apitypes.Bundle, error) {
+	return &apitypes.Bundle{
+		TrustDomain: b.s.td.Name(),
+		X509Authorities: []*apitypes.X509Certificate{
+			{Asn1: b.s.ca.cert.Raw},
+		},
+		RefreshHint:    bundleRefreshHint,
+		SequenceNumber: 1,
+	}, nil
+}
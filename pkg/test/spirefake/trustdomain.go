@@ -0,0 +1,275 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spirefake
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	trustdomainv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/trustdomain/v1"
+	apitypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type trustDomainServer struct {
+	trustdomainv1.UnimplementedTrustDomainServer
+
+	s *Server
+}
+
+func (t trustDomainServer) ListFederationRelationships(_ context.Context, req *trustdomainv1.ListFederationRelationshipsRequest) (*trustdomainv1.ListFederationRelationshipsResponse, error) {
+	federationRelationships, nextPageToken := t.s.federationRelationships.List(req.PageToken, int(req.PageSize))
+	resp := &trustdomainv1.ListFederationRelationshipsResponse{NextPageToken: nextPageToken}
+	for _, federationRelationship := range federationRelationships {
+		resp.FederationRelationships = append(resp.FederationRelationships, applyFederationRelationshipMask(federationRelationship, req.OutputMask))
+	}
+	return resp, nil
+}
+
+func (t trustDomainServer) GetFederationRelationship(_ context.Context, req *trustdomainv1.GetFederationRelationshipRequest) (*apitypes.FederationRelationship, error) {
+	federationRelationship, err := t.s.federationRelationships.Get(req.TrustDomain)
+	if err != nil {
+		return nil, err
+	}
+	return applyFederationRelationshipMask(federationRelationship, req.OutputMask), nil
+}
+
+func (t trustDomainServer) BatchCreateFederationRelationship(_ context.Context, req *trustdomainv1.BatchCreateFederationRelationshipRequest) (*trustdomainv1.BatchCreateFederationRelationshipResponse, error) {
+	resp := new(trustdomainv1.BatchCreateFederationRelationshipResponse)
+	for _, federationRelationship := range req.FederationRelationships {
+		created, err := t.s.federationRelationships.Create(federationRelationship, t.s.td)
+		result := &trustdomainv1.BatchCreateFederationRelationshipResponse_Result{Status: statusToAPI(err)}
+		if err == nil {
+			result.FederationRelationship = applyFederationRelationshipMask(created, req.OutputMask)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+func (t trustDomainServer) BatchUpdateFederationRelationship(_ context.Context, req *trustdomainv1.BatchUpdateFederationRelationshipRequest) (*trustdomainv1.BatchUpdateFederationRelationshipResponse, error) {
+	resp := new(trustdomainv1.BatchUpdateFederationRelationshipResponse)
+	for _, federationRelationship := range req.FederationRelationships {
+		updated, err := t.s.federationRelationships.Update(federationRelationship, req.InputMask)
+		result := &trustdomainv1.BatchUpdateFederationRelationshipResponse_Result{Status: statusToAPI(err)}
+		if err == nil {
+			result.FederationRelationship = applyFederationRelationshipMask(updated, req.OutputMask)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+func (t trustDomainServer) BatchDeleteFederationRelationship(_ context.Context, req *trustdomainv1.BatchDeleteFederationRelationshipRequest) (*trustdomainv1.BatchDeleteFederationRelationshipResponse, error) {
+	resp := new(trustdomainv1.BatchDeleteFederationRelationshipResponse)
+	for _, td := range req.TrustDomains {
+		resp.Results = append(resp.Results, &trustdomainv1.BatchDeleteFederationRelationshipResponse_Result{
+			Status:      statusToAPI(t.s.federationRelationships.Delete(td)),
+			TrustDomain: td,
+		})
+	}
+	return resp, nil
+}
+
+// federationRelationshipStore holds the federation relationships on the
+// server, keyed by trust domain.
+type federationRelationshipStore struct {
+	mtx                     sync.RWMutex
+	federationRelationships map[string]*apitypes.FederationRelationship
+}
+
+func newFederationRelationshipStore() *federationRelationshipStore {
+	return &federationRelationshipStore{
+		federationRelationships: make(map[string]*apitypes.FederationRelationship),
+	}
+}
+
+func (s *federationRelationshipStore) All() []*apitypes.FederationRelationship {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return cloneFederationRelationships(s.sorted())
+}
+
+func (s *federationRelationshipStore) Set(federationRelationships []*apitypes.FederationRelationship) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.federationRelationships = make(map[string]*apitypes.FederationRelationship, len(federationRelationships))
+	for _, federationRelationship := range cloneFederationRelationships(federationRelationships) {
+		s.federationRelationships[federationRelationship.TrustDomain] = federationRelationship
+	}
+}
+
+// List returns a page of the federation relationships, in trust domain
+// order, starting after the trust domain in the page token. A page size of
+// zero returns every remaining federation relationship.
+func (s *federationRelationshipStore) List(pageToken string, pageSize int) ([]*apitypes.FederationRelationship, string) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var federationRelationships []*apitypes.FederationRelationship
+	for _, federationRelationship := range s.sorted() {
+		if federationRelationship.TrustDomain > pageToken {
+			federationRelationships = append(federationRelationships, federationRelationship)
+		}
+	}
+	var nextPageToken string
+	if pageSize > 0 && len(federationRelationships) > pageSize {
+		federationRelationships = federationRelationships[:pageSize]
+		nextPageToken = federationRelationships[pageSize-1].TrustDomain
+	}
+	return cloneFederationRelationships(federationRelationships), nextPageToken
+}
+
+func (s *federationRelationshipStore) Get(td string) (*apitypes.FederationRelationship, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	federationRelationship, ok := s.federationRelationships[td]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "federation relationship %q not found", td)
+	}
+	return proto.Clone(federationRelationship).(*apitypes.FederationRelationship), nil
+}
+
+// Create creates the federation relationship. A server cannot federate with
+// its own trust domain.
+func (s *federationRelationshipStore) Create(federationRelationship *apitypes.FederationRelationship, serverTD spiffeid.TrustDomain) (*apitypes.FederationRelationship, error) {
+	if err := validateFederationRelationship(federationRelationship); err != nil {
+		return nil, err
+	}
+	if federationRelationship.TrustDomain == serverTD.Name() {
+		return nil, status.Error(codes.InvalidArgument, "unable to create federation relationship for server trust domain")
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.federationRelationships[federationRelationship.TrustDomain]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "federation relationship %q already exists", federationRelationship.TrustDomain)
+	}
+	federationRelationship = proto.Clone(federationRelationship).(*apitypes.FederationRelationship)
+	s.federationRelationships[federationRelationship.TrustDomain] = federationRelationship
+	return proto.Clone(federationRelationship).(*apitypes.FederationRelationship), nil
+}
+
+// Update updates the fields of the federation relationship in the mask, or
+// every field if the mask is nil.
+func (s *federationRelationshipStore) Update(federationRelationship *apitypes.FederationRelationship, mask *apitypes.FederationRelationshipMask) (*apitypes.FederationRelationship, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	existing, ok := s.federationRelationships[federationRelationship.TrustDomain]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "federation relationship %q not found", federationRelationship.TrustDomain)
+	}
+	if mask == nil {
+		mask = &apitypes.FederationRelationshipMask{
+			BundleEndpointUrl:     true,
+			BundleEndpointProfile: true,
+			TrustDomainBundle:     true,
+		}
+	}
+	updated := proto.Clone(existing).(*apitypes.FederationRelationship)
+	if mask.BundleEndpointUrl {
+		updated.BundleEndpointUrl = federationRelationship.BundleEndpointUrl
+	}
+	if mask.BundleEndpointProfile {
+		updated.BundleEndpointProfile = federationRelationship.BundleEndpointProfile
+	}
+	if mask.TrustDomainBundle {
+		updated.TrustDomainBundle = federationRelationship.TrustDomainBundle
+	}
+	if err := validateFederationRelationship(updated); err != nil {
+		return nil, err
+	}
+	s.federationRelationships[updated.TrustDomain] = updated
+	return proto.Clone(updated).(*apitypes.FederationRelationship), nil
+}
+
+func (s *federationRelationshipStore) Delete(td string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.federationRelationships[td]; !ok {
+		return status.Errorf(codes.NotFound, "federation relationship %q not found", td)
+	}
+	delete(s.federationRelationships, td)
+	return nil
+}
+
+// sorted returns the federation relationships in trust domain order. The
+// lock must be held.
+func (s *federationRelationshipStore) sorted() []*apitypes.FederationRelationship {
+	federationRelationships := make([]*apitypes.FederationRelationship, 0, len(s.federationRelationships))
+	for _, federationRelationship := range s.federationRelationships {
+		federationRelationships = append(federationRelationships, federationRelationship)
+	}
+	sort.Slice(federationRelationships, func(i, j int) bool {
+		return federationRelationships[i].TrustDomain < federationRelationships[j].TrustDomain
+	})
+	return federationRelationships
+}
+
+func validateFederationRelationship(federationRelationship *apitypes.FederationRelationship) error {
+	if _, err := spiffeid.TrustDomainFromString(federationRelationship.TrustDomain); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid trust domain: %v", err)
+	}
+	u, err := url.Parse(federationRelationship.BundleEndpointUrl)
+	switch {
+	case err != nil:
+		return status.Errorf(codes.InvalidArgument, "invalid bundle endpoint URL: %v", err)
+	case u.Scheme != "https":
+		return status.Error(codes.InvalidArgument, "bundle endpoint URL must use the https scheme")
+	}
+	switch profile := federationRelationship.BundleEndpointProfile.(type) {
+	case *apitypes.FederationRelationship_HttpsWeb:
+	case *apitypes.FederationRelationship_HttpsSpiffe:
+		if _, err := spiffeid.FromString(profile.HttpsSpiffe.GetEndpointSpiffeId()); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid endpoint SPIFFE ID: %v", err)
+		}
+	default:
+		return status.Error(codes.InvalidArgument, "bundle endpoint profile is required")
+	}
+	return nil
+}
+
+func applyFederationRelationshipMask(federationRelationship *apitypes.FederationRelationship, mask *apitypes.FederationRelationshipMask) *apitypes.FederationRelationship {
+	if mask == nil {
+		return federationRelationship
+	}
+	out := &apitypes.FederationRelationship{TrustDomain: federationRelationship.TrustDomain}
+	if mask.BundleEndpointUrl {
+		out.BundleEndpointUrl = federationRelationship.BundleEndpointUrl
+	}
+	if mask.BundleEndpointProfile {
+		out.BundleEndpointProfile = federationRelationship.BundleEndpointProfile
+	}
+	if mask.TrustDomainBundle {
+		out.TrustDomainBundle = federationRelationship.TrustDomainBundle
+	}
+	return out
+}
+
+func cloneFederationRelationships(federationRelationships []*apitypes.FederationRelationship) []*apitypes.FederationRelationship {
+	out := make([]*apitypes.FederationRelationship, 0, len(federationRelationships))
+	for _, federationRelationship := range federationRelationships {
+		out = append(out, proto.Clone(federationRelationship).(*apitypes.FederationRelationship))
+	}
+	return out
+}
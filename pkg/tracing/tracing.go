@@ -0,0 +1,112 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ServiceName is the service name reported on exported spans.
+	ServiceName = "spire-controller-manager"
+
+	// GRPCStatusCodeKey is the attribute recording the gRPC status code of
+	// a call made within a span.
+	GRPCStatusCodeKey = attribute.Key("rpc.grpc.status_code")
+
+	instrumentationName = "github.com/spiffe/spire-controller-manager"
+)
+
+// Config configures the export of trace spans.
+type Config struct {
+	// Endpoint is the host:port of the OTLP gRPC collector. Tracing is
+	// disabled if empty.
+	Endpoint string
+
+	// Insecure disables TLS on the connection to the collector.
+	Insecure bool
+
+	// SamplingPercent is the percentage of reconciles that are traced.
+	SamplingPercent int
+}
+
+// Setup installs a global tracer provider that exports spans to the OTLP
+// collector described by the config. The returned function flushes any
+// pending spans and shuts the provider down. If tracing is disabled, the
+// global no-op provider is left in place.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	if config.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if config.SamplingPercent < 0 || config.SamplingPercent > 100 {
+		return nil, fmt.Errorf("sampling percent %d is not between 0 and 100", config.SamplingPercent)
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(config.SamplingPercent)/100))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span using the global tracer provider.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks the span failed if the error is non-nil and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// EndRPC is like End but also records the gRPC status code of the error,
+// for spans covering calls to the SPIRE Server API.
+func EndRPC(span trace.Span, err error) {
+	span.SetAttributes(GRPCStatusCodeKey.String(status.Code(err).String()))
+	End(span, err)
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 SPIRE Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spiffe/spire-controller-manager/pkg/tracing"
+)
+
+func TestSetupDisabled(t *testing.T) {
+	before := otel.GetTracerProvider()
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{})
+	require.NoError(t, err)
+	assert.Equal(t, before, otel.GetTracerProvider())
+	require.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetupInvalidSamplingPercent(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), tracing.Config{Endpoint: "localhost:4317", SamplingPercent: 101})
+	require.EqualError(t, err, "sampling percent 101 is not between 0 and 100")
+}
+
+func TestSetupExportsSpans(t *testing.T) {
+	collector := startCollector(t)
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:        collector.addr,
+		Insecure:        true,
+		SamplingPercent: 100,
+	})
+	require.NoError(t, err)
+
+	ctx, parent := tracing.Start(context.Background(), "parent", attribute.Int("count", 3))
+	_, child := tracing.Start(ctx, "child")
+	tracing.EndRPC(child, status.Error(codes.Unavailable, "oh no"))
+	tracing.End(parent, nil)
+
+	// Shutting down flushes the spans to the collector.
+	require.NoError(t, shutdown(context.Background()))
+
+	spans := collector.getSpans()
+	require.Len(t, spans, 2)
+	byName := make(map[string]*tracev1.Span)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	require.Contains(t, byName, "parent")
+	require.Contains(t, byName, "child")
+
+	assert.Equal(t, byName["parent"].SpanId, byName["child"].ParentSpanId)
+	assert.Equal(t, tracev1.Status_STATUS_CODE_UNSET, byName["parent"].Status.GetCode())
+	assert.Equal(t, map[string]string{"count": "3"}, spanAttributes(byName["parent"]))
+
+	assert.Equal(t, tracev1.Status_STATUS_CODE_ERROR, byName["child"].Status.GetCode())
+	assert.Equal(t, "rpc error: code = Unavailable desc = oh no", byName["child"].Status.GetMessage())
+	assert.Equal(t, map[string]string{"rpc.grpc.status_code": "Unavailable"}, spanAttributes(byName["child"]))
+}
+
+func TestEndRecordsError(t *testing.T) {
+	collector := startCollector(t)
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:        collector.addr,
+		Insecure:        true,
+		SamplingPercent: 100,
+	})
+	require.NoError(t, err)
+
+	_, span := tracing.Start(context.Background(), "failed")
+	tracing.End(span, errors.New("oh no"))
+	require.NoError(t, shutdown(context.Background()))
+
+	spans := collector.getSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, tracev1.Status_STATUS_CODE_ERROR, spans[0].Status.GetCode())
+	assert.Equal(t, "oh no", spans[0].Status.GetMessage())
+	assert.Empty(t, spanAttributes(spans[0]))
+}
+
+type collector struct {
+	coltracev1.UnimplementedTraceServiceServer
+
+	addr string
+
+	mtx   sync.Mutex
+	spans []*tracev1.Span
+}
+
+func startCollector(t *testing.T) *collector {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// Setup replaces the global tracer provider, so put it back after.
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	c := &collector{addr: listener.Addr().String()}
+	server := grpc.NewServer()
+	coltracev1.RegisterTraceServiceServer(server, c)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Serve(listener) }()
+	t.Cleanup(func() {
+		server.Stop()
+		assert.NoError(t, <-errCh)
+	})
+	return c
+}
+
+func (c *collector) Export(_ context.Context, req *coltracev1.ExportTraceServiceRequest) (*coltracev1.ExportTraceServiceResponse, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, resourceSpans := range req.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			c.spans = append(c.spans, scopeSpans.Spans...)
+		}
+	}
+	return &coltracev1.ExportTraceServiceResponse{}, nil
+}
+
+func (c *collector) getSpans() []*tracev1.Span {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.spans
+}
+
+func spanAttributes(span *tracev1.Span) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range span.Attributes {
+		switch attr.Value.Value.(type) {
+		case *commonv1.AnyValue_IntValue:
+			attrs[attr.Key] = strconv.FormatInt(attr.Value.GetIntValue(), 10)
+		default:
+			attrs[attr.Key] = attr.Value.GetStringValue()
+		}
+	}
+	return attrs
+}